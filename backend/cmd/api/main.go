@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -226,6 +231,11 @@ func main() {
 		log.Fatalf("❌ FATAL: Falha ao criar políticas padrão: %v", err)
 	}
 	log.Println("✅ Políticas padrão verificadas/criadas")
+	
+	// Políticas compiladas em memória; réplicas sincronizam pela geração no banco
+	if err := policyService.EnableCache(policy.DefaultCachePollInterval); err != nil {
+		log.Printf("⚠️ Cache de políticas desativado: %v", err)
+	}
 
 	// ========================================
 	// POLICY THRESHOLDS - Fase 17 Step 2
@@ -293,6 +303,11 @@ func main() {
 	governedAgentService.SetShadowService(shadowService)
 	// Fase 13: Integrar Approval e Authority Services
 	governedAgentService.SetApprovalService(approvalService)
+	governedBillingService.SetApprovalService(approvalService)
+	// Fase 17: Propostas do recomendador de thresholds passam por aprovação
+	thresholdService.SetApprovalService(approvalService)
+	// policy.Enforce nas rotas: aprovação criada automaticamente em require_approval
+	policy.ConfigureEnforcement(policyService, approvalService)
 	governedAgentService.SetAuthorityService(authorityService)
 	// Fase 14: Integrar Memory Service
 	governedAgentService.SetMemoryService(memoryService)
@@ -441,6 +456,10 @@ func main() {
 	log.Println("✅ Stripe Webhook Handler registrado (/webhooks/stripe/:app_id) com idempotência e rate limit")
 
 	// Agrupar rotas da API v1
+	// Encerramento em ordem, depois que o HTTP para de aceitar requisições.
+	// Quem sobe algo em background registra aqui como parar.
+	var shutdownSteps []func()
+
 	v1 := r.Group("/api/v1")
 	{
 		// ========================================
@@ -678,6 +697,61 @@ func main() {
 		telemetryService := telemetry.NewTelemetryService(gormDB)
 		telemetry.RegisterTelemetryRoutes(v1, telemetryService, application.AppContextMiddleware(applicationService), application.RequireAppContext(), middleware.AuthMiddleware(), middleware.AdminOnly())
 		log.Println("✅ Telemetry routes registradas (/telemetry/*)")
+		
+		// Retenção por plano: expurgo periódico via JobService
+		telemetryService.SetPlanResolver(func(appID uuid.UUID) (string, error) {
+			sub, err := kernelBillingService.GetSubscription(appID.String())
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", nil // Sem assinatura = free
+			}
+			if err != nil {
+				return "", err // Billing indisponível: o app fica para a próxima execução
+			}
+			if sub.IsLapsed(time.Now()) {
+				return "", nil // Cancelada/vencida = free
+			}
+			if sub.Plan == nil {
+				return "", fmt.Errorf("plano %s da assinatura não encontrado", sub.PlanID)
+			}
+			return sub.Plan.Name, nil
+		})
+		archiveDir := os.Getenv("TELEMETRY_ARCHIVE_DIR")
+		if archiveDir == "" {
+			archiveDir = "/data/telemetry-archive"
+		}
+		if err := telemetryService.SetRetentionOptions(telemetry.RetentionOptions{
+			Mode:       os.Getenv("TELEMETRY_RETENTION_MODE"), // delete (padrão) ou archive
+			ArchiveDir: archiveDir,
+			Rollup:     os.Getenv("TELEMETRY_RETENTION_ROLLUP") != "false",
+		}); err != nil {
+			log.Printf("⚠️ Retenção de telemetria usando padrões: %v", err)
+		}
+		telemetry.RegisterRetentionJobHandlers(jobService, telemetryService)
+		
+		// GeoIP offline: GEOIP_DB_PATHS=/data/GeoLite2-City.mmdb,/data/GeoLite2-ASN.mmdb
+		if paths := os.Getenv("GEOIP_DB_PATHS"); paths != "" {
+			if geo, err := telemetry.OpenGeoIP(strings.Split(paths, ",")...); err != nil {
+				log.Printf("⚠️ GeoIP desabilitado: %v", err)
+			} else {
+				telemetryService.SetGeoLocator(geo)
+				defer geo.Close() // Depois da drenagem: workers ainda localizam eventos
+			}
+		}
+		
+		// Lotes que o banco recusou ficam em disco até a regravação
+		spillDir := os.Getenv("TELEMETRY_SPILL_DIR")
+		if spillDir == "" {
+			spillDir = "/data/telemetry-spill"
+		}
+		if err := telemetryService.SetIngestSpillDir(spillDir); err != nil {
+			log.Printf("⚠️ Spill de telemetria desabilitado: %v", err)
+		}
+		
+		// Shutdown: drenar a fila de ingestão (o stream ainda alimenta o rules engine)
+		shutdownSteps = append(shutdownSteps, func() {
+			log.Println("🛑 Drenando fila de telemetria...")
+			telemetryService.Stop()
+		})
 
 		// ========================================
 		// NARRATIVE SERVICE - Fase 32
@@ -708,6 +782,7 @@ func main() {
 		// "Observação → Condição → Ação"
 		// ========================================
 		rulesService := rules.NewRulesService(gormDB)
+		rulesService.SetPlatformKillSwitch(killSwitchService)
 		
 		// Conectar rules ao telemetry para alertas
 		rulesService.SetAlertCallback(func(appID uuid.UUID, alertType, message string, data map[string]interface{}) {
@@ -734,8 +809,29 @@ func main() {
 			log.Printf("🎯 [RULE ALERT] app=%s type=%s severity=%s msg=%s", appID, alertType, severity, message)
 		})
 		
+		// Stream de eventos da telemetria → triggers de evento e sequência
+		telemetryService.SetEventCallback(func(event *telemetry.TelemetryEvent) {
+			var metadata map[string]interface{}
+			json.Unmarshal([]byte(event.Metadata), &metadata)
+			rulesService.ProcessEvent(rules.StreamEvent{
+				ID:        event.ID,
+				AppID:     event.AppID,
+				UserID:    event.UserID,
+				SessionID: event.SessionID,
+				Type:      event.Type,
+				Metadata:  metadata,
+				Timestamp: event.Timestamp,
+			})
+		})
+		
+		// Segmentos de telemetria como condição de regra: in_segment("nome")
+		rulesService.SetSegmentResolver(telemetryService.IsUserInSegment)
+		
+		shutdownSteps = append(shutdownSteps, rulesService.Stop) // Depois da telemetria
+		
 		rules.RegisterRulesRoutes(v1, rulesService, middleware.AuthMiddleware(), middleware.AdminOnly())
-		log.Println("✅ Rules Engine routes registradas (/admin/rules/*)")
+		rules.RegisterExperimentRoutes(v1, rulesService, application.AppContextMiddleware(applicationService), application.RequireAppContext())
+		log.Println("✅ Rules Engine routes registradas (/admin/rules/*, /experiments/*)")
 
 		// ========================================
 		// ADD-ONS - Capabilities como SKUs
@@ -761,7 +857,10 @@ func main() {
 		event.RegisterEventRoutes(v1, eventService, middleware.AuthMiddleware())
 
 		// Rotas de Pagamentos
-		payment.RegisterPaymentRoutes(v1, paymentService, middleware.AuthMiddleware())
+		// Iniciar pagamento passa pelo Policy Engine (deny → 403, require_approval → 202)
+		// amount chega em reais; as políticas de pagamento comparam centavos
+		payment.RegisterPaymentRoutes(v1, paymentService, middleware.AuthMiddleware(),
+			policy.Enforce(policy.ResourcePayment, "create", policy.Builders(policy.FromBody("currency"), policy.FromBodyCents("amount"))))
 
 		// Rotas de Governança por IA (admin/privilegiado)
 		ai.RegisterAIRoutes(v1, aiService, middleware.AuthMiddleware())
@@ -778,8 +877,36 @@ func main() {
 	// 	c.JSON(200, gin.H{"status": "ok", "message": "Prost-QS Core is running!"})
 	// })
 
-	log.Printf("🚀 Prost-QS Core rodando na porta: %s", serverPort)
-	log.Fatal(r.Run(":" + serverPort))
+	srv := &http.Server{Addr: ":" + serverPort, Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("🚀 Prost-QS Core rodando na porta: %s", serverPort)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		log.Printf("❌ Servidor HTTP parou: %v", err)
+	case <-sig:
+	}
+
+	// 1. Parar de aceitar requisições e esperar as em andamento (nada mais entra nas filas)
+	log.Println("🛑 Encerrando servidor HTTP...")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️ Shutdown HTTP incompleto: %v", err)
+	}
+
+	// 2. Drenar e parar os serviços em background, na ordem de registro
+	for _, step := range shutdownSteps {
+		step()
+	}
+	policyService.StopCache()
+	cancel() // Worker de jobs
+	log.Println("✅ Encerrado")
 }
 
 // ========================================
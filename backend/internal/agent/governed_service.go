@@ -279,6 +279,10 @@ func (s *GovernedAgentService) ProposeDecisionGoverned(ctx context.Context, inpu
 		return nil, err
 	}
 
+	if evalResult.Result == policy.ResultPendingApproval {
+		return nil, s.requestPolicyApproval(input.Domain, input.Action, input.Amount, evalResult, input.AgentID, input.Reason, appCtx)
+	}
+
 	if !evalResult.Allowed {
 		s.auditService.LogWithAppContext(
 			appCtx.toAuditContext(),
@@ -545,3 +549,44 @@ func (s *GovernedAgentService) mapRiskToImpact(riskScore float64) authority.Impa
 		return authority.ImpactNone
 	}
 }
+
+// requestPolicyApproval abre a ApprovalRequest de uma avaliação pending_approval.
+// O ID da avaliação vai nos metadados para o desfecho alimentar o recomendador de thresholds.
+func (s *GovernedAgentService) requestPolicyApproval(domain, action string, amount int64, evalResult *policy.EvaluationResponse, agentID uuid.UUID, reason string, appCtx *AgentAppContext) error {
+	if s.approvalService == nil {
+		return fmt.Errorf("requer aprovação humana: %s", evalResult.Reason)
+	}
+
+	metadata := evalResult.ApprovalMetadata()
+	if appCtx != nil && appCtx.AppID != nil {
+		metadata["app_id"] = appCtx.AppID.String()
+	}
+	approvalReq, err := s.approvalService.CreateRequest(approval.CreateApprovalRequest{
+		Domain: domain,
+		Action: action,
+		Impact: authority.ImpactMedium,
+		Amount: amount,
+		Context: approval.ApprovalContext{
+			Intent:      fmt.Sprintf("Agente quer executar %s em %s", action, domain),
+			Description: evalResult.Reason,
+			Metadata:    metadata,
+		},
+		RequestedBy:     agentID,
+		RequestedByType: "agent",
+		RequestReason:   reason,
+		ExpiresInHours:  24,
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao abrir aprovação: %w", err)
+	}
+
+	s.auditService.LogWithAppContext(
+		appCtx.toAuditContext(),
+		"APPROVAL_REQUEST_AUTO_CREATED",
+		agentID, approvalReq.ID,
+		audit.ActorSystem, "approval_request", "auto_create",
+		nil, nil, nil,
+		fmt.Sprintf("ApprovalRequest criado a partir da política: %s", evalResult.Reason),
+	)
+	return fmt.Errorf("requer aprovação humana: %s - ApprovalRequest ID: %s", evalResult.Reason, approvalReq.ID)
+}
@@ -1,6 +1,7 @@
 package application
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
@@ -618,6 +619,12 @@ func AppContextMiddleware(service *ApplicationService) gin.HandlerFunc {
 			c.Set("app_id", app.ID.String())
 			c.Set("app_credential", cred)
 			c.Set("app_scopes", cred.Scopes)
+
+			var scopes []string
+			_ = json.Unmarshal([]byte(cred.Scopes), &scopes)
+			reqCtx := &RequestContext{App: app, Scopes: scopes}
+			reqCtx.UserID, _ = uuid.Parse(c.GetString("userID"))
+			c.Set(RequestContextKey, reqCtx)
 		}
 
 		c.Next()
@@ -133,6 +133,9 @@ const (
 // "Toda request carrega app_context"
 // ========================================
 
+// RequestContextKey chave do *RequestContext no gin.Context (credencial validada)
+const RequestContextKey = "app_context"
+
 // RequestContext é o contexto completo de uma request
 type RequestContext struct {
 	App        *Application `json:"app"`
@@ -6,7 +6,9 @@ import (
 
 	"github.com/google/uuid"
 
+	"prost-qs/backend/internal/approval"
 	"prost-qs/backend/internal/audit"
+	"prost-qs/backend/internal/authority"
 	"prost-qs/backend/internal/killswitch"
 	"prost-qs/backend/internal/policy"
 )
@@ -22,6 +24,7 @@ type GovernedBillingService struct {
 	policyService    *policy.PolicyService
 	killSwitch       *killswitch.KillSwitchService
 	auditService     *audit.AuditService
+	approvalService  *approval.ApprovalService // pending_approval abre ApprovalRequest
 }
 
 // ========================================
@@ -67,6 +70,42 @@ func NewGovernedBillingService(
 	}
 }
 
+// SetApprovalService configura o fluxo de aprovação para decisões pending_approval
+func (s *GovernedBillingService) SetApprovalService(approvalSvc *approval.ApprovalService) {
+	s.approvalService = approvalSvc
+}
+
+// requestPolicyApproval abre a ApprovalRequest de uma avaliação pending_approval.
+// O ID da avaliação vai nos metadados para o desfecho alimentar o recomendador de thresholds.
+func (s *GovernedBillingService) requestPolicyApproval(domain, action string, amount int64, evalResult *policy.EvaluationResponse, actorID uuid.UUID, appCtx *BillingAppContext) error {
+	if s.approvalService == nil {
+		return fmt.Errorf("requer aprovação humana: %s", evalResult.Reason)
+	}
+
+	metadata := evalResult.ApprovalMetadata()
+	if appCtx != nil && appCtx.AppID != nil {
+		metadata["app_id"] = appCtx.AppID.String()
+	}
+	req, err := s.approvalService.CreateRequest(approval.CreateApprovalRequest{
+		Domain: domain,
+		Action: action,
+		Impact: authority.ImpactHigh,
+		Amount: amount,
+		Context: approval.ApprovalContext{
+			Intent:      fmt.Sprintf("%s %s", domain, action),
+			Description: evalResult.Reason,
+			Metadata:    metadata,
+		},
+		RequestedBy:     actorID,
+		RequestedByType: "user",
+		RequestReason:   evalResult.Reason,
+	})
+	if err != nil {
+		return fmt.Errorf("erro ao abrir aprovação: %w", err)
+	}
+	return fmt.Errorf("requer aprovação humana: %s - ApprovalRequest ID: %s", evalResult.Reason, req.ID)
+}
+
 // ========================================
 // GOVERNED OPERATIONS
 // ========================================
@@ -172,6 +211,9 @@ func (s *GovernedBillingService) CreatePaymentIntentGoverned(
 	if err != nil {
 		return nil, err
 	}
+	if evalResult.Result == policy.ResultPendingApproval {
+		return nil, s.requestPolicyApproval(policy.ResourcePayment, "create", amount, evalResult, actorID, appCtx)
+	}
 	if !evalResult.Allowed {
 		s.auditService.LogWithAppContext(
 			appCtx.toAuditContext(),
@@ -262,7 +304,7 @@ func (s *GovernedBillingService) RequestPayoutGoverned(
 			nil, nil, nil,
 			fmt.Sprintf("Requer aprovação: %s", evalResult.Reason),
 		)
-		return nil, fmt.Errorf("requer aprovação humana: %s", evalResult.Reason)
+		return nil, s.requestPolicyApproval(policy.ResourceLedger, policy.ActionDebit, amount, evalResult, actorID, appCtx)
 	}
 
 	if !evalResult.Allowed {
@@ -50,6 +50,7 @@ type DecisionTimeline struct {
 	PolicyName   string     `gorm:"type:text" json:"policy_name"`
 	PolicyResult string     `gorm:"type:text;not null" json:"policy_result"` // allowed, denied, pending_approval
 	PolicyReason string     `gorm:"type:text" json:"policy_reason"`
+	PolicyTrace  PolicyTraceList `gorm:"type:text" json:"policy_trace,omitempty"` // Trace por política/condição (explain)
 
 	// ========================================
 	// AVALIAÇÃO - Threshold (conselho)
@@ -119,6 +120,62 @@ func (r *RiskFactorList) Scan(value any) error {
 	return json.Unmarshal(bytes, r)
 }
 
+// ConditionTraceSnapshot resultado de uma condição no momento da decisão
+type ConditionTraceSnapshot struct {
+	Path       string                   `json:"path"`            // conditions[0].any[1]
+	Group      string                   `json:"group,omitempty"` // all, any, not
+	Field      string                   `json:"field,omitempty"`
+	Value      any                      `json:"value,omitempty"` // Valor resolvido do contexto
+	Operator   string                   `json:"operator,omitempty"`
+	Expected   any                      `json:"expected,omitempty"` // Valor esperado (ou resolvido de value_field)
+	ValueField string                   `json:"value_field,omitempty"`
+	Result     bool                     `json:"result"`
+	Error      string                   `json:"error,omitempty"`
+	Children   []ConditionTraceSnapshot `json:"children,omitempty"`
+}
+
+// PolicyTraceSnapshot avaliação de uma política no momento da decisão
+type PolicyTraceSnapshot struct {
+	PolicyID   uuid.UUID                `json:"policy_id"`
+	PolicyName string                   `json:"policy_name"`
+	Effect     string                   `json:"effect"`
+	Matched    bool                     `json:"matched"`
+	Error      string                   `json:"error,omitempty"` // Política pulada por erro
+	Conditions []ConditionTraceSnapshot `json:"conditions,omitempty"`
+}
+
+// PolicyTraceList para serialização GORM
+type PolicyTraceList []PolicyTraceSnapshot
+
+func (p PolicyTraceList) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (p *PolicyTraceList) Scan(value any) error {
+	if value == nil {
+		*p = []PolicyTraceSnapshot{}
+		return nil
+	}
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		*p = []PolicyTraceSnapshot{}
+		return nil
+	}
+	return json.Unmarshal(bytes, p)
+}
+
 // JSONMap para serialização de mapas
 type JSONMap map[string]any
 
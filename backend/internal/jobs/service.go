@@ -83,6 +83,25 @@ func (s *JobService) Enqueue(jobType string, payload interface{}, opts ...JobOpt
 	return job, nil
 }
 
+// EnqueueIfIdle enfileira só se não houver job do tipo pendente ou em execução
+// (útil para jobs periódicos que se reagendam). Retorna nil se já havia um.
+func (s *JobService) EnqueueIfIdle(jobType string, payload interface{}, opts ...JobOption) (*Job, error) {
+	var active int64
+	err := s.db.Model(&Job{}).
+		Where("type = ?", jobType).
+		Where("status IN ? OR (status = ? AND locked_at >= ?)",
+			[]string{string(JobStatusPending), string(JobStatusRetrying)},
+			string(JobStatusProcessing), time.Now().Add(-5*time.Minute)).
+		Count(&active).Error
+	if err != nil {
+		return nil, fmt.Errorf("falha ao verificar fila: %w", err)
+	}
+	if active > 0 {
+		return nil, nil
+	}
+	return s.Enqueue(jobType, payload, opts...)
+}
+
 // JobOption opção para configurar job
 type JobOption func(*Job)
 
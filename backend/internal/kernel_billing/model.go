@@ -104,6 +104,11 @@ func (s *AppSubscription) IsActive() bool {
 	return s.Status == SubscriptionStatusActive || s.Status == SubscriptionStatusTrialing
 }
 
+// IsLapsed cancelada ou vencida (cancelamento no fim do período já passado): não dá direito ao plano
+func (s *AppSubscription) IsLapsed(now time.Time) bool {
+	return s.Status == SubscriptionStatusCanceled || (s.CancelAtPeriodEnd && now.After(s.CurrentPeriodEnd))
+}
+
 // ========================================
 // APP USAGE - Ledger Operacional
 // "Usage incrementa sempre, nunca apaga"
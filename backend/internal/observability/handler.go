@@ -110,6 +110,18 @@ type MetricsResponse struct {
 	UptimeSeconds        int64 `json:"uptime_seconds"`
 	GoRoutines           int   `json:"go_routines"`
 	MemoryMB             uint64 `json:"memory_mb"`
+	
+	PolicyEvaluationsTotal    int64 `json:"policy_evaluations_total"`
+	PolicyEvaluationAvgMicros int64 `json:"policy_evaluation_avg_us"`
+	PolicyEvaluationMaxMicros int64 `json:"policy_evaluation_max_us"`
+	PolicyCacheHitsTotal      int64 `json:"policy_cache_hits_total"`
+	PolicyCacheMissesTotal    int64 `json:"policy_cache_misses_total"`
+	
+	TelemetryIngestedTotal int64 `json:"telemetry_ingested_total"`
+	TelemetryRejectedTotal int64 `json:"telemetry_rejected_total"`
+	TelemetryFailedTotal   int64 `json:"telemetry_failed_total"`
+	TelemetryBatchesTotal  int64 `json:"telemetry_batches_total"`
+	TelemetryQueueDepth    int64 `json:"telemetry_queue_depth"`
 }
 
 // MetricsBasic returns basic metrics
@@ -129,6 +141,18 @@ func MetricsBasic(c *gin.Context) {
 		UptimeSeconds:        snapshot.UptimeSeconds,
 		GoRoutines:           runtime.NumGoroutine(),
 		MemoryMB:             memStats.Alloc / 1024 / 1024,
+		
+		PolicyEvaluationsTotal:    snapshot.PolicyEvaluationsTotal,
+		PolicyEvaluationAvgMicros: snapshot.PolicyEvaluationAvgMicros,
+		PolicyEvaluationMaxMicros: snapshot.PolicyEvaluationMaxMicros,
+		PolicyCacheHitsTotal:      snapshot.PolicyCacheHitsTotal,
+		PolicyCacheMissesTotal:    snapshot.PolicyCacheMissesTotal,
+		
+		TelemetryIngestedTotal: snapshot.TelemetryIngestedTotal,
+		TelemetryRejectedTotal: snapshot.TelemetryRejectedTotal,
+		TelemetryFailedTotal:   snapshot.TelemetryFailedTotal,
+		TelemetryBatchesTotal:  snapshot.TelemetryBatchesTotal,
+		TelemetryQueueDepth:    snapshot.TelemetryQueueDepth,
 	})
 }
 
@@ -23,6 +23,20 @@ type Metrics struct {
 	RequestsTotal int64
 	ErrorsTotal   int64
 	
+	// Policy engine (latência em microssegundos: soma e máximo)
+	PolicyEvaluationsTotal      int64
+	PolicyEvaluationMicrosTotal int64
+	PolicyEvaluationMicrosMax   int64
+	PolicyCacheHitsTotal        int64
+	PolicyCacheMissesTotal      int64
+	
+	// Telemetry ingest pipeline
+	TelemetryIngestedTotal int64
+	TelemetryRejectedTotal int64 // Backpressure (fila cheia)
+	TelemetryFailedTotal   int64 // Falha na gravação do lote
+	TelemetryBatchesTotal  int64
+	TelemetryQueueDepth    int64 // Gauge
+	
 	// Start time for uptime calculation
 	StartTime time.Time
 }
@@ -61,6 +75,42 @@ func IncrementErrors() {
 	atomic.AddInt64(&metrics.ErrorsTotal, 1)
 }
 
+// RecordPolicyEvaluation registra latência de uma avaliação de políticas
+func RecordPolicyEvaluation(elapsed time.Duration, cacheHit bool) {
+	micros := elapsed.Microseconds()
+	atomic.AddInt64(&metrics.PolicyEvaluationsTotal, 1)
+	atomic.AddInt64(&metrics.PolicyEvaluationMicrosTotal, micros)
+	for {
+		max := atomic.LoadInt64(&metrics.PolicyEvaluationMicrosMax)
+		if micros <= max || atomic.CompareAndSwapInt64(&metrics.PolicyEvaluationMicrosMax, max, micros) {
+			break
+		}
+	}
+	if cacheHit {
+		atomic.AddInt64(&metrics.PolicyCacheHitsTotal, 1)
+	} else {
+		atomic.AddInt64(&metrics.PolicyCacheMissesTotal, 1)
+	}
+}
+
+// RecordTelemetryBatch registra um lote de eventos gravado
+func RecordTelemetryBatch(events int) {
+	atomic.AddInt64(&metrics.TelemetryIngestedTotal, int64(events))
+	atomic.AddInt64(&metrics.TelemetryBatchesTotal, 1)
+}
+
+func RecordTelemetryRejected(events int) {
+	atomic.AddInt64(&metrics.TelemetryRejectedTotal, int64(events))
+}
+
+func RecordTelemetryFailed(events int) {
+	atomic.AddInt64(&metrics.TelemetryFailedTotal, int64(events))
+}
+
+func SetTelemetryQueueDepth(depth int) {
+	atomic.StoreInt64(&metrics.TelemetryQueueDepth, int64(depth))
+}
+
 // ========================================
 // SNAPSHOT (for reading)
 // ========================================
@@ -72,10 +122,22 @@ type MetricsSnapshot struct {
 	RequestsTotal        int64  `json:"requests_total"`
 	ErrorsTotal          int64  `json:"errors_total"`
 	UptimeSeconds        int64  `json:"uptime_seconds"`
+	
+	PolicyEvaluationsTotal    int64 `json:"policy_evaluations_total"`
+	PolicyEvaluationAvgMicros int64 `json:"policy_evaluation_avg_us"`
+	PolicyEvaluationMaxMicros int64 `json:"policy_evaluation_max_us"`
+	PolicyCacheHitsTotal      int64 `json:"policy_cache_hits_total"`
+	PolicyCacheMissesTotal    int64 `json:"policy_cache_misses_total"`
+	
+	TelemetryIngestedTotal int64 `json:"telemetry_ingested_total"`
+	TelemetryRejectedTotal int64 `json:"telemetry_rejected_total"`
+	TelemetryFailedTotal   int64 `json:"telemetry_failed_total"`
+	TelemetryBatchesTotal  int64 `json:"telemetry_batches_total"`
+	TelemetryQueueDepth    int64 `json:"telemetry_queue_depth"`
 }
 
 func (m *Metrics) Snapshot() MetricsSnapshot {
-	return MetricsSnapshot{
+	snapshot := MetricsSnapshot{
 		AuditEventsTotal:     atomic.LoadInt64(&m.AuditEventsTotal),
 		AppEventsTotal:       atomic.LoadInt64(&m.AppEventsTotal),
 		AppEventsFailedTotal: atomic.LoadInt64(&m.AppEventsFailedTotal),
@@ -83,4 +145,20 @@ func (m *Metrics) Snapshot() MetricsSnapshot {
 		ErrorsTotal:          atomic.LoadInt64(&m.ErrorsTotal),
 		UptimeSeconds:        int64(time.Since(m.StartTime).Seconds()),
 	}
+	
+	evaluations := atomic.LoadInt64(&m.PolicyEvaluationsTotal)
+	snapshot.PolicyEvaluationsTotal = evaluations
+	if evaluations > 0 {
+		snapshot.PolicyEvaluationAvgMicros = atomic.LoadInt64(&m.PolicyEvaluationMicrosTotal) / evaluations
+	}
+	snapshot.PolicyEvaluationMaxMicros = atomic.LoadInt64(&m.PolicyEvaluationMicrosMax)
+	snapshot.PolicyCacheHitsTotal = atomic.LoadInt64(&m.PolicyCacheHitsTotal)
+	snapshot.PolicyCacheMissesTotal = atomic.LoadInt64(&m.PolicyCacheMissesTotal)
+	
+	snapshot.TelemetryIngestedTotal = atomic.LoadInt64(&m.TelemetryIngestedTotal)
+	snapshot.TelemetryRejectedTotal = atomic.LoadInt64(&m.TelemetryRejectedTotal)
+	snapshot.TelemetryFailedTotal = atomic.LoadInt64(&m.TelemetryFailedTotal)
+	snapshot.TelemetryBatchesTotal = atomic.LoadInt64(&m.TelemetryBatchesTotal)
+	snapshot.TelemetryQueueDepth = atomic.LoadInt64(&m.TelemetryQueueDepth)
+	return snapshot
 }
@@ -10,11 +10,12 @@ import (
 )
 
 // RegisterPaymentRoutes configura as rotas relacionadas a pagamentos.
-func RegisterPaymentRoutes(rg *gin.RouterGroup, service *PaymentService, authMiddleware gin.HandlerFunc) {
+// initiateGuards rodam antes de iniciar o pagamento (ex.: policy.Enforce)
+func RegisterPaymentRoutes(rg *gin.RouterGroup, service *PaymentService, authMiddleware gin.HandlerFunc, initiateGuards ...gin.HandlerFunc) {
 	paymentRoutes := rg.Group("/payments")
 	paymentRoutes.Use(authMiddleware) // Todas as rotas de pagamento requerem autenticação
 	{
-		paymentRoutes.POST("/initiate", initiatePayment(service))
+		paymentRoutes.POST("/initiate", append(initiateGuards, initiatePayment(service))...)
 		paymentRoutes.GET("/:paymentId/status", getPaymentStatus(service))
 		paymentRoutes.GET("/balance/:userId", getUserBalance(service))
 	}
@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"prost-qs/backend/internal/explainability"
+
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// AUDIT - Registro das avaliações
+// "Decidir rápido, registrar sempre"
+// ========================================
+
+// Configuração da gravação
+const (
+	AuditWriteRetries = 3                     // Tentativas antes de falhar a avaliação
+	AuditRetryBackoff = 50 * time.Millisecond // Dobra a cada tentativa
+)
+
+// ErrAuditUnavailable avaliação não pôde ser registrada
+var ErrAuditUnavailable = errors.New("policy evaluation audit unavailable")
+
+// recordAudit grava a avaliação antes de a decisão sair: o EvaluationID
+// devolvido já pode ser buscado em GetEvaluation. Sem registro não há
+// decisão (fail closed). A timeline é complementar: erro só vai para o log.
+func (s *PolicyService) recordAudit(evaluation *PolicyEvaluation, timeline *explainability.DecisionTimeline) error {
+	var err error
+	for attempt := 0; attempt < AuditWriteRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(AuditRetryBackoff << (attempt - 1))
+		}
+		// DoNothing: tentativa anterior pode ter gravado e perdido a resposta
+		if err = s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(evaluation).Error; err == nil {
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("❌ [POLICY] Evaluation audit insert failed: evaluation=%s err=%v", evaluation.ID, err)
+		return fmt.Errorf("%w: %v", ErrAuditUnavailable, err)
+	}
+
+	if s.timelineService != nil && timeline != nil {
+		if err := s.timelineService.RecordTimeline(timeline); err != nil {
+			log.Printf("⚠️ [POLICY] Timeline record failed: decision=%s err=%v", timeline.DecisionID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Auditoria das avaliações
+// ========================================
+
+func TestEvaluationIDIsFetchableOnReturn(t *testing.T) {
+	s := newTestPolicyService(t)
+
+	req := EvaluationRequest{Resource: ResourceAds, Action: "spend", Context: map[string]any{"amount": 50.0}}
+	r, err := s.Evaluate(req)
+	if err != nil || r.EvaluationID == nil {
+		t.Fatalf("avaliação deveria responder com ID: %+v %v", r, err)
+	}
+	if _, err := s.GetEvaluation(uuid.MustParse(*r.EvaluationID)); err != nil {
+		t.Fatalf("avaliação devolvida deveria estar gravada: %v", err)
+	}
+}
+
+func TestEvaluateFailsWhenAuditCannotBeWritten(t *testing.T) {
+	s := newTestPolicyService(t)
+	if err := s.db.Migrator().DropTable(&PolicyEvaluation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := EvaluationRequest{Resource: ResourceAds, Action: "spend", Context: map[string]any{"amount": 50.0}}
+	if r, err := s.Evaluate(req); !errors.Is(err, ErrAuditUnavailable) {
+		t.Fatalf("sem auditoria a avaliação deveria falhar, obtido %+v %v", r, err)
+	}
+}
@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// POLICY CACHE - Políticas compiladas em memória
+// "Avaliar em toda request, sem ir ao banco"
+// ========================================
+
+// Intervalos do cache
+const (
+	DefaultCachePollInterval = 2 * time.Second // Verificação da geração compartilhada
+	appTenantTTL             = 5 * time.Minute // Dono do app muda raramente e não gera invalidação
+	cacheStateName           = "policies"
+)
+
+// PolicyCacheState geração compartilhada entre réplicas.
+// Toda alteração de política incrementa; réplicas que observam outra geração descartam o cache.
+type PolicyCacheState struct {
+	Name       string    `gorm:"size:50;primaryKey" json:"name"`
+	Generation int64     `json:"generation"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (PolicyCacheState) TableName() string {
+	return "policy_cache_state"
+}
+
+// PolicyCacheStats estado do cache local
+type PolicyCacheStats struct {
+	Enabled    bool      `json:"enabled"`
+	Generation int64     `json:"generation"`
+	Sets       int       `json:"sets"`     // Conjuntos recurso/ação carregados
+	Policies   int       `json:"policies"` // Políticas compiladas em memória
+	Configs    int       `json:"configs"`
+	LoadedAt   time.Time `json:"loaded_at,omitempty"` // Última invalidação
+}
+
+type cachedTenant struct {
+	tenantID  *uuid.UUID
+	expiresAt time.Time
+}
+
+// policyCache conjuntos pré-ordenados (prioridade DESC) por recurso/ação, com todas as camadas.
+// O filtro de escopo (global/tenant/app) é feito em memória a cada avaliação.
+type policyCache struct {
+	mu         sync.RWMutex
+	generation int64
+	resetAt    time.Time
+	sets       map[string][]Policy
+	configs    map[string]ResourcePolicyConfig
+	tenants    map[uuid.UUID]cachedTenant
+	stop       chan struct{}
+}
+
+func newPolicyCache(generation int64) *policyCache {
+	c := &policyCache{stop: make(chan struct{})}
+	c.reset(generation)
+	return c
+}
+
+// reset descarta tudo (chamar com lock ou antes de publicar o cache)
+func (c *policyCache) reset(generation int64) {
+	c.generation = generation
+	c.resetAt = time.Now()
+	c.sets = make(map[string][]Policy)
+	c.configs = make(map[string]ResourcePolicyConfig)
+	c.tenants = make(map[uuid.UUID]cachedTenant)
+}
+
+// ========================================
+// CICLO DE VIDA
+// ========================================
+
+// EnableCache liga o cache e o acompanhamento da geração compartilhada
+func (s *PolicyService) EnableCache(pollInterval time.Duration) error {
+	state := PolicyCacheState{Name: cacheStateName}
+	if err := s.db.Where("name = ?", cacheStateName).FirstOrCreate(&state).Error; err != nil {
+		return err
+	}
+	if pollInterval <= 0 {
+		pollInterval = DefaultCachePollInterval
+	}
+
+	cache := newPolicyCache(state.Generation)
+	if previous := s.cache.Swap(cache); previous != nil {
+		close(previous.stop)
+	}
+	go s.watchCacheGeneration(cache, pollInterval)
+	return nil
+}
+
+// StopCache desliga o cache (avaliações voltam a consultar o banco).
+// Seguro com avaliações em andamento: quem já leu o ponteiro termina no cache antigo.
+func (s *PolicyService) StopCache() {
+	if cache := s.cache.Swap(nil); cache != nil {
+		close(cache.stop)
+	}
+}
+
+// watchCacheGeneration descarta o cache local quando outra réplica altera políticas
+func (s *PolicyService) watchCacheGeneration(cache *policyCache, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cache.stop:
+			return
+		case <-ticker.C:
+			var state PolicyCacheState
+			if err := s.db.Where("name = ?", cacheStateName).First(&state).Error; err != nil {
+				continue
+			}
+			cache.mu.Lock()
+			if state.Generation != cache.generation {
+				cache.reset(state.Generation)
+			}
+			cache.mu.Unlock()
+		}
+	}
+}
+
+// policiesChanged avisa as demais réplicas e invalida o cache local.
+// A geração compartilhada sobe mesmo sem cache nesta réplica: as outras podem ter.
+func (s *PolicyService) policiesChanged() {
+	var state PolicyCacheState
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&PolicyCacheState{Name: cacheStateName}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&PolicyCacheState{}).Where("name = ?", cacheStateName).Updates(map[string]any{
+			"generation": gorm.Expr("generation + 1"),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("name = ?", cacheStateName).First(&state).Error
+	})
+	if err != nil {
+		log.Printf("⚠️ [POLICY] Cache generation bump failed: %v", err)
+	}
+
+	cache := s.cache.Load()
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	if err != nil {
+		state.Generation = cache.generation // Descarta mesmo assim, na geração atual
+	}
+	cache.reset(state.Generation)
+	cache.mu.Unlock()
+}
+
+// InvalidateCache força o recarregamento (local e réplicas)
+func (s *PolicyService) InvalidateCache() {
+	s.policiesChanged()
+}
+
+// CacheStats estado do cache local
+func (s *PolicyService) CacheStats() PolicyCacheStats {
+	cache := s.cache.Load()
+	if cache == nil {
+		return PolicyCacheStats{}
+	}
+
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+	stats := PolicyCacheStats{
+		Enabled:    true,
+		Generation: cache.generation,
+		Sets:       len(cache.sets),
+		Configs:    len(cache.configs),
+		LoadedAt:   cache.resetAt,
+	}
+	for _, set := range cache.sets {
+		stats.Policies += len(set)
+	}
+	return stats
+}
+
+// ========================================
+// LEITURA
+// ========================================
+
+// policiesFor políticas aplicáveis (camadas global/tenant/app), do cache quando ligado.
+// Retorna também se veio do cache.
+func (s *PolicyService) policiesFor(resource, action string, tenantID, appID *uuid.UUID) ([]Policy, bool, error) {
+	cache := s.cache.Load()
+	if cache == nil {
+		policies, err := s.ListPoliciesForScope(resource, action, tenantID, appID)
+		return policies, false, err
+	}
+
+	key := resource + "|" + action
+	cache.mu.RLock()
+	set, hit := cache.sets[key]
+	generation := cache.generation
+	cache.mu.RUnlock()
+
+	if !hit {
+		if err := s.db.Where(
+			"active = ? AND (resource = ? OR resource = ?) AND (action = ? OR action = ?)",
+			true, resource, ResourceAll, action, ActionAll,
+		).Order("priority DESC, created_at ASC").Find(&set).Error; err != nil {
+			return nil, false, err
+		}
+		compilePolicies(set)
+
+		// Só publica se nenhuma invalidação ocorreu durante a carga
+		cache.mu.Lock()
+		if cache.generation == generation {
+			cache.sets[key] = set
+		}
+		cache.mu.Unlock()
+	}
+
+	policies := make([]Policy, 0, len(set))
+	for _, policy := range set {
+		if policyInScope(&policy, tenantID, appID) {
+			policies = append(policies, policy)
+		}
+	}
+	return policies, hit, nil
+}
+
+// resourceConfig configuração do recurso, do cache quando ligado
+func (s *PolicyService) resourceConfig(resource string) ResourcePolicyConfig {
+	cache := s.cache.Load()
+	if cache == nil {
+		return s.GetResourceConfig(resource)
+	}
+
+	cache.mu.RLock()
+	config, ok := cache.configs[resource]
+	generation := cache.generation
+	cache.mu.RUnlock()
+	if ok {
+		return config
+	}
+
+	config = s.GetResourceConfig(resource)
+	cache.mu.Lock()
+	if cache.generation == generation {
+		cache.configs[resource] = config
+	}
+	cache.mu.Unlock()
+	return config
+}
+
+// cachedAppTenant dono do app, do cache quando ligado
+func (s *PolicyService) cachedAppTenant(appID uuid.UUID) *uuid.UUID {
+	cache := s.cache.Load()
+	if cache == nil {
+		return s.appTenant(appID)
+	}
+
+	cache.mu.RLock()
+	entry, ok := cache.tenants[appID]
+	cache.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.tenantID
+	}
+
+	tenantID := s.appTenant(appID)
+	cache.mu.Lock()
+	cache.tenants[appID] = cachedTenant{tenantID: tenantID, expiresAt: time.Now().Add(appTenantTTL)}
+	cache.mu.Unlock()
+	return tenantID
+}
+
+// policyInScope política pertence às camadas da requisição
+func policyInScope(policy *Policy, tenantID, appID *uuid.UUID) bool {
+	switch policy.Scope {
+	case ScopeTenant:
+		return tenantID != nil && policy.ScopeID == *tenantID
+	case ScopeApp:
+		return appID != nil && policy.ScopeID == *appID
+	}
+	return true // global (ou legado sem escopo)
+}
+
+// compilePolicies pré-compila o que é caro na avaliação (regex)
+func compilePolicies(policies []Policy) {
+	var walk func(conditions []Condition)
+	walk = func(conditions []Condition) {
+		for _, cond := range conditions {
+			if cond.Operator == OpRegex {
+				if pattern, ok := cond.Value.(string); ok {
+					compileRegex(pattern)
+				}
+			}
+			walk(cond.All)
+			walk(cond.Any)
+			if cond.Not != nil {
+				walk([]Condition{*cond.Not})
+			}
+		}
+	}
+	for _, policy := range policies {
+		walk(policy.Conditions)
+	}
+}
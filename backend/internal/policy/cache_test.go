@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+// ========================================
+// TESTES - Cache de políticas
+// ========================================
+
+func TestPolicyCacheInvalidatesAcrossReplicas(t *testing.T) {
+	writer := newTestPolicyService(t)
+	sqlDB, _ := writer.db.DB()
+	sqlDB.SetMaxOpenConns(1) // :memory: é por conexão
+	writer.db.AutoMigrate(&PolicyCacheState{})
+
+	// Segunda réplica no mesmo banco
+	replica := &PolicyService{db: writer.db}
+	for _, s := range []*PolicyService{writer, replica} {
+		if err := s.EnableCache(10 * time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		defer s.StopCache()
+	}
+
+	req := EvaluationRequest{Resource: ResourceAds, Action: "spend", Context: map[string]any{"amount": 50.0}}
+	if r, _ := replica.Evaluate(req); r.Result != ResultAllowed {
+		t.Fatalf("sem políticas deveria permitir: %+v", r)
+	}
+	if _, hit, _ := replica.policiesFor(ResourceAds, "spend", nil, nil); !hit {
+		t.Fatal("segunda leitura deveria vir do cache")
+	}
+
+	block := &Policy{Name: "bloqueio ads", Resource: ResourceAds, Action: ActionAll, Effect: EffectDeny, Active: true}
+	if err := writer.CreatePolicy(block); err != nil {
+		t.Fatal(err)
+	}
+	if writer.CacheStats().Sets != 0 {
+		t.Error("cache local deveria ser descartado na escrita")
+	}
+
+	var result string
+	for i := 0; i < 100 && result != ResultDenied; i++ {
+		time.Sleep(10 * time.Millisecond)
+		r, _ := replica.Evaluate(req)
+		result = r.Result
+	}
+	if result != ResultDenied {
+		t.Fatalf("réplica deveria ver a nova política: %s", result)
+	}
+	if replica.CacheStats().Generation != writer.CacheStats().Generation {
+		t.Error("gerações deveriam convergir")
+	}
+}
+
+func TestPolicyChangeBumpsGenerationWithoutLocalCache(t *testing.T) {
+	writer := newTestPolicyService(t)
+	sqlDB, _ := writer.db.DB()
+	sqlDB.SetMaxOpenConns(1) // :memory: é por conexão
+
+	// Só a réplica tem cache; quem escreve não
+	replica := &PolicyService{db: writer.db}
+	if err := replica.EnableCache(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	defer replica.StopCache()
+	before := replica.CacheStats().Generation
+
+	block := &Policy{Name: "bloqueio ads", Resource: ResourceAds, Action: ActionAll, Effect: EffectDeny, Active: true}
+	if err := writer.CreatePolicy(block); err != nil {
+		t.Fatal(err)
+	}
+
+	var state PolicyCacheState
+	if err := writer.db.Where("name = ?", cacheStateName).First(&state).Error; err != nil {
+		t.Fatal(err)
+	}
+	if state.Generation != before+1 {
+		t.Errorf("geração compartilhada deveria subir: antes %d, agora %d", before, state.Generation)
+	}
+}
@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// COMBINING ALGORITHMS - Como várias políticas viram uma decisão
+// "Dinheiro não é permitido por omissão"
+// ========================================
+
+// Algoritmos de combinação
+const (
+	CombineFirstApplicable = "first_applicable" // Primeira que casar (ordem de prioridade)
+	CombineDenyOverrides   = "deny_overrides"   // Qualquer deny vence; depois require_approval; depois allow
+	CombinePermitOverrides = "permit_overrides" // Qualquer allow vence; depois require_approval; depois deny
+	CombineUnanimous       = "unanimous"        // Todas as aplicáveis concordam, senão deny
+)
+
+// Contribuição de cada política casada para a decisão
+const (
+	ContributionDecisive   = "decisive"   // Definiu o resultado
+	ContributionConcurring = "concurring" // Mesmo efeito do resultado
+	ContributionOverridden = "overridden" // Efeito vencido pelo algoritmo
+	ContributionIgnored    = "ignored"    // first_applicable: avaliada depois da decisiva
+)
+
+// Defaults quando o recurso não tem configuração (nem "*")
+const (
+	DefaultCombiningAlgorithm = CombineFirstApplicable
+	DefaultEffect             = EffectAllow
+)
+
+// defaultResourceConfigs configurações criadas no seed: o ledger falha fechado
+var defaultResourceConfigs = []ResourcePolicyConfig{
+	{Resource: ResourceLedger, CombiningAlgorithm: CombineDenyOverrides, DefaultEffect: EffectDeny},
+}
+
+// ResourcePolicyConfig algoritmo e efeito padrão de um recurso
+type ResourcePolicyConfig struct {
+	Resource           string    `gorm:"size:50;primaryKey" json:"resource"` // ledger, agent, ... ou "*"
+	CombiningAlgorithm string    `gorm:"size:30" json:"combining_algorithm"`
+	DefaultEffect      string    `gorm:"size:20" json:"default_effect"` // Quando nenhuma política casa
+	Version            int       `json:"version"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	UpdatedBy          uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+}
+
+func (ResourcePolicyConfig) TableName() string {
+	return "policy_resource_configs"
+}
+
+// ResourcePolicyConfigVersion histórico imutável da configuração de um recurso
+type ResourcePolicyConfigVersion struct {
+	ID                 uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Resource           string    `gorm:"size:50;uniqueIndex:idx_resource_config_version" json:"resource"`
+	Version            int       `gorm:"uniqueIndex:idx_resource_config_version" json:"version"`
+	CombiningAlgorithm string    `gorm:"size:30" json:"combining_algorithm"`
+	DefaultEffect      string    `gorm:"size:20" json:"default_effect"`
+	Removed            bool      `json:"removed"` // Configuração removida (recurso volta a herdar)
+	ChangedBy          uuid.UUID `gorm:"type:uuid" json:"changed_by"`
+	ChangedAt          time.Time `json:"changed_at"`
+}
+
+func (ResourcePolicyConfigVersion) TableName() string {
+	return "policy_resource_config_versions"
+}
+
+// PolicyMatch política que casou e o que contribuiu
+type PolicyMatch struct {
+	PolicyID     string `json:"policy_id"`
+	PolicyName   string `json:"policy_name"`
+	Scope        string `json:"scope,omitempty"`
+	Priority     int    `json:"priority"`
+	Effect       string `json:"effect"`
+	Reason       string `json:"reason"`
+	Contribution string `json:"contribution"`
+}
+
+// PolicyMatchList para serialização GORM
+type PolicyMatchList []PolicyMatch
+
+func (m PolicyMatchList) Value() (driver.Value, error) {
+	if m == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func (m *PolicyMatchList) Scan(value any) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		*m = PolicyMatchList{}
+		return nil
+	}
+	return json.Unmarshal(bytes, m)
+}
+
+func validAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case CombineFirstApplicable, CombineDenyOverrides, CombinePermitOverrides, CombineUnanimous:
+		return true
+	}
+	return false
+}
+
+func validEffect(effect string) bool {
+	switch effect {
+	case EffectAllow, EffectDeny, EffectRequireApproval:
+		return true
+	}
+	return false
+}
+
+// ========================================
+// CONFIGURAÇÃO POR RECURSO
+// ========================================
+
+// GetResourceConfig configuração efetiva: recurso → "*" → default do sistema
+func (s *PolicyService) GetResourceConfig(resource string) ResourcePolicyConfig {
+	for _, candidate := range []string{resource, ResourceAll} {
+		var config ResourcePolicyConfig
+		if err := s.db.Where("resource = ?", candidate).First(&config).Error; err == nil {
+			return config
+		}
+	}
+	return ResourcePolicyConfig{
+		Resource:           resource,
+		CombiningAlgorithm: DefaultCombiningAlgorithm,
+		DefaultEffect:      DefaultEffect,
+	}
+}
+
+// ListResourceConfigs lista as configurações gravadas
+func (s *PolicyService) ListResourceConfigs() ([]ResourcePolicyConfig, error) {
+	var configs []ResourcePolicyConfig
+	err := s.db.Order("resource ASC").Find(&configs).Error
+	return configs, err
+}
+
+// SetResourceConfig define algoritmo e efeito padrão de um recurso
+func (s *PolicyService) SetResourceConfig(resource, algorithm, defaultEffect string, updatedBy uuid.UUID) (*ResourcePolicyConfig, error) {
+	if resource == "" {
+		return nil, fmt.Errorf("resource é obrigatório")
+	}
+	if !validAlgorithm(algorithm) {
+		return nil, fmt.Errorf("combining_algorithm inválido: %s (use: first_applicable, deny_overrides, permit_overrides, unanimous)", algorithm)
+	}
+	if !validEffect(defaultEffect) {
+		return nil, fmt.Errorf("default_effect inválido: %s (use: allow, deny, require_approval)", defaultEffect)
+	}
+
+	config := &ResourcePolicyConfig{
+		Resource:           resource,
+		CombiningAlgorithm: algorithm,
+		DefaultEffect:      defaultEffect,
+		UpdatedAt:          time.Now(),
+		UpdatedBy:          updatedBy,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		version, err := recordResourceConfigVersion(tx, config, false, updatedBy)
+		if err != nil {
+			return err
+		}
+		config.Version = version
+		return tx.Save(config).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.policiesChanged()
+	return config, nil
+}
+
+// DeleteResourceConfig remove a configuração (volta a herdar de "*" / default)
+func (s *PolicyService) DeleteResourceConfig(resource string, deletedBy uuid.UUID) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing ResourcePolicyConfig
+		if err := tx.Where("resource = ?", resource).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("configuração não encontrada: %w", err)
+			}
+			return err
+		}
+		if _, err := recordResourceConfigVersion(tx, &existing, true, deletedBy); err != nil {
+			return err
+		}
+		return tx.Where("resource = ?", resource).Delete(&ResourcePolicyConfig{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.policiesChanged()
+	return nil
+}
+
+// GetResourceConfigVersions histórico da configuração de um recurso
+func (s *PolicyService) GetResourceConfigVersions(resource string) ([]ResourcePolicyConfigVersion, error) {
+	var versions []ResourcePolicyConfigVersion
+	err := s.db.Where("resource = ?", resource).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// recordResourceConfigVersion grava a próxima versão da configuração com o autor.
+// O índice único (resource, version) barra duas alterações concorrentes na mesma versão.
+func recordResourceConfigVersion(tx *gorm.DB, config *ResourcePolicyConfig, removed bool, changedBy uuid.UUID) (int, error) {
+	var last int
+	if err := tx.Model(&ResourcePolicyConfigVersion{}).Where("resource = ?", config.Resource).
+		Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+		return 0, err
+	}
+	version := &ResourcePolicyConfigVersion{
+		ID:                 uuid.New(),
+		Resource:           config.Resource,
+		Version:            last + 1,
+		CombiningAlgorithm: config.CombiningAlgorithm,
+		DefaultEffect:      config.DefaultEffect,
+		Removed:            removed,
+		ChangedBy:          changedBy,
+		ChangedAt:          time.Now(),
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
+
+// ========================================
+// COMBINAÇÃO
+// ========================================
+
+// effectRank restritividade (maior = mais restritivo)
+func effectRank(effect string) int {
+	switch effect {
+	case EffectDeny:
+		return 2
+	case EffectRequireApproval:
+		return 1
+	}
+	return 0
+}
+
+// combine aplica o algoritmo às políticas casadas (em ordem de prioridade).
+// Retorna o efeito, o índice da política decisiva (-1 = nenhuma, ex: unanimous em desacordo)
+// e a contribuição de cada uma.
+func combine(algorithm string, matched []Policy) (string, int, []string) {
+	contributions := make([]string, len(matched))
+	if len(matched) == 0 {
+		return "", -1, contributions
+	}
+
+	decisive := 0
+	switch algorithm {
+	case CombineDenyOverrides, CombinePermitOverrides:
+		// Primeira política (maior prioridade) com o efeito vencedor
+		better := func(a, b string) bool { return effectRank(a) > effectRank(b) }
+		if algorithm == CombinePermitOverrides {
+			better = func(a, b string) bool { return effectRank(a) < effectRank(b) }
+		}
+		for i := range matched {
+			if better(matched[i].Effect, matched[decisive].Effect) {
+				decisive = i
+			}
+		}
+
+	case CombineUnanimous:
+		for i := range matched {
+			if matched[i].Effect != matched[0].Effect {
+				for j := range contributions {
+					contributions[j] = ContributionOverridden
+				}
+				return EffectDeny, -1, contributions
+			}
+		}
+
+	default: // first_applicable
+		for i := range contributions {
+			contributions[i] = ContributionIgnored
+		}
+		contributions[0] = ContributionDecisive
+		return matched[0].Effect, 0, contributions
+	}
+
+	effect := matched[decisive].Effect
+	for i := range matched {
+		switch {
+		case i == decisive:
+			contributions[i] = ContributionDecisive
+		case matched[i].Effect == effect:
+			contributions[i] = ContributionConcurring
+		default:
+			contributions[i] = ContributionOverridden
+		}
+	}
+	return effect, decisive, contributions
+}
@@ -0,0 +1,459 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ========================================
+// CONDITIONS - Grupos aninhados e operadores ricos
+// "Regras de dinheiro não cabem em um AND"
+// ========================================
+
+// ErrInvalidCondition condição malformada (operador, regex, CIDR, janela...)
+var ErrInvalidCondition = errors.New("invalid policy condition")
+
+// maxConditionDepth limite de aninhamento de grupos
+const maxConditionDepth = 10
+
+// regexCache padrões já compilados (políticas são avaliadas o tempo todo)
+var regexCache sync.Map
+
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// isGroup indica se a condição é um grupo all/any/not
+func (c Condition) isGroup() bool {
+	return c.All != nil || c.Any != nil || c.Not != nil
+}
+
+// ========================================
+// VALIDAÇÃO
+// ========================================
+
+// ValidateConditions valida a árvore de condições de uma política
+func ValidateConditions(conditions []Condition) error {
+	for i, cond := range conditions {
+		if err := validateCondition(cond, fmt.Sprintf("conditions[%d]", i), 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCondition(cond Condition, path string, depth int) error {
+	if depth > maxConditionDepth {
+		return fmt.Errorf("%w: %s excede %d níveis de aninhamento", ErrInvalidCondition, path, maxConditionDepth)
+	}
+
+	if cond.isGroup() {
+		groups := 0
+		for _, set := range []bool{cond.All != nil, cond.Any != nil, cond.Not != nil} {
+			if set {
+				groups++
+			}
+		}
+		if groups > 1 || cond.Field != "" || cond.Operator != "" {
+			return fmt.Errorf("%w: %s deve ter apenas um de all, any, not ou field/operator", ErrInvalidCondition, path)
+		}
+		for i, child := range cond.All {
+			if err := validateCondition(child, fmt.Sprintf("%s.all[%d]", path, i), depth+1); err != nil {
+				return err
+			}
+		}
+		for i, child := range cond.Any {
+			if err := validateCondition(child, fmt.Sprintf("%s.any[%d]", path, i), depth+1); err != nil {
+				return err
+			}
+		}
+		if cond.Not != nil {
+			return validateCondition(*cond.Not, path+".not", depth+1)
+		}
+		return nil
+	}
+
+	// Janelas de tempo usam "agora" quando field é omitido
+	if cond.Field == "" && cond.Operator != OpTimeBetween && cond.Operator != OpDayOfWeek {
+		return fmt.Errorf("%w: %s sem field", ErrInvalidCondition, path)
+	}
+
+	// Com value_field o operando só existe na avaliação
+	if cond.ValueField != "" {
+		switch cond.Operator {
+		case OpEqual, OpNotEqual, OpGreaterThan, OpGreaterOrEq, OpLessThan, OpLessOrEq,
+			OpIn, OpNotIn, OpContains, OpBefore, OpAfter:
+			return nil
+		}
+		return fmt.Errorf("%w: %s operador %s não aceita value_field", ErrInvalidCondition, path, cond.Operator)
+	}
+
+	switch cond.Operator {
+	case OpEqual, OpNotEqual, OpGreaterThan, OpGreaterOrEq, OpLessThan, OpLessOrEq,
+		OpIn, OpNotIn, OpContains:
+		return nil
+	case OpExists:
+		if _, ok := cond.Value.(bool); cond.Value != nil && !ok {
+			return fmt.Errorf("%w: %s exists espera true ou false", ErrInvalidCondition, path)
+		}
+		return nil
+	case OpRegex:
+		pattern, ok := cond.Value.(string)
+		if !ok {
+			return fmt.Errorf("%w: %s regex espera um padrão", ErrInvalidCondition, path)
+		}
+		if _, err := compileRegex(pattern); err != nil {
+			return fmt.Errorf("%w: %s regex inválida: %v", ErrInvalidCondition, path, err)
+		}
+		return nil
+	case OpCIDR:
+		if _, err := parseCIDRs(cond.Value); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidCondition, path, err)
+		}
+		return nil
+	case OpTimeBetween:
+		if _, _, _, err := parseTimeWindow(cond.Value); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidCondition, path, err)
+		}
+		return nil
+	case OpDayOfWeek:
+		if _, _, err := parseDaysOfWeek(cond.Value); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidCondition, path, err)
+		}
+		return nil
+	case OpBefore, OpAfter:
+		if _, ok := toTime(cond.Value, time.Now()); !ok {
+			return fmt.Errorf("%w: %s data inválida: %v", ErrInvalidCondition, path, cond.Value)
+		}
+		return nil
+	case OpWithinLast:
+		if _, err := parseDurationValue(cond.Value); err != nil {
+			return fmt.Errorf("%w: %s %v", ErrInvalidCondition, path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s operador desconhecido: %s", ErrInvalidCondition, path, cond.Operator)
+}
+
+// ========================================
+// AVALIAÇÃO DOS OPERADORES ESTENDIDOS
+// ========================================
+
+// evaluateExtendedOperator avalia regex, cidr, janelas de tempo, exists e datas
+func (s *PolicyService) evaluateExtendedOperator(cond Condition, value, operand any, now time.Time) (bool, error) {
+	switch cond.Operator {
+	case OpExists:
+		want := true
+		if b, ok := operand.(bool); ok {
+			want = b
+		}
+		return (value != nil) == want, nil
+
+	case OpRegex:
+		pattern, ok := operand.(string)
+		if !ok {
+			return false, fmt.Errorf("regex espera um padrão")
+		}
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return false, err
+		}
+		str, ok := value.(string)
+		return ok && re.MatchString(str), nil
+
+	case OpCIDR:
+		networks, err := parseCIDRs(operand)
+		if err != nil {
+			return false, err
+		}
+		str, _ := value.(string)
+		ip := net.ParseIP(strings.TrimSpace(str))
+		if ip == nil {
+			return false, nil
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case OpTimeBetween:
+		from, to, loc, err := parseTimeWindow(operand)
+		if err != nil {
+			return false, err
+		}
+		at, ok := conditionInstant(cond, value, now)
+		if !ok {
+			return false, nil
+		}
+		at = at.In(loc)
+		minute := at.Hour()*60 + at.Minute()
+		if from <= to {
+			return minute >= from && minute < to, nil
+		}
+		return minute >= from || minute < to, nil // Atravessa a meia-noite
+
+	case OpDayOfWeek:
+		days, loc, err := parseDaysOfWeek(operand)
+		if err != nil {
+			return false, err
+		}
+		at, ok := conditionInstant(cond, value, now)
+		if !ok {
+			return false, nil
+		}
+		return days[at.In(loc).Weekday()], nil
+
+	case OpBefore, OpAfter:
+		at, ok := toTime(value, now)
+		if !ok {
+			return false, nil
+		}
+		ref, ok := toTime(operand, now)
+		if !ok {
+			return false, fmt.Errorf("data inválida: %v", operand)
+		}
+		if cond.Operator == OpBefore {
+			return at.Before(ref), nil
+		}
+		return at.After(ref), nil
+
+	case OpWithinLast:
+		at, ok := toTime(value, now)
+		if !ok {
+			return false, nil
+		}
+		window, err := parseDurationValue(operand)
+		if err != nil {
+			return false, err
+		}
+		return !at.After(now) && now.Sub(at) <= window, nil
+	}
+
+	return false, fmt.Errorf("operador desconhecido: %s", cond.Operator)
+}
+
+// conditionInstant instante avaliado pelas janelas: campo do contexto ou agora
+func conditionInstant(cond Condition, value any, now time.Time) (time.Time, bool) {
+	if cond.Field == "" {
+		return now, true
+	}
+	return toTime(value, now)
+}
+
+// ========================================
+// PARSERS
+// ========================================
+
+// toTime converte time.Time, RFC3339, "2006-01-02", unix (segundos) ou "now[±duração]"
+func toTime(v any, now time.Time) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t == nil {
+			return time.Time{}, false
+		}
+		return *t, true
+	case float64:
+		return time.Unix(int64(t), 0), true
+	case int64:
+		return time.Unix(t, 0), true
+	case int:
+		return time.Unix(int64(t), 0), true
+	case string:
+		str := strings.TrimSpace(t)
+		if strings.HasPrefix(str, "now") {
+			offset := strings.TrimPrefix(str, "now")
+			if offset == "" {
+				return now, true
+			}
+			if offset[0] == '+' {
+				offset = offset[1:]
+			}
+			d, err := time.ParseDuration(offset)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return now.Add(d), true
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, str); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDurationValue aceita "720h", "30m" ou segundos numéricos
+func parseDurationValue(v any) (time.Duration, error) {
+	switch d := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(d)
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("duração inválida: %s", d)
+		}
+		return parsed, nil
+	case float64:
+		if d > 0 {
+			return time.Duration(d * float64(time.Second)), nil
+		}
+	case int:
+		if d > 0 {
+			return time.Duration(d) * time.Second, nil
+		}
+	}
+	return 0, fmt.Errorf("duração inválida: %v", v)
+}
+
+// parseCIDRs aceita um CIDR/IP ou uma lista deles
+func parseCIDRs(v any) ([]*net.IPNet, error) {
+	var items []any
+	switch list := v.(type) {
+	case string:
+		items = []any{list}
+	case []any:
+		items = list
+	case []string:
+		for _, item := range list {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("cidr espera string ou lista")
+	}
+
+	networks := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		str, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("cidr inválido: %v", item)
+		}
+		str = strings.TrimSpace(str)
+		if !strings.Contains(str, "/") {
+			// IP isolado vira /32 ou /128
+			ip := net.ParseIP(str)
+			if ip == nil {
+				return nil, fmt.Errorf("cidr inválido: %s", str)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(str)
+		if err != nil {
+			return nil, fmt.Errorf("cidr inválido: %s", str)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseLocation timezone opcional (padrão UTC)
+func parseLocation(v any) (*time.Location, error) {
+	name, _ := v.(string)
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("timezone inválida: %s", name)
+	}
+	return loc, nil
+}
+
+// parseClock "HH:MM" em minutos desde a meia-noite
+func parseClock(v any) (int, error) {
+	str, _ := v.(string)
+	t, err := time.Parse("15:04", str)
+	if err != nil {
+		return 0, fmt.Errorf("horário inválido: %v (use HH:MM)", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseTimeWindow {"from":"HH:MM","to":"HH:MM","timezone":"..."}
+func parseTimeWindow(v any) (int, int, *time.Location, error) {
+	window, ok := v.(map[string]any)
+	if !ok {
+		return 0, 0, nil, fmt.Errorf("time_between espera {from, to, timezone}")
+	}
+	from, err := parseClock(window["from"])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	to, err := parseClock(window["to"])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if from == to {
+		return 0, 0, nil, fmt.Errorf("time_between com janela vazia")
+	}
+	loc, err := parseLocation(window["timezone"])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return from, to, loc, nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseDaysOfWeek lista de dias ("mon", "monday", 0-6) ou {"days":[...],"timezone":"..."}
+func parseDaysOfWeek(v any) (map[time.Weekday]bool, *time.Location, error) {
+	loc := time.UTC
+	list, ok := v.([]any)
+	if window, isMap := v.(map[string]any); isMap {
+		var err error
+		if loc, err = parseLocation(window["timezone"]); err != nil {
+			return nil, nil, err
+		}
+		list, ok = window["days"].([]any)
+	}
+	if !ok || len(list) == 0 {
+		return nil, nil, fmt.Errorf("day_of_week espera uma lista de dias")
+	}
+
+	days := make(map[time.Weekday]bool, len(list))
+	for _, item := range list {
+		switch d := item.(type) {
+		case string:
+			name := strings.ToLower(strings.TrimSpace(d))
+			if len(name) > 3 {
+				name = name[:3]
+			}
+			day, known := weekdayNames[name]
+			if !known {
+				return nil, nil, fmt.Errorf("dia inválido: %s", d)
+			}
+			days[day] = true
+		case float64:
+			if d < 0 || d > 6 || d != float64(int(d)) {
+				return nil, nil, fmt.Errorf("dia inválido: %v (0=domingo..6=sábado)", d)
+			}
+			days[time.Weekday(int(d))] = true
+		default:
+			return nil, nil, fmt.Errorf("dia inválido: %v", item)
+		}
+	}
+	return days, loc, nil
+}
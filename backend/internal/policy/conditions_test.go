@@ -0,0 +1,76 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ========================================
+// TESTES - Condições aninhadas e operadores
+// ========================================
+
+func mustConditions(t *testing.T, raw string) ConditionList {
+	t.Helper()
+	var conditions ConditionList
+	if err := json.Unmarshal([]byte(raw), &conditions); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateConditions(conditions); err != nil {
+		t.Fatal(err)
+	}
+	return conditions
+}
+
+func TestNestedConditionsAndOperators(t *testing.T) {
+	s := &PolicyService{}
+	context := map[string]any{
+		"amount":  1500.0,
+		"ip":      "10.1.2.3",
+		"email":   "ops@prost.dev",
+		"user":    map[string]any{"role": "user"},
+		"account": map[string]any{"daily_limit": 1000.0, "created_at": time.Now().Add(-48 * time.Hour).Format(time.RFC3339)},
+	}
+
+	cases := []struct {
+		name string
+		raw  string
+		want bool
+	}{
+		{"formato plano", `[{"field":"amount","operator":"gt","value":1000},{"field":"user.role","operator":"eq","value":"user"}]`, true},
+		{"campo contra campo", `[{"field":"amount","operator":"gt","value_field":"account.daily_limit"}]`, true},
+		{"any/not", `[{"any":[{"field":"user.role","operator":"eq","value":"admin"},{"not":{"field":"ip","operator":"cidr","value":["192.168.0.0/16"]}}]}]`, true},
+		{"all falso", `[{"all":[{"field":"ip","operator":"cidr","value":"10.0.0.0/8"},{"field":"email","operator":"regex","value":"@example\\.com$"}]}]`, false},
+		{"exists", `[{"field":"account.daily_limit","operator":"exists"},{"field":"device","operator":"exists","value":false}]`, true},
+		{"datas", `[{"field":"account.created_at","operator":"after","value":"now-72h"},{"field":"account.created_at","operator":"within_last","value":"24h"}]`, false},
+		{"janela 24h", `[{"operator":"time_between","value":{"from":"00:00","to":"23:59"}},{"operator":"day_of_week","value":["sun","mon","tue","wed","thu","fri","sat"]}]`, true},
+	}
+	for _, tc := range cases {
+		got, err := s.evaluateConditions(mustConditions(t, tc.raw), context)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %v (%v), want %v", tc.name, got, err, tc.want)
+		}
+	}
+
+	// Janela que atravessa a meia-noite
+	night := Condition{Field: "at", Operator: OpTimeBetween, Value: map[string]any{"from": "22:00", "to": "06:00"}}
+	for at, want := range map[string]bool{"2026-01-05T23:30:00Z": true, "2026-01-05T05:59:00Z": true, "2026-01-05T12:00:00Z": false} {
+		if got, _ := s.evaluateCondition(night, map[string]any{"at": at}); got != want {
+			t.Errorf("time_between %s: got %v", at, got)
+		}
+	}
+
+	for _, raw := range []string{
+		`[{"field":"ip","operator":"cidr","value":"10.0.0.0/33"}]`,
+		`[{"field":"email","operator":"regex","value":"("}]`,
+		`[{"all":[],"field":"amount"}]`,
+		`[{"field":"amount","operator":"between"}]`,
+	} {
+		var conditions ConditionList
+		json.Unmarshal([]byte(raw), &conditions)
+		if err := ValidateConditions(conditions); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("%s deveria ser inválida: %v", raw, err)
+		}
+	}
+}
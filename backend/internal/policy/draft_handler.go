@@ -0,0 +1,261 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"prost-qs/backend/pkg/middleware"
+)
+
+// ========================================
+// DRAFT HANDLER - Rascunhos, revisão e publicação
+// ========================================
+
+// draftRequest corpo de criação/edição de rascunho
+type draftRequest struct {
+	PolicyID *uuid.UUID `json:"policy_id"` // Vazio = política nova
+	PolicyDefinition
+	Note string `json:"note"`
+}
+
+// contextUser usuário autenticado (Nil se ausente)
+func contextUser(c *gin.Context) uuid.UUID {
+	userID, _ := uuid.Parse(c.GetString(middleware.ContextUserIDKey))
+	return userID
+}
+
+// draftError traduz erros do fluxo de rascunhos
+func draftError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrDraftNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rascunho não encontrado"})
+	case errors.Is(err, ErrInvalidPolicy), errors.Is(err, ErrInvalidCondition), errors.Is(err, ErrInvalidPolicyScope):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReviewerRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Revisão exige usuário autenticado"})
+	case errors.Is(err, ErrSelfReview):
+		c.JSON(http.StatusForbidden, gin.H{"error": "O autor não pode revisar o próprio rascunho"})
+	case errors.Is(err, ErrDraftNeedsImpact):
+		c.JSON(http.StatusConflict, gin.H{"error": "Execute a análise de impacto após a última edição antes de publicar"})
+	case errors.Is(err, ErrInvalidDraftState), errors.Is(err, ErrDraftConflict), errors.Is(err, ErrPolicyTestsFailed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao processar rascunho"})
+	}
+}
+
+// CreateDraft cria um rascunho (nova política ou alteração)
+// POST /api/v1/policies/drafts
+func (h *PolicyHandler) CreateDraft(c *gin.Context) {
+	var req draftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, err := h.service.CreateDraft(req.PolicyID, req.PolicyDefinition, req.Note, contextUser(c))
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, draft)
+}
+
+// ListDrafts lista rascunhos
+// GET /api/v1/policies/drafts?status=
+func (h *PolicyHandler) ListDrafts(c *gin.Context) {
+	drafts, err := h.service.ListDrafts(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar rascunhos"})
+		return
+	}
+
+	c.JSON(http.StatusOK, drafts)
+}
+
+// GetDraft busca um rascunho
+// GET /api/v1/policies/drafts/:draftId
+func (h *PolicyHandler) GetDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	draft, err := h.service.GetDraft(id)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// UpdateDraft edita a definição do rascunho
+// PUT /api/v1/policies/drafts/:draftId
+func (h *PolicyHandler) UpdateDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req draftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, err := h.service.UpdateDraft(id, req.PolicyDefinition, req.Note)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// SubmitDraft envia para revisão
+// POST /api/v1/policies/drafts/:draftId/submit
+func (h *PolicyHandler) SubmitDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	draft, err := h.service.SubmitDraft(id)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// ReviewDraft aprova ou rejeita
+// POST /api/v1/policies/drafts/:draftId/review
+func (h *PolicyHandler) ReviewDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req struct {
+		Approve *bool  `json:"approve" binding:"required"`
+		Note    string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft, err := h.service.ReviewDraft(id, *req.Approve, contextUser(c), req.Note)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// PublishDraft publica como nova versão imutável
+// POST /api/v1/policies/drafts/:draftId/publish
+func (h *PolicyHandler) PublishDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	policy, err := h.service.PublishDraft(id, contextUser(c))
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DiscardDraft abandona o rascunho
+// DELETE /api/v1/policies/drafts/:draftId
+func (h *PolicyHandler) DiscardDraft(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if _, err := h.service.DiscardDraft(id); err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rascunho descartado"})
+}
+
+// AnalyzeDraftImpact reexecuta as últimas avaliações contra o rascunho.
+// POST porque registra a análise no rascunho (pré-requisito da publicação).
+// POST /api/v1/policies/drafts/:draftId/impact?limit=500
+func (h *PolicyHandler) AnalyzeDraftImpact(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultImpactSample)))
+
+	report, err := h.service.AnalyzeDraftImpact(id, limit)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetPolicyVersions histórico publicado
+// GET /api/v1/policies/:id/versions
+func (h *PolicyHandler) GetPolicyVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	versions, err := h.service.GetPolicyVersions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar versões"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetPolicyVersion uma versão publicada
+// GET /api/v1/policies/:id/versions/:version
+func (h *PolicyHandler) GetPolicyVersion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Versão inválida"})
+		return
+	}
+
+	v, err := h.service.GetPolicyVersion(id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Versão não encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, v)
+}
@@ -0,0 +1,663 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// DRAFTS - Rascunho → revisão → publicação
+// "Política publicada não se edita: se substitui"
+// ========================================
+
+var (
+	ErrInvalidPolicy     = errors.New("invalid policy definition")
+	ErrDraftNotFound     = errors.New("policy draft not found")
+	ErrInvalidDraftState = errors.New("invalid policy draft state")
+	ErrDraftConflict     = errors.New("policy changed since draft was created")
+	ErrDraftNeedsImpact  = errors.New("policy draft needs an up-to-date impact report")
+	ErrSelfReview        = errors.New("policy draft cannot be reviewed by its author")
+	ErrReviewerRequired  = errors.New("policy draft review requires an authenticated reviewer")
+)
+
+// Status do rascunho
+const (
+	DraftStatusDraft     = "draft"
+	DraftStatusInReview  = "in_review"
+	DraftStatusApproved  = "approved"
+	DraftStatusRejected  = "rejected"
+	DraftStatusPublished = "published"
+	DraftStatusDiscarded = "discarded"
+)
+
+// Limites do replay de impacto
+const (
+	DefaultImpactSample = 500
+	MaxImpactSample     = 5000
+)
+
+// PolicyDefinition campos que definem o comportamento de uma política.
+// Versão, timestamps e autoria não entram.
+type PolicyDefinition struct {
+	Name        string        `gorm:"size:100" json:"name"`
+	Description string        `gorm:"size:500" json:"description"`
+	Scope       string        `gorm:"size:20" json:"scope"`
+	ScopeID     uuid.UUID     `gorm:"type:uuid" json:"scope_id"`
+	Resource    string        `gorm:"size:50" json:"resource"`
+	Action      string        `gorm:"size:50" json:"action"`
+	Conditions  ConditionList `gorm:"type:text" json:"conditions"`
+	Effect      string        `gorm:"size:20" json:"effect"`
+	Reason      string        `gorm:"size:500" json:"reason"`
+	Priority    int           `json:"priority"`
+	Active      bool          `json:"active"`
+}
+
+// PolicyVersion versão publicada, imutável
+type PolicyVersion struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	PolicyID         uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_policy_version" json:"policy_id"`
+	Version          int        `gorm:"uniqueIndex:idx_policy_version" json:"version"`
+	PolicyDefinition `gorm:"embedded"`
+	DraftID          *uuid.UUID `gorm:"type:uuid" json:"draft_id,omitempty"` // nil = edição direta/legado
+	PublishedBy      uuid.UUID  `gorm:"type:uuid" json:"published_by"`
+	PublishedAt      time.Time  `json:"published_at"`
+}
+
+func (PolicyVersion) TableName() string {
+	return "policy_versions"
+}
+
+// PolicyDraft rascunho de política (nova ou alteração de existente)
+type PolicyDraft struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	PolicyID         *uuid.UUID `gorm:"type:uuid;index" json:"policy_id,omitempty"` // nil = política nova
+	BaseVersion      int        `json:"base_version"`                               // Versão publicada quando o rascunho foi criado
+	PolicyDefinition `gorm:"embedded"`
+	Status           string     `gorm:"size:20;index" json:"status"`
+	Note             string     `gorm:"size:500" json:"note,omitempty"` // Motivo da mudança
+
+	// Revisão
+	CreatedBy  uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+	ReviewedBy *uuid.UUID `gorm:"type:uuid" json:"reviewed_by,omitempty"`
+	ReviewNote string     `gorm:"size:500" json:"review_note,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+
+	// Impacto (última análise)
+	ImpactCheckedAt *time.Time `json:"impact_checked_at,omitempty"`
+	ImpactReplayed  int        `json:"impact_replayed"`
+	ImpactFlipped   int        `json:"impact_flipped"`
+
+	// Publicação
+	PublishedVersion int        `json:"published_version,omitempty"`
+	PublishedBy      *uuid.UUID `gorm:"type:uuid" json:"published_by,omitempty"`
+	PublishedAt      *time.Time `json:"published_at,omitempty"`
+
+	EditedAt  time.Time `json:"edited_at"` // Última alteração da definição
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (PolicyDraft) TableName() string {
+	return "policy_drafts"
+}
+
+// DecisionFlip decisão passada que mudaria com o rascunho
+type DecisionFlip struct {
+	EvaluationID uuid.UUID `json:"evaluation_id"`
+	EvaluatedAt  time.Time `json:"evaluated_at"`
+	ActorID      uuid.UUID `json:"actor_id"`
+	ActorType    string    `json:"actor_type"`
+	Resource     string    `json:"resource"`
+	Action       string    `json:"action"`
+	Recorded     string    `json:"recorded"` // Resultado gravado na época
+	Before       string    `json:"before"`   // Políticas publicadas hoje
+	After        string    `json:"after"`    // Com o rascunho
+	BeforePolicy string    `json:"before_policy,omitempty"`
+	AfterPolicy  string    `json:"after_policy,omitempty"`
+}
+
+// ActorImpact decisões alteradas por ator
+type ActorImpact struct {
+	ActorID     uuid.UUID      `json:"actor_id"`
+	ActorType   string         `json:"actor_type"`
+	Flipped     int            `json:"flipped"`
+	Transitions map[string]int `json:"transitions"` // "allowed→denied": 2
+}
+
+// ImpactReport replay das últimas avaliações contra o rascunho
+type ImpactReport struct {
+	DraftID     uuid.UUID      `json:"draft_id"`
+	PolicyID    *uuid.UUID     `json:"policy_id,omitempty"`
+	Replayed    int            `json:"replayed"`
+	Flipped     int            `json:"flipped"`
+	Transitions map[string]int `json:"transitions"`
+	Flips       []DecisionFlip `json:"flips"`
+	Actors      []ActorImpact  `json:"actors"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// ========================================
+// DEFINIÇÕES E VERSÕES
+// ========================================
+
+func policyDefinitionOf(policy *Policy) PolicyDefinition {
+	return PolicyDefinition{
+		Name:        policy.Name,
+		Description: policy.Description,
+		Scope:       policy.Scope,
+		ScopeID:     policy.ScopeID,
+		Resource:    policy.Resource,
+		Action:      policy.Action,
+		Conditions:  policy.Conditions,
+		Effect:      policy.Effect,
+		Reason:      policy.Reason,
+		Priority:    policy.Priority,
+		Active:      policy.Active,
+	}
+}
+
+// toPolicy política (sem ID/versão) a partir da definição
+func (d PolicyDefinition) toPolicy() Policy {
+	return Policy{
+		Name:        d.Name,
+		Description: d.Description,
+		Scope:       d.Scope,
+		ScopeID:     d.ScopeID,
+		Resource:    d.Resource,
+		Action:      d.Action,
+		Conditions:  d.Conditions,
+		Effect:      d.Effect,
+		Reason:      d.Reason,
+		Priority:    d.Priority,
+		Active:      d.Active,
+	}
+}
+
+// columns campos da definição para Updates (inclui valores zero)
+func (d PolicyDefinition) columns() map[string]any {
+	return map[string]any{
+		"name":        d.Name,
+		"description": d.Description,
+		"scope":       d.Scope,
+		"scope_id":    d.ScopeID,
+		"resource":    d.Resource,
+		"action":      d.Action,
+		"conditions":  d.Conditions,
+		"effect":      d.Effect,
+		"reason":      d.Reason,
+		"priority":    d.Priority,
+		"active":      d.Active,
+	}
+}
+
+func validateDefinition(d *PolicyDefinition) error {
+	if d.Name == "" || d.Resource == "" || d.Action == "" {
+		return fmt.Errorf("%w: name, resource e action são obrigatórios", ErrInvalidPolicy)
+	}
+	if !validEffect(d.Effect) {
+		return fmt.Errorf("%w: effect inválido: %s", ErrInvalidPolicy, d.Effect)
+	}
+	if d.Scope == "" {
+		d.Scope = ScopeGlobal
+	}
+	if err := validateScope(d.Scope, d.ScopeID); err != nil {
+		return err
+	}
+	return ValidateConditions(d.Conditions)
+}
+
+// recordPolicyVersion grava a versão atual da política
+func recordPolicyVersion(db *gorm.DB, policy *Policy, publishedBy uuid.UUID, draftID *uuid.UUID) error {
+	return db.Create(&PolicyVersion{
+		ID:               uuid.New(),
+		PolicyID:         policy.ID,
+		Version:          policy.Version,
+		PolicyDefinition: policyDefinitionOf(policy),
+		DraftID:          draftID,
+		PublishedBy:      publishedBy,
+		PublishedAt:      time.Now(),
+	}).Error
+}
+
+// ensureBaselinePolicyVersion grava a versão atual de políticas anteriores ao versionamento
+func ensureBaselinePolicyVersion(db *gorm.DB, policy *Policy) error {
+	var count int64
+	db.Model(&PolicyVersion{}).Where("policy_id = ? AND version = ?", policy.ID, policy.Version).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	return recordPolicyVersion(db, policy, policy.CreatedBy, nil)
+}
+
+// GetPolicyVersions histórico publicado de uma política
+func (s *PolicyService) GetPolicyVersions(policyID uuid.UUID) ([]PolicyVersion, error) {
+	var versions []PolicyVersion
+	err := s.db.Where("policy_id = ?", policyID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetPolicyVersion uma versão publicada
+func (s *PolicyService) GetPolicyVersion(policyID uuid.UUID, version int) (*PolicyVersion, error) {
+	var v PolicyVersion
+	if err := s.db.Where("policy_id = ? AND version = ?", policyID, version).First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ========================================
+// FLUXO DO RASCUNHO
+// ========================================
+
+// CreateDraft cria um rascunho. Com policyID, parte da versão publicada;
+// a definição enviada substitui a atual por inteiro.
+func (s *PolicyService) CreateDraft(policyID *uuid.UUID, def PolicyDefinition, note string, createdBy uuid.UUID) (*PolicyDraft, error) {
+	draft := &PolicyDraft{
+		ID:        uuid.New(),
+		PolicyID:  policyID,
+		Status:    DraftStatusDraft,
+		Note:      note,
+		CreatedBy: createdBy,
+		EditedAt:  time.Now(),
+	}
+
+	if policyID != nil {
+		existing, err := s.GetPolicy(*policyID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: política %s", ErrDraftNotFound, policyID)
+		}
+		draft.BaseVersion = existing.Version
+	}
+	if err := validateDefinition(&def); err != nil {
+		return nil, err
+	}
+	draft.PolicyDefinition = def
+
+	if err := s.db.Create(draft).Error; err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// GetDraft busca um rascunho
+func (s *PolicyService) GetDraft(id uuid.UUID) (*PolicyDraft, error) {
+	var draft PolicyDraft
+	if err := s.db.Where("id = ?", id).First(&draft).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDraftNotFound
+		}
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// ListDrafts lista rascunhos (status vazio = abertos)
+func (s *PolicyService) ListDrafts(status string) ([]PolicyDraft, error) {
+	var drafts []PolicyDraft
+	query := s.db.Order("updated_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status NOT IN ?", []string{DraftStatusPublished, DraftStatusDiscarded})
+	}
+	err := query.Find(&drafts).Error
+	return drafts, err
+}
+
+// UpdateDraft altera a definição (volta para draft; exige nova análise de impacto)
+func (s *PolicyService) UpdateDraft(id uuid.UUID, def PolicyDefinition, note string) (*PolicyDraft, error) {
+	draft, err := s.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != DraftStatusDraft && draft.Status != DraftStatusRejected {
+		return nil, fmt.Errorf("%w: rascunho em %s não pode ser editado", ErrInvalidDraftState, draft.Status)
+	}
+	if err := validateDefinition(&def); err != nil {
+		return nil, err
+	}
+
+	draft.PolicyDefinition = def
+	draft.Note = note
+	draft.Status = DraftStatusDraft
+	draft.EditedAt = time.Now()
+	if err := s.db.Save(draft).Error; err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// SubmitDraft envia para revisão
+func (s *PolicyService) SubmitDraft(id uuid.UUID) (*PolicyDraft, error) {
+	return s.transitionDraft(id, []string{DraftStatusDraft}, map[string]any{"status": DraftStatusInReview})
+}
+
+// ReviewDraft aprova ou rejeita (revisor diferente do autor)
+func (s *PolicyService) ReviewDraft(id uuid.UUID, approve bool, reviewer uuid.UUID, note string) (*PolicyDraft, error) {
+	draft, err := s.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if reviewer == uuid.Nil {
+		return nil, ErrReviewerRequired
+	}
+	if reviewer == draft.CreatedBy {
+		return nil, ErrSelfReview
+	}
+
+	// Aprovar exige o relatório de impacto da definição atual: o revisor decide vendo-o
+	status := DraftStatusRejected
+	if approve {
+		if !draft.impactUpToDate() {
+			return nil, ErrDraftNeedsImpact
+		}
+		status = DraftStatusApproved
+	}
+	now := time.Now()
+	return s.transitionDraft(id, []string{DraftStatusInReview}, map[string]any{
+		"status":      status,
+		"reviewed_by": reviewer,
+		"review_note": note,
+		"reviewed_at": now,
+	})
+}
+
+// impactUpToDate relatório de impacto gerado depois da última edição
+func (d *PolicyDraft) impactUpToDate() bool {
+	return d.ImpactCheckedAt != nil && !d.ImpactCheckedAt.Before(d.EditedAt)
+}
+
+// DiscardDraft abandona um rascunho não publicado
+func (s *PolicyService) DiscardDraft(id uuid.UUID) (*PolicyDraft, error) {
+	return s.transitionDraft(id, []string{DraftStatusDraft, DraftStatusInReview, DraftStatusApproved, DraftStatusRejected},
+		map[string]any{"status": DraftStatusDiscarded})
+}
+
+func (s *PolicyService) transitionDraft(id uuid.UUID, from []string, updates map[string]any) (*PolicyDraft, error) {
+	draft, err := s.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, status := range from {
+		allowed = allowed || draft.Status == status
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: rascunho em %s", ErrInvalidDraftState, draft.Status)
+	}
+	if err := s.db.Model(draft).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return s.GetDraft(id)
+}
+
+// PublishDraft publica um rascunho aprovado como nova versão imutável
+func (s *PolicyService) PublishDraft(id uuid.UUID, publishedBy uuid.UUID) (*Policy, error) {
+	draft, err := s.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != DraftStatusApproved {
+		return nil, fmt.Errorf("%w: só rascunhos aprovados são publicados (atual: %s)", ErrInvalidDraftState, draft.Status)
+	}
+	if !draft.impactUpToDate() {
+		return nil, ErrDraftNeedsImpact
+	}
+	run, err := s.RunPolicyTests(nil, &draft.ID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Failed > 0 {
+		return nil, fmt.Errorf("%w: %d de %d casos falharam com o rascunho", ErrPolicyTestsFailed, run.Failed, run.Total)
+	}
+
+	var published Policy
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if draft.PolicyID == nil {
+			published = draft.PolicyDefinition.toPolicy()
+			published.ID = uuid.New()
+			published.Version = 1
+			published.CreatedBy = draft.CreatedBy
+			published.CreatedAt = now
+			published.UpdatedAt = now
+			if err := tx.Create(&published).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := tx.Where("id = ?", *draft.PolicyID).First(&published).Error; err != nil {
+				return err
+			}
+			if published.Version != draft.BaseVersion {
+				return fmt.Errorf("%w: versão publicada %d, rascunho baseado na %d", ErrDraftConflict, published.Version, draft.BaseVersion)
+			}
+			if err := ensureBaselinePolicyVersion(tx, &published); err != nil {
+				return err
+			}
+			updates := draft.PolicyDefinition.columns()
+			updates["version"] = published.Version + 1
+			updates["updated_at"] = now
+			if err := tx.Model(&published).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id = ?", published.ID).First(&published).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := recordPolicyVersion(tx, &published, publishedBy, &draft.ID); err != nil {
+			return err
+		}
+		// Casos do rascunho passam a ser da política
+		if err := tx.Model(&PolicyTestCase{}).Where("draft_id = ?", draft.ID).
+			Updates(map[string]any{"policy_id": published.ID, "draft_id": nil}).Error; err != nil {
+			return err
+		}
+		return tx.Model(draft).Updates(map[string]any{
+			"status":            DraftStatusPublished,
+			"policy_id":         published.ID,
+			"published_version": published.Version,
+			"published_by":      publishedBy,
+			"published_at":      now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.policiesChanged()
+	return &published, nil
+}
+
+// ========================================
+// ANÁLISE DE IMPACTO
+// ========================================
+
+// AnalyzeDraftImpact reexecuta as últimas avaliações (Context gravado) com as
+// políticas publicadas e com o rascunho, listando decisões que mudariam.
+// Só antes da aprovação: o relatório é insumo da revisão.
+func (s *PolicyService) AnalyzeDraftImpact(id uuid.UUID, limit int) (*ImpactReport, error) {
+	draft, err := s.GetDraft(id)
+	if err != nil {
+		return nil, err
+	}
+	if draft.Status != DraftStatusDraft && draft.Status != DraftStatusInReview {
+		return nil, fmt.Errorf("%w: impacto é analisado antes da revisão (atual: %s)", ErrInvalidDraftState, draft.Status)
+	}
+	if limit <= 0 {
+		limit = DefaultImpactSample
+	}
+	if limit > MaxImpactSample {
+		limit = MaxImpactSample
+	}
+
+	// Avaliações afetáveis: recurso/ação do rascunho e da versão publicada
+	resources := []string{draft.Resource}
+	actions := []string{draft.Action}
+	if draft.PolicyID != nil {
+		if existing, err := s.GetPolicy(*draft.PolicyID); err == nil {
+			resources = append(resources, existing.Resource)
+			actions = append(actions, existing.Action)
+		}
+	}
+	query := s.db.Order("evaluated_at DESC").Limit(limit)
+	if !containsString(resources, ResourceAll) {
+		query = query.Where("resource IN ?", resources)
+	}
+	if !containsString(actions, ActionAll) {
+		query = query.Where("action IN ?", actions)
+	}
+	var evals []PolicyEvaluation
+	if err := query.Find(&evals).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ImpactReport{
+		DraftID:     draft.ID,
+		PolicyID:    draft.PolicyID,
+		Replayed:    len(evals),
+		Transitions: make(map[string]int),
+		Flips:       []DecisionFlip{},
+		Actors:      []ActorImpact{},
+		GeneratedAt: time.Now(),
+	}
+
+	livePolicies := make(map[string][]Policy) // Cache por recurso/ação/camadas
+	configs := make(map[string]ResourcePolicyConfig)
+	actors := make(map[uuid.UUID]*ActorImpact)
+
+	for _, eval := range evals {
+		req := EvaluationRequest{
+			Resource:  eval.Resource,
+			Action:    eval.Action,
+			Context:   map[string]any(eval.Context),
+			ActorID:   eval.ActorID,
+			ActorType: eval.ActorType,
+		}
+		tenantID, appID := s.resolveScope(req.Context)
+
+		key := fmt.Sprintf("%s|%s|%v|%v", req.Resource, req.Action, tenantID, appID)
+		live, cached := livePolicies[key]
+		if !cached {
+			if live, err = s.ListPoliciesForScope(req.Resource, req.Action, tenantID, appID); err != nil {
+				return nil, err
+			}
+			livePolicies[key] = live
+		}
+		config, cached := configs[req.Resource]
+		if !cached {
+			config = s.GetResourceConfig(req.Resource)
+			configs[req.Resource] = config
+		}
+
+		before := s.decide(req, live, config)
+		after := s.decide(req, draft.candidatePolicies(live, req.Resource, req.Action, tenantID, appID), config)
+		if before.result == after.result {
+			continue
+		}
+
+		flip := DecisionFlip{
+			EvaluationID: eval.ID,
+			EvaluatedAt:  eval.EvaluatedAt,
+			ActorID:      eval.ActorID,
+			ActorType:    eval.ActorType,
+			Resource:     eval.Resource,
+			Action:       eval.Action,
+			Recorded:     eval.Result,
+			Before:       before.result,
+			After:        after.result,
+		}
+		if before.decisive != nil {
+			flip.BeforePolicy = before.decisive.Name
+		}
+		if after.decisive != nil {
+			flip.AfterPolicy = after.decisive.Name
+		}
+		report.Flips = append(report.Flips, flip)
+
+		transition := before.result + "→" + after.result
+		report.Transitions[transition]++
+		actor, ok := actors[eval.ActorID]
+		if !ok {
+			actor = &ActorImpact{ActorID: eval.ActorID, ActorType: eval.ActorType, Transitions: make(map[string]int)}
+			actors[eval.ActorID] = actor
+		}
+		actor.Flipped++
+		actor.Transitions[transition]++
+	}
+
+	report.Flipped = len(report.Flips)
+	for _, actor := range actors {
+		report.Actors = append(report.Actors, *actor)
+	}
+	sort.Slice(report.Actors, func(i, j int) bool {
+		return report.Actors[i].Flipped > report.Actors[j].Flipped
+	})
+
+	// Registrar no rascunho (sem tocar EditedAt), se ainda não foi revisado
+	now := report.GeneratedAt
+	s.db.Model(&PolicyDraft{}).Where("id = ? AND status IN ?", draft.ID, []string{DraftStatusDraft, DraftStatusInReview}).
+		UpdateColumns(map[string]any{
+			"impact_checked_at": now,
+			"impact_replayed":   report.Replayed,
+			"impact_flipped":    report.Flipped,
+		})
+
+	return report, nil
+}
+
+// candidatePolicies conjunto publicado com o rascunho no lugar da versão atual
+func (d *PolicyDraft) candidatePolicies(live []Policy, resource, action string, tenantID, appID *uuid.UUID) []Policy {
+	candidate := make([]Policy, 0, len(live)+1)
+	for _, policy := range live {
+		if d.PolicyID != nil && policy.ID == *d.PolicyID {
+			continue
+		}
+		candidate = append(candidate, policy)
+	}
+	if !d.Active || !d.applies(resource, action, tenantID, appID) {
+		return candidate
+	}
+
+	policy := d.PolicyDefinition.toPolicy()
+	policy.ID = d.ID
+	if d.PolicyID != nil {
+		policy.ID = *d.PolicyID
+	}
+	// Mesma ordem de ListPoliciesForScope (prioridade DESC)
+	at := sort.Search(len(candidate), func(i int) bool { return candidate[i].Priority < policy.Priority })
+	candidate = append(candidate, Policy{})
+	copy(candidate[at+1:], candidate[at:])
+	candidate[at] = policy
+	return candidate
+}
+
+// applies indica se o rascunho valeria para a requisição
+func (d *PolicyDraft) applies(resource, action string, tenantID, appID *uuid.UUID) bool {
+	if d.Resource != resource && d.Resource != ResourceAll {
+		return false
+	}
+	if d.Action != action && d.Action != ActionAll {
+		return false
+	}
+	switch d.Scope {
+	case ScopeTenant:
+		return tenantID != nil && *tenantID == d.ScopeID
+	case ScopeApp:
+		return appID != nil && *appID == d.ScopeID
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
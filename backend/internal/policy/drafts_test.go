@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Rascunhos e análise de impacto
+// ========================================
+
+func TestDraftImpactAndPublish(t *testing.T) {
+	s := newTestPolicyService(t)
+	author, reviewer := uuid.New(), uuid.New()
+
+	live := &Policy{Name: "débito alto", Resource: ResourceLedger, Action: ActionDebit, Effect: EffectRequireApproval, Active: true,
+		Conditions: ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 1000.0}}}
+	if err := s.CreatePolicy(live); err != nil {
+		t.Fatal(err)
+	}
+
+	// Histórico: dois atores, valores variados
+	alice, bob := uuid.New(), uuid.New()
+	for _, call := range []struct {
+		actor  uuid.UUID
+		amount float64
+	}{{alice, 200}, {alice, 700}, {bob, 800}, {bob, 5000}} {
+		s.Evaluate(EvaluationRequest{Resource: ResourceLedger, Action: ActionDebit, ActorID: call.actor, ActorType: "user",
+			Context: map[string]any{"amount": call.amount}})
+	}
+
+	def := policyDefinitionOf(live)
+	def.Conditions = ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 500.0}}
+	draft, err := s.CreateDraft(&live.ID, def, "limite menor", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.AnalyzeDraftImpact(draft.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Replayed != 4 || report.Flipped != 2 || report.Transitions["allowed→pending_approval"] != 2 || len(report.Actors) != 2 {
+		t.Fatalf("impacto inesperado: %+v", report)
+	}
+
+	if _, err := s.SubmitDraft(draft.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReviewDraft(draft.ID, true, author, ""); !errors.Is(err, ErrSelfReview) {
+		t.Errorf("autor não deveria revisar: %v", err)
+	}
+	if _, err := s.ReviewDraft(draft.ID, true, uuid.Nil, ""); !errors.Is(err, ErrReviewerRequired) {
+		t.Errorf("revisão sem usuário deveria ser recusada: %v", err)
+	}
+	if _, err := s.ReviewDraft(draft.ID, true, reviewer, "ok"); err != nil {
+		t.Fatal(err)
+	}
+
+	published, err := s.PublishDraft(draft.ID, reviewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.Version != 2 || published.Conditions[0].Value != 500.0 {
+		t.Errorf("publicação inesperada: %+v", published)
+	}
+	versions, _ := s.GetPolicyVersions(live.ID)
+	if len(versions) != 2 || versions[1].Conditions[0].Value != 1000.0 || versions[0].DraftID == nil {
+		t.Errorf("versões imutáveis esperadas: %+v", versions)
+	}
+
+	// Rascunho baseado na versão 1 não pode mais ser publicado
+	stale, _ := s.CreateDraft(&live.ID, def, "", author)
+	stale.BaseVersion = 1
+	s.db.Save(stale)
+	s.AnalyzeDraftImpact(stale.ID, 10)
+	s.SubmitDraft(stale.ID)
+	s.ReviewDraft(stale.ID, true, reviewer, "")
+	if _, err := s.PublishDraft(stale.ID, reviewer); !errors.Is(err, ErrDraftConflict) {
+		t.Errorf("conflito de versão esperado: %v", err)
+	}
+}
+
+func TestDeactivationGoesThroughReviewedDraft(t *testing.T) {
+	s := newTestPolicyService(t)
+	author, reviewer := uuid.New(), uuid.New()
+
+	live := &Policy{Name: "bloqueio ads", Resource: ResourceAds, Action: ActionAll, Effect: EffectDeny, Active: true}
+	if err := s.CreatePolicy(live); err != nil {
+		t.Fatal(err)
+	}
+
+	// DELETE só propõe: a política segue ativa até a publicação
+	draft, err := s.DeactivatePolicy(live.ID, "", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := s.GetPolicy(live.ID); !current.Active {
+		t.Fatal("desativação não deveria valer antes da publicação")
+	}
+
+	// Aprovar exige o relatório de impacto; depois da aprovação não há nova análise
+	s.SubmitDraft(draft.ID)
+	if _, err := s.ReviewDraft(draft.ID, true, reviewer, ""); !errors.Is(err, ErrDraftNeedsImpact) {
+		t.Fatalf("aprovação sem impacto deveria ser recusada: %v", err)
+	}
+	if _, err := s.AnalyzeDraftImpact(draft.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReviewDraft(draft.ID, true, reviewer, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AnalyzeDraftImpact(draft.ID, 0); !errors.Is(err, ErrInvalidDraftState) {
+		t.Errorf("impacto após aprovação deveria ser recusado: %v", err)
+	}
+
+	published, err := s.PublishDraft(draft.ID, reviewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.Active || published.Version != 2 {
+		t.Errorf("publicação deveria desativar em nova versão: %+v", published)
+	}
+	if versions, _ := s.GetPolicyVersions(live.ID); len(versions) != 2 || versions[0].PublishedBy != reviewer {
+		t.Errorf("versão da desativação deveria registrar quem publicou: %+v", versions)
+	}
+}
+
+func TestResourceConfigChangesAreVersioned(t *testing.T) {
+	s := newTestPolicyService(t)
+	admin := uuid.New()
+
+	if _, err := s.SetResourceConfig(ResourceAds, CombineFirstApplicable, EffectAllow, admin); err != nil {
+		t.Fatal(err)
+	}
+	config, err := s.SetResourceConfig(ResourceAds, CombineDenyOverrides, EffectDeny, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Version != 2 {
+		t.Errorf("versão esperada 2, obtida %d", config.Version)
+	}
+	if err := s.DeleteResourceConfig(ResourceAds, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := s.GetResourceConfigVersions(ResourceAds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || !versions[0].Removed || versions[0].ChangedBy != admin || versions[1].DefaultEffect != EffectDeny {
+		t.Errorf("histórico inesperado: %+v", versions)
+	}
+}
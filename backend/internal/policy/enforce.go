@@ -0,0 +1,403 @@
+package policy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+	"prost-qs/backend/internal/application"
+	"prost-qs/backend/internal/approval"
+	"prost-qs/backend/internal/authority"
+	"prost-qs/backend/pkg/middleware"
+)
+
+// ========================================
+// ENFORCE MIDDLEWARE - Política declarativa nas rotas
+// "A rota declara o que é; a política decide se pode"
+// ========================================
+
+const (
+	// EnforcedEvaluationKey resultado da avaliação disponível para o handler
+	EnforcedEvaluationKey = "policyEvaluation"
+
+	// ApprovalRequestHeader ID da ApprovalRequest aprovada, enviado ao repetir a requisição
+	ApprovalRequestHeader = "X-Approval-Request-ID"
+
+	// EnforceMaxBodyBytes teto do body lido para o contexto (acima disso: 413).
+	// Rotas com uploads maiores não devem usar Enforce com body.
+	EnforceMaxBodyBytes = 1 << 20 // 1 MiB
+
+	approvalMetadataContextHash = "context_hash"
+)
+
+var (
+	ErrEnforceBodyTooLarge = errors.New("request body too large")
+	ErrApprovalNotGranted  = errors.New("approval request not approved")
+	ErrApprovalMismatch    = errors.New("approval request does not match this request")
+	ErrApprovalAlreadyUsed = errors.New("approval request already used")
+)
+
+// ApprovalConsumption uso único de uma aprovação no Enforce.
+// A ApprovalRequest é imutável; o consumo fica registrado aqui (PK = uma vez só).
+type ApprovalConsumption struct {
+	ApprovalRequestID uuid.UUID `gorm:"type:uuid;primaryKey" json:"approval_request_id"`
+	EvaluationID      string    `gorm:"size:36" json:"evaluation_id"` // Avaliação da requisição liberada
+	ConsumedBy        uuid.UUID `gorm:"type:uuid" json:"consumed_by"`
+	ConsumedAt        time.Time `json:"consumed_at"`
+}
+
+func (ApprovalConsumption) TableName() string {
+	return "policy_approval_consumptions"
+}
+
+// ContextBuilder completa o contexto de avaliação.
+// Recebe o contexto base (user, app, params, body) e pode promover ou derivar campos.
+type ContextBuilder func(c *gin.Context, ctx map[string]any) error
+
+var enforcement struct {
+	mu        sync.RWMutex
+	service   *PolicyService
+	approvals *approval.ApprovalService
+}
+
+// ConfigureEnforcement define os serviços usados por Enforce
+func ConfigureEnforcement(service *PolicyService, approvals *approval.ApprovalService) {
+	enforcement.mu.Lock()
+	defer enforcement.mu.Unlock()
+	enforcement.service = service
+	enforcement.approvals = approvals
+}
+
+// Enforce middleware que avalia resource/action antes do handler.
+//   - deny             → 403 com o motivo da política
+//   - require_approval → 202 com uma ApprovalRequest criada automaticamente;
+//     repetida com ApprovalRequestHeader aprovado (mesmo contexto, uso único) → segue
+//   - allow            → segue; o resultado fica em EnforcedEvaluationKey
+//
+// Campos do body ficam em "body" (não no topo) para o cliente não forjar
+// campos avaliados; use FromBody para promover os confiáveis.
+func Enforce(resource, action string, contextBuilder ContextBuilder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enforcement.mu.RLock()
+		service, approvals := enforcement.service, enforcement.approvals
+		enforcement.mu.RUnlock()
+		if service == nil {
+			// Sem motor de políticas não há como decidir: falha fechada
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Motor de políticas indisponível"})
+			c.Abort()
+			return
+		}
+
+		ctx, err := buildEnforcementContext(c)
+		if errors.Is(err, ErrEnforceBodyTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Body excede %d bytes", EnforceMaxBodyBytes)})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if contextBuilder != nil {
+			if err := contextBuilder(c, ctx); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		actorID, _ := uuid.Parse(c.GetString(middleware.ContextUserIDKey))
+		result, err := service.Evaluate(EvaluationRequest{
+			Resource:  resource,
+			Action:    action,
+			Context:   ctx,
+			ActorID:   actorID,
+			ActorType: "user",
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao avaliar política"})
+			c.Abort()
+			return
+		}
+
+		switch {
+		case result.Result == ResultPendingApproval && c.GetHeader(ApprovalRequestHeader) != "":
+			// Repetição com aprovação: só passa se aprovada para esta mesma requisição e ainda não usada
+			if err := service.consumeApproval(c.GetHeader(ApprovalRequestHeader), resource, action, ctx, actorID, result); err != nil {
+				status := http.StatusForbidden
+				if errors.Is(err, ErrApprovalAlreadyUsed) {
+					status = http.StatusConflict
+				}
+				c.JSON(status, gin.H{"error": err.Error(), "evaluation_id": result.EvaluationID})
+				c.Abort()
+				return
+			}
+			c.Set(EnforcedEvaluationKey, result)
+			c.Next()
+		case result.Result == ResultPendingApproval:
+			respondPendingApproval(c, approvals, resource, action, ctx, actorID, result)
+			c.Abort()
+		case !result.Allowed:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":         "Bloqueado por política",
+				"reason":        result.Reason,
+				"policy_name":   result.PolicyName,
+				"evaluation_id": result.EvaluationID,
+			})
+			c.Abort()
+		default:
+			c.Set(EnforcedEvaluationKey, result)
+			c.Next()
+		}
+	}
+}
+
+// respondPendingApproval abre a ApprovalRequest e responde 202
+func respondPendingApproval(c *gin.Context, approvals *approval.ApprovalService, resource, action string, ctx map[string]any, actorID uuid.UUID, result *EvaluationResponse) {
+	if approvals == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ação requer aprovação, mas o fluxo de aprovação não está configurado"})
+		return
+	}
+
+	metadata := result.ApprovalMetadata()
+	metadata["route"] = c.FullPath()
+	metadata["method"] = c.Request.Method
+	metadata[approvalMetadataContextHash] = enforcementContextHash(resource, action, ctx)
+	if appID, ok := ctx["app_id"]; ok {
+		metadata["app_id"] = appID
+	}
+	if params, ok := ctx["params"]; ok {
+		metadata["params"] = params
+	}
+
+	amount, _ := ctx["amount"].(float64)
+	riskLevel, _ := ctx["risk_level"].(string)
+	req, err := approvals.CreateRequest(approval.CreateApprovalRequest{
+		Domain: resource,
+		Action: action,
+		Impact: impactForRiskLevel(riskLevel),
+		Amount: int64(amount),
+		Context: approval.ApprovalContext{
+			Intent:      fmt.Sprintf("%s %s", c.Request.Method, c.FullPath()),
+			Description: result.Reason,
+			Metadata:    metadata,
+		},
+		RequestedBy:     actorID,
+		RequestedByType: "user",
+		RequestReason:   result.Reason,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar solicitação de aprovação"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":             fmt.Sprintf("Ação requer aprovação humana; após aprovada, repita a requisição com %s", ApprovalRequestHeader),
+		"reason":              result.Reason,
+		"policy_name":         result.PolicyName,
+		"evaluation_id":       result.EvaluationID,
+		"approval_request_id": req.ID,
+		"expires_at":          req.ExpiresAt,
+	})
+}
+
+// consumeApproval valida a aprovação enviada na repetição e a marca como usada.
+// Exige: aprovada, mesmo recurso/ação e mesmo contexto (hash) da requisição original.
+func (s *PolicyService) consumeApproval(rawID, resource, action string, ctx map[string]any, actorID uuid.UUID, result *EvaluationResponse) error {
+	requestID, err := uuid.Parse(rawID)
+	if err != nil {
+		return ErrApprovalMismatch
+	}
+	var req approval.ApprovalRequest
+	if err := s.db.Where("id = ?", requestID).First(&req).Error; err != nil {
+		return ErrApprovalMismatch
+	}
+	if req.Status != approval.StatusApproved {
+		return ErrApprovalNotGranted
+	}
+	hash, _ := req.Context.Metadata[approvalMetadataContextHash].(string)
+	if req.Domain != resource || req.Action != action || hash != enforcementContextHash(resource, action, ctx) {
+		return ErrApprovalMismatch
+	}
+
+	consumption := ApprovalConsumption{ApprovalRequestID: requestID, ConsumedBy: actorID, ConsumedAt: time.Now()}
+	if result.EvaluationID != nil {
+		consumption.EvaluationID = *result.EvaluationID
+	}
+	// Réplicas concorrentes: só quem insere a linha usa a aprovação
+	claim := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&consumption)
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected != 1 {
+		return ErrApprovalAlreadyUsed
+	}
+	return nil
+}
+
+// enforcementContextHash identifica a requisição aprovada (session_id fica de fora: muda entre tentativas)
+func enforcementContextHash(resource, action string, ctx map[string]any) string {
+	stable := make(map[string]any, len(ctx)+2)
+	for key, value := range ctx {
+		if key != "session_id" {
+			stable[key] = value
+		}
+	}
+	stable["resource"], stable["action"] = resource, action
+	raw, _ := json.Marshal(stable) // Chaves de map saem ordenadas
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func impactForRiskLevel(level string) authority.ImpactLevel {
+	switch level {
+	case "low":
+		return authority.ImpactLow
+	case "high":
+		return authority.ImpactHigh
+	case "critical":
+		return authority.ImpactCritical
+	}
+	return authority.ImpactMedium
+}
+
+// ========================================
+// CONTEXTO BASE
+// ========================================
+
+// buildEnforcementContext claims do JWT, app, params da rota e body JSON
+func buildEnforcementContext(c *gin.Context) (map[string]any, error) {
+	ctx := map[string]any{}
+
+	// Body JSON (restaurado para o handler), limitado a EnforceMaxBodyBytes
+	if c.Request.Body != nil && c.Request.ContentLength != 0 {
+		raw, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, EnforceMaxBodyBytes))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, ErrEnforceBodyTooLarge
+		}
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler body: %w", err)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		if len(bytes.TrimSpace(raw)) > 0 {
+			var body map[string]any
+			if err := json.Unmarshal(raw, &body); err == nil {
+				ctx["body"] = body
+			}
+		}
+	}
+
+	if len(c.Params) > 0 {
+		params := make(map[string]any, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		ctx["params"] = params
+	}
+
+	// Claims do JWT
+	if userID := c.GetString(middleware.ContextUserIDKey); userID != "" {
+		ctx["user"] = map[string]any{
+			"id":             userID,
+			"role":           c.GetString(middleware.ContextUserRoleKey),
+			"account_status": c.GetString(middleware.ContextAccountStatusKey),
+		}
+	}
+
+	// App: só do RequestContext da credencial validada (AppContextMiddleware).
+	// O X-App-ID (middleware.ContextAppIDKey) é escolhido pelo cliente e
+	// selecionaria as políticas da camada app; sem credencial, valem apenas
+	// as camadas global/tenant.
+	if value, ok := c.Get(application.RequestContextKey); ok {
+		if reqCtx, ok := value.(*application.RequestContext); ok && reqCtx.App != nil {
+			app := reqCtx.App
+			ctx["app_id"] = app.ID.String()
+			ctx["app"] = map[string]any{"id": app.ID.String(), "name": app.Name, "owner_id": app.OwnerID.String()}
+			ctx["app_scopes"] = reqCtx.Scopes
+		}
+	}
+	if appUserID := c.GetString(middleware.ContextAppUserIDKey); appUserID != "" {
+		ctx["app_user_id"] = appUserID
+	}
+	if sessionID := c.GetString(middleware.ContextSessionIDKey); sessionID != "" {
+		ctx["session_id"] = sessionID
+	}
+	return ctx, nil
+}
+
+// ========================================
+// BUILDERS
+// ========================================
+
+// FromBody promove campos do body para o topo do contexto (ex.: "amount")
+func FromBody(fields ...string) ContextBuilder {
+	return func(c *gin.Context, ctx map[string]any) error {
+		body, _ := ctx["body"].(map[string]any)
+		for _, field := range fields {
+			if value, ok := body[field]; ok {
+				ctx[field] = value
+			}
+		}
+		return nil
+	}
+}
+
+// FromBodyCents promove valores monetários do body (unidades da moeda, ex.: 1500.50)
+// em centavos, a unidade das políticas de pagamento (ex.: 150050)
+func FromBodyCents(fields ...string) ContextBuilder {
+	return func(c *gin.Context, ctx map[string]any) error {
+		body, _ := ctx["body"].(map[string]any)
+		for _, field := range fields {
+			value, ok := body[field]
+			if !ok {
+				continue
+			}
+			amount, ok := value.(float64)
+			if !ok {
+				return fmt.Errorf("%s deve ser numérico", field)
+			}
+			ctx[field] = math.Round(amount * 100)
+		}
+		return nil
+	}
+}
+
+// FromParams promove params da rota para o topo do contexto
+func FromParams(params ...string) ContextBuilder {
+	return func(c *gin.Context, ctx map[string]any) error {
+		for _, param := range params {
+			if value := c.Param(param); value != "" {
+				ctx[param] = value
+			}
+		}
+		return nil
+	}
+}
+
+// Builders combina vários ContextBuilder em ordem
+func Builders(builders ...ContextBuilder) ContextBuilder {
+	return func(c *gin.Context, ctx map[string]any) error {
+		for _, build := range builders {
+			if build == nil {
+				continue
+			}
+			if err := build(c, ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"prost-qs/backend/internal/application"
+	"prost-qs/backend/internal/approval"
+	"prost-qs/backend/internal/audit"
+	"prost-qs/backend/internal/authority"
+	"prost-qs/backend/internal/payment"
+	"prost-qs/backend/pkg/middleware"
+)
+
+// newTestEnforcement serviço com fluxo de aprovação configurado para Enforce
+func newTestEnforcement(t *testing.T) *PolicyService {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := newTestPolicyService(t)
+	if err := s.db.AutoMigrate(&approval.ApprovalRequest{}, &authority.DecisionAuthority{}, &audit.AuditEvent{}, &ApprovalConsumption{}); err != nil {
+		t.Fatal(err)
+	}
+	ConfigureEnforcement(s, approval.NewApprovalService(s.db, authority.NewAuthorityService(s.db), audit.NewAuditService(s.db)))
+	t.Cleanup(func() { ConfigureEnforcement(nil, nil) })
+	return s
+}
+
+// ========================================
+// TESTES - Middleware Enforce
+// ========================================
+
+func TestEnforceMapsDecisionsToResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestPolicyService(t)
+	if err := s.db.AutoMigrate(&approval.ApprovalRequest{}, &authority.DecisionAuthority{}, &audit.AuditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	ConfigureEnforcement(s, approval.NewApprovalService(s.db, authority.NewAuthorityService(s.db), audit.NewAuditService(s.db)))
+	defer ConfigureEnforcement(nil, nil)
+
+	s.CreatePolicy(&Policy{Name: "bloqueio suspensos", Resource: ResourcePayment, Action: "create", Effect: EffectDeny, Priority: 100, Active: true,
+		Reason: "Conta em revisão", Conditions: ConditionList{{Field: "user.role", Operator: OpEqual, Value: "restricted"}}})
+	s.CreatePolicy(&Policy{Name: "pagamento alto", Resource: ResourcePayment, Action: "create", Effect: EffectRequireApproval, Priority: 50, Active: true,
+		Conditions: ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 1000.0}}})
+
+	router := gin.New()
+	router.POST("/wallets/:walletId/pay", func(c *gin.Context) {
+		c.Set(middleware.ContextUserIDKey, "7b0e7b4e-1f7e-4c56-9a55-9d1c1f3c0a11")
+		c.Set("userRole", c.GetHeader("X-Role"))
+	}, Enforce(ResourcePayment, "create", FromBody("amount")), func(c *gin.Context) {
+		var body map[string]any
+		c.ShouldBindJSON(&body) // body restaurado pelo middleware
+		c.JSON(http.StatusOK, body)
+	})
+
+	call := func(role, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/wallets/w1/pay", strings.NewReader(body))
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call("user", `{"amount": 50}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"amount":50`) {
+		t.Fatalf("valor baixo deveria passar com body intacto: %d %s", w.Code, w.Body)
+	}
+
+	// Body não forja claims do JWT
+	if w := call("restricted", `{"amount": 50, "user": {"role": "admin"}}`); w.Code != http.StatusForbidden ||
+		!strings.Contains(w.Body.String(), "Conta em revisão") {
+		t.Fatalf("deny deveria virar 403 com o motivo: %d %s", w.Code, w.Body)
+	}
+
+	w := call("user", `{"amount": 5000}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("require_approval deveria virar 202: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ApprovalRequestID string `json:"approval_request_id"`
+		EvaluationID      string `json:"evaluation_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	var req approval.ApprovalRequest
+	if err := s.db.Where("id = ?", resp.ApprovalRequestID).First(&req).Error; err != nil {
+		t.Fatalf("aprovação deveria ser criada: %v", err)
+	}
+	if req.Amount != 5000 || req.Context.Metadata[ApprovalMetadataEvaluationID] != resp.EvaluationID {
+		t.Errorf("aprovação deveria apontar para a avaliação: %+v", req)
+	}
+}
+
+func TestEnforceIgnoresClientAppHeader(t *testing.T) {
+	s := newTestEnforcement(t)
+	appID := uuid.New()
+	s.CreatePolicy(&Policy{Name: "app bloqueia", Scope: ScopeApp, ScopeID: appID, Resource: ResourcePayment, Action: "create",
+		Effect: EffectDeny, Priority: 100, Active: true, Conditions: ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 10.0}}})
+
+	router := gin.New()
+	router.POST("/pay", func(c *gin.Context) {
+		c.Set(middleware.ContextAppIDKey, c.GetHeader("X-App-ID")) // Header informativo (AuthMiddleware)
+		c.Set("app_id", c.GetHeader("X-App-ID"))                   // Chave solta: não é a credencial
+		if c.GetHeader("X-Credential") == "ok" {
+			c.Set(application.RequestContextKey, &application.RequestContext{App: &application.Application{ID: appID}})
+		}
+	}, Enforce(ResourcePayment, "create", FromBody("amount")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	call := func(credential bool) int {
+		req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(`{"amount": 50}`))
+		req.Header.Set("X-App-ID", appID.String())
+		if credential {
+			req.Header.Set("X-Credential", "ok")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Só o header: camada app não é selecionada
+	if code := call(false); code != http.StatusOK {
+		t.Errorf("X-App-ID sem credencial não deveria aplicar políticas do app: %d", code)
+	}
+	if code := call(true); code != http.StatusForbidden {
+		t.Errorf("credencial validada deveria aplicar políticas do app: %d", code)
+	}
+}
+
+func TestEnforceApprovalRetryIsSingleUse(t *testing.T) {
+	s := newTestEnforcement(t)
+	s.CreatePolicy(&Policy{Name: "pagamento alto", Resource: ResourcePayment, Action: "create", Effect: EffectRequireApproval, Active: true,
+		Conditions: ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 1000.0}}})
+
+	executed := 0
+	router := gin.New()
+	router.POST("/pay", func(c *gin.Context) {
+		c.Set(middleware.ContextUserIDKey, "7b0e7b4e-1f7e-4c56-9a55-9d1c1f3c0a11")
+	}, Enforce(ResourcePayment, "create", FromBody("amount")), func(c *gin.Context) {
+		executed++
+		c.Status(http.StatusOK)
+	})
+
+	call := func(body, approvalID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(body))
+		if approvalID != "" {
+			req.Header.Set(ApprovalRequestHeader, approvalID)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(`{"amount": 5000}`, "")
+	var resp struct {
+		ApprovalRequestID string `json:"approval_request_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusAccepted || resp.ApprovalRequestID == "" {
+		t.Fatalf("deveria pedir aprovação: %d %s", w.Code, w.Body)
+	}
+
+	// Ainda pendente
+	if w := call(`{"amount": 5000}`, resp.ApprovalRequestID); w.Code != http.StatusForbidden {
+		t.Fatalf("aprovação pendente não deveria liberar: %d %s", w.Code, w.Body)
+	}
+
+	s.db.Model(&approval.ApprovalRequest{}).Where("id = ?", resp.ApprovalRequestID).Update("status", approval.StatusApproved)
+
+	// Outro valor não é a requisição aprovada
+	if w := call(`{"amount": 9000}`, resp.ApprovalRequestID); w.Code != http.StatusForbidden {
+		t.Fatalf("contexto diferente não deveria usar a aprovação: %d %s", w.Code, w.Body)
+	}
+	if w := call(`{"amount": 5000}`, resp.ApprovalRequestID); w.Code != http.StatusOK {
+		t.Fatalf("aprovação deveria liberar a repetição: %d %s", w.Code, w.Body)
+	}
+	if w := call(`{"amount": 5000}`, resp.ApprovalRequestID); w.Code != http.StatusConflict {
+		t.Fatalf("aprovação já usada deveria ser recusada: %d %s", w.Code, w.Body)
+	}
+	if executed != 1 {
+		t.Errorf("handler deveria executar uma vez, executou %d", executed)
+	}
+}
+
+func TestEnforceRejectsOversizedBody(t *testing.T) {
+	newTestEnforcement(t)
+	router := gin.New()
+	router.POST("/pay", Enforce(ResourcePayment, "create", nil), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	body := `{"note": "` + strings.Repeat("x", EnforceMaxBodyBytes) + `"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pay", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("body acima do teto deveria ser 413: %d", w.Code)
+	}
+}
+
+func TestEnforcePaymentInitiateAmountInCents(t *testing.T) {
+	s := newTestEnforcement(t)
+	if err := s.SeedDefaultPolicies(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mesmos builders da rota /payments/initiate (cmd/api)
+	router := gin.New()
+	router.POST("/payments/initiate", func(c *gin.Context) {
+		c.Set(middleware.ContextUserIDKey, "7b0e7b4e-1f7e-4c56-9a55-9d1c1f3c0a11")
+		c.Set("userRole", "user")
+	}, Enforce(ResourcePayment, "create", Builders(FromBody("currency"), FromBodyCents("amount"))), func(c *gin.Context) {
+		var req payment.InitiatePaymentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	})
+
+	call := func(amount string) *httptest.ResponseRecorder {
+		body := `{"userId": "7b0e7b4e-1f7e-4c56-9a55-9d1c1f3c0a11", "amount": ` + amount + `, "currency": "BRL", "paymentMethod": "pix"}`
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/payments/initiate", strings.NewReader(body)))
+		return w
+	}
+
+	// R$ 1500,00 passa do limite de R$ 1000 (100000 centavos)
+	w := call("1500.00")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("R$ 1500 deveria exigir aprovação: %d %s", w.Code, w.Body)
+	}
+	var resp struct {
+		ApprovalRequestID string `json:"approval_request_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	var req approval.ApprovalRequest
+	s.db.Where("id = ?", resp.ApprovalRequestID).First(&req)
+	if req.Amount != 150000 {
+		t.Errorf("aprovação deveria registrar centavos: %d", req.Amount)
+	}
+
+	if w := call("500.00"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"amount":500`) {
+		t.Fatalf("R$ 500 deveria passar com o body intacto: %d %s", w.Code, w.Body)
+	}
+}
@@ -1,10 +1,12 @@
 package policy
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // ========================================
@@ -39,6 +41,10 @@ func (h *PolicyHandler) CreatePolicy(c *gin.Context) {
 	}
 
 	if err := h.service.CreatePolicy(&policy); err != nil {
+		if errors.Is(err, ErrInvalidCondition) || errors.Is(err, ErrInvalidPolicyScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criar política"})
 		return
 	}
@@ -78,7 +84,7 @@ func (h *PolicyHandler) GetPolicy(c *gin.Context) {
 	c.JSON(http.StatusOK, policy)
 }
 
-// UpdatePolicy atualiza uma política
+// UpdatePolicy propõe uma alteração: vira rascunho e segue revisão → impacto → publicação
 // PUT /api/v1/policies/:id
 func (h *PolicyHandler) UpdatePolicy(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -93,15 +99,19 @@ func (h *PolicyHandler) UpdatePolicy(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdatePolicy(id, &updates); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao atualizar política"})
+	draft, err := h.service.ProposePolicyUpdate(id, &updates, c.Query("note"), contextUser(c))
+	if err != nil {
+		draftError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Política atualizada"})
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Alteração registrada como rascunho; submeta, revise, analise o impacto e publique",
+		"draft":   draft,
+	})
 }
 
-// DeactivatePolicy desativa uma política
+// DeactivatePolicy propõe a desativação: vira rascunho e segue revisão → impacto → publicação
 // DELETE /api/v1/policies/:id
 func (h *PolicyHandler) DeactivatePolicy(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
@@ -110,12 +120,16 @@ func (h *PolicyHandler) DeactivatePolicy(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeactivatePolicy(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao desativar política"})
+	draft, err := h.service.DeactivatePolicy(id, c.Query("note"), contextUser(c))
+	if err != nil {
+		draftError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Política desativada"})
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Desativação registrada como rascunho; submeta, revise, analise o impacto e publique",
+		"draft":   draft,
+	})
 }
 
 // ========================================
@@ -131,6 +145,11 @@ func (h *PolicyHandler) Evaluate(c *gin.Context) {
 		return
 	}
 
+	// ?explain=true equivale a "explain": true no corpo
+	if c.Query("explain") == "true" {
+		req.Explain = true
+	}
+
 	// Pegar ator do contexto se não fornecido
 	if req.ActorID == uuid.Nil {
 		userID := c.GetString("userID")
@@ -165,6 +184,135 @@ func (h *PolicyHandler) GetEvaluations(c *gin.Context) {
 	c.JSON(http.StatusOK, evals)
 }
 
+// GetEffectivePolicies conjunto efetivo de políticas de um app (global + tenant + app)
+// GET /api/v1/policies/apps/:appId/effective?resource=&action=
+func (h *PolicyHandler) GetEffectivePolicies(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de app inválido"})
+		return
+	}
+
+	policies, err := h.service.EffectivePolicies(appID, c.Query("resource"), c.Query("action"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar políticas efetivas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"app_id":   appID,
+		"policies": policies,
+		"count":    len(policies),
+	})
+}
+
+// GetEvaluation busca uma avaliação com o trace registrado
+// GET /api/v1/policies/evaluations/:id
+func (h *PolicyHandler) GetEvaluation(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	eval, err := h.service.GetEvaluation(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avaliação não encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, eval)
+}
+
+// GetCacheStats estado do cache de políticas desta réplica
+// GET /api/v1/policies/cache
+func (h *PolicyHandler) GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.CacheStats())
+}
+
+// InvalidateCache força o recarregamento em todas as réplicas
+// POST /api/v1/policies/cache/invalidate
+func (h *PolicyHandler) InvalidateCache(c *gin.Context) {
+	h.service.InvalidateCache()
+	c.JSON(http.StatusOK, h.service.CacheStats())
+}
+
+// ========================================
+// CONFIGURAÇÃO POR RECURSO
+// ========================================
+
+// ListResourceConfigs lista algoritmos e efeitos padrão configurados
+// GET /api/v1/policies/resources
+func (h *PolicyHandler) ListResourceConfigs(c *gin.Context) {
+	configs, err := h.service.ListResourceConfigs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar configurações"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"configs": configs,
+		"default": gin.H{
+			"combining_algorithm": DefaultCombiningAlgorithm,
+			"default_effect":      DefaultEffect,
+		},
+	})
+}
+
+// GetResourceConfig retorna a configuração efetiva de um recurso
+// GET /api/v1/policies/resources/:resource
+func (h *PolicyHandler) GetResourceConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.GetResourceConfig(c.Param("resource")))
+}
+
+// SetResourceConfig define algoritmo de combinação e efeito padrão
+// PUT /api/v1/policies/resources/:resource
+func (h *PolicyHandler) SetResourceConfig(c *gin.Context) {
+	var req struct {
+		CombiningAlgorithm string `json:"combining_algorithm" binding:"required"`
+		DefaultEffect      string `json:"default_effect" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	config, err := h.service.SetResourceConfig(c.Param("resource"), req.CombiningAlgorithm, req.DefaultEffect, contextUser(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// DeleteResourceConfig remove a configuração (recurso volta a herdar)
+// DELETE /api/v1/policies/resources/:resource
+func (h *PolicyHandler) DeleteResourceConfig(c *gin.Context) {
+	if err := h.service.DeleteResourceConfig(c.Param("resource"), contextUser(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Configuração não encontrada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover configuração"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Configuração removida"})
+}
+
+// GetResourceConfigVersions histórico da configuração (quem mudou e quando)
+// GET /api/v1/policies/resources/:resource/versions
+func (h *PolicyHandler) GetResourceConfigVersions(c *gin.Context) {
+	versions, err := h.service.GetResourceConfigVersions(c.Param("resource"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao buscar histórico"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
 // ========================================
 // ROUTE REGISTRATION
 // ========================================
@@ -188,6 +336,39 @@ func RegisterPolicyRoutes(router *gin.RouterGroup, service *PolicyService, authM
 			policies.PUT("/:id", handler.UpdatePolicy)
 			policies.DELETE("/:id", handler.DeactivatePolicy)
 			policies.GET("/evaluations", handler.GetEvaluations)
+			policies.GET("/evaluations/:id", handler.GetEvaluation)
+			policies.GET("/apps/:appId/effective", handler.GetEffectivePolicies)
+			policies.GET("/cache", handler.GetCacheStats)
+			policies.POST("/cache/invalidate", handler.InvalidateCache)
+			policies.GET("/:id/versions", handler.GetPolicyVersions)
+			policies.GET("/:id/versions/:version", handler.GetPolicyVersion)
+			
+			// Rascunho → revisão → publicação
+			policies.POST("/drafts", handler.CreateDraft)
+			policies.GET("/drafts", handler.ListDrafts)
+			policies.GET("/drafts/:draftId", handler.GetDraft)
+			policies.PUT("/drafts/:draftId", handler.UpdateDraft)
+			policies.DELETE("/drafts/:draftId", handler.DiscardDraft)
+			policies.POST("/drafts/:draftId/impact", handler.AnalyzeDraftImpact)
+			policies.POST("/drafts/:draftId/submit", handler.SubmitDraft)
+			policies.POST("/drafts/:draftId/review", handler.ReviewDraft)
+			policies.POST("/drafts/:draftId/publish", handler.PublishDraft)
+			policies.POST("/drafts/:draftId/tests", handler.AddDraftTest)
+			policies.POST("/drafts/:draftId/tests/run", handler.RunDraftTests)
+			
+			// Casos de teste (fixture de contexto + resultado esperado)
+			policies.GET("/:id/tests", handler.ListPolicyTests)
+			policies.POST("/:id/tests", handler.AddPolicyTest)
+			policies.POST("/:id/tests/run", handler.RunPolicyTests)
+			policies.POST("/tests/run", handler.RunAllPolicyTests)
+			policies.DELETE("/tests/:testId", handler.DeletePolicyTest)
+			
+			// Combinação e efeito padrão por recurso
+			policies.GET("/resources", handler.ListResourceConfigs)
+			policies.GET("/resources/:resource", handler.GetResourceConfig)
+			policies.PUT("/resources/:resource", handler.SetResourceConfig)
+			policies.DELETE("/resources/:resource", handler.DeleteResourceConfig)
+			policies.GET("/resources/:resource/versions", handler.GetResourceConfigVersions)
 		}
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"time"
 
+	"prost-qs/backend/internal/explainability"
+
 	"github.com/google/uuid"
 )
 
@@ -16,8 +18,10 @@ import (
 // Policy - regra declarativa versionada
 type Policy struct {
 	ID          uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
-	Name        string          `gorm:"size:100;uniqueIndex" json:"name"`
+	Name        string          `gorm:"size:100;uniqueIndex:idx_policy_scope_name,priority:3" json:"name"` // único dentro do escopo
 	Description string          `gorm:"size:500" json:"description"`
+	Scope       string          `gorm:"size:20;default:global;uniqueIndex:idx_policy_scope_name,priority:1" json:"scope"`   // global, tenant, app
+	ScopeID     uuid.UUID       `gorm:"type:uuid;uniqueIndex:idx_policy_scope_name,priority:2" json:"scope_id"`             // tenant ou app (Nil = global)
 	Version     int             `gorm:"default:1" json:"version"`
 	Resource    string          `gorm:"size:50;index" json:"resource"`  // ledger, agent, identity, ads, *
 	Action      string          `gorm:"size:50;index" json:"action"`    // debit, credit, execute, delete, *
@@ -32,10 +36,18 @@ type Policy struct {
 }
 
 // Condition - condição de uma policy
+// Folha (field/operator/value) ou grupo (all/any/not), aninhável.
+// Uma ConditionList no topo continua sendo um AND implícito.
 type Condition struct {
-	Field    string `json:"field"`    // amount, user.role, risk_score
-	Operator string `json:"operator"` // eq, ne, gt, gte, lt, lte, in, not_in, contains
-	Value    any    `json:"value"`    // valor para comparar
+	Field      string `json:"field,omitempty"`       // amount, user.role, risk_score
+	Operator   string `json:"operator,omitempty"`    // ver ConditionOperator
+	Value      any    `json:"value,omitempty"`       // valor para comparar
+	ValueField string `json:"value_field,omitempty"` // compara com outro campo do contexto (ex: account.daily_limit)
+	
+	// Grupos
+	All []Condition `json:"all,omitempty"` // todas verdadeiras
+	Any []Condition `json:"any,omitempty"` // ao menos uma verdadeira
+	Not *Condition  `json:"not,omitempty"` // negação
 }
 
 // ConditionList para serialização GORM
@@ -110,6 +122,14 @@ const (
 	OpIn          = "in"
 	OpNotIn       = "not_in"
 	OpContains    = "contains"
+	OpRegex       = "regex"        // value: padrão RE2
+	OpCIDR        = "cidr"         // value: "10.0.0.0/8" ou lista
+	OpTimeBetween = "time_between" // value: {"from":"22:00","to":"06:00","timezone":"America/Sao_Paulo"}
+	OpDayOfWeek   = "day_of_week"  // value: ["sat","sun"] ou {"days":[...],"timezone":"..."}
+	OpExists      = "exists"       // value: true (padrão) ou false
+	OpBefore      = "before"       // value: data RFC3339, "2006-01-02", "now" ou "now-24h"
+	OpAfter       = "after"        // idem
+	OpWithinLast  = "within_last"  // value: duração ("720h") até agora
 )
 
 // PolicyEvaluation - resultado de avaliação
@@ -125,6 +145,13 @@ type PolicyEvaluation struct {
 	ActorID      uuid.UUID      `gorm:"type:uuid;index" json:"actor_id"`
 	ActorType    string         `gorm:"size:20" json:"actor_type"`      // user, agent, system
 	EvaluatedAt  time.Time      `json:"evaluated_at"`
+
+	// Combinação (todas as políticas que casaram e o que contribuíram)
+	CombiningAlgorithm string          `gorm:"size:30" json:"combining_algorithm"`
+	MatchedPolicies    PolicyMatchList `gorm:"type:text" json:"matched_policies"`
+	
+	// Trace por política/condição (explain, ou políticas puladas por erro)
+	Trace explainability.PolicyTraceList `gorm:"type:text" json:"trace,omitempty"`
 }
 
 // EvaluationResult - resultado da avaliação
@@ -137,7 +164,7 @@ const (
 // JSONMap para serialização de mapas
 type JSONMap map[string]any
 
-func (j JSONMap) Value() (any, error) {
+func (j JSONMap) Value() (driver.Value, error) {
 	return json.Marshal(j)
 }
 
@@ -175,6 +202,7 @@ type EvaluationRequest struct {
 	Context   map[string]any `json:"context" binding:"required"`
 	ActorID   uuid.UUID      `json:"actor_id"`
 	ActorType string         `json:"actor_type"`
+	Explain   bool           `json:"explain,omitempty"` // Trace por política/condição na resposta
 }
 
 // EvaluationResponse - resposta da avaliação
@@ -186,6 +214,14 @@ type EvaluationResponse struct {
 	PolicyName   *string `json:"policy_name,omitempty"`
 	Reason       string  `json:"reason"`
 	
+	// Combinação por recurso: algoritmo usado e contribuição de cada política casada
+	CombiningAlgorithm string        `json:"combining_algorithm"`
+	DefaultApplied     bool          `json:"default_applied"` // nenhuma política casou
+	MatchedPolicies    []PolicyMatch `json:"matched_policies"`
+	
+	// Trace por política/condição (explain, ou políticas puladas por erro)
+	Trace []explainability.PolicyTraceSnapshot `json:"trace,omitempty"`
+	
 	// Threshold recommendation (integração passiva - Fase 17)
 	// Thresholds influenciam, não decidem
 	ThresholdRecommendation *ThresholdRecommendationInfo `json:"threshold_recommendation,omitempty"`
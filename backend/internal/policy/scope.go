@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// SCOPES - Políticas globais, por tenant e por app
+// "O app ajusta, mas não afrouxa o que o kernel negou"
+// ========================================
+
+// Escopos de política (do mais externo para o mais específico)
+const (
+	ScopeGlobal = "global"
+	ScopeTenant = "tenant"
+	ScopeApp    = "app"
+)
+
+// ErrInvalidPolicyScope escopo inconsistente com scope_id
+var ErrInvalidPolicyScope = errors.New("invalid policy scope")
+
+// scopeLevels ordem das camadas na avaliação
+var scopeLevels = []string{ScopeGlobal, ScopeTenant, ScopeApp}
+
+func scopeLevel(scope string) int {
+	for i, candidate := range scopeLevels {
+		if candidate == scope {
+			return i
+		}
+	}
+	return 0 // Legado sem escopo = global
+}
+
+func validateScope(scope string, scopeID uuid.UUID) error {
+	switch scope {
+	case ScopeGlobal:
+		if scopeID != uuid.Nil {
+			return fmt.Errorf("%w: política global não tem scope_id", ErrInvalidPolicyScope)
+		}
+	case ScopeTenant, ScopeApp:
+		if scopeID == uuid.Nil {
+			return fmt.Errorf("%w: escopo %s exige scope_id", ErrInvalidPolicyScope, scope)
+		}
+	default:
+		return fmt.Errorf("%w: escopo inválido: %s (use: global, tenant, app)", ErrInvalidPolicyScope, scope)
+	}
+	return nil
+}
+
+// ========================================
+// RESOLUÇÃO DE CAMADAS
+// ========================================
+
+// resolveScope extrai app_id e tenant_id do contexto.
+// Sem tenant_id explícito, o tenant é o dono do app.
+func (s *PolicyService) resolveScope(context map[string]any) (*uuid.UUID, *uuid.UUID) {
+	parse := func(key string) *uuid.UUID {
+		if str, ok := context[key].(string); ok {
+			if parsed, err := uuid.Parse(str); err == nil {
+				return &parsed
+			}
+		}
+		return nil
+	}
+
+	tenantID, appID := parse("tenant_id"), parse("app_id")
+	if tenantID == nil && appID != nil {
+		tenantID = s.cachedAppTenant(*appID)
+	}
+	return tenantID, appID
+}
+
+// appTenant dono do app (tabela applications)
+func (s *PolicyService) appTenant(appID uuid.UUID) *uuid.UUID {
+	var owners []string
+	s.db.Table("applications").Where("id = ?", appID).Limit(1).Pluck("owner_id", &owners)
+	if len(owners) == 0 {
+		return nil
+	}
+	ownerID, err := uuid.Parse(owners[0])
+	if err != nil {
+		return nil
+	}
+	return &ownerID
+}
+
+// ListPoliciesForScope políticas ativas das camadas global, tenant e app
+func (s *PolicyService) ListPoliciesForScope(resource, action string, tenantID, appID *uuid.UUID) ([]Policy, error) {
+	var policies []Policy
+	query := s.db.Where(
+		"active = ? AND (resource = ? OR resource = ?) AND (action = ? OR action = ?)",
+		true, resource, ResourceAll, action, ActionAll,
+	)
+
+	scopes := s.db.Where("scope = ? OR scope IS NULL OR scope = ''", ScopeGlobal)
+	if tenantID != nil {
+		scopes = scopes.Or("scope = ? AND scope_id = ?", ScopeTenant, *tenantID)
+	}
+	if appID != nil {
+		scopes = scopes.Or("scope = ? AND scope_id = ?", ScopeApp, *appID)
+	}
+
+	err := query.Where(scopes).Order("priority DESC, created_at ASC").Find(&policies).Error
+	return policies, err
+}
+
+// EffectivePolicies conjunto efetivo de um app (camada a camada, por prioridade).
+// resource/action vazios = todas.
+func (s *PolicyService) EffectivePolicies(appID uuid.UUID, resource, action string) ([]Policy, error) {
+	tenantID := s.appTenant(appID)
+
+	var policies []Policy
+	query := s.db.Where("active = ?", true)
+	if resource != "" {
+		query = query.Where("resource = ? OR resource = ?", resource, ResourceAll)
+	}
+	if action != "" {
+		query = query.Where("action = ? OR action = ?", action, ActionAll)
+	}
+
+	scopes := s.db.Where("scope = ? OR scope IS NULL OR scope = ''", ScopeGlobal).
+		Or("scope = ? AND scope_id = ?", ScopeApp, appID)
+	if tenantID != nil {
+		scopes = scopes.Or("scope = ? AND scope_id = ?", ScopeTenant, *tenantID)
+	}
+
+	if err := query.Where(scopes).Order("priority DESC").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	// Camada externa primeiro; prioridade dentro da camada (ordenação estável)
+	ordered := make([]Policy, 0, len(policies))
+	for level := range scopeLevels {
+		for _, policy := range policies {
+			if scopeLevel(policy.Scope) == level {
+				ordered = append(ordered, policy)
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// ========================================
+// COMBINAÇÃO ENTRE CAMADAS
+// ========================================
+
+// combineLayers combina cada camada com o algoritmo do recurso e depois as camadas:
+// a camada mais externa com políticas aplicáveis define o piso e as internas só
+// podem apertá-lo (deny > require_approval > allow). Um allow do app não
+// afrouxa o require_approval ou o deny do tenant ou do global.
+func combineLayers(algorithm string, matched []Policy) (string, int, []string) {
+	contributions := make([]string, len(matched))
+	if len(matched) == 0 {
+		return "", -1, contributions
+	}
+
+	layers := make([][]int, len(scopeLevels))
+	for i, policy := range matched {
+		level := scopeLevel(policy.Scope)
+		layers[level] = append(layers[level], i)
+	}
+
+	var effect string
+	decisive := -1
+	var layerIndexes []int
+	var layerContributions []string
+	for _, indexes := range layers {
+		if len(indexes) == 0 {
+			continue
+		}
+		subset := make([]Policy, len(indexes))
+		for j, i := range indexes {
+			subset[j] = matched[i]
+		}
+
+		layerEffect, layerDecisive, subsetContributions := combine(algorithm, subset)
+		if layerIndexes != nil && effectRank(layerEffect) <= effectRank(effect) {
+			continue // Camada interna não afrouxa (nem repete) o piso
+		}
+		effect, layerIndexes, layerContributions = layerEffect, indexes, subsetContributions
+		decisive = -1
+		if layerDecisive >= 0 {
+			decisive = indexes[layerDecisive]
+		}
+		if effect == EffectDeny {
+			break // Nada é mais restritivo que deny
+		}
+	}
+
+	// Camada decisiva mantém suas contribuições; as demais concordam ou são vencidas
+	for i, policy := range matched {
+		if policy.Effect == effect {
+			contributions[i] = ContributionConcurring
+		} else {
+			contributions[i] = ContributionOverridden
+		}
+	}
+	for j, i := range layerIndexes {
+		contributions[i] = layerContributions[j]
+	}
+	return effect, decisive, contributions
+}
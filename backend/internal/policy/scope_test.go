@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Escopos global/tenant/app
+// ========================================
+
+// testApplication espelho mínimo de applications
+type testApplication struct {
+	ID      uuid.UUID `gorm:"type:text;primaryKey"`
+	OwnerID uuid.UUID `gorm:"type:text"`
+}
+
+func (testApplication) TableName() string {
+	return "applications"
+}
+
+func TestScopedPoliciesMergeLayers(t *testing.T) {
+	s := newTestPolicyService(t)
+	s.db.AutoMigrate(&testApplication{})
+	appID, otherApp, tenantID := uuid.New(), uuid.New(), uuid.New()
+	s.db.Create(&testApplication{ID: appID, OwnerID: tenantID})
+
+	create := func(p Policy) {
+		t.Helper()
+		p.Resource, p.Action, p.Active = ResourcePayment, ActionAll, true
+		if err := s.CreatePolicy(&p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	big := ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 1000.0}}
+	create(Policy{Name: "bloqueio", Effect: EffectDeny, Conditions: ConditionList{{Field: "country", Operator: OpEqual, Value: "XX"}}})
+	create(Policy{Name: "limite", Effect: EffectAllow, Conditions: big})
+	create(Policy{Name: "limite", Scope: ScopeTenant, ScopeID: tenantID, Effect: EffectRequireApproval, Conditions: big})
+	create(Policy{Name: "liberado", Scope: ScopeApp, ScopeID: appID, Effect: EffectAllow, Priority: 900})
+
+	if err := s.CreatePolicy(&Policy{Name: "sem id", Scope: ScopeApp}); err == nil {
+		t.Error("escopo app sem scope_id deveria falhar")
+	}
+
+	evaluate := func(app uuid.UUID, context map[string]any) *EvaluationResponse {
+		t.Helper()
+		context["app_id"] = app.String()
+		response, err := s.Evaluate(EvaluationRequest{Resource: ResourcePayment, Action: "create", Context: context})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	// Deny global não é afrouxado pelo allow do app
+	if r := evaluate(appID, map[string]any{"country": "XX", "amount": 10.0}); r.Result != ResultDenied || *r.PolicyName != "bloqueio" {
+		t.Errorf("deny global deveria vencer: %+v", r)
+	}
+	// Camada externa é piso: o allow do app não afrouxa a aprovação do tenant
+	if r := evaluate(appID, map[string]any{"amount": 5000.0}); r.Result != ResultPendingApproval || *r.PolicyName != "limite" || len(r.MatchedPolicies) != 3 {
+		t.Errorf("tenant deveria manter a aprovação: %+v", r)
+	}
+	// Sem restrição externa, o app decide
+	if r := evaluate(appID, map[string]any{"amount": 10.0}); r.Result != ResultAllowed || *r.PolicyName != "liberado" {
+		t.Errorf("app deveria decidir: %+v", r)
+	}
+	// Outro app do mesmo sistema não vê as políticas do tenant/app
+	if r := evaluate(otherApp, map[string]any{"amount": 5000.0}); r.Result != ResultAllowed || *r.PolicyName != "limite" || len(r.MatchedPolicies) != 1 {
+		t.Errorf("só a camada global deveria aplicar: %+v", r)
+	}
+
+	effective, err := s.EffectivePolicies(appID, ResourcePayment, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(effective) != 4 || effective[0].Scope != ScopeGlobal || effective[3].Scope != ScopeApp {
+		t.Errorf("conjunto efetivo inesperado: %+v", effective)
+	}
+}
+
+func TestAppLayerCannotLoosenGlobalApproval(t *testing.T) {
+	global := Policy{Name: "aprovação global", Scope: ScopeGlobal, Effect: EffectRequireApproval}
+	app := Policy{Name: "app libera", Scope: ScopeApp, Effect: EffectAllow, Priority: 900}
+
+	for _, algorithm := range []string{CombineFirstApplicable, CombineDenyOverrides, CombinePermitOverrides} {
+		effect, decisive, contributions := combineLayers(algorithm, []Policy{global, app})
+		if effect != EffectRequireApproval || decisive != 0 {
+			t.Errorf("%s: esperado require_approval da camada global, obtido %s (decisiva %d)", algorithm, effect, decisive)
+		}
+		if contributions[1] != ContributionOverridden {
+			t.Errorf("%s: allow do app deveria ser vencido: %v", algorithm, contributions)
+		}
+	}
+
+	// O app ainda pode apertar
+	deny := Policy{Name: "app bloqueia", Scope: ScopeApp, Effect: EffectDeny}
+	if effect, decisive, _ := combineLayers(CombineFirstApplicable, []Policy{global, deny}); effect != EffectDeny || decisive != 1 {
+		t.Errorf("deny do app deveria apertar: %s (decisiva %d)", effect, decisive)
+	}
+}
+
+func TestUpdatePolicyMovesScopeToGlobal(t *testing.T) {
+	s := newTestPolicyService(t)
+	appID := uuid.New()
+	policy := &Policy{Name: "do app", Scope: ScopeApp, ScopeID: appID, Resource: ResourcePayment, Action: ActionAll, Effect: EffectDeny, Active: true}
+	if err := s.CreatePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := s.ProposePolicyUpdate(policy.ID, &Policy{Scope: ScopeGlobal}, "", uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.Scope != ScopeGlobal || draft.ScopeID != uuid.Nil || draft.Effect != EffectDeny {
+		t.Errorf("rascunho deveria ser global sem scope_id: %+v", draft.PolicyDefinition)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"prost-qs/backend/internal/explainability"
+	"prost-qs/backend/internal/observability"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -19,8 +21,9 @@ import (
 
 type PolicyService struct {
 	db               *gorm.DB
-	thresholdService *ThresholdService              // Integração passiva com thresholds
+	thresholdService *ThresholdService               // Integração passiva com thresholds
 	timelineService  *explainability.TimelineService // Registro de timeline (Fase 18)
+	cache            atomic.Pointer[policyCache]     // Políticas compiladas em memória (EnableCache)
 }
 
 func NewPolicyService(db *gorm.DB) *PolicyService {
@@ -47,12 +50,31 @@ func (s *PolicyService) SetTimelineService(ts *explainability.TimelineService) {
 
 // CreatePolicy cria uma nova política
 func (s *PolicyService) CreatePolicy(policy *Policy) error {
+	if policy.Scope == "" {
+		policy.Scope = ScopeGlobal
+	}
+	if err := validateScope(policy.Scope, policy.ScopeID); err != nil {
+		return err
+	}
+	if err := ValidateConditions(policy.Conditions); err != nil {
+		return err
+	}
+	
 	policy.ID = uuid.New()
 	policy.Version = 1
 	policy.CreatedAt = time.Now()
 	policy.UpdatedAt = time.Now()
 	
-	return s.db.Create(policy).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(policy).Error; err != nil {
+			return err
+		}
+		return recordPolicyVersion(tx, policy, policy.CreatedBy, nil)
+	})
+	if err == nil {
+		s.policiesChanged()
+	}
+	return err
 }
 
 // GetPolicy busca uma política por ID
@@ -64,10 +86,10 @@ func (s *PolicyService) GetPolicy(id uuid.UUID) (*Policy, error) {
 	return &policy, nil
 }
 
-// GetPolicyByName busca uma política por nome
+// GetPolicyByName busca uma política global por nome
 func (s *PolicyService) GetPolicyByName(name string) (*Policy, error) {
 	var policy Policy
-	if err := s.db.Where("name = ? AND active = ?", name, true).First(&policy).Error; err != nil {
+	if err := s.db.Where("name = ? AND scope = ? AND active = ?", name, ScopeGlobal, true).First(&policy).Error; err != nil {
 		return nil, err
 	}
 	return &policy, nil
@@ -86,37 +108,73 @@ func (s *PolicyService) ListPolicies(activeOnly bool) ([]Policy, error) {
 	return policies, nil
 }
 
-// ListPoliciesForResource lista políticas para um recurso específico
+// ListPoliciesForResource lista políticas globais para um recurso específico
+// (para incluir tenant/app ver ListPoliciesForScope)
 func (s *PolicyService) ListPoliciesForResource(resource, action string) ([]Policy, error) {
-	var policies []Policy
-	err := s.db.Where(
-		"active = ? AND (resource = ? OR resource = ?) AND (action = ? OR action = ?)",
-		true, resource, ResourceAll, action, ActionAll,
-	).Order("priority DESC").Find(&policies).Error
-	
-	return policies, err
+	return s.ListPoliciesForScope(resource, action, nil, nil)
 }
 
-// UpdatePolicy atualiza uma política (cria nova versão)
-func (s *PolicyService) UpdatePolicy(id uuid.UUID, updates *Policy) error {
-	var existing Policy
-	if err := s.db.Where("id = ?", id).First(&existing).Error; err != nil {
-		return err
+// ProposePolicyUpdate transforma uma edição parcial (PUT) em rascunho da política.
+// Campos vazios mantêm o valor publicado; scope enviado grava scope_id junto
+// (vazio ao mover para global). Publicar passa por revisão, impacto e testes.
+func (s *PolicyService) ProposePolicyUpdate(id uuid.UUID, updates *Policy, note string, createdBy uuid.UUID) (*PolicyDraft, error) {
+	existing, err := s.GetPolicy(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: política %s", ErrDraftNotFound, id)
 	}
-	
-	// Incrementar versão
-	updates.Version = existing.Version + 1
-	updates.UpdatedAt = time.Now()
-	
-	return s.db.Model(&existing).Updates(updates).Error
+
+	def := policyDefinitionOf(existing)
+	if updates.Name != "" {
+		def.Name = updates.Name
+	}
+	if updates.Description != "" {
+		def.Description = updates.Description
+	}
+	if updates.Scope != "" || updates.ScopeID != uuid.Nil {
+		if updates.Scope != "" {
+			def.Scope = updates.Scope
+		}
+		def.ScopeID = updates.ScopeID
+	}
+	if updates.Resource != "" {
+		def.Resource = updates.Resource
+	}
+	if updates.Action != "" {
+		def.Action = updates.Action
+	}
+	if updates.Conditions != nil {
+		def.Conditions = updates.Conditions
+	}
+	if updates.Effect != "" {
+		def.Effect = updates.Effect
+	}
+	if updates.Reason != "" {
+		def.Reason = updates.Reason
+	}
+	if updates.Priority != 0 {
+		def.Priority = updates.Priority
+	}
+
+	if note == "" {
+		note = "edição via PUT /policies/:id"
+	}
+	return s.CreateDraft(&id, def, note, createdBy)
 }
 
-// DeactivatePolicy desativa uma política (não deleta)
-func (s *PolicyService) DeactivatePolicy(id uuid.UUID) error {
-	return s.db.Model(&Policy{}).Where("id = ?", id).Updates(map[string]any{
-		"active":     false,
-		"updated_at": time.Now(),
-	}).Error
+// DeactivatePolicy propõe a desativação (não deleta): vira rascunho com active=false
+// e segue revisão → impacto → publicação, gerando uma nova versão.
+func (s *PolicyService) DeactivatePolicy(id uuid.UUID, note string, createdBy uuid.UUID) (*PolicyDraft, error) {
+	existing, err := s.GetPolicy(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: política %s", ErrDraftNotFound, id)
+	}
+
+	def := policyDefinitionOf(existing)
+	def.Active = false
+	if note == "" {
+		note = "desativação via DELETE /policies/:id"
+	}
+	return s.CreateDraft(&id, def, note, createdBy)
 }
 
 // ========================================
@@ -124,101 +182,165 @@ func (s *PolicyService) DeactivatePolicy(id uuid.UUID) error {
 // ========================================
 
 // Evaluate avalia uma ação contra todas as políticas aplicáveis
+// e combina os efeitos pelo algoritmo configurado para o recurso.
 // Integração passiva com thresholds: retorna recomendação, não executa
 func (s *PolicyService) Evaluate(req EvaluationRequest) (*EvaluationResponse, error) {
-	// Buscar políticas aplicáveis
-	policies, err := s.ListPoliciesForResource(req.Resource, req.Action)
+	start := time.Now()
+	
+	// Buscar políticas aplicáveis (cache quando ligado)
+	// Camadas global → tenant → app conforme app_id/tenant_id do contexto
+	tenantID, appID := s.resolveScope(req.Context)
+	policies, cacheHit, err := s.policiesFor(req.Resource, req.Action, tenantID, appID)
 	if err != nil {
 		return nil, err
 	}
 	
-	// Se não há políticas, permitir por padrão
-	if len(policies) == 0 {
-		return &EvaluationResponse{
-			Allowed: true,
-			Result:  ResultAllowed,
-			Reason:  "Nenhuma política aplicável - permitido por padrão",
-		}, nil
+	decision := s.decide(req, policies, s.resourceConfig(req.Resource))
+	decisivePolicy, result := decision.decisive, decision.result
+	
+	// Logar avaliação
+	evalID := uuid.New()
+	evalIDStr := evalID.String()
+	eval := &PolicyEvaluation{
+		ID:                 evalID,
+		Resource:           req.Resource,
+		Action:             req.Action,
+		Context:            req.Context,
+		Result:             result,
+		Reason:             decision.reason,
+		CombiningAlgorithm: decision.config.CombiningAlgorithm,
+		MatchedPolicies:    decision.matches,
+		Trace:              decision.trace,
+		ActorID:            req.ActorID,
+		ActorType:          req.ActorType,
+		EvaluatedAt:        time.Now(),
+	}
+	response := &EvaluationResponse{
+		Allowed:            result == ResultAllowed,
+		Result:             result,
+		EvaluationID:       &evalIDStr,
+		Reason:             decision.reason,
+		CombiningAlgorithm: decision.config.CombiningAlgorithm,
+		DefaultApplied:     decision.defaultApplied,
+		MatchedPolicies:    decision.matches,
+		Trace:              decision.trace,
+	}
+	if decisivePolicy != nil {
+		policyIDStr := decisivePolicy.ID.String()
+		eval.PolicyID = &decisivePolicy.ID
+		eval.PolicyName = decisivePolicy.Name
+		response.PolicyID = &policyIDStr
+		response.PolicyName = &decisivePolicy.Name
+	}
+	
+	// ========================================
+	// INTEGRAÇÃO PASSIVA COM THRESHOLDS
+	// Thresholds influenciam, não decidem
+	// ========================================
+	if s.thresholdService != nil && decisivePolicy != nil {
+		thresholdRec := s.getThresholdRecommendation(decisivePolicy.ID, req.Context)
+		if thresholdRec != nil {
+			response.ThresholdRecommendation = thresholdRec
+		}
 	}
 	
-	// Avaliar cada política em ordem de prioridade
+	// ========================================
+	// REGISTRO DE TIMELINE - Fase 18
+	// "Timeline é registro, não julgamento"
+	// Registrado também para decisões padrão
+	// ========================================
+	var timeline *explainability.DecisionTimeline
+	if s.timelineService != nil {
+		timeline = s.buildTimeline(evalID, req, response, decisivePolicy)
+	}
+	
+	// Auditoria antes da resposta: o EvaluationID devolvido já existe no banco
+	if err := s.recordAudit(eval, timeline); err != nil {
+		return nil, err
+	}
+	observability.RecordPolicyEvaluation(time.Since(start), cacheHit)
+	
+	return response, nil
+}
+
+// policyDecision resultado da combinação (sem efeitos colaterais)
+type policyDecision struct {
+	config         ResourcePolicyConfig
+	matches        []PolicyMatch
+	trace          []explainability.PolicyTraceSnapshot
+	decisive       *Policy
+	reason         string
+	result         string
+	defaultApplied bool
+}
+
+// decide avalia as políticas e combina os efeitos. Não registra nada:
+// usado por Evaluate e pelo replay da análise de impacto.
+func (s *PolicyService) decide(req EvaluationRequest, policies []Policy, config ResourcePolicyConfig) *policyDecision {
+	// Avaliar TODAS as políticas em ordem de prioridade
+	var matched []Policy
+	var trace []explainability.PolicyTraceSnapshot
 	for _, policy := range policies {
-		matches, err := s.evaluateConditions(policy.Conditions, req.Context)
+		// Explain: trace de todas, avaliadas uma única vez pelo próprio trace
+		var matches bool
+		var err error
+		if req.Explain {
+			var snapshot explainability.PolicyTraceSnapshot
+			snapshot, matches, err = s.tracePolicy(policy, req.Context)
+			trace = append(trace, snapshot)
+		} else if matches, err = s.evaluateConditions(policy.Conditions, req.Context); err != nil {
+			// Pulada por erro: trace só para mostrar onde e por quê (decisão já tomada)
+			snapshot, _, _ := s.tracePolicy(policy, req.Context)
+			trace = append(trace, snapshot)
+		}
 		if err != nil {
 			continue // Pular política com erro
 		}
-		
 		if matches {
-			// Política aplicável encontrada
-			result := s.effectToResult(policy.Effect)
-			
-			// Logar avaliação
-			evalID := uuid.New()
-			eval := &PolicyEvaluation{
-				ID:          evalID,
-				PolicyID:    &policy.ID,
-				PolicyName:  policy.Name,
-				Resource:    req.Resource,
-				Action:      req.Action,
-				Context:     req.Context,
-				Result:      result,
-				Reason:      policy.Reason,
-				ActorID:     req.ActorID,
-				ActorType:   req.ActorType,
-				EvaluatedAt: time.Now(),
-			}
-			s.db.Create(eval)
-			
-			policyIDStr := policy.ID.String()
-			evalIDStr := evalID.String()
-			response := &EvaluationResponse{
-				Allowed:      result == ResultAllowed,
-				Result:       result,
-				EvaluationID: &evalIDStr,
-				PolicyID:     &policyIDStr,
-				PolicyName:   &policy.Name,
-				Reason:       policy.Reason,
-			}
-			
-			// ========================================
-			// INTEGRAÇÃO PASSIVA COM THRESHOLDS
-			// Thresholds influenciam, não decidem
-			// ========================================
-			if s.thresholdService != nil {
-				thresholdRec := s.getThresholdRecommendation(policy.ID, req.Context)
-				if thresholdRec != nil {
-					response.ThresholdRecommendation = thresholdRec
-				}
-			}
-			
-			// ========================================
-			// REGISTRO DE TIMELINE - Fase 18
-			// "Timeline é registro, não julgamento"
-			// ========================================
-			if s.timelineService != nil {
-				s.recordTimeline(evalID, req, response, &policy)
-			}
-			
-			return response, nil
+			matched = append(matched, policy)
 		}
 	}
 	
-	// Nenhuma política matched - permitir por padrão
-	defaultEvalID := uuid.New()
-	defaultEvalIDStr := defaultEvalID.String()
-	defaultResponse := &EvaluationResponse{
-		Allowed:      true,
-		Result:       ResultAllowed,
-		EvaluationID: &defaultEvalIDStr,
-		Reason:       "Nenhuma política correspondente - permitido por padrão",
+	// Combinar efeitos (por camada; camada externa é piso, internas só apertam)
+	effect, decisive, contributions := combineLayers(config.CombiningAlgorithm, matched)
+	defaultApplied := len(matched) == 0
+	
+	matches := make([]PolicyMatch, len(matched))
+	for i, policy := range matched {
+		matches[i] = PolicyMatch{
+			PolicyID:     policy.ID.String(),
+			PolicyName:   policy.Name,
+			Scope:        policy.Scope,
+			Priority:     policy.Priority,
+			Effect:       policy.Effect,
+			Reason:       policy.Reason,
+			Contribution: contributions[i],
+		}
 	}
 	
-	// Registrar timeline mesmo para decisões padrão
-	if s.timelineService != nil {
-		s.recordTimeline(defaultEvalID, req, defaultResponse, nil)
+	var decisivePolicy *Policy
+	var reason string
+	switch {
+	case defaultApplied:
+		effect = config.DefaultEffect
+		reason = fmt.Sprintf("Nenhuma política correspondente - efeito padrão do recurso (%s)", effect)
+	case decisive < 0:
+		reason = fmt.Sprintf("Políticas aplicáveis divergem (%s) - negado", config.CombiningAlgorithm)
+	default:
+		decisivePolicy = &matched[decisive]
+		reason = decisivePolicy.Reason
 	}
+	result := s.effectToResult(effect)
 	
-	return defaultResponse, nil
+	return &policyDecision{
+		config:         config,
+		matches:        matches,
+		trace:          trace,
+		decisive:       decisivePolicy,
+		reason:         reason,
+		result:         result,
+		defaultApplied: defaultApplied,
+	}
 }
 
 // getThresholdRecommendation obtém recomendação de threshold baseada no contexto
@@ -280,6 +402,11 @@ func (s *PolicyService) getThresholdRecommendation(policyID uuid.UUID, context m
 
 // scoreToLevel converte score numérico para nível de risco
 func (s *PolicyService) scoreToLevel(score float64) string {
+	return riskLevelForScore(score)
+}
+
+// riskLevelForScore faixas de risco (low < 0.3 <= medium < 0.6 <= high < 0.8 <= critical)
+func riskLevelForScore(score float64) string {
 	switch {
 	case score >= 0.8:
 		return "critical"
@@ -329,32 +456,61 @@ func (s *PolicyService) evaluateConditions(conditions []Condition, context map[s
 	return true, nil
 }
 
-// evaluateCondition avalia uma única condição
+// evaluateCondition avalia uma condição (folha ou grupo all/any/not)
 func (s *PolicyService) evaluateCondition(cond Condition, context map[string]any) (bool, error) {
+	// Grupos aninhados
+	switch {
+	case cond.All != nil:
+		return s.evaluateConditions(cond.All, context)
+	case cond.Any != nil:
+		for _, child := range cond.Any {
+			matches, err := s.evaluateCondition(child, context)
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				return true, nil // OR lógico - basta uma
+			}
+		}
+		return false, nil
+	case cond.Not != nil:
+		matches, err := s.evaluateCondition(*cond.Not, context)
+		if err != nil {
+			return false, err
+		}
+		return !matches, nil
+	}
+	
 	// Extrair valor do contexto (suporta nested: "user.role")
 	value := s.extractValue(cond.Field, context)
 	
+	// Operando: valor literal ou outro campo do contexto (amount > account.daily_limit)
+	operand := cond.Value
+	if cond.ValueField != "" {
+		operand = s.extractValue(cond.ValueField, context)
+	}
+	
 	switch cond.Operator {
 	case OpEqual:
-		return s.compareEqual(value, cond.Value), nil
+		return s.compareEqual(value, operand), nil
 	case OpNotEqual:
-		return !s.compareEqual(value, cond.Value), nil
+		return !s.compareEqual(value, operand), nil
 	case OpGreaterThan:
-		return s.compareNumeric(value, cond.Value, ">"), nil
+		return s.compareNumeric(value, operand, ">"), nil
 	case OpGreaterOrEq:
-		return s.compareNumeric(value, cond.Value, ">="), nil
+		return s.compareNumeric(value, operand, ">="), nil
 	case OpLessThan:
-		return s.compareNumeric(value, cond.Value, "<"), nil
+		return s.compareNumeric(value, operand, "<"), nil
 	case OpLessOrEq:
-		return s.compareNumeric(value, cond.Value, "<="), nil
+		return s.compareNumeric(value, operand, "<="), nil
 	case OpIn:
-		return s.compareIn(value, cond.Value), nil
+		return s.compareIn(value, operand), nil
 	case OpNotIn:
-		return !s.compareIn(value, cond.Value), nil
+		return !s.compareIn(value, operand), nil
 	case OpContains:
-		return s.compareContains(value, cond.Value), nil
+		return s.compareContains(value, operand), nil
 	default:
-		return false, fmt.Errorf("operador desconhecido: %s", cond.Operator)
+		return s.evaluateExtendedOperator(cond, value, operand, time.Now())
 	}
 }
 
@@ -403,7 +559,7 @@ func (s *PolicyService) compareIn(value any, list any) bool {
 	listSlice, ok := list.([]any)
 	if !ok {
 		// Tentar converter de []interface{}
-		if reflect.TypeOf(list).Kind() == reflect.Slice {
+		if list != nil && reflect.TypeOf(list).Kind() == reflect.Slice {
 			v := reflect.ValueOf(list)
 			listSlice = make([]any, v.Len())
 			for i := 0; i < v.Len(); i++ {
@@ -484,6 +640,15 @@ func (s *PolicyService) GetEvaluations(resource, action string, limit int) ([]Po
 	return evals, nil
 }
 
+// GetEvaluation busca uma avaliação (com trace, se houver)
+func (s *PolicyService) GetEvaluation(id uuid.UUID) (*PolicyEvaluation, error) {
+	var eval PolicyEvaluation
+	if err := s.db.Where("id = ?", id).First(&eval).Error; err != nil {
+		return nil, err
+	}
+	return &eval, nil
+}
+
 // GetEvaluationsByActor busca avaliações por ator
 func (s *PolicyService) GetEvaluationsByActor(actorID uuid.UUID, limit int) ([]PolicyEvaluation, error) {
 	var evals []PolicyEvaluation
@@ -552,6 +717,30 @@ func (s *PolicyService) SeedDefaultPolicies() error {
 			Priority: 500,
 			Active:   true,
 		},
+		// 3b. Débito baixo e abertura de conta: o ledger nega o que não for permitido
+		{
+			Name:        "low_value_debit",
+			Description: "Débito de até R$ 100 é permitido",
+			Resource:    ResourceLedger,
+			Action:      ActionDebit,
+			Conditions: []Condition{
+				{Field: "amount", Operator: OpLessOrEq, Value: float64(10000)}, // 10000 centavos = R$ 100
+			},
+			Effect:   EffectAllow,
+			Reason:   "Débito de até R$ 100 é permitido",
+			Priority: 100,
+			Active:   true,
+		},
+		{
+			Name:        "ledger_account_creation",
+			Description: "Abertura de conta no ledger é permitida",
+			Resource:    ResourceLedger,
+			Action:      "create_account",
+			Effect:      EffectAllow,
+			Reason:      "Abertura de conta é permitida",
+			Priority:    100,
+			Active:      true,
+		},
 		// 4. Bloquear agente com risco alto
 		{
 			Name:        "block_high_risk_agent",
@@ -603,6 +792,9 @@ func (s *PolicyService) SeedDefaultPolicies() error {
 		existing, err := s.GetPolicyByName(policy.Name)
 		if err == nil && existing != nil {
 			fmt.Printf("  ⏭️ Política '%s' já existe, pulando\n", policy.Name)
+			if err := s.seedDefaultPolicyTests(existing); err != nil {
+				return err
+			}
 			continue // Já existe, pular
 		}
 
@@ -612,9 +804,25 @@ func (s *PolicyService) SeedDefaultPolicies() error {
 			fmt.Printf("  ❌ Erro ao criar política '%s': %v\n", policy.Name, err)
 			return err
 		}
+		if err := s.seedDefaultPolicyTests(&policy); err != nil {
+			return err
+		}
 		fmt.Printf("  ✅ Política '%s' criada\n", policy.Name)
 	}
 	
+	// Recursos que movem dinheiro não são permitidos por omissão.
+	// Só cria a configuração se o recurso ainda não tiver uma (não sobrescreve o admin).
+	for _, config := range defaultResourceConfigs {
+		var existing ResourcePolicyConfig
+		if err := s.db.Where("resource = ?", config.Resource).First(&existing).Error; err == nil {
+			continue
+		}
+		if _, err := s.SetResourceConfig(config.Resource, config.CombiningAlgorithm, config.DefaultEffect, uuid.Nil); err != nil {
+			return err
+		}
+		fmt.Printf("  🔒 Recurso '%s': %s, padrão %s\n", config.Resource, config.CombiningAlgorithm, config.DefaultEffect)
+	}
+	
 	fmt.Println("🔧 Seed de políticas concluído")
 
 	return nil
@@ -625,8 +833,8 @@ func (s *PolicyService) SeedDefaultPolicies() error {
 // "Timeline é registro, não julgamento"
 // ========================================
 
-// recordTimeline registra a decisão na timeline
-func (s *PolicyService) recordTimeline(evalID uuid.UUID, req EvaluationRequest, response *EvaluationResponse, policy *Policy) {
+// buildTimeline monta o registro da decisão na timeline
+func (s *PolicyService) buildTimeline(evalID uuid.UUID, req EvaluationRequest, response *EvaluationResponse, policy *Policy) *explainability.DecisionTimeline {
 	now := time.Now()
 	
 	// Extrair dados do contexto
@@ -710,6 +918,7 @@ func (s *PolicyService) recordTimeline(evalID uuid.UUID, req EvaluationRequest,
 		timeline.PolicyResult = response.Result
 		timeline.PolicyReason = response.Reason
 	}
+	timeline.PolicyTrace = response.Trace
 	
 	// Threshold data
 	if response.ThresholdRecommendation != nil {
@@ -723,8 +932,7 @@ func (s *PolicyService) recordTimeline(evalID uuid.UUID, req EvaluationRequest,
 		timeline.ThresholdReason = rec.Reason
 	}
 	
-	// Registrar (ignora erro para não bloquear a decisão)
-	_ = s.timelineService.RecordTimeline(timeline)
+	return timeline
 }
 
 // Helper functions para extrair valores do map
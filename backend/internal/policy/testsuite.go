@@ -0,0 +1,268 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TEST SUITES - Casos de teste junto das políticas
+// "Quem mexe em política de dinheiro roda os testes antes"
+// ========================================
+
+// ErrPolicyTestsFailed publicação bloqueada por teste falhando
+var ErrPolicyTestsFailed = errors.New("policy tests failed")
+
+// PolicyTestCase contexto de entrada e resultado esperado
+type PolicyTestCase struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	PolicyID       *uuid.UUID `gorm:"type:uuid;index" json:"policy_id,omitempty"`
+	DraftID        *uuid.UUID `gorm:"type:uuid;index" json:"draft_id,omitempty"` // Rascunho de política nova (vira policy_id ao publicar)
+	Name           string     `gorm:"size:100" json:"name"`
+	Resource       string     `gorm:"size:50" json:"resource"`
+	Action         string     `gorm:"size:50" json:"action"`
+	Context        JSONMap    `gorm:"type:text" json:"context"`
+	ExpectedResult string     `gorm:"size:20" json:"expected_result"`            // allowed, denied, pending_approval
+	ExpectedPolicy string     `gorm:"size:100" json:"expected_policy,omitempty"` // Política decisiva esperada (opcional)
+	Active         bool       `gorm:"default:true" json:"active"`
+	CreatedBy      uuid.UUID  `gorm:"type:uuid" json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+func (PolicyTestCase) TableName() string {
+	return "policy_test_cases"
+}
+
+// PolicyTestResult resultado de um caso
+type PolicyTestResult struct {
+	TestID         uuid.UUID `json:"test_id"`
+	Name           string    `json:"name"`
+	Resource       string    `json:"resource"`
+	Action         string    `json:"action"`
+	ExpectedResult string    `json:"expected_result"`
+	ActualResult   string    `json:"actual_result"`
+	ExpectedPolicy string    `json:"expected_policy,omitempty"`
+	ActualPolicy   string    `json:"actual_policy,omitempty"`
+	Reason         string    `json:"reason"`
+	Passed         bool      `json:"passed"`
+}
+
+// PolicyTestRun execução de uma suíte
+type PolicyTestRun struct {
+	PolicyID *uuid.UUID         `json:"policy_id,omitempty"`
+	DraftID  *uuid.UUID         `json:"draft_id,omitempty"` // Executada com o rascunho no lugar da versão publicada
+	Total    int                `json:"total"`
+	Passed   int                `json:"passed"`
+	Failed   int                `json:"failed"`
+	Results  []PolicyTestResult `json:"results"`
+	RanAt    time.Time          `json:"ran_at"`
+}
+
+func validateTestCase(tc *PolicyTestCase) error {
+	if tc.Name == "" || tc.Resource == "" || tc.Action == "" {
+		return fmt.Errorf("%w: name, resource e action são obrigatórios", ErrInvalidPolicy)
+	}
+	switch tc.ExpectedResult {
+	case ResultAllowed, ResultDenied, ResultPendingApproval:
+	default:
+		return fmt.Errorf("%w: expected_result inválido: %s (use: allowed, denied, pending_approval)", ErrInvalidPolicy, tc.ExpectedResult)
+	}
+	if tc.Context == nil {
+		tc.Context = JSONMap{}
+	}
+	return nil
+}
+
+// ========================================
+// CRUD
+// ========================================
+
+// AddPolicyTest anexa um caso a uma política
+func (s *PolicyService) AddPolicyTest(policyID uuid.UUID, tc *PolicyTestCase) error {
+	if _, err := s.GetPolicy(policyID); err != nil {
+		return err
+	}
+	tc.PolicyID, tc.DraftID = &policyID, nil
+	return s.createPolicyTest(tc)
+}
+
+// AddDraftTest anexa um caso ao rascunho de uma política nova
+func (s *PolicyService) AddDraftTest(draftID uuid.UUID, tc *PolicyTestCase) error {
+	draft, err := s.GetDraft(draftID)
+	if err != nil {
+		return err
+	}
+	if draft.PolicyID != nil {
+		return s.AddPolicyTest(*draft.PolicyID, tc)
+	}
+	tc.PolicyID, tc.DraftID = nil, &draftID
+	return s.createPolicyTest(tc)
+}
+
+func (s *PolicyService) createPolicyTest(tc *PolicyTestCase) error {
+	if err := validateTestCase(tc); err != nil {
+		return err
+	}
+	tc.ID = uuid.New()
+	tc.Active = true
+	tc.CreatedAt = time.Now()
+	return s.db.Create(tc).Error
+}
+
+// ListPolicyTests casos de uma política
+func (s *PolicyService) ListPolicyTests(policyID uuid.UUID) ([]PolicyTestCase, error) {
+	var tests []PolicyTestCase
+	err := s.db.Where("policy_id = ? AND active = ?", policyID, true).Order("created_at ASC").Find(&tests).Error
+	return tests, err
+}
+
+// DeletePolicyTest desativa um caso
+func (s *PolicyService) DeletePolicyTest(id uuid.UUID) error {
+	return s.db.Model(&PolicyTestCase{}).Where("id = ?", id).Update("active", false).Error
+}
+
+// ========================================
+// EXECUÇÃO
+// ========================================
+
+// RunPolicyTests executa a suíte contra as políticas publicadas, ou com um rascunho no lugar.
+// Com rascunho roda TODOS os casos ativos (regressão: a mudança pode quebrar outras políticas);
+// sem rascunho, os casos de policyID (ou todos, se nil).
+func (s *PolicyService) RunPolicyTests(policyID, draftID *uuid.UUID) (*PolicyTestRun, error) {
+	var draft *PolicyDraft
+	query := s.db.Where("active = ?", true).Order("created_at ASC")
+	if draftID != nil {
+		var err error
+		if draft, err = s.GetDraft(*draftID); err != nil {
+			return nil, err
+		}
+		query = query.Where("draft_id IS NULL OR draft_id = ?", *draftID)
+	} else {
+		query = query.Where("draft_id IS NULL")
+		if policyID != nil {
+			query = query.Where("policy_id = ?", *policyID)
+		}
+	}
+
+	var tests []PolicyTestCase
+	if err := query.Find(&tests).Error; err != nil {
+		return nil, err
+	}
+
+	run := &PolicyTestRun{
+		PolicyID: policyID,
+		DraftID:  draftID,
+		Total:    len(tests),
+		Results:  make([]PolicyTestResult, 0, len(tests)),
+		RanAt:    time.Now(),
+	}
+	for _, tc := range tests {
+		req := EvaluationRequest{Resource: tc.Resource, Action: tc.Action, Context: map[string]any(tc.Context)}
+		tenantID, appID := s.resolveScope(req.Context)
+		policies, err := s.ListPoliciesForScope(req.Resource, req.Action, tenantID, appID)
+		if err != nil {
+			return nil, err
+		}
+		if draft != nil {
+			policies = draft.candidatePolicies(policies, req.Resource, req.Action, tenantID, appID)
+		}
+
+		decision := s.decide(req, policies, s.GetResourceConfig(req.Resource))
+		result := PolicyTestResult{
+			TestID:         tc.ID,
+			Name:           tc.Name,
+			Resource:       tc.Resource,
+			Action:         tc.Action,
+			ExpectedResult: tc.ExpectedResult,
+			ActualResult:   decision.result,
+			ExpectedPolicy: tc.ExpectedPolicy,
+			Reason:         decision.reason,
+		}
+		if decision.decisive != nil {
+			result.ActualPolicy = decision.decisive.Name
+		}
+		result.Passed = result.ActualResult == tc.ExpectedResult &&
+			(tc.ExpectedPolicy == "" || result.ActualPolicy == tc.ExpectedPolicy)
+
+		if result.Passed {
+			run.Passed++
+		} else {
+			run.Failed++
+		}
+		run.Results = append(run.Results, result)
+	}
+	return run, nil
+}
+
+// ========================================
+// TESTES DAS POLÍTICAS PADRÃO
+// Valores em centavos, como nas políticas
+// ========================================
+
+var defaultPolicyTests = map[string][]PolicyTestCase{
+	"super_admin_override": {
+		{Name: "super admin debita qualquer valor", Resource: ResourceLedger, Action: ActionDebit,
+			Context: JSONMap{"amount": float64(5000000), "user": map[string]any{"role": "super_admin"}}, ExpectedResult: ResultAllowed},
+	},
+	"admin_access": {
+		{Name: "admin paga acima do limite", Resource: ResourcePayment, Action: "create",
+			Context: JSONMap{"amount": float64(500000), "user": map[string]any{"role": "admin"}}, ExpectedResult: ResultAllowed},
+	},
+	"high_value_debit": {
+		{Name: "débito acima de R$ 100 exige aprovação", Resource: ResourceLedger, Action: ActionDebit,
+			Context: JSONMap{"amount": float64(20000), "user": map[string]any{"role": "user"}}, ExpectedResult: ResultPendingApproval, ExpectedPolicy: "high_value_debit"},
+		{Name: "débito de R$ 50 passa", Resource: ResourceLedger, Action: ActionDebit,
+			Context: JSONMap{"amount": float64(5000), "user": map[string]any{"role": "user"}}, ExpectedResult: ResultAllowed},
+	},
+	"low_value_debit": {
+		{Name: "débito de R$ 100 passa", Resource: ResourceLedger, Action: ActionDebit,
+			Context: JSONMap{"amount": float64(10000), "user": map[string]any{"role": "user"}}, ExpectedResult: ResultAllowed, ExpectedPolicy: "low_value_debit"},
+	},
+	"ledger_account_creation": {
+		{Name: "abertura de conta passa", Resource: ResourceLedger, Action: "create_account",
+			Context: JSONMap{"user_id": "u1"}, ExpectedResult: ResultAllowed, ExpectedPolicy: "ledger_account_creation"},
+		{Name: "ação de ledger sem política é negada", Resource: ResourceLedger, Action: ActionCredit,
+			Context: JSONMap{"amount": float64(5000)}, ExpectedResult: ResultDenied},
+	},
+	"block_high_risk_agent": {
+		{Name: "agente com risco 80% é bloqueado", Resource: ResourceAgent, Action: ActionExecute,
+			Context: JSONMap{"risk_score": 0.8}, ExpectedResult: ResultDenied, ExpectedPolicy: "block_high_risk_agent"},
+	},
+	"medium_risk_agent_approval": {
+		{Name: "agente com risco 45% exige aprovação", Resource: ResourceAgent, Action: ActionExecute,
+			Context: JSONMap{"risk_score": 0.45}, ExpectedResult: ResultPendingApproval, ExpectedPolicy: "medium_risk_agent_approval"},
+		{Name: "agente com risco 10% executa", Resource: ResourceAgent, Action: ActionExecute,
+			Context: JSONMap{"risk_score": 0.1}, ExpectedResult: ResultAllowed},
+	},
+	"high_value_payment": {
+		{Name: "pagamento acima de R$ 1000 exige aprovação", Resource: ResourcePayment, Action: "create",
+			Context: JSONMap{"amount": float64(150000), "user": map[string]any{"role": "user"}}, ExpectedResult: ResultPendingApproval, ExpectedPolicy: "high_value_payment"},
+		{Name: "pagamento de R$ 500 passa", Resource: ResourcePayment, Action: "create",
+			Context: JSONMap{"amount": float64(50000), "user": map[string]any{"role": "user"}}, ExpectedResult: ResultAllowed},
+	},
+}
+
+// seedDefaultPolicyTests cria os casos padrão de uma política que ainda não tem nenhum
+func (s *PolicyService) seedDefaultPolicyTests(policy *Policy) error {
+	cases := defaultPolicyTests[policy.Name]
+	if len(cases) == 0 {
+		return nil
+	}
+
+	var count int64
+	s.db.Model(&PolicyTestCase{}).Where("policy_id = ?", policy.ID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	for _, tc := range cases {
+		tc := tc
+		tc.PolicyID = &policy.ID
+		if err := s.createPolicyTest(&tc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// TEST SUITE HANDLER - Casos de teste de políticas
+// ========================================
+
+// policyTestRequest corpo de criação de caso
+type policyTestRequest struct {
+	Name           string  `json:"name" binding:"required"`
+	Resource       string  `json:"resource" binding:"required"`
+	Action         string  `json:"action" binding:"required"`
+	Context        JSONMap `json:"context"`
+	ExpectedResult string  `json:"expected_result" binding:"required"`
+	ExpectedPolicy string  `json:"expected_policy"`
+}
+
+func (r policyTestRequest) toTestCase(createdBy uuid.UUID) *PolicyTestCase {
+	return &PolicyTestCase{
+		Name:           r.Name,
+		Resource:       r.Resource,
+		Action:         r.Action,
+		Context:        r.Context,
+		ExpectedResult: r.ExpectedResult,
+		ExpectedPolicy: r.ExpectedPolicy,
+		CreatedBy:      createdBy,
+	}
+}
+
+// ListPolicyTests casos de uma política
+// GET /api/v1/policies/:id/tests
+func (h *PolicyHandler) ListPolicyTests(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	tests, err := h.service.ListPolicyTests(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao listar testes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tests)
+}
+
+// AddPolicyTest anexa um caso a uma política
+// POST /api/v1/policies/:id/tests
+func (h *PolicyHandler) AddPolicyTest(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req policyTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tc := req.toTestCase(contextUser(c))
+	if err := h.service.AddPolicyTest(id, tc); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Política não encontrada"})
+			return
+		}
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tc)
+}
+
+// AddDraftTest anexa um caso ao rascunho (política nova ainda sem ID)
+// POST /api/v1/policies/drafts/:draftId/tests
+func (h *PolicyHandler) AddDraftTest(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req policyTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tc := req.toTestCase(contextUser(c))
+	if err := h.service.AddDraftTest(id, tc); err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tc)
+}
+
+// DeletePolicyTest desativa um caso
+// DELETE /api/v1/policies/tests/:testId
+func (h *PolicyHandler) DeletePolicyTest(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("testId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	if err := h.service.DeletePolicyTest(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao remover teste"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Teste removido"})
+}
+
+// RunPolicyTests executa os casos de uma política contra o conjunto publicado
+// POST /api/v1/policies/:id/tests/run
+func (h *PolicyHandler) RunPolicyTests(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	h.respondTestRun(c, &id, nil)
+}
+
+// RunAllPolicyTests executa todos os casos contra o conjunto publicado
+// POST /api/v1/policies/tests/run
+func (h *PolicyHandler) RunAllPolicyTests(c *gin.Context) {
+	h.respondTestRun(c, nil, nil)
+}
+
+// RunDraftTests executa todos os casos com o rascunho no lugar da versão publicada
+// POST /api/v1/policies/drafts/:draftId/tests/run
+func (h *PolicyHandler) RunDraftTests(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	h.respondTestRun(c, nil, &id)
+}
+
+func (h *PolicyHandler) respondTestRun(c *gin.Context, policyID, draftID *uuid.UUID) {
+	run, err := h.service.RunPolicyTests(policyID, draftID)
+	if err != nil {
+		draftError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Suítes de teste de políticas
+// ========================================
+
+func TestDefaultPolicyTestsGuardPublishing(t *testing.T) {
+	s := newTestPolicyService(t)
+	if err := s.SeedDefaultPolicies(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SeedDefaultPolicies(); err != nil { // Idempotente, inclusive os casos
+		t.Fatal(err)
+	}
+
+	run, err := s.RunPolicyTests(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Total != 12 || run.Failed != 0 {
+		t.Fatalf("casos padrão deveriam passar: %+v", run)
+	}
+
+	// Afrouxar o limite de débito quebra a regressão
+	debit, _ := s.GetPolicyByName("high_value_debit")
+	def := policyDefinitionOf(debit)
+	def.Conditions[0].Value = 50000.0
+	author, reviewer := uuid.New(), uuid.New()
+	draft, err := s.CreateDraft(&debit.ID, def, "limite maior", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err = s.RunPolicyTests(nil, &draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Failed != 1 || run.Total != 12 {
+		t.Fatalf("rascunho deveria quebrar um caso: %+v", run)
+	}
+
+	s.SubmitDraft(draft.ID)
+	s.AnalyzeDraftImpact(draft.ID, 0)
+	s.ReviewDraft(draft.ID, true, reviewer, "")
+	if _, err := s.PublishDraft(draft.ID, reviewer); !errors.Is(err, ErrPolicyTestsFailed) {
+		t.Fatalf("publicação deveria ser bloqueada: %v", err)
+	}
+
+	// Política nova com caso próprio: o caso acompanha a publicação
+	newDef := PolicyDefinition{Name: "bloqueio ads", Resource: ResourceAds, Action: ActionAll, Effect: EffectDeny, Active: true}
+	fresh, err := s.CreateDraft(nil, newDef, "", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddDraftTest(fresh.ID, &PolicyTestCase{Name: "ads negado", Resource: ResourceAds, Action: "spend", ExpectedResult: ResultDenied}); err != nil {
+		t.Fatal(err)
+	}
+	s.SubmitDraft(fresh.ID)
+	s.AnalyzeDraftImpact(fresh.ID, 0)
+	s.ReviewDraft(fresh.ID, true, reviewer, "")
+	published, err := s.PublishDraft(fresh.ID, reviewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests, _ := s.ListPolicyTests(published.ID); len(tests) != 1 {
+		t.Errorf("caso do rascunho deveria migrar para a política: %d", len(tests))
+	}
+}
+
+func TestPolicyUpdateCannotBypassTestSuite(t *testing.T) {
+	s := newTestPolicyService(t)
+	if err := s.SeedDefaultPolicies(); err != nil {
+		t.Fatal(err)
+	}
+
+	// PUT /policies/:id só propõe: a política publicada não muda
+	debit, _ := s.GetPolicyByName("high_value_debit")
+	loosened := ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 50000.0}}
+	author, reviewer := uuid.New(), uuid.New()
+	draft, err := s.ProposePolicyUpdate(debit.ID, &Policy{Conditions: loosened}, "", author)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live, _ := s.GetPolicy(debit.ID); live.Version != debit.Version {
+		t.Fatalf("PUT não deveria alterar a política publicada: versão %d", live.Version)
+	}
+
+	s.SubmitDraft(draft.ID)
+	s.AnalyzeDraftImpact(draft.ID, 0)
+	s.ReviewDraft(draft.ID, true, reviewer, "")
+	if _, err := s.PublishDraft(draft.ID, reviewer); !errors.Is(err, ErrPolicyTestsFailed) {
+		t.Fatalf("alteração que quebra a suíte não deveria publicar: %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package policy
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -277,6 +279,67 @@ func (h *ThresholdHandler) RevertAdjustment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "ajuste revertido", "adjustment_id": adjustmentID})
 }
 
+// ========================================
+// RECOMENDADOR ADAPTATIVO
+// ========================================
+
+// GetRecommendations desfechos por política/faixa de risco e ajustes sugeridos
+// GET /api/v1/thresholds/recommendations?window_days=30
+func (h *ThresholdHandler) GetRecommendations(c *gin.Context) {
+	windowDays, _ := strconv.Atoi(c.DefaultQuery("window_days", strconv.Itoa(DefaultRecommendationWindowDays)))
+
+	recommendations, err := h.service.Recommendations(windowDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erro ao calcular recomendações"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"window_days": windowDays, "recommendations": recommendations})
+}
+
+// ProposeAdjustments registra propostas e abre o fluxo de aprovação
+// POST /api/v1/thresholds/proposals?window_days=30
+func (h *ThresholdHandler) ProposeAdjustments(c *gin.Context) {
+	windowDays, _ := strconv.Atoi(c.DefaultQuery("window_days", strconv.Itoa(DefaultRecommendationWindowDays)))
+	userID, _ := uuid.Parse(c.GetString("userID"))
+
+	proposals, err := h.service.ProposeAdjustments(windowDays, userID)
+	if err != nil {
+		if errors.Is(err, ErrApprovalFlowUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "fluxo de aprovação não configurado"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"proposals": proposals, "count": len(proposals)})
+}
+
+// ListProposals lista propostas de ajuste
+// GET /api/v1/thresholds/proposals?status=pending
+func (h *ThresholdHandler) ListProposals(c *gin.Context) {
+	proposals, err := h.service.ListProposals(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erro ao listar propostas"})
+		return
+	}
+
+	c.JSON(http.StatusOK, proposals)
+}
+
+// ResolveProposals aplica propostas aprovadas e encerra as rejeitadas
+// POST /api/v1/thresholds/proposals/resolve
+func (h *ThresholdHandler) ResolveProposals(c *gin.Context) {
+	resolved, err := h.service.ResolveProposals()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"resolved": resolved, "count": len(resolved)})
+}
+
 // ========================================
 // ROUTE REGISTRATION
 // ========================================
@@ -300,6 +363,12 @@ func RegisterThresholdRoutes(router *gin.RouterGroup, service *ThresholdService,
 		// Recomendação
 		thresholds.POST("/recommend", handler.GetRecommendation)
 		
+		// Recomendador adaptativo (propostas passam pelo fluxo de aprovação)
+		thresholds.GET("/recommendations", adminMiddleware, handler.GetRecommendations)
+		thresholds.GET("/proposals", adminMiddleware, handler.ListProposals)
+		thresholds.POST("/proposals", adminMiddleware, handler.ProposeAdjustments)
+		thresholds.POST("/proposals/resolve", adminMiddleware, handler.ResolveProposals)
+		
 		// Reversão
 		thresholds.POST("/adjustments/:adjustmentId/revert", adminMiddleware, handler.RevertAdjustment)
 		
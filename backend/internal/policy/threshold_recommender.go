@@ -0,0 +1,488 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"prost-qs/backend/internal/approval"
+	"prost-qs/backend/internal/authority"
+	"prost-qs/backend/internal/observer"
+)
+
+// ========================================
+// ADAPTIVE THRESHOLDS - Recomendador de ajustes
+// "O sistema propõe, o humano decide"
+// ========================================
+//
+// Desfechos considerados (por política e faixa de risco da avaliação):
+//   - ApprovalDecision de solicitações com Context.Metadata["policy_evaluation_id"]
+//   - HumanDecision cujo suggestion_id é o ID da avaliação (accepted = aprovado, ignored = rejeitado)
+// Cada avaliação conta uma vez; com as duas fontes, vale a ApprovalDecision.
+
+// Parâmetros do recomendador
+const (
+	DefaultRecommendationWindowDays = 30
+	RecommenderMinSamples           = 20   // Abaixo disso não há evidência suficiente
+	RecommenderRelaxRate            = 0.95 // Taxa de aprovação para afrouxar um degrau
+	RecommenderTightenRate          = 0.50 // Taxa de rejeição para apertar um degrau
+
+	// ApprovalMetadataEvaluationID chave que liga uma ApprovalRequest à avaliação de política
+	ApprovalMetadataEvaluationID = "policy_evaluation_id"
+
+	approvalDomainPolicy   = "policy"
+	approvalActionAdjust   = "adjust_threshold"
+	proposalTriggerType    = "automatic"
+	proposalApprovalExpiry = 72 // horas
+)
+
+// Estados de uma proposta
+const (
+	ProposalStatusPending  = "pending"  // Aguardando a aprovação
+	ProposalStatusApplied  = "applied"  // Aprovada e aplicada como ThresholdAdjustment
+	ProposalStatusRejected = "rejected" // Rejeitada (ou expirada) no fluxo de aprovação
+	ProposalStatusStale    = "stale"    // Aprovada, mas o threshold mudou desde a proposta (não aplicada)
+)
+
+var (
+	ErrApprovalFlowUnavailable = errors.New("approval flow not configured")
+	ErrProposalNotFound        = errors.New("threshold proposal not found")
+	ErrProposalStale           = errors.New("threshold changed since the proposal")
+)
+
+// ApprovalMetadata metadados que ligam a ApprovalRequest à avaliação.
+// Toda aprovação aberta a partir de pending_approval deve incluí-los para o desfecho contar.
+func (r *EvaluationResponse) ApprovalMetadata() map[string]any {
+	metadata := map[string]any{}
+	if r.EvaluationID != nil {
+		metadata[ApprovalMetadataEvaluationID] = *r.EvaluationID
+	}
+	if r.PolicyID != nil {
+		metadata["policy_id"] = *r.PolicyID
+	}
+	return metadata
+}
+
+// thresholdLadder do mais permissivo ao mais restritivo
+var thresholdLadder = []ThresholdAction{
+	ThresholdActionAllow,
+	ThresholdActionRequireApproval,
+	ThresholdActionShadow,
+	ThresholdActionBlock,
+}
+
+// BandOutcome desfechos humanos de uma política numa faixa de risco
+type BandOutcome struct {
+	PolicyID     uuid.UUID       `json:"policy_id"`
+	PolicyName   string          `json:"policy_name"`
+	RiskLevel    string          `json:"risk_level"`
+	Samples      int             `json:"samples"`
+	Approved     int             `json:"approved"`
+	Rejected     int             `json:"rejected"`
+	ApprovalRate float64         `json:"approval_rate"`
+	Current      ThresholdAction `json:"current_action"`
+	Proposed     ThresholdAction `json:"proposed_action,omitempty"` // Vazio = manter
+	Rationale    string          `json:"rationale,omitempty"`
+}
+
+// ThresholdProposal ajuste proposto, pendente do fluxo de aprovação
+type ThresholdProposal struct {
+	ID             uuid.UUID       `gorm:"type:text;primaryKey" json:"id"`
+	PolicyID       uuid.UUID       `gorm:"type:text;not null;index:idx_proposal_band" json:"policy_id"`
+	RiskLevel      string          `gorm:"type:text;not null;index:idx_proposal_band" json:"risk_level"`
+	ThresholdID    *uuid.UUID      `gorm:"type:text" json:"threshold_id,omitempty"` // nil = padrão do sistema (cria threshold ao aplicar)
+	CurrentAction  ThresholdAction `gorm:"type:text;not null" json:"current_action"`
+	ProposedAction ThresholdAction `gorm:"type:text;not null" json:"proposed_action"`
+
+	// Evidência
+	Samples      int     `json:"samples"`
+	Approved     int     `json:"approved"`
+	Rejected     int     `json:"rejected"`
+	ApprovalRate float64 `json:"approval_rate"`
+	WindowDays   int     `json:"window_days"`
+	Rationale    string  `gorm:"type:text" json:"rationale"`
+
+	// Fluxo de aprovação
+	ApprovalRequestID *uuid.UUID `gorm:"type:text" json:"approval_request_id,omitempty"`
+	Status            string     `gorm:"type:text;not null;index" json:"status"`
+	AdjustmentID      *uuid.UUID `gorm:"type:text" json:"adjustment_id,omitempty"`
+	ProposedBy        uuid.UUID  `gorm:"type:text" json:"proposed_by"`
+	CreatedAt         time.Time  `gorm:"not null" json:"created_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+}
+
+func (ThresholdProposal) TableName() string {
+	return "threshold_proposals"
+}
+
+// ========================================
+// COLETA DE DESFECHOS
+// ========================================
+
+type evaluationBand struct {
+	policyID   uuid.UUID
+	policyName string
+	riskLevel  string
+}
+
+// evaluationRiskLevel faixa de risco registrada no contexto da avaliação
+func evaluationRiskLevel(context JSONMap) string {
+	if level, ok := context["risk_level"].(string); ok && isValidRiskLevel(level) {
+		return level
+	}
+	score, _ := context["risk_score"].(float64)
+	return riskLevelForScore(score)
+}
+
+// CollectOutcomes agrega aprovações/rejeições humanas por política e faixa de risco
+func (s *ThresholdService) CollectOutcomes(windowDays int) ([]BandOutcome, error) {
+	if windowDays <= 0 {
+		windowDays = DefaultRecommendationWindowDays
+	}
+	since := time.Now().AddDate(0, 0, -windowDays)
+
+	// Avaliações que pediram decisão humana
+	var evaluations []PolicyEvaluation
+	if err := s.db.Where("result = ? AND policy_id IS NOT NULL AND evaluated_at >= ?", ResultPendingApproval, since).
+		Find(&evaluations).Error; err != nil {
+		return nil, err
+	}
+	bands := make(map[uuid.UUID]evaluationBand, len(evaluations))
+	ids := make([]uuid.UUID, 0, len(evaluations))
+	for _, eval := range evaluations {
+		bands[eval.ID] = evaluationBand{policyID: *eval.PolicyID, policyName: eval.PolicyName, riskLevel: evaluationRiskLevel(eval.Context)}
+		ids = append(ids, eval.ID)
+	}
+
+	// Um desfecho por avaliação: a ApprovalDecision (coletada primeiro) prevalece
+	// sobre a HumanDecision do console para a mesma solicitação
+	outcomes := make(map[evaluationBand]*BandOutcome)
+	decided := make(map[uuid.UUID]bool)
+	record := func(evalID uuid.UUID, approved bool) {
+		band, ok := bands[evalID]
+		if !ok || decided[evalID] {
+			return
+		}
+		decided[evalID] = true
+		outcome := outcomes[band]
+		if outcome == nil {
+			outcome = &BandOutcome{PolicyID: band.policyID, PolicyName: band.policyName, RiskLevel: band.riskLevel}
+			outcomes[band] = outcome
+		}
+		outcome.Samples++
+		if approved {
+			outcome.Approved++
+		} else {
+			outcome.Rejected++
+		}
+	}
+
+	// 1. Fluxo de aprovação (ApprovalDecision)
+	var requests []approval.ApprovalRequest
+	if err := s.db.Where("created_at >= ? AND decision_id IS NOT NULL", since).Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	requestEval := make(map[uuid.UUID]uuid.UUID)
+	decisionIDs := make([]uuid.UUID, 0, len(requests))
+	for _, req := range requests {
+		raw, _ := req.Context.Metadata[ApprovalMetadataEvaluationID].(string)
+		evalID, err := uuid.Parse(raw)
+		if err != nil {
+			continue
+		}
+		requestEval[req.ID] = evalID
+		decisionIDs = append(decisionIDs, *req.DecisionID)
+	}
+	if len(decisionIDs) > 0 {
+		var decisions []approval.ApprovalDecision
+		if err := s.db.Where("id IN ?", decisionIDs).Find(&decisions).Error; err != nil {
+			return nil, err
+		}
+		for _, d := range decisions {
+			switch d.Decision {
+			case approval.StatusApproved:
+				record(requestEval[d.RequestID], true)
+			case approval.StatusRejected:
+				record(requestEval[d.RequestID], false)
+			}
+		}
+	}
+
+	// 2. Decisões no console (HumanDecision sobre a própria avaliação)
+	if len(ids) > 0 {
+		var humans []observer.HumanDecision
+		if err := s.db.Where("suggestion_id IN ? AND decision IN ?", ids,
+			[]observer.DecisionType{observer.DecisionAccepted, observer.DecisionIgnored}).Find(&humans).Error; err != nil {
+			return nil, err
+		}
+		for _, h := range humans {
+			record(h.SuggestionID, h.Decision == observer.DecisionAccepted)
+		}
+	}
+
+	result := make([]BandOutcome, 0, len(outcomes))
+	for _, outcome := range outcomes {
+		outcome.ApprovalRate = float64(outcome.Approved) / float64(outcome.Samples)
+		result = append(result, *outcome)
+	}
+	return result, nil
+}
+
+// ========================================
+// RECOMENDAÇÃO
+// ========================================
+
+// recommendStep um degrau na escada allow → require_approval → shadow → block
+func recommendStep(current ThresholdAction, outcome BandOutcome) (ThresholdAction, string) {
+	if outcome.Samples < RecommenderMinSamples {
+		return "", ""
+	}
+	step := 0
+	for i, action := range thresholdLadder {
+		if action == current {
+			step = i
+		}
+	}
+
+	rejectionRate := float64(outcome.Rejected) / float64(outcome.Samples)
+	switch {
+	case outcome.ApprovalRate >= RecommenderRelaxRate && step > 0:
+		proposed := thresholdLadder[step-1]
+		return proposed, fmt.Sprintf("%.0f%% das decisões %s de risco %s foram aprovadas (%d/%d); propor %s",
+			outcome.ApprovalRate*100, current, outcome.RiskLevel, outcome.Approved, outcome.Samples, proposed)
+	case rejectionRate >= RecommenderTightenRate && step < len(thresholdLadder)-1:
+		proposed := thresholdLadder[step+1]
+		return proposed, fmt.Sprintf("%.0f%% das decisões %s de risco %s foram rejeitadas (%d/%d); propor %s",
+			rejectionRate*100, current, outcome.RiskLevel, outcome.Rejected, outcome.Samples, proposed)
+	}
+	return "", ""
+}
+
+// Recommendations desfechos por faixa com a ação atual e a proposta (sem efeito colateral)
+func (s *ThresholdService) Recommendations(windowDays int) ([]BandOutcome, error) {
+	outcomes, err := s.CollectOutcomes(windowDays)
+	if err != nil {
+		return nil, err
+	}
+	for i := range outcomes {
+		current, _ := s.GetRecommendation(outcomes[i].PolicyID, nil, outcomes[i].RiskLevel, 0)
+		outcomes[i].Current = current.Action
+		outcomes[i].Proposed, outcomes[i].Rationale = recommendStep(current.Action, outcomes[i])
+	}
+	return outcomes, nil
+}
+
+// ProposeAdjustments registra propostas e abre uma ApprovalRequest para cada.
+// Faixas com proposta pendente são puladas.
+func (s *ThresholdService) ProposeAdjustments(windowDays int, proposedBy uuid.UUID) ([]ThresholdProposal, error) {
+	if s.approvalService == nil {
+		return nil, ErrApprovalFlowUnavailable
+	}
+	if windowDays <= 0 {
+		windowDays = DefaultRecommendationWindowDays
+	}
+	recommendations, err := s.Recommendations(windowDays)
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := []ThresholdProposal{}
+	for _, rec := range recommendations {
+		if rec.Proposed == "" {
+			continue
+		}
+		var pending int64
+		s.db.Model(&ThresholdProposal{}).Where("policy_id = ? AND risk_level = ? AND status = ?",
+			rec.PolicyID, rec.RiskLevel, ProposalStatusPending).Count(&pending)
+		if pending > 0 {
+			continue
+		}
+
+		proposal := ThresholdProposal{
+			ID:             uuid.New(),
+			PolicyID:       rec.PolicyID,
+			RiskLevel:      rec.RiskLevel,
+			CurrentAction:  rec.Current,
+			ProposedAction: rec.Proposed,
+			Samples:        rec.Samples,
+			Approved:       rec.Approved,
+			Rejected:       rec.Rejected,
+			ApprovalRate:   rec.ApprovalRate,
+			WindowDays:     windowDays,
+			Rationale:      rec.Rationale,
+			Status:         ProposalStatusPending,
+			ProposedBy:     proposedBy,
+			CreatedAt:      time.Now(),
+		}
+		if threshold, err := s.GetThreshold(rec.PolicyID, nil, rec.RiskLevel); err == nil {
+			proposal.ThresholdID = &threshold.ID
+		}
+
+		req, err := s.approvalService.CreateRequest(approval.CreateApprovalRequest{
+			Domain: approvalDomainPolicy,
+			Action: approvalActionAdjust,
+			Impact: authority.ImpactMedium,
+			Context: approval.ApprovalContext{
+				Intent:               fmt.Sprintf("Threshold %s → %s (%s, risco %s)", rec.Current, rec.Proposed, rec.PolicyName, rec.RiskLevel),
+				Description:          rec.Rationale,
+				SystemRecommendation: string(rec.Proposed),
+				RiskAssessment:       fmt.Sprintf("%d decisões em %d dias", rec.Samples, windowDays),
+				Metadata: map[string]any{
+					"proposal_id":     proposal.ID.String(),
+					"policy_id":       rec.PolicyID.String(),
+					"risk_level":      rec.RiskLevel,
+					"current_action":  rec.Current,
+					"proposed_action": rec.Proposed,
+				},
+			},
+			RequestedBy:     proposedBy,
+			RequestedByType: "system",
+			RequestReason:   rec.Rationale,
+			ExpiresInHours:  proposalApprovalExpiry,
+		})
+		if err != nil {
+			return proposals, fmt.Errorf("erro ao abrir aprovação: %w", err)
+		}
+		proposal.ApprovalRequestID = &req.ID
+
+		if err := s.db.Create(&proposal).Error; err != nil {
+			return proposals, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	return proposals, nil
+}
+
+// ListProposals propostas (status vazio = todas)
+func (s *ThresholdService) ListProposals(status string) ([]ThresholdProposal, error) {
+	var proposals []ThresholdProposal
+	query := s.db.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&proposals).Error
+	return proposals, err
+}
+
+// ========================================
+// APLICAÇÃO
+// ========================================
+
+// ResolveProposals aplica as propostas aprovadas e encerra as rejeitadas/expiradas.
+// A decisão é lida da ApprovalRequest — aprovação é evento, não comando.
+func (s *ThresholdService) ResolveProposals() ([]ThresholdProposal, error) {
+	pending, err := s.ListProposals(ProposalStatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := []ThresholdProposal{}
+	for _, proposal := range pending {
+		if proposal.ApprovalRequestID == nil {
+			continue
+		}
+		var req approval.ApprovalRequest
+		if err := s.db.Where("id = ?", *proposal.ApprovalRequestID).First(&req).Error; err != nil {
+			continue
+		}
+
+		switch {
+		case req.Status == approval.StatusApproved && req.DecisionID != nil:
+			var decision approval.ApprovalDecision
+			if err := s.db.Where("id = ?", *req.DecisionID).First(&decision).Error; err != nil {
+				return resolved, err
+			}
+			if err := s.applyProposal(&proposal, decision); errors.Is(err, ErrProposalStale) {
+				// Aprovada sobre um estado que não existe mais: encerra sem aplicar
+				now := time.Now()
+				proposal.Status = ProposalStatusStale
+				proposal.ResolvedAt = &now
+				if err := s.db.Save(&proposal).Error; err != nil {
+					return resolved, err
+				}
+			} else if err != nil {
+				return resolved, err
+			}
+		case req.Status == approval.StatusRejected, req.Status == approval.StatusExpired,
+			req.Status == approval.StatusCancelled, req.Status == approval.StatusPending && req.IsExpired():
+			now := time.Now()
+			proposal.Status = ProposalStatusRejected
+			proposal.ResolvedAt = &now
+			if err := s.db.Save(&proposal).Error; err != nil {
+				return resolved, err
+			}
+		default:
+			continue
+		}
+		resolved = append(resolved, proposal)
+	}
+	return resolved, nil
+}
+
+// applyProposal grava o novo threshold e o ThresholdAdjustment correspondente numa transação.
+// Só aplica se o threshold ainda está na ação de quando a proposta foi feita; senão ErrProposalStale.
+func (s *ThresholdService) applyProposal(proposal *ThresholdProposal, decision approval.ApprovalDecision) error {
+	now := time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		ts := &ThresholdService{db: tx, approvalService: s.approvalService}
+
+		// Threshold vivo da faixa (pode ter sido criado depois da proposta)
+		threshold, err := ts.GetThreshold(proposal.PolicyID, nil, proposal.RiskLevel)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if threshold == nil {
+			if GetDefaultAction(proposal.RiskLevel) != proposal.CurrentAction {
+				return ErrProposalStale
+			}
+			// Padrão do sistema → threshold explícito para a política
+			created, err := ts.CreateThreshold(CreateThresholdRequest{
+				PolicyID:    proposal.PolicyID,
+				RiskLevel:   proposal.RiskLevel,
+				Action:      proposal.CurrentAction,
+				Description: "Criado pelo recomendador de thresholds",
+			}, decision.DecidedBy)
+			if err != nil {
+				return err
+			}
+			threshold = created
+		}
+		if threshold.Action != proposal.CurrentAction {
+			return ErrProposalStale
+		}
+
+		adjustment := &ThresholdAdjustment{
+			ID:             uuid.New(),
+			ThresholdID:    threshold.ID,
+			PreviousAction: threshold.Action,
+			NewAction:      proposal.ProposedAction,
+			Reason:         fmt.Sprintf("%s — aprovado: %s", proposal.Rationale, decision.Justification),
+			TriggerType:    proposalTriggerType,
+			DaysAnalyzed:   proposal.WindowDays,
+			AdjustedBy:     decision.DecidedBy.String(),
+			CreatedAt:      now,
+		}
+		if err := tx.Create(adjustment).Error; err != nil {
+			return fmt.Errorf("erro ao registrar ajuste: %w", err)
+		}
+
+		// Escrita condicional: outra réplica/admin pode ter alterado o threshold entre a leitura e aqui
+		result := tx.Model(&PolicyThreshold{}).
+			Where("id = ? AND action = ?", threshold.ID, proposal.CurrentAction).
+			Updates(map[string]any{"action": proposal.ProposedAction, "updated_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrProposalStale
+		}
+
+		proposal.ThresholdID = &threshold.ID
+		proposal.AdjustmentID = &adjustment.ID
+		proposal.Status = ProposalStatusApplied
+		proposal.ResolvedAt = &now
+		return tx.Save(proposal).Error
+	})
+}
@@ -0,0 +1,144 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"prost-qs/backend/internal/approval"
+	"prost-qs/backend/internal/audit"
+	"prost-qs/backend/internal/authority"
+	"prost-qs/backend/internal/observer"
+)
+
+// ========================================
+// TESTES - Recomendador de thresholds
+// ========================================
+
+func TestThresholdRecommenderProposesThroughApproval(t *testing.T) {
+	db := newTestPolicyService(t).db
+	if err := db.AutoMigrate(&PolicyThreshold{}, &ThresholdAdjustment{}, &ThresholdProposal{},
+		&approval.ApprovalRequest{}, &approval.ApprovalDecision{}, &observer.HumanDecision{},
+		&authority.DecisionAuthority{}, &audit.AuditEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	ts := NewThresholdService(db)
+	ts.SetApprovalService(approval.NewApprovalService(db, authority.NewAuthorityService(db), audit.NewAuditService(db)))
+
+	// 20 decisões de risco médio: 12 pelo fluxo de aprovação, 8 no console (1 ignorada) = 95%
+	policyID, reviewer := uuid.New(), uuid.New()
+	for i := 0; i < 20; i++ {
+		eval := PolicyEvaluation{ID: uuid.New(), PolicyID: &policyID, PolicyName: "medium_risk_agent_approval",
+			Result: ResultPendingApproval, Context: JSONMap{"risk_score": 0.4}, EvaluatedAt: time.Now()}
+		db.Create(&eval)
+
+		if i < 12 {
+			decisionID := uuid.New()
+			db.Create(&approval.ApprovalRequest{ID: uuid.New(), Status: approval.StatusApproved, DecisionID: &decisionID, CreatedAt: time.Now(),
+				Context: approval.ApprovalContext{Metadata: map[string]any{ApprovalMetadataEvaluationID: eval.ID.String()}}})
+			var req approval.ApprovalRequest
+			db.Where("decision_id = ?", decisionID).First(&req)
+			db.Create(&approval.ApprovalDecision{ID: decisionID, RequestID: req.ID, Decision: approval.StatusApproved, DecidedAt: time.Now()})
+			if i == 0 {
+				// Mesma solicitação também decidida no console: conta uma vez só
+				db.Create(&observer.HumanDecision{ID: uuid.New(), SuggestionID: eval.ID, Decision: observer.DecisionIgnored, CreatedAt: time.Now()})
+			}
+			continue
+		}
+		decision := observer.DecisionAccepted
+		if i == 19 {
+			decision = observer.DecisionIgnored
+		}
+		db.Create(&observer.HumanDecision{ID: uuid.New(), SuggestionID: eval.ID, Decision: decision, CreatedAt: time.Now()})
+	}
+
+	recs, err := ts.Recommendations(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].RiskLevel != "medium" || recs[0].Samples != 20 || recs[0].Approved != 19 ||
+		recs[0].Current != ThresholdActionRequireApproval || recs[0].Proposed != ThresholdActionAllow {
+		t.Fatalf("recomendação inesperada: %+v", recs)
+	}
+
+	proposals, err := ts.ProposeAdjustments(0, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proposals) != 1 || proposals[0].ApprovalRequestID == nil {
+		t.Fatalf("deveria abrir uma aprovação: %+v", proposals)
+	}
+	if again, _ := ts.ProposeAdjustments(0, uuid.New()); len(again) != 0 {
+		t.Error("faixa com proposta pendente não deveria ser reproposta")
+	}
+
+	// Ainda pendente: nada a aplicar
+	if resolved, _ := ts.ResolveProposals(); len(resolved) != 0 {
+		t.Fatal("proposta pendente não deveria ser aplicada")
+	}
+
+	// Humano aprova no fluxo existente
+	decision := approval.ApprovalDecision{ID: uuid.New(), RequestID: *proposals[0].ApprovalRequestID, DecidedBy: reviewer,
+		Decision: approval.StatusApproved, Justification: "evidência suficiente", DecidedAt: time.Now()}
+	db.Create(&decision)
+	db.Model(&approval.ApprovalRequest{}).Where("id = ?", decision.RequestID).
+		Updates(map[string]any{"status": approval.StatusApproved, "decision_id": decision.ID})
+
+	resolved, err := ts.ResolveProposals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 || resolved[0].Status != ProposalStatusApplied {
+		t.Fatalf("proposta aprovada deveria ser aplicada: %+v", resolved)
+	}
+
+	threshold, err := ts.GetThreshold(policyID, nil, "medium")
+	if err != nil || threshold.Action != ThresholdActionAllow {
+		t.Fatalf("threshold deveria ser allow: %+v %v", threshold, err)
+	}
+	history, _ := ts.GetAdjustmentHistory(threshold.ID, 10)
+	if len(history) != 1 || history[0].TriggerType != "automatic" || history[0].AdjustedBy != reviewer.String() ||
+		history[0].PreviousAction != ThresholdActionRequireApproval {
+		t.Fatalf("ajuste deveria ser registrado: %+v", history)
+	}
+}
+
+func TestThresholdProposalStaleWhenThresholdChanged(t *testing.T) {
+	db := newTestPolicyService(t).db
+	if err := db.AutoMigrate(&PolicyThreshold{}, &ThresholdAdjustment{}, &ThresholdProposal{},
+		&approval.ApprovalRequest{}, &approval.ApprovalDecision{}); err != nil {
+		t.Fatal(err)
+	}
+	ts := NewThresholdService(db)
+
+	policyID := uuid.New()
+	threshold, err := ts.CreateThreshold(CreateThresholdRequest{PolicyID: policyID, RiskLevel: "medium", Action: ThresholdActionRequireApproval}, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Aprovada para afrouxar require_approval → allow, mas um admin já bloqueou a faixa
+	decision := approval.ApprovalDecision{ID: uuid.New(), RequestID: uuid.New(), DecidedBy: uuid.New(),
+		Decision: approval.StatusApproved, Justification: "evidência suficiente", DecidedAt: time.Now()}
+	db.Create(&decision)
+	db.Create(&approval.ApprovalRequest{ID: decision.RequestID, Status: approval.StatusApproved, DecisionID: &decision.ID, CreatedAt: time.Now()})
+	db.Create(&ThresholdProposal{ID: uuid.New(), PolicyID: policyID, RiskLevel: "medium", ThresholdID: &threshold.ID,
+		CurrentAction: ThresholdActionRequireApproval, ProposedAction: ThresholdActionAllow,
+		ApprovalRequestID: &decision.RequestID, Status: ProposalStatusPending, CreatedAt: time.Now()})
+	db.Model(&PolicyThreshold{}).Where("id = ?", threshold.ID).Update("action", ThresholdActionBlock)
+
+	resolved, err := ts.ResolveProposals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 || resolved[0].Status != ProposalStatusStale || resolved[0].AdjustmentID != nil {
+		t.Fatalf("proposta deveria ser encerrada como stale: %+v", resolved)
+	}
+
+	live, _ := ts.GetThresholdByID(threshold.ID)
+	var adjustments int64
+	db.Model(&ThresholdAdjustment{}).Count(&adjustments)
+	if live.Action != ThresholdActionBlock || adjustments != 0 {
+		t.Errorf("threshold não deveria mudar: action=%s ajustes=%d", live.Action, adjustments)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"prost-qs/backend/internal/approval"
 )
 
 // ========================================
@@ -14,13 +15,19 @@ import (
 // ========================================
 
 type ThresholdService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	approvalService *approval.ApprovalService // Propostas do recomendador passam por aprovação
 }
 
 func NewThresholdService(db *gorm.DB) *ThresholdService {
 	return &ThresholdService{db: db}
 }
 
+// SetApprovalService configura o fluxo de aprovação das propostas de ajuste
+func (s *ThresholdService) SetApprovalService(approvalSvc *approval.ApprovalService) {
+	s.approvalService = approvalSvc
+}
+
 // ========================================
 // CRUD
 // ========================================
@@ -0,0 +1,92 @@
+package policy
+
+import (
+	"fmt"
+
+	"prost-qs/backend/internal/explainability"
+)
+
+// ========================================
+// TRACE - Por que cada política casou (ou não)
+// "Decisão sem explicação é só um if"
+// ========================================
+
+// tracePolicy avalia a política registrando cada condição.
+// Todas as condições aparecem no trace, mas o resultado respeita o
+// curto-circuito de evaluateConditions (mesma decisão, mesmo erro),
+// então o explain decide a partir do próprio trace, sem reavaliar.
+func (s *PolicyService) tracePolicy(policy Policy, context map[string]any) (explainability.PolicyTraceSnapshot, bool, error) {
+	conditions, matched, err := s.traceGroup(policy.Conditions, context, "conditions", true)
+	snapshot := explainability.PolicyTraceSnapshot{
+		PolicyID:   policy.ID,
+		PolicyName: policy.Name,
+		Effect:     policy.Effect,
+		Matched:    matched,
+		Conditions: conditions,
+	}
+	if err != nil {
+		snapshot.Error = err.Error()
+	}
+	return snapshot, matched, err
+}
+
+// traceGroup avalia filhos de um grupo all (AND) ou any (OR)
+func (s *PolicyService) traceGroup(children []Condition, context map[string]any, path string, all bool) ([]explainability.ConditionTraceSnapshot, bool, error) {
+	snapshots := make([]explainability.ConditionTraceSnapshot, 0, len(children))
+	result := all // all: verdadeiro até um falso; any: falso até um verdadeiro
+	var groupErr error
+	decided := false
+
+	for i, child := range children {
+		snapshot, err := s.traceCondition(child, context, fmt.Sprintf("%s[%d]", path, i))
+		snapshots = append(snapshots, snapshot)
+		if decided {
+			continue // Após o curto-circuito só registra
+		}
+		if err != nil {
+			result, groupErr, decided = false, err, true
+			continue
+		}
+		if snapshot.Result != all {
+			result, decided = !all, true
+		}
+	}
+	return snapshots, result, groupErr
+}
+
+// traceCondition avalia uma condição (folha ou grupo) registrando valores resolvidos
+func (s *PolicyService) traceCondition(cond Condition, context map[string]any, path string) (explainability.ConditionTraceSnapshot, error) {
+	snapshot := explainability.ConditionTraceSnapshot{Path: path}
+	var err error
+
+	switch {
+	case cond.All != nil:
+		snapshot.Group = "all"
+		snapshot.Children, snapshot.Result, err = s.traceGroup(cond.All, context, path+".all", true)
+	case cond.Any != nil:
+		snapshot.Group = "any"
+		snapshot.Children, snapshot.Result, err = s.traceGroup(cond.Any, context, path+".any", false)
+	case cond.Not != nil:
+		snapshot.Group = "not"
+		var child explainability.ConditionTraceSnapshot
+		child, err = s.traceCondition(*cond.Not, context, path+".not")
+		snapshot.Children = []explainability.ConditionTraceSnapshot{child}
+		snapshot.Result = err == nil && !child.Result
+	default:
+		snapshot.Field = cond.Field
+		snapshot.Operator = cond.Operator
+		snapshot.ValueField = cond.ValueField
+		snapshot.Value = s.extractValue(cond.Field, context)
+		snapshot.Expected = cond.Value
+		if cond.ValueField != "" {
+			snapshot.Expected = s.extractValue(cond.ValueField, context)
+		}
+		snapshot.Result, err = s.evaluateCondition(cond, context)
+	}
+
+	if err != nil {
+		snapshot.Result = false
+		snapshot.Error = err.Error()
+	}
+	return snapshot, err
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// TESTES - Trace de avaliação
+// ========================================
+
+func newTestPolicyService(t *testing.T) *PolicyService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Policy{}, &PolicyEvaluation{}, &ResourcePolicyConfig{}, &ResourcePolicyConfigVersion{}, &PolicyVersion{}, &PolicyDraft{}, &PolicyTestCase{}, &PolicyCacheState{}); err != nil {
+		t.Fatal(err)
+	}
+	return &PolicyService{db: db}
+}
+
+func TestEvaluateTraceRecordsConditionsAndErrors(t *testing.T) {
+	s := newTestPolicyService(t)
+
+	// Operador desconhecido gravado direto no banco (política legada)
+	broken := &Policy{Name: "quebrada", Resource: ResourceLedger, Action: ActionAll, Effect: EffectDeny, Priority: 200, Active: true,
+		Conditions: ConditionList{{Field: "amount", Operator: OpGreaterThan, Value: 0.0}}}
+	limit := &Policy{Name: "limite diário", Resource: ResourceLedger, Action: ActionAll, Effect: EffectRequireApproval, Priority: 100, Active: true,
+		Conditions: ConditionList{{Any: []Condition{
+			{Field: "user.role", Operator: OpEqual, Value: "admin"},
+			{Field: "amount", Operator: OpGreaterThan, ValueField: "account.daily_limit"},
+		}}}}
+	for _, p := range []*Policy{broken, limit} {
+		if err := s.CreatePolicy(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.db.Model(broken).Update("conditions", `[{"field":"amount","operator":"between"}]`)
+
+	context := map[string]any{"amount": 500.0, "user": map[string]any{"role": "user"}, "account": map[string]any{"daily_limit": 300.0}}
+
+	// Sem explain: só a política pulada por erro aparece
+	response, err := s.Evaluate(EvaluationRequest{Resource: ResourceLedger, Action: ActionDebit, Context: context})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result != ResultPendingApproval || len(response.Trace) != 1 || response.Trace[0].Error == "" {
+		t.Fatalf("erro deveria ser registrado: %+v", response.Trace)
+	}
+
+	// Com explain: todas, com valores resolvidos
+	response, _ = s.Evaluate(EvaluationRequest{Resource: ResourceLedger, Action: ActionDebit, Context: context, Explain: true})
+	if len(response.Trace) != 2 || !response.Trace[1].Matched {
+		t.Fatalf("trace incompleto: %+v", response.Trace)
+	}
+	group := response.Trace[1].Conditions[0]
+	if group.Group != "any" || len(group.Children) != 2 {
+		t.Fatalf("grupo any esperado: %+v", group)
+	}
+	leaf := group.Children[1]
+	if leaf.Path != "conditions[0].any[1]" || leaf.Value != 500.0 || leaf.Expected != 300.0 || !leaf.Result {
+		t.Errorf("folha inesperada: %+v", leaf)
+	}
+
+	stored, err := s.GetEvaluation(uuid.MustParse(*response.EvaluationID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Trace) != 2 || stored.Trace[0].Error == "" {
+		t.Errorf("trace não persistido: %+v", stored.Trace)
+	}
+}
@@ -0,0 +1,331 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// ANOMALIA - Baselines estatísticos por app e métrica
+// "online_now > 100 às 3h da manhã não é o mesmo que às 21h"
+// ========================================
+
+const (
+	// anomalyEWMAAlpha peso de cada amostra (1/min) na média móvel exponencial
+	anomalyEWMAAlpha = 0.05
+
+	// anomalyGlobalBucket linha do baseline EWMA; 0..167 = hora da semana (UTC)
+	anomalyGlobalBucket = -1
+
+	// defaultAnomalyZScore desvio padrão a partir do qual a regra dispara
+	defaultAnomalyZScore = 3.0
+
+	// defaultAnomalyMinSamples amostras mínimas antes de disparar (aquecimento)
+	defaultAnomalyMinSamples = 60
+
+	// minSeasonalSamples amostras mínimas na hora da semana para usar o perfil sazonal
+	minSeasonalSamples = 30
+
+	// anomalyMaxStaleness observação mais velha que isso é ignorada
+	anomalyMaxStaleness = 3 * time.Minute
+
+	// Direções
+	AnomalyUp   = "up"
+	AnomalyDown = "down"
+	AnomalyBoth = "both"
+)
+
+// AnomalyTriggerConfig config para trigger de anomalia
+type AnomalyTriggerConfig struct {
+	Metric     string  `json:"metric"`      // Ex: "online_now", "events_per_minute"
+	ZScore     float64 `json:"z_score"`     // Desvio mínimo (default 3)
+	Direction  string  `json:"direction"`   // "up", "down" ou "both" (default)
+	Seasonal   bool    `json:"seasonal"`    // Comparar com o perfil da hora da semana
+	MinSamples int64   `json:"min_samples"` // Aquecimento do baseline (default 60)
+}
+
+// ParseAnomalyConfig lê e valida o trigger_config de uma regra de anomalia
+func ParseAnomalyConfig(raw string) (*AnomalyTriggerConfig, error) {
+	var config AnomalyTriggerConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTriggerConfig, err)
+	}
+	if config.Metric == "" {
+		return nil, fmt.Errorf("%w: anomaly rules require a metric", ErrInvalidTriggerConfig)
+	}
+	if config.ZScore < 0 {
+		return nil, fmt.Errorf("%w: z_score must be positive", ErrInvalidTriggerConfig)
+	}
+	if config.ZScore == 0 {
+		config.ZScore = defaultAnomalyZScore
+	}
+	switch config.Direction {
+	case "":
+		config.Direction = AnomalyBoth
+	case AnomalyUp, AnomalyDown, AnomalyBoth:
+	default:
+		return nil, fmt.Errorf("%w: direction must be up, down or both", ErrInvalidTriggerConfig)
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = defaultAnomalyMinSamples
+	}
+	return &config, nil
+}
+
+// MetricBaseline estatísticas de uma métrica de um app.
+// Bucket -1 é a EWMA global; 0..167 é o perfil sazonal da hora da semana.
+type MetricBaseline struct {
+	ID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID    uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_metric_baseline" json:"app_id"`
+	Metric   string    `gorm:"size:50;uniqueIndex:idx_metric_baseline" json:"metric"`
+	Bucket   int       `gorm:"uniqueIndex:idx_metric_baseline" json:"bucket"`
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Samples  int64     `json:"samples"`
+
+	// Última observação (só na linha global), medida ANTES de entrar no baseline
+	LastValue        float64    `json:"last_value"`
+	LastExpected     float64    `json:"last_expected"`
+	LastStdDev       float64    `json:"last_std_dev"`
+	LastZ            float64    `json:"last_z"`
+	SeasonalExpected float64    `json:"seasonal_expected"`
+	SeasonalStdDev   float64    `json:"seasonal_std_dev"`
+	SeasonalZ        float64    `json:"seasonal_z"`
+	SeasonalSamples  int64      `json:"seasonal_samples"`
+	LastAt           *time.Time `json:"last_at,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (MetricBaseline) TableName() string {
+	return "rule_metric_baselines"
+}
+
+// AnomalyDeviation desvio observado na última amostra
+type AnomalyDeviation struct {
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Expected  float64   `json:"expected"`
+	StdDev    float64   `json:"std_dev"`
+	ZScore    float64   `json:"z_score"`
+	Threshold float64   `json:"threshold"`
+	Direction string    `json:"direction"`
+	Baseline  string    `json:"baseline"` // "ewma" ou "seasonal"
+	Samples   int64     `json:"samples"`
+	At        time.Time `json:"at"`
+}
+
+// addTo expõe o desvio às condições e às ações (anomaly.*)
+func (d *AnomalyDeviation) addTo(metrics map[string]float64) {
+	seasonal := 0.0
+	if d.Baseline == "seasonal" {
+		seasonal = 1
+	}
+	metrics["anomaly.value"] = d.Value
+	metrics["anomaly.expected"] = d.Expected
+	metrics["anomaly.std_dev"] = d.StdDev
+	metrics["anomaly.z_score"] = d.ZScore
+	metrics["anomaly.samples"] = float64(d.Samples)
+	metrics["anomaly.seasonal"] = seasonal
+}
+
+// anomalyFromMetrics reconstrói o desvio a partir de anomaly.* (nil se ausente)
+func anomalyFromMetrics(rule *Rule, metrics map[string]float64) *AnomalyDeviation {
+	z, ok := metrics["anomaly.z_score"]
+	if !ok {
+		return nil
+	}
+	config, err := ParseAnomalyConfig(rule.TriggerConfig)
+	if err != nil {
+		return nil
+	}
+	d := &AnomalyDeviation{
+		Metric:    config.Metric,
+		Value:     metrics["anomaly.value"],
+		Expected:  metrics["anomaly.expected"],
+		StdDev:    metrics["anomaly.std_dev"],
+		ZScore:    z,
+		Threshold: config.ZScore,
+		Direction: config.Direction,
+		Baseline:  "ewma",
+		Samples:   int64(metrics["anomaly.samples"]),
+		At:        time.Now(),
+	}
+	if metrics["anomaly.seasonal"] == 1 {
+		d.Baseline = "seasonal"
+	}
+	return d
+}
+
+// hourOfWeek bucket sazonal (UTC)
+func hourOfWeek(t time.Time) int {
+	t = t.UTC()
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// stdDev desvio padrão com piso: métrica constante não gera z infinito
+func (b *MetricBaseline) stdDev() float64 {
+	return math.Max(math.Sqrt(b.Variance), math.Max(0.01*math.Abs(b.Mean), 1e-3))
+}
+
+// observe incorpora uma amostra (EWMA; média simples enquanto aquece)
+func (b *MetricBaseline) observe(value float64) {
+	if b.Samples == 0 {
+		b.Mean = value
+		b.Variance = 0
+		b.Samples = 1
+		return
+	}
+	alpha := math.Max(anomalyEWMAAlpha, 1/float64(b.Samples+1))
+	diff := value - b.Mean
+	incr := alpha * diff
+	b.Mean += incr
+	b.Variance = (1 - alpha) * (b.Variance + diff*incr)
+	b.Samples++
+}
+
+// ========================================
+// ATUALIZAÇÃO (a cada amostra do avaliador)
+// ========================================
+
+// updateAnomalyBaselines mede o desvio das métricas usadas por regras de anomalia
+// e depois incorpora o valor ao baseline global e ao da hora da semana
+func (s *RulesService) updateAnomalyBaselines(appID uuid.UUID, metrics map[string]float64, at time.Time) {
+	var configs []string
+	s.db.Model(&Rule{}).
+		Where("app_id = ? AND status = ? AND trigger_type = ?", appID, RuleStatusActive, TriggerAnomaly).
+		Pluck("trigger_config", &configs)
+
+	tracked := make(map[string]bool)
+	for _, raw := range configs {
+		if config, err := ParseAnomalyConfig(raw); err == nil {
+			tracked[config.Metric] = true
+		}
+	}
+
+	for metric := range tracked {
+		value, ok := metrics[metric]
+		if !ok {
+			continue
+		}
+		s.db.Transaction(func(tx *gorm.DB) error {
+			return observeMetric(tx, appID, metric, value, at)
+		})
+	}
+}
+
+// observeMetric atualiza as duas linhas de baseline de uma métrica
+func observeMetric(tx *gorm.DB, appID uuid.UUID, metric string, value float64, at time.Time) error {
+	global, err := loadBaseline(tx, appID, metric, anomalyGlobalBucket)
+	if err != nil {
+		return err
+	}
+	seasonal, err := loadBaseline(tx, appID, metric, hourOfWeek(at))
+	if err != nil {
+		return err
+	}
+
+	// Desvio contra o baseline anterior à amostra
+	global.LastValue = value
+	global.LastExpected = global.Mean
+	global.LastStdDev = global.stdDev()
+	global.LastZ = (value - global.Mean) / global.LastStdDev
+	global.SeasonalExpected = seasonal.Mean
+	global.SeasonalStdDev = seasonal.stdDev()
+	global.SeasonalZ = (value - seasonal.Mean) / global.SeasonalStdDev
+	global.SeasonalSamples = seasonal.Samples
+	global.LastAt = &at
+
+	global.observe(value)
+	seasonal.observe(value)
+
+	global.UpdatedAt = at
+	seasonal.UpdatedAt = at
+	if err := tx.Save(global).Error; err != nil {
+		return err
+	}
+	return tx.Save(seasonal).Error
+}
+
+func loadBaseline(tx *gorm.DB, appID uuid.UUID, metric string, bucket int) (*MetricBaseline, error) {
+	var b MetricBaseline
+	err := tx.Where("app_id = ? AND metric = ? AND bucket = ?", appID, metric, bucket).First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &MetricBaseline{ID: uuid.New(), AppID: appID, Metric: metric, Bucket: bucket}, nil
+	}
+	return &b, err
+}
+
+// ========================================
+// AVALIAÇÃO
+// ========================================
+
+// evaluateAnomaly desvio da última amostra e se ele passa do limite da regra.
+// Sem amostra recente ou baseline ainda aquecendo: nil, false.
+func (s *RulesService) evaluateAnomaly(rule *Rule) (*AnomalyDeviation, bool, error) {
+	config, err := ParseAnomalyConfig(rule.TriggerConfig)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var b MetricBaseline
+	err = s.db.Where("app_id = ? AND metric = ? AND bucket = ?", rule.AppID, config.Metric, anomalyGlobalBucket).First(&b).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if b.LastAt == nil || time.Since(*b.LastAt) > anomalyMaxStaleness {
+		return nil, false, nil
+	}
+
+	// Samples já inclui a última amostra
+	deviation := &AnomalyDeviation{
+		Metric:    config.Metric,
+		Value:     b.LastValue,
+		Expected:  b.LastExpected,
+		StdDev:    b.LastStdDev,
+		ZScore:    b.LastZ,
+		Threshold: config.ZScore,
+		Direction: config.Direction,
+		Baseline:  "ewma",
+		Samples:   b.Samples - 1,
+		At:        *b.LastAt,
+	}
+	if config.Seasonal && b.SeasonalSamples >= minSeasonalSamples {
+		deviation.Expected = b.SeasonalExpected
+		deviation.StdDev = b.SeasonalStdDev
+		deviation.ZScore = b.SeasonalZ
+		deviation.Baseline = "seasonal"
+		deviation.Samples = b.SeasonalSamples
+	}
+
+	if b.Samples-1 < config.MinSamples {
+		return deviation, false, nil
+	}
+
+	var fired bool
+	switch config.Direction {
+	case AnomalyUp:
+		fired = deviation.ZScore >= config.ZScore
+	case AnomalyDown:
+		fired = deviation.ZScore <= -config.ZScore
+	default:
+		fired = math.Abs(deviation.ZScore) >= config.ZScore
+	}
+	return deviation, fired, nil
+}
+
+// GetMetricBaselines baselines globais de um app (última observação inclusa)
+func (s *RulesService) GetMetricBaselines(appID uuid.UUID) ([]MetricBaseline, error) {
+	var baselines []MetricBaseline
+	err := s.db.Where("app_id = ? AND bucket = ?", appID, anomalyGlobalBucket).Order("metric ASC").Find(&baselines).Error
+	return baselines, err
+}
@@ -0,0 +1,112 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Trigger de anomalia
+// ========================================
+
+func TestAnomalyTriggerFiresOnDeviation(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&MetricBaseline{})
+	appID := uuid.New()
+
+	rule := &Rule{
+		AppID:         appID,
+		Name:          "pico anômalo",
+		Status:        RuleStatusActive,
+		TriggerType:   TriggerAnomaly,
+		TriggerConfig: `{"metric":"online_now","z_score":4,"direction":"up","min_samples":20}`,
+		ActionType:    ActionAlert,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ruído em torno de 100
+	at := time.Now().Add(-30 * time.Minute)
+	for i := 0; i < 30; i++ {
+		s.updateAnomalyBaselines(appID, map[string]float64{"online_now": float64(95 + i%10)}, at)
+		at = at.Add(time.Minute)
+	}
+	deviation, fired, err := s.evaluateAnomaly(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fired || deviation == nil {
+		t.Fatalf("valor normal não deveria disparar: %+v", deviation)
+	}
+
+	// Pico
+	s.updateAnomalyBaselines(appID, map[string]float64{"online_now": 400}, time.Now())
+	deviation, fired, err = s.evaluateAnomaly(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fired || deviation.Value != 400 || deviation.Expected < 95 || deviation.Expected > 105 || deviation.ZScore < 4 {
+		t.Fatalf("pico deveria disparar: %+v", deviation)
+	}
+
+	// Desvio chega ao alerta
+	var alertData map[string]interface{}
+	s.alertCallback = func(appID uuid.UUID, alertType, message string, data map[string]interface{}) {
+		alertData = data
+	}
+	metrics := map[string]float64{}
+	deviation.addTo(metrics)
+	if _, err := s.executeAlertAction(rule, metrics); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := alertData["anomaly"].(*AnomalyDeviation)
+	if !ok || got.Metric != "online_now" || got.Baseline != "ewma" {
+		t.Errorf("alerta sem desvio: %+v", alertData)
+	}
+
+	if err := validateRule(&Rule{TriggerType: TriggerAnomaly, TriggerConfig: `{"direction":"up"}`}); err == nil {
+		t.Error("anomalia sem métrica deveria falhar")
+	}
+}
+
+func TestMetricSamplingClaimsTickOnce(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&MetricBaseline{}, &RuleMetricSample{}, &testMetricsSnapshot{}, &testTelemetrySession{})
+	appID := uuid.New()
+
+	rule := &Rule{
+		AppID:         appID,
+		Name:          "pico anômalo",
+		Status:        RuleStatusActive,
+		TriggerType:   TriggerAnomaly,
+		TriggerConfig: `{"metric":"online_now","z_score":4}`,
+		ActionType:    ActionAlert,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// Duas réplicas no mesmo tick: uma amostra e uma observação no baseline
+	now := time.Now().Truncate(metricSampleTick).Add(10 * time.Second)
+	s.recordMetricSamplesAt(now)
+	replica := &RulesService{db: s.db}
+	replica.recordMetricSamplesAt(now.Add(5 * time.Second))
+
+	var samples int64
+	s.db.Model(&RuleMetricSample{}).Where("app_id = ?", appID).Count(&samples)
+	var global MetricBaseline
+	s.db.Where("app_id = ? AND bucket = ?", appID, anomalyGlobalBucket).First(&global)
+	if samples != 1 || global.Samples != 1 {
+		t.Fatalf("esperada 1 amostra e 1 observação, obtidas %d e %d", samples, global.Samples)
+	}
+
+	// Tick seguinte volta a amostrar
+	s.recordMetricSamplesAt(now.Add(metricSampleTick))
+	s.db.Model(&RuleMetricSample{}).Where("app_id = ?", appID).Count(&samples)
+	if samples != 2 {
+		t.Errorf("esperadas 2 amostras após o próximo tick, obtidas %d", samples)
+	}
+}
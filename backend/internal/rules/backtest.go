@@ -0,0 +1,329 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// BACKTEST - Dry-run contra telemetria histórica
+// "Quantas vezes esta regra teria disparado?"
+// ========================================
+
+var (
+	ErrInvalidBacktest = errors.New("invalid backtest")
+)
+
+const (
+	// defaultBacktestStep mesmo intervalo do avaliador periódico
+	defaultBacktestStep = time.Minute
+
+	// maxBacktestPoints limite de avaliações por backtest.
+	// Cada momento custa ~15-35 queries; o backtest roda dentro da requisição HTTP.
+	maxBacktestPoints = 500
+
+	// backtestEventPage eventos lidos por consulta ao procurar os que casam com os filtros
+	backtestEventPage = 1000
+
+	// BacktestTimeout prazo máximo de um backtest síncrono
+	BacktestTimeout = 20 * time.Second
+)
+
+// BacktestRequest parâmetros do backtest
+type BacktestRequest struct {
+	Rule Rule      `json:"rule"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Step string    `json:"step"` // Intervalo entre avaliações (metric/threshold); vazio = 1m
+}
+
+// BacktestFiring momento em que a regra teria disparado
+type BacktestFiring struct {
+	At               time.Time          `json:"at"`
+	Metrics          map[string]float64 `json:"metrics"`
+	ActionType       RuleActionType     `json:"action_type"`
+	ActionConfig     string             `json:"action_config"`
+	WouldExecute     bool               `json:"would_execute"`
+	BlockReason      string             `json:"block_reason,omitempty"`
+	RequiresApproval bool               `json:"requires_approval,omitempty"`
+	EventID          *uuid.UUID         `json:"event_id,omitempty"` // Evento que disparou (trigger event)
+}
+
+// BacktestResult resultado do backtest
+type BacktestResult struct {
+	RuleID      *uuid.UUID      `json:"rule_id,omitempty"`
+	RuleName    string          `json:"rule_name"`
+	TriggerType RuleTriggerType `json:"trigger_type"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Step        string          `json:"step,omitempty"`
+	Period      string          `json:"period"`
+
+	Evaluations          int  `json:"evaluations"`
+	ConditionMet         int  `json:"condition_met"`
+	WouldFire            int  `json:"would_fire"`
+	WouldBlock           int  `json:"would_block"`
+	SuppressedByCooldown int  `json:"suppressed_by_cooldown"`
+	Errors               int  `json:"errors"`
+	Truncated            bool `json:"truncated"` // Limite de pontos ou prazo atingido
+
+	Firings    []BacktestFiring `json:"firings"`
+	LastError  string           `json:"last_error,omitempty"`
+	ComputedAt time.Time        `json:"computed_at"`
+}
+
+// backtestMoment ponto da linha do tempo a avaliar
+type backtestMoment struct {
+	At      time.Time
+	EventID *uuid.UUID
+}
+
+// Backtest reexecuta a regra sobre a telemetria de [From, To] sem executar ações.
+// A política (validateAction) é aplicada com o estado atual de kill switch e pausas.
+// Se ctx expirar, retorna o resultado parcial marcado como truncado.
+func (s *RulesService) Backtest(ctx context.Context, req BacktestRequest) (*BacktestResult, error) {
+	rule := req.Rule
+	if rule.AppID == uuid.Nil {
+		return nil, fmt.Errorf("%w: app_id is required", ErrInvalidBacktest)
+	}
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidBacktest)
+	}
+	if rule.TriggerType == TriggerAnomaly {
+		return nil, fmt.Errorf("%w: anomaly rules depend on live baselines and cannot be backtested", ErrInvalidBacktest)
+	}
+	if rule.TriggerType == TriggerSequence {
+		return nil, fmt.Errorf("%w: sequence rules are not supported by backtest yet", ErrInvalidBacktest)
+	}
+	if req.To.After(time.Now()) {
+		req.To = time.Now()
+	}
+	if err := validateRule(&rule); err != nil {
+		return nil, err
+	}
+
+	step := defaultBacktestStep
+	if req.Step != "" {
+		d, err := parseWindow(req.Step)
+		if err != nil || d < time.Minute {
+			return nil, fmt.Errorf("%w: step must be a duration of at least 1m", ErrInvalidBacktest)
+		}
+		step = d
+	}
+
+	moments, truncated, err := s.backtestTimeline(ctx, &rule, req.From, req.To, step)
+	if err != nil {
+		return nil, err
+	}
+
+	var expr *Expression
+	if strings.TrimSpace(rule.Condition) != "" {
+		if expr, err = ParseExpression(rule.Condition); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BacktestResult{
+		RuleName:    rule.Name,
+		TriggerType: rule.TriggerType,
+		From:        req.From,
+		To:          req.To,
+		Period:      ruleMetricWindow(&rule, req.To).Period,
+		Truncated:   truncated,
+		Firings:     []BacktestFiring{},
+		ComputedAt:  time.Now(),
+	}
+	if rule.ID != uuid.Nil {
+		result.RuleID = &rule.ID
+	}
+	if rule.TriggerType == TriggerMetric || rule.TriggerType == TriggerThreshold {
+		result.Step = step.String()
+	}
+
+	validation := s.validateAction(&rule)
+	cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
+	var lastFired *time.Time
+
+	for _, moment := range moments {
+		if ctx.Err() != nil {
+			result.Truncated = true
+			result.LastError = ctx.Err().Error()
+			break
+		}
+		result.Evaluations++
+
+		metrics, err := s.historicalAppMetrics(rule.AppID, ruleMetricWindow(&rule, moment.At))
+		if err != nil {
+			result.Errors++
+			result.LastError = err.Error()
+			continue
+		}
+
+		met := true
+		if expr != nil {
+			met, err = expr.EvalBool(s.newExprEnv(rule.AppID, metrics, moment.At))
+			if err != nil {
+				result.Errors++
+				result.LastError = err.Error()
+				continue
+			}
+		}
+		if !met {
+			continue
+		}
+		result.ConditionMet++
+
+		// Mesma regra do avaliador: agendadas não têm cooldown
+		if rule.TriggerType != TriggerSchedule && lastFired != nil && moment.At.Sub(*lastFired) < cooldown {
+			result.SuppressedByCooldown++
+			continue
+		}
+		at := moment.At
+		lastFired = &at
+
+		if validation.Allowed {
+			result.WouldFire++
+		} else {
+			result.WouldBlock++
+		}
+		result.Firings = append(result.Firings, BacktestFiring{
+			At:               moment.At,
+			Metrics:          metrics,
+			ActionType:       rule.ActionType,
+			ActionConfig:     rule.ActionConfig,
+			WouldExecute:     validation.Allowed,
+			BlockReason:      blockReason(validation),
+			RequiresApproval: validation.RequiresApproval,
+			EventID:          moment.EventID,
+		})
+	}
+
+	return result, nil
+}
+
+func blockReason(validation ActionValidationResult) string {
+	if validation.Allowed {
+		return ""
+	}
+	return validation.Reason
+}
+
+// backtestTimeline momentos em que o avaliador real teria avaliado a regra
+func (s *RulesService) backtestTimeline(ctx context.Context, rule *Rule, from, to time.Time, step time.Duration) ([]backtestMoment, bool, error) {
+	var moments []backtestMoment
+
+	switch rule.TriggerType {
+	case TriggerSchedule:
+		sched, err := ParseScheduleConfig(rule.TriggerConfig)
+		if err != nil {
+			return nil, false, err
+		}
+		for t := sched.Next(from.Add(-time.Nanosecond)); !t.IsZero() && !t.After(to); t = sched.Next(t) {
+			if len(moments) == maxBacktestPoints {
+				return moments, true, nil
+			}
+			moments = append(moments, backtestMoment{At: t})
+		}
+
+	case TriggerEvent:
+		var config EventTriggerConfig
+		if err := json.Unmarshal([]byte(rule.TriggerConfig), &config); err != nil || config.EventType == "" {
+			return nil, false, fmt.Errorf("%w: event rules require trigger_config with event_type", ErrInvalidTriggerConfig)
+		}
+		// Filtros são aplicados em memória: pagina até achar maxBacktestPoints eventos que casam
+		var afterAt time.Time
+		var afterID uuid.UUID
+		for {
+			if ctx.Err() != nil {
+				return moments, true, nil
+			}
+			var events []struct {
+				ID        uuid.UUID
+				Metadata  string
+				Timestamp time.Time
+			}
+			query := s.db.WithContext(ctx).Table("telemetry_events").
+				Select("id, metadata, timestamp").
+				Where("app_id = ? AND type = ? AND timestamp >= ? AND timestamp <= ?", rule.AppID, config.EventType, from, to)
+			if afterID != uuid.Nil {
+				query = query.Where("(timestamp > ? OR (timestamp = ? AND id > ?))", afterAt, afterAt, afterID)
+			}
+			if err := query.Order("timestamp ASC, id ASC").Limit(backtestEventPage).Find(&events).Error; err != nil {
+				return nil, false, err
+			}
+			for i := range events {
+				if !eventMatchesFilters(decodeEventMetadata(events[i].Metadata), config.Filters) {
+					continue
+				}
+				if len(moments) == maxBacktestPoints {
+					return moments, true, nil
+				}
+				moments = append(moments, backtestMoment{At: events[i].Timestamp, EventID: &events[i].ID})
+			}
+			if len(events) < backtestEventPage {
+				break
+			}
+			afterAt, afterID = events[len(events)-1].Timestamp, events[len(events)-1].ID
+		}
+
+	default:
+		for t := from; !t.After(to); t = t.Add(step) {
+			if len(moments) == maxBacktestPoints {
+				return moments, true, nil
+			}
+			moments = append(moments, backtestMoment{At: t})
+		}
+	}
+
+	return moments, false, nil
+}
+
+// decodeEventMetadata metadata JSON do evento (nil se inválido)
+func decodeEventMetadata(metadata string) map[string]interface{} {
+	var data map[string]interface{}
+	if json.Unmarshal([]byte(metadata), &data) != nil {
+		return nil
+	}
+	return data
+}
+
+// historicalAppMetrics reconstrói as métricas do app como estariam em window.End,
+// usando só telemetria bruta (o snapshot guarda apenas o estado atual)
+func (s *RulesService) historicalAppMetrics(appID uuid.UUID, window MetricWindow) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	at := window.End
+
+	// Presença: sessões abertas em `at` com heartbeat recente (mesmos limites do snapshot)
+	var onlineNow, activeSessions, activeUsers24h, totalUsers int64
+	openAt := s.db.Table("telemetry_sessions").
+		Where("app_id = ? AND started_at <= ? AND (ended_at IS NULL OR ended_at > ?)", appID, at, at)
+	if err := openAt.Session(&gorm.Session{}).Where("last_seen_at >= ?", at.Add(-30*time.Second)).Count(&onlineNow).Error; err != nil {
+		return nil, err
+	}
+	openAt.Session(&gorm.Session{}).Where("last_seen_at >= ?", at.Add(-5*time.Minute)).Count(&activeSessions)
+
+	s.db.Table("telemetry_sessions").
+		Where("app_id = ? AND started_at >= ? AND started_at <= ?", appID, at.Add(-24*time.Hour), at).
+		Distinct("user_id").
+		Count(&activeUsers24h)
+	s.db.Table("telemetry_sessions").
+		Where("app_id = ? AND started_at <= ?", appID, at).
+		Distinct("user_id").
+		Count(&totalUsers)
+
+	metrics["online_now"] = float64(onlineNow)
+	metrics["active_sessions"] = float64(activeSessions)
+	metrics["active_users_24h"] = float64(activeUsers24h)
+	metrics["total_users"] = float64(totalUsers)
+
+	s.rangeMetrics(appID, window, metrics, true)
+
+	return metrics, nil
+}
@@ -0,0 +1,135 @@
+package rules
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Backtest
+// ========================================
+
+// testTelemetrySession espelho mínimo de telemetry_sessions
+type testTelemetrySession struct {
+	ID               uuid.UUID `gorm:"type:uuid;primaryKey"`
+	AppID            uuid.UUID `gorm:"type:uuid"`
+	UserID           uuid.UUID `gorm:"type:uuid"`
+	StartedAt        time.Time
+	LastSeenAt       time.Time
+	EndedAt          *time.Time
+	InteractionCount int
+	DurationMs       int64
+}
+
+func (testTelemetrySession) TableName() string {
+	return "telemetry_sessions"
+}
+
+func TestBacktestCooldownAndTimeline(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&testTelemetrySession{}, &RuleMetricSample{})
+	appID := uuid.New()
+
+	// 3 sessões abertas entre 10:00 e 11:00
+	base := time.Now().UTC().Add(-48 * time.Hour).Truncate(time.Hour)
+	for i := 0; i < 3; i++ {
+		ended := base.Add(time.Hour)
+		s.db.Create(&testTelemetrySession{
+			ID:         uuid.New(),
+			AppID:      appID,
+			UserID:     uuid.New(),
+			StartedAt:  base,
+			LastSeenAt: ended,
+			EndedAt:    &ended,
+			DurationMs: time.Hour.Milliseconds(),
+		})
+	}
+
+	result, err := s.Backtest(context.Background(), BacktestRequest{
+		Rule: Rule{
+			AppID:           appID,
+			Name:            "pico",
+			TriggerType:     TriggerMetric,
+			Condition:       "online_now >= 3",
+			ActionType:      ActionAlert,
+			CooldownMinutes: 30,
+		},
+		From: base.Add(-time.Hour),
+		To:   base.Add(2 * time.Hour),
+		Step: "10m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Condição verdadeira de 10:00 a 10:50 (6 pontos); cooldown de 30min deixa 10:00 e 10:30
+	if result.Evaluations != 19 || result.ConditionMet != 6 || result.WouldFire != 2 || result.SuppressedByCooldown != 4 {
+		t.Fatalf("resultado inesperado: %+v", result)
+	}
+	if !result.Firings[0].At.Equal(base) || !result.Firings[1].At.Equal(base.Add(30*time.Minute)) {
+		t.Errorf("disparos inesperados: %v, %v", result.Firings[0].At, result.Firings[1].At)
+	}
+	if result.Firings[0].Metrics["total_users"] != 3 {
+		t.Errorf("total_users esperado 3, obtido %v", result.Firings[0].Metrics["total_users"])
+	}
+
+	if _, err := s.Backtest(context.Background(), BacktestRequest{Rule: Rule{AppID: appID}, From: base, To: base}); err == nil {
+		t.Error("intervalo vazio deveria falhar")
+	}
+
+	// Prazo expirado: resultado parcial marcado como truncado
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	partial, err := s.Backtest(ctx, BacktestRequest{
+		Rule: Rule{AppID: appID, Name: "pico", TriggerType: TriggerMetric, Condition: "online_now >= 3", ActionType: ActionAlert},
+		From: base,
+		To:   base.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partial.Truncated || partial.Evaluations != 0 {
+		t.Errorf("esperado resultado truncado sem avaliações: %+v", partial)
+	}
+}
+
+func TestBacktestEventFiltersDoNotConsumePointLimit(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	// Eventos que não casam com o filtro vêm antes e passam do limite de pontos
+	base := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Hour)
+	events := make([]testTelemetryEvent, 0, maxBacktestPoints+backtestEventPage)
+	for i := 0; i < maxBacktestPoints+backtestEventPage; i++ {
+		events = append(events, testTelemetryEvent{ID: uuid.New(), AppID: appID, Type: "match.ended",
+			Metadata: `{"mode":"casual"}`, Timestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+	for i := 0; i < 3; i++ {
+		events = append(events, testTelemetryEvent{ID: uuid.New(), AppID: appID, Type: "match.ended",
+			Metadata: `{"mode":"ranked","players":4}`, Timestamp: base.Add(time.Hour + time.Duration(i)*time.Minute)})
+	}
+	if err := s.db.CreateInBatches(events, 200).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rule := &Rule{AppID: appID, TriggerType: TriggerEvent,
+		TriggerConfig: `{"event_type":"match.ended","filters":{"mode":"ranked","players":"4"}}`}
+	moments, truncated, err := s.backtestTimeline(context.Background(), rule, base, base.Add(2*time.Hour), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moments) != 3 || truncated {
+		t.Fatalf("esperado 3 eventos sem truncar, obtido %d (truncado=%v)", len(moments), truncated)
+	}
+
+	// Disparo real usa o mesmo critério
+	if !eventMatchesFilters(map[string]interface{}{"mode": "ranked", "players": 4.0}, map[string]string{"mode": "ranked", "players": "4"}) {
+		t.Error("filtro numérico deveria casar como no backtest")
+	}
+	if eventMatchesFilters(map[string]interface{}{"mode": "ranked"}, map[string]string{"players": "<nil>"}) {
+		t.Error("chave ausente não deveria casar")
+	}
+}
@@ -0,0 +1,225 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// EXPORT / IMPORT - Promoção de regras entre ambientes
+// "O que foi validado em staging vai igual para produção"
+// ========================================
+
+var (
+	ErrInvalidRuleBundle = errors.New("invalid rule bundle")
+)
+
+const (
+	// ruleBundleFormat versão do formato do arquivo exportado
+	ruleBundleFormat = 1
+
+	BundleFormatJSON = "json"
+	BundleFormatYAML = "yaml"
+)
+
+// RuleBundleEntry regra exportada (definição + status)
+type RuleBundleEntry struct {
+	RuleDefinition `yaml:",inline"`
+	Status         RuleStatus `json:"status" yaml:"status"`
+}
+
+// RuleBundle conjunto de regras de um app
+type RuleBundle struct {
+	Format      int               `json:"format" yaml:"format"`
+	SourceAppID string            `json:"source_app_id,omitempty" yaml:"source_app_id,omitempty"`
+	ExportedAt  time.Time         `json:"exported_at" yaml:"exported_at"`
+	Rules       []RuleBundleEntry `json:"rules" yaml:"rules"`
+}
+
+// RuleImportChange regra atualizada (ou que seria, em dry-run)
+type RuleImportChange struct {
+	Name    string            `json:"name"`
+	RuleID  uuid.UUID         `json:"rule_id"`
+	Version int               `json:"version"`
+	Changes []RuleFieldChange `json:"changes"`
+}
+
+// RuleImportResult resultado do import
+type RuleImportResult struct {
+	AppID     uuid.UUID          `json:"app_id"`
+	DryRun    bool               `json:"dry_run"`
+	Created   []string           `json:"created"`
+	Updated   []RuleImportChange `json:"updated"`
+	Unchanged []string           `json:"unchanged"`
+}
+
+// ExportRules exporta as regras de um app.
+// Regras geradas por meta-regras (depth > 0) ficam de fora: são estado de execução.
+func (s *RulesService) ExportRules(appID uuid.UUID) (*RuleBundle, error) {
+	var rules []Rule
+	err := s.db.Where("app_id = ? AND depth = ?", appID, 0).
+		Order("priority DESC, name ASC").
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &RuleBundle{
+		Format:      ruleBundleFormat,
+		SourceAppID: appID.String(),
+		ExportedAt:  time.Now().UTC(),
+		Rules:       make([]RuleBundleEntry, 0, len(rules)),
+	}
+	for i := range rules {
+		bundle.Rules = append(bundle.Rules, RuleBundleEntry{
+			RuleDefinition: ruleDefinitionOf(&rules[i]),
+			Status:         rules[i].Status,
+		})
+	}
+	return bundle, nil
+}
+
+// ImportRules aplica um bundle em um app, casando regras pelo nome.
+// Regras novas são criadas, existentes ganham nova versão se mudarem;
+// regras do app ausentes no bundle não são tocadas.
+func (s *RulesService) ImportRules(appID uuid.UUID, bundle *RuleBundle, changedBy uuid.UUID, reason string, dryRun bool) (*RuleImportResult, error) {
+	if bundle.Format != ruleBundleFormat {
+		return nil, fmt.Errorf("%w: unsupported format %d", ErrInvalidRuleBundle, bundle.Format)
+	}
+
+	// Validar tudo antes de gravar qualquer coisa.
+	// O nome é normalizado uma vez: validação, busca e gravação usam o mesmo valor.
+	entries := make([]RuleBundleEntry, len(bundle.Rules))
+	seen := make(map[string]bool, len(bundle.Rules))
+	for i, entry := range bundle.Rules {
+		name := strings.TrimSpace(entry.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: rule #%d has no name", ErrInvalidRuleBundle, i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate rule name %q", ErrInvalidRuleBundle, name)
+		}
+		seen[name] = true
+		entry.Name = name
+		entries[i] = entry
+
+		rule := Rule{AppID: appID}
+		entry.applyTo(&rule)
+		if err := validateRule(&rule); err != nil {
+			return nil, fmt.Errorf("%w: rule %q: %v", ErrInvalidRuleBundle, name, err)
+		}
+	}
+
+	if reason == "" {
+		reason = "import"
+		if bundle.SourceAppID != "" {
+			reason = "import from app " + bundle.SourceAppID
+		}
+	}
+
+	result := &RuleImportResult{
+		AppID:     appID,
+		DryRun:    dryRun,
+		Created:   []string{},
+		Updated:   []RuleImportChange{},
+		Unchanged: []string{},
+	}
+
+	var err error
+	if dryRun {
+		err = s.importEntries(appID, entries, changedBy, reason, true, result)
+	} else {
+		// Tudo ou nada: uma falha na regra k desfaz as regras 1..k-1
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			return (&RulesService{db: tx}).importEntries(appID, entries, changedBy, reason, false, result)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// importEntries casa e aplica as entradas já validadas, preenchendo result
+func (s *RulesService) importEntries(appID uuid.UUID, entries []RuleBundleEntry, changedBy uuid.UUID, reason string, dryRun bool, result *RuleImportResult) error {
+	for _, entry := range entries {
+		status := entry.Status
+		if status == "" {
+			status = RuleStatusActive
+		}
+
+		var existing Rule
+		err := s.db.Where("app_id = ? AND name = ? AND depth = ?", appID, entry.Name, 0).First(&existing).Error
+		if err != nil {
+			// Regra nova
+			if !dryRun {
+				rule := Rule{AppID: appID, Status: status, CreatedBy: changedBy}
+				entry.applyTo(&rule)
+				if err := s.CreateRule(&rule); err != nil {
+					return fmt.Errorf("rule %q: %w", entry.Name, err)
+				}
+			}
+			result.Created = append(result.Created, entry.Name)
+			continue
+		}
+
+		changes := diffDefinitions(ruleDefinitionOf(&existing), entry.RuleDefinition)
+		if len(changes) == 0 && existing.Status == status {
+			result.Unchanged = append(result.Unchanged, entry.Name)
+			continue
+		}
+		if !dryRun {
+			rule := existing
+			entry.applyTo(&rule)
+			rule.Status = status
+			if err := s.UpdateRule(&rule, changedBy, reason); err != nil {
+				return fmt.Errorf("rule %q: %w", entry.Name, err)
+			}
+			existing.Version = rule.Version
+		}
+		result.Updated = append(result.Updated, RuleImportChange{
+			Name:    entry.Name,
+			RuleID:  existing.ID,
+			Version: existing.Version,
+			Changes: changes,
+		})
+	}
+
+	return nil
+}
+
+// MarshalRuleBundle serializa o bundle em JSON ou YAML
+func MarshalRuleBundle(bundle *RuleBundle, format string) ([]byte, error) {
+	switch format {
+	case BundleFormatYAML, "yml":
+		return yaml.Marshal(bundle)
+	case BundleFormatJSON, "":
+		return json.MarshalIndent(bundle, "", "  ")
+	}
+	return nil, fmt.Errorf("%w: unknown format %q (use json or yaml)", ErrInvalidRuleBundle, format)
+}
+
+// UnmarshalRuleBundle lê um bundle em JSON ou YAML
+func UnmarshalRuleBundle(data []byte, format string) (*RuleBundle, error) {
+	var bundle RuleBundle
+	var err error
+	switch format {
+	case BundleFormatYAML, "yml":
+		err = yaml.Unmarshal(data, &bundle)
+	case BundleFormatJSON, "":
+		err = json.Unmarshal(data, &bundle)
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q (use json or yaml)", ErrInvalidRuleBundle, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRuleBundle, err)
+	}
+	return &bundle, nil
+}
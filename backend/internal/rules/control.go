@@ -0,0 +1,320 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+
+	"prost-qs/backend/internal/killswitch"
+)
+
+// ========================================
+// CONTROLES PERSISTIDOS - Kill switch, pausas e shadow mode
+// "Uma parada de emergência sobrevive a restart e vale para todas as réplicas"
+// ========================================
+
+var (
+	ErrInvalidControlScope = errors.New("invalid control scope")
+	ErrUnknownActionType   = errors.New("unknown action type")
+)
+
+// RulesControlKind tipo de controle
+type RulesControlKind string
+
+const (
+	ControlKillSwitch  RulesControlKind = "kill_switch"
+	ControlActionPause RulesControlKind = "action_pause"
+	ControlShadowMode  RulesControlKind = "shadow_mode"
+)
+
+const (
+	// ControlScopeGlobal escopo que vale para todos os apps
+	ControlScopeGlobal = "global"
+
+	// controlSyncInterval frequência com que cada réplica relê os controles
+	controlSyncInterval = 5 * time.Second
+)
+
+// RulesControl controle humano persistido
+// (kind, scope, action_type) é único: reativar atualiza a mesma linha
+type RulesControl struct {
+	ID          uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	Kind        RulesControlKind `gorm:"size:30;uniqueIndex:idx_rules_control" json:"kind"`
+	Scope       string           `gorm:"size:100;uniqueIndex:idx_rules_control" json:"scope"`      // "global" ou app_id
+	ActionType  RuleActionType   `gorm:"size:30;uniqueIndex:idx_rules_control" json:"action_type"` // Só para action_pause
+	Active      bool             `gorm:"default:false;index" json:"active"`
+	Reason      string           `gorm:"size:500" json:"reason"`
+	ActivatedBy string           `gorm:"size:100" json:"activated_by"`
+	ActivatedAt time.Time        `json:"activated_at"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+	Filters     string           `gorm:"type:text" json:"filters,omitempty"` // Shadow mode: JSON ShadowModeFilters
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+func (RulesControl) TableName() string {
+	return "rules_controls"
+}
+
+// isEffective ativo e não expirado
+func (c RulesControl) isEffective(now time.Time) bool {
+	return c.Active && (c.ExpiresAt == nil || now.Before(*c.ExpiresAt))
+}
+
+// RulesControlStatus visão unificada dos controles do rules engine e do kill switch da plataforma
+type RulesControlStatus struct {
+	KillSwitch       map[string]interface{}       `json:"kill_switch"`
+	ShadowMode       map[string]interface{}       `json:"shadow_mode"`
+	Controls         []RulesControl               `json:"controls"`
+	Platform         *killswitch.KillSwitchStatus `json:"platform,omitempty"`
+	PlatformSwitches []killswitch.KillSwitch      `json:"platform_switches,omitempty"`
+	InstanceID       string                       `json:"instance_id"`
+	SyncedAt         time.Time                    `json:"synced_at"`
+}
+
+// normalizeControlScope aceita "", "global" ou um app ID
+func normalizeControlScope(scope string) (string, error) {
+	if scope == "" || scope == ControlScopeGlobal {
+		return ControlScopeGlobal, nil
+	}
+	id, err := uuid.Parse(scope)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q (use \"global\" or an app id)", ErrInvalidControlScope, scope)
+	}
+	return id.String(), nil
+}
+
+// SetPlatformKillSwitch conecta o kill switch da plataforma:
+// o escopo "all" também bloqueia ações automáticas de regras
+func (s *RulesService) SetPlatformKillSwitch(ks *killswitch.KillSwitchService) {
+	s.platformKillSwitch = ks
+}
+
+// validateAction aplica a política de ações e o kill switch da plataforma
+func (s *RulesService) validateAction(rule *Rule) ActionValidationResult {
+	if s.platformKillSwitch != nil && s.platformKillSwitch.IsActive(killswitch.ScopeAll) {
+		return ActionValidationResult{
+			Allowed: false,
+			Reason:  "Kill switch da plataforma ativo - todas as automações pausadas",
+		}
+	}
+	return ValidateAction(rule.ActionType, rule.AppID, rule.ActionConfig)
+}
+
+// ========================================
+// ESCRITA
+// ========================================
+
+// upsertControl ativa (ou reativa) um controle
+func (s *RulesService) upsertControl(control *RulesControl) error {
+	now := time.Now()
+	control.ID = uuid.New()
+	control.Active = true
+	control.ActivatedAt = now
+	control.CreatedAt = now
+	control.UpdatedAt = now
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "scope"}, {Name: "action_type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"active", "reason", "activated_by", "activated_at", "expires_at", "filters", "updated_at"}),
+	}).Create(control).Error
+	if err != nil {
+		return err
+	}
+	return s.syncControls()
+}
+
+// deactivateControl desativa um controle (a linha fica como histórico)
+func (s *RulesService) deactivateControl(kind RulesControlKind, scope string, actionType RuleActionType) error {
+	err := s.db.Model(&RulesControl{}).
+		Where("kind = ? AND scope = ? AND action_type = ?", kind, scope, actionType).
+		Updates(map[string]interface{}{"active": false, "updated_at": time.Now()}).Error
+	if err != nil {
+		return err
+	}
+	return s.syncControls()
+}
+
+func expiresAfter(d *time.Duration) *time.Time {
+	if d == nil || *d <= 0 {
+		return nil
+	}
+	t := time.Now().Add(*d)
+	return &t
+}
+
+// ActivateKillSwitch ativa o kill switch (global ou de um app)
+func (s *RulesService) ActivateKillSwitch(scope, activatedBy, reason string, autoResumeAfter *time.Duration) error {
+	scope, err := normalizeControlScope(scope)
+	if err != nil {
+		return err
+	}
+	log.Printf("🛑 [RULES] Kill switch activated (scope=%s) by %s: %s", scope, activatedBy, reason)
+	return s.upsertControl(&RulesControl{
+		Kind:        ControlKillSwitch,
+		Scope:       scope,
+		Reason:      reason,
+		ActivatedBy: activatedBy,
+		ExpiresAt:   expiresAfter(autoResumeAfter),
+	})
+}
+
+// DeactivateKillSwitch desativa o kill switch do escopo
+func (s *RulesService) DeactivateKillSwitch(scope string) error {
+	scope, err := normalizeControlScope(scope)
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ [RULES] Kill switch deactivated (scope=%s)", scope)
+	return s.deactivateControl(ControlKillSwitch, scope, "")
+}
+
+// PauseActionType pausa um tipo de ação (global ou de um app)
+func (s *RulesService) PauseActionType(scope string, actionType RuleActionType, activatedBy, reason string, duration *time.Duration) error {
+	scope, err := normalizeControlScope(scope)
+	if err != nil {
+		return err
+	}
+	// Pausa de tipo inexistente não pausaria nada
+	if _, known := DefaultActionPolicies[actionType]; !known {
+		return fmt.Errorf("%w: %q", ErrUnknownActionType, actionType)
+	}
+	return s.upsertControl(&RulesControl{
+		Kind:        ControlActionPause,
+		Scope:       scope,
+		ActionType:  actionType,
+		Reason:      reason,
+		ActivatedBy: activatedBy,
+		ExpiresAt:   expiresAfter(duration),
+	})
+}
+
+// ResumeActionType retoma um tipo de ação no escopo
+func (s *RulesService) ResumeActionType(scope string, actionType RuleActionType) error {
+	scope, err := normalizeControlScope(scope)
+	if err != nil {
+		return err
+	}
+	return s.deactivateControl(ControlActionPause, scope, actionType)
+}
+
+// ActivateShadowMode ativa o shadow mode (filtros vazios = tudo)
+func (s *RulesService) ActivateShadowMode(activatedBy, reason string, duration *time.Duration, filters ShadowModeFilters) error {
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return err
+	}
+	return s.upsertControl(&RulesControl{
+		Kind:        ControlShadowMode,
+		Scope:       ControlScopeGlobal,
+		Reason:      reason,
+		ActivatedBy: activatedBy,
+		ExpiresAt:   expiresAfter(duration),
+		Filters:     string(data),
+	})
+}
+
+// DeactivateShadowMode desativa o shadow mode
+func (s *RulesService) DeactivateShadowMode() error {
+	return s.deactivateControl(ControlShadowMode, ControlScopeGlobal, "")
+}
+
+// ========================================
+// SINCRONIZAÇÃO ENTRE RÉPLICAS
+// ========================================
+
+// syncControls relê os controles ativos e reconstrói o cache em memória
+func (s *RulesService) syncControls() error {
+	var controls []RulesControl
+	if err := s.db.Where("active = ?", true).Find(&controls).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var switches, pauses []RulesControl
+	var shadow *RulesControl
+	for i := range controls {
+		c := controls[i]
+		if !c.isEffective(now) {
+			// Expirou: desativar para que o status reflita o estado real
+			s.db.Model(&RulesControl{}).Where("id = ?", c.ID).
+				Updates(map[string]interface{}{"active": false, "updated_at": now})
+			continue
+		}
+		switch c.Kind {
+		case ControlKillSwitch:
+			switches = append(switches, c)
+		case ControlActionPause:
+			pauses = append(pauses, c)
+		case ControlShadowMode:
+			shadow = &c
+		}
+	}
+
+	setKillSwitchCache(switches, pauses)
+	setShadowModeCache(shadow)
+
+	s.controlsMu.Lock()
+	s.controlsSyncedAt = now
+	s.controlsMu.Unlock()
+	return nil
+}
+
+// startControlSync mantém o cache alinhado com o banco (mudanças de outras réplicas)
+func (s *RulesService) startControlSync() {
+	if err := s.syncControls(); err != nil {
+		log.Printf("⚠️ [RULES] Failed to load controls: %v", err)
+	}
+
+	s.evalWg.Add(1)
+	go func() {
+		defer s.evalWg.Done()
+		ticker := time.NewTicker(controlSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.syncControls(); err != nil {
+					log.Printf("⚠️ [RULES] Failed to sync controls: %v", err)
+				}
+			case <-s.stopEval:
+				return
+			}
+		}
+	}()
+}
+
+// ========================================
+// STATUS
+// ========================================
+
+// GetControlStatus retorna kill switch, pausas, shadow mode e kill switch da plataforma
+func (s *RulesService) GetControlStatus() (*RulesControlStatus, error) {
+	var controls []RulesControl
+	if err := s.db.Where("active = ?", true).Order("kind ASC, scope ASC").Find(&controls).Error; err != nil {
+		return nil, err
+	}
+
+	s.controlsMu.RLock()
+	syncedAt := s.controlsSyncedAt
+	s.controlsMu.RUnlock()
+
+	status := &RulesControlStatus{
+		KillSwitch: GetKillSwitchStatus(),
+		ShadowMode: GetShadowModeStatus(),
+		Controls:   controls,
+		InstanceID: s.instanceID,
+		SyncedAt:   syncedAt,
+	}
+	if s.platformKillSwitch != nil {
+		status.Platform = s.platformKillSwitch.GetStatus()
+		status.PlatformSwitches, _ = s.platformKillSwitch.GetAll()
+	}
+	return status, nil
+}
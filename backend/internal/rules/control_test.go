@@ -0,0 +1,130 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Controles persistidos
+// ========================================
+
+func TestControlsSurviveRestart(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&RulesControl{})
+	appID := uuid.New()
+
+	if err := s.ActivateKillSwitch(appID.String(), "ops", "incidente", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PauseActionType("", ActionWebhook, "ops", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	// Reativar atualiza a mesma linha
+	if err := s.PauseActionType("global", ActionWebhook, "ops", "de novo", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ActivateShadowMode("ops", "observar", nil, ShadowModeFilters{ActionTypes: []RuleActionType{ActionAdjust}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simula restart / outra réplica: cache vazio, estado vem do banco
+	setKillSwitchCache(nil, nil)
+	setShadowModeCache(nil)
+	if IsKillSwitchActiveForApp(appID) {
+		t.Fatal("cache deveria estar vazio")
+	}
+	if err := s.syncControls(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsKillSwitchActiveForApp(appID) || IsKillSwitchActiveForApp(uuid.New()) || IsKillSwitchActive() {
+		t.Error("kill switch deveria valer só para o app")
+	}
+	if !IsActionTypePausedForApp(ActionWebhook, uuid.New()) {
+		t.Error("pausa global deveria valer para qualquer app")
+	}
+	if !IsShadowModeActive(appID, ActionAdjust) || IsShadowModeActive(appID, ActionAlert) {
+		t.Error("shadow mode deveria respeitar filtros")
+	}
+
+	var count int64
+	s.db.Model(&RulesControl{}).Where("kind = ?", ControlActionPause).Count(&count)
+	if count != 1 {
+		t.Errorf("esperada 1 linha de pausa, obtidas %d", count)
+	}
+
+	// Expiração desativa no próximo sync
+	hour := time.Hour
+	if err := s.ActivateKillSwitch("", "ops", "expirado", &hour); err != nil {
+		t.Fatal(err)
+	}
+	s.db.Model(&RulesControl{}).Where("kind = ? AND scope = ?", ControlKillSwitch, ControlScopeGlobal).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	s.syncControls()
+	if IsKillSwitchActive() {
+		t.Error("kill switch expirado não deveria estar ativo")
+	}
+
+	if err := s.DeactivateKillSwitch(appID.String()); err != nil {
+		t.Fatal(err)
+	}
+	s.ResumeActionType("", ActionWebhook)
+	s.DeactivateShadowMode()
+	if IsKillSwitchActiveForApp(appID) || IsActionTypePaused(ActionWebhook) || IsShadowModeActive(appID, ActionAdjust) {
+		t.Error("controles deveriam estar desativados")
+	}
+
+	if err := s.ActivateKillSwitch("not-an-app", "ops", "", nil); err == nil {
+		t.Error("escopo inválido deveria falhar")
+	}
+}
+
+func TestPauseActionTypeRejectsInvalidRequests(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&RulesControl{})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/actions/:type/pause", NewRulesHandler(s).PauseActionTypeHandler)
+
+	pause := func(actionType, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/actions/"+actionType+"/pause", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		name, actionType, body string
+	}{
+		{"json inválido", "webhook", `{"duration":`},
+		{"duração inválida", "webhook", `{"duration":"uma hora"}`},
+		{"duração negativa", "webhook", `{"duration":"-1h"}`},
+		{"tipo desconhecido", "teleport", `{}`},
+	} {
+		if code := pause(tc.actionType, tc.body); code != http.StatusBadRequest {
+			t.Errorf("%s: esperado 400, obtido %d", tc.name, code)
+		}
+	}
+	var controls int64
+	s.db.Model(&RulesControl{}).Count(&controls)
+	if controls != 0 {
+		t.Fatalf("requisições inválidas não deveriam pausar nada: %d controles", controls)
+	}
+
+	// Corpo vazio continua valendo: pausa global até retomar
+	if code := pause("webhook", ""); code != http.StatusOK {
+		t.Fatalf("pausa sem corpo deveria ser aceita: %d", code)
+	}
+	if code := pause("webhook", `{"duration":"30m"}`); code != http.StatusOK {
+		t.Fatalf("pausa com duração deveria ser aceita: %d", code)
+	}
+	s.ResumeActionType("", ActionWebhook) // Cache de controles é do pacote
+}
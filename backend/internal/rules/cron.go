@@ -0,0 +1,228 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Imagem runtime (alpine) não tem zoneinfo; embute a base IANA no binário
+	_ "time/tzdata"
+)
+
+// ========================================
+// CRON - Expressões de agendamento
+// "minuto hora dia-do-mês mês dia-da-semana"
+// ========================================
+
+// CronSchedule expressão cron compilada (5 campos, padrão Unix)
+type CronSchedule struct {
+	Expression string
+	Location   *time.Location
+
+	minutes  uint64 // bits 0-59
+	hours    uint64 // bits 0-23
+	days     uint64 // bits 1-31
+	months   uint64 // bits 1-12
+	weekdays uint64 // bits 0-6 (0 = domingo)
+
+	// Se dia-do-mês e dia-da-semana forem ambos restritos, basta um bater (semântica Vixie cron)
+	domRestricted bool
+	dowRestricted bool
+}
+
+// cronMacros atalhos aceitos
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseCron compila uma expressão cron no fuso informado (vazio = UTC)
+func ParseCron(expression, timezone string) (*CronSchedule, error) {
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+		loc = l
+	}
+
+	spec := strings.TrimSpace(expression)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+
+	sched := &CronSchedule{Expression: expression, Location: loc}
+	var err error
+
+	if sched.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute field: %v", err)
+	}
+	if sched.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour field: %v", err)
+	}
+	if sched.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day-of-month field: %v", err)
+	}
+	if sched.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("month field: %v", err)
+	}
+	// Dia da semana aceita 7 como domingo
+	if sched.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return nil, fmt.Errorf("weekday field: %v", err)
+	}
+	if sched.weekdays&(1<<7) != 0 {
+		sched.weekdays = (sched.weekdays | 1) &^ (1 << 7)
+	}
+
+	sched.domRestricted = fields[2] != "*" && fields[2] != "?"
+	sched.dowRestricted = fields[4] != "*" && fields[4] != "?"
+
+	return sched, nil
+}
+
+// parseCronField interpreta "*", "5", "1-5", "*/15", "1-30/5", "mon-fri" e listas separadas por vírgula
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		if part == "" {
+			return 0, fmt.Errorf("empty value in %q", field)
+		}
+
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangePart = part[:idx]
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = s
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			// intervalo completo
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(rangePart, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// "5/10" significa "de 5 até o fim, de 10 em 10"
+			if step > 1 {
+				hi = max
+			} else {
+				hi = v
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q (allowed %d-%d)", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if names != nil {
+		if v, ok := names[strings.ToLower(s)]; ok {
+			return v, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// Next retorna o primeiro disparo estritamente depois de t
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	// Trabalha no fuso do agendamento, com granularidade de minuto
+	t = t.In(c.Location).Truncate(time.Minute).Add(time.Minute)
+
+	// Limite de busca: 5 anos (cobre 29 de fevereiro e combinações raras)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.Location)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.Location)
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			// Avança para a próxima hora cheia; em transições de horário de verão
+			// time.Date normaliza horas inexistentes
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.Location)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// NextN retorna os próximos n disparos depois de t
+func (c *CronSchedule) NextN(t time.Time, n int) []time.Time {
+	times := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		t = c.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := c.days&(1<<uint(t.Day())) != 0
+	dowMatch := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"testing"
+	"time"
+)
+
+// ========================================
+// TESTES - Cron
+// ========================================
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2026, 3, 14, 10, 7, 30, 0, time.UTC) // sábado
+
+	cases := []struct {
+		expr     string
+		tz       string
+		expected []string
+	}{
+		{"*/15 * * * *", "", []string{"2026-03-14T10:15:00Z", "2026-03-14T10:30:00Z", "2026-03-14T10:45:00Z"}},
+		{"0 9 * * mon-fri", "", []string{"2026-03-16T09:00:00Z", "2026-03-17T09:00:00Z"}},
+		{"@daily", "", []string{"2026-03-15T00:00:00Z", "2026-03-16T00:00:00Z"}},
+		{"0 9 * * *", "America/Sao_Paulo", []string{"2026-03-14T12:00:00Z", "2026-03-15T12:00:00Z"}},
+		{"30 0 1 * *", "", []string{"2026-04-01T00:30:00Z", "2026-05-01T00:30:00Z"}},
+		{"0 0 29 2 *", "", []string{"2028-02-29T00:00:00Z"}},
+		// Dia do mês OU dia da semana quando ambos restritos
+		{"0 12 1 * sun", "", []string{"2026-03-15T12:00:00Z", "2026-03-22T12:00:00Z", "2026-03-29T12:00:00Z", "2026-04-01T12:00:00Z"}},
+	}
+
+	for _, tc := range cases {
+		sched, err := ParseCron(tc.expr, tc.tz)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.expr, err)
+		}
+		got := sched.NextN(base, len(tc.expected))
+		if len(got) != len(tc.expected) {
+			t.Fatalf("%q: esperado %d disparos, obtido %d", tc.expr, len(tc.expected), len(got))
+		}
+		for i, want := range tc.expected {
+			if g := got[i].UTC().Format(time.RFC3339); g != want {
+				t.Errorf("%q[%d]: esperado %s, obtido %s", tc.expr, i, want, g)
+			}
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr, ""); err == nil {
+			t.Errorf("%q: esperado erro", expr)
+		}
+	}
+	if _, err := ParseCron("* * * * *", "Mars/Olympus"); err == nil {
+		t.Error("timezone inválida deveria falhar")
+	}
+}
@@ -0,0 +1,597 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// EXPERIMENTS - Testes A/B
+// "Mudança só vira padrão depois de provar que é melhor"
+// ========================================
+
+var (
+	ErrExperimentNotFound   = errors.New("experiment not found")
+	ErrInvalidExperiment    = errors.New("invalid experiment")
+	ErrExperimentNotRunning = errors.New("experiment is not running")
+	ErrNoWinner             = errors.New("experiment has no significant winner")
+)
+
+// ExperimentStatus status do experimento
+type ExperimentStatus string
+
+const (
+	ExperimentDraft     ExperimentStatus = "draft"
+	ExperimentRunning   ExperimentStatus = "running"
+	ExperimentStopped   ExperimentStatus = "stopped"
+	ExperimentCompleted ExperimentStatus = "completed" // Vencedor promovido
+)
+
+const (
+	defaultExposureEvent = "experiment.exposure"
+	defaultConfidence    = 0.95
+	defaultMinSampleSize = 100
+)
+
+// Experiment experimento A/B de um app
+// O primeiro variant é o controle; o vencedor é gravado em AppConfig[ConfigKey]
+type Experiment struct {
+	ID          uuid.UUID        `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID       uuid.UUID        `gorm:"type:uuid;index" json:"app_id"`
+	Name        string           `gorm:"size:100" json:"name"`
+	Description string           `gorm:"size:500" json:"description"`
+	Status      ExperimentStatus `gorm:"size:20;default:'draft'" json:"status"`
+
+	// Variantes (JSON []ExperimentVariant)
+	Variants string `gorm:"type:text" json:"variants"`
+
+	// Config que recebe o valor do vencedor
+	ConfigKey string `gorm:"size:100" json:"config_key"`
+
+	// Eventos de telemetria que medem o experimento
+	ExposureEvent   string `gorm:"size:100" json:"exposure_event"`   // Vazio = "experiment.exposure"
+	ConversionEvent string `gorm:"size:100" json:"conversion_event"` // Ex: "interaction.match.accepted"
+
+	// Critério de decisão
+	Confidence    float64 `gorm:"default:0.95" json:"confidence"`
+	MinSampleSize int     `gorm:"default:100" json:"min_sample_size"` // Expostos por variante
+
+	// Resultado
+	WinnerVariant string `gorm:"size:50" json:"winner_variant,omitempty"`
+
+	// Timing
+	StartedAt  *time.Time `json:"started_at"`
+	StoppedAt  *time.Time `json:"stopped_at"`
+	PromotedAt *time.Time `json:"promoted_at"`
+
+	// Metadata
+	CreatedByRule *uuid.UUID `gorm:"type:uuid" json:"created_by_rule,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (Experiment) TableName() string {
+	return "experiments"
+}
+
+// ExperimentVariant variante do experimento
+type ExperimentVariant struct {
+	Key    string `json:"key"`    // Ex: "control", "b"
+	Weight int    `json:"weight"` // Peso relativo na alocação de tráfego
+	Value  string `json:"value"`  // Valor gravado na config se vencer
+}
+
+// ExperimentAssignment alocação de um usuário a uma variante (sticky)
+type ExperimentAssignment struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	ExperimentID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_experiment_user" json:"experiment_id"`
+	UserID       uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_experiment_user" json:"user_id"`
+	Variant      string    `gorm:"size:50;index" json:"variant"`
+	AssignedAt   time.Time `json:"assigned_at"`
+}
+
+func (ExperimentAssignment) TableName() string {
+	return "experiment_assignments"
+}
+
+// ExperimentActionConfig config para ação de experimento
+type ExperimentActionConfig struct {
+	Operation      string `json:"operation"`       // "start", "stop", "promote"
+	ExperimentID   string `json:"experiment_id"`   // ID do experimento
+	ExperimentName string `json:"experiment_name"` // Ou nome (se ID não fornecido)
+	Variant        string `json:"variant"`         // promote: variante a promover (vazio = vencedor estatístico)
+	Reason         string `json:"reason"`
+}
+
+// VariantResult resultado de uma variante
+type VariantResult struct {
+	Key            string  `json:"key"`
+	Assigned       int64   `json:"assigned"`
+	Exposed        int64   `json:"exposed"`
+	Conversions    int64   `json:"conversions"`
+	ConversionRate float64 `json:"conversion_rate"` // %
+	Lift           float64 `json:"lift"`            // % relativo ao controle
+	ZScore         float64 `json:"z_score"`
+	PValue         float64 `json:"p_value"`
+	Significant    bool    `json:"significant"`
+}
+
+// ExperimentResults resultado consolidado do experimento
+type ExperimentResults struct {
+	ExperimentID  uuid.UUID        `json:"experiment_id"`
+	Status        ExperimentStatus `json:"status"`
+	Control       string           `json:"control"`
+	Variants      []VariantResult  `json:"variants"`
+	Winner        string           `json:"winner,omitempty"`
+	SampleReached bool             `json:"sample_reached"`
+	ComputedAt    time.Time        `json:"computed_at"`
+}
+
+// GetVariants decodifica as variantes do experimento
+func (e *Experiment) GetVariants() []ExperimentVariant {
+	var variants []ExperimentVariant
+	json.Unmarshal([]byte(e.Variants), &variants)
+	return variants
+}
+
+func (e *Experiment) exposureEvent() string {
+	if e.ExposureEvent == "" {
+		return defaultExposureEvent
+	}
+	return e.ExposureEvent
+}
+
+// validateExperiment valida variantes e critérios
+func validateExperiment(exp *Experiment) error {
+	if exp.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidExperiment)
+	}
+	if exp.ConfigKey == "" {
+		return fmt.Errorf("%w: config_key is required", ErrInvalidExperiment)
+	}
+	if exp.ConversionEvent == "" {
+		return fmt.Errorf("%w: conversion_event is required", ErrInvalidExperiment)
+	}
+
+	var variants []ExperimentVariant
+	if err := json.Unmarshal([]byte(exp.Variants), &variants); err != nil {
+		return fmt.Errorf("%w: variants: %v", ErrInvalidExperiment, err)
+	}
+	if len(variants) < 2 {
+		return fmt.Errorf("%w: at least 2 variants are required", ErrInvalidExperiment)
+	}
+	seen := make(map[string]bool)
+	for _, v := range variants {
+		if v.Key == "" {
+			return fmt.Errorf("%w: variant key is required", ErrInvalidExperiment)
+		}
+		if seen[v.Key] {
+			return fmt.Errorf("%w: duplicate variant %q", ErrInvalidExperiment, v.Key)
+		}
+		if v.Weight <= 0 {
+			return fmt.Errorf("%w: variant %q must have a positive weight", ErrInvalidExperiment, v.Key)
+		}
+		seen[v.Key] = true
+	}
+
+	if exp.Confidence == 0 {
+		exp.Confidence = defaultConfidence
+	}
+	if exp.Confidence <= 0.5 || exp.Confidence >= 1 {
+		return fmt.Errorf("%w: confidence must be between 0.5 and 1", ErrInvalidExperiment)
+	}
+	if exp.MinSampleSize <= 0 {
+		exp.MinSampleSize = defaultMinSampleSize
+	}
+	return nil
+}
+
+// ========================================
+// CRUD
+// ========================================
+
+// CreateExperiment cria um experimento (em rascunho)
+func (s *RulesService) CreateExperiment(exp *Experiment) error {
+	if err := validateExperiment(exp); err != nil {
+		return err
+	}
+	exp.ID = uuid.New()
+	exp.Status = ExperimentDraft
+	exp.WinnerVariant = ""
+	exp.CreatedAt = time.Now()
+	exp.UpdatedAt = time.Now()
+	return s.db.Create(exp).Error
+}
+
+// GetExperiment busca experimento por ID
+func (s *RulesService) GetExperiment(id uuid.UUID) (*Experiment, error) {
+	var exp Experiment
+	if err := s.db.Where("id = ?", id).First(&exp).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExperimentNotFound
+		}
+		return nil, err
+	}
+	return &exp, nil
+}
+
+// GetExperimentsByApp lista experimentos de um app
+func (s *RulesService) GetExperimentsByApp(appID uuid.UUID) ([]Experiment, error) {
+	var experiments []Experiment
+	err := s.db.Where("app_id = ?", appID).Order("created_at DESC").Find(&experiments).Error
+	return experiments, err
+}
+
+// StartExperiment inicia (ou retoma) um experimento
+func (s *RulesService) StartExperiment(id uuid.UUID) (*Experiment, error) {
+	exp, err := s.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if exp.Status == ExperimentCompleted {
+		return nil, fmt.Errorf("%w: experiment already completed", ErrInvalidExperiment)
+	}
+	if exp.Status == ExperimentRunning {
+		return exp, nil
+	}
+
+	now := time.Now()
+	if exp.StartedAt == nil {
+		exp.StartedAt = &now
+	}
+	exp.StoppedAt = nil
+	exp.Status = ExperimentRunning
+	exp.UpdatedAt = now
+	if err := s.db.Save(exp).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("🧪 [EXPERIMENT] Started %s (%s)", exp.Name, exp.ID)
+	return exp, nil
+}
+
+// StopExperiment pausa a coleta; assignments existentes são mantidos
+func (s *RulesService) StopExperiment(id uuid.UUID) (*Experiment, error) {
+	exp, err := s.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if exp.Status != ExperimentRunning {
+		return nil, ErrExperimentNotRunning
+	}
+
+	now := time.Now()
+	exp.Status = ExperimentStopped
+	exp.StoppedAt = &now
+	exp.UpdatedAt = now
+	if err := s.db.Save(exp).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("🧪 [EXPERIMENT] Stopped %s (%s)", exp.Name, exp.ID)
+	return exp, nil
+}
+
+// PromoteExperiment grava a variante vencedora na config do app e encerra o experimento.
+// variant vazio = vencedor estatístico (falha com ErrNoWinner se não houver).
+func (s *RulesService) PromoteExperiment(id uuid.UUID, variant, reason string, ruleID *uuid.UUID) (*Experiment, error) {
+	exp, err := s.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	if exp.Status == ExperimentCompleted || exp.Status == ExperimentDraft {
+		return nil, fmt.Errorf("%w: cannot promote a %s experiment", ErrInvalidExperiment, exp.Status)
+	}
+
+	if variant == "" {
+		results, err := s.GetExperimentResults(id)
+		if err != nil {
+			return nil, err
+		}
+		if results.Winner == "" {
+			return nil, ErrNoWinner
+		}
+		variant = results.Winner
+	}
+
+	var winner *ExperimentVariant
+	variants := exp.GetVariants()
+	for i := range variants {
+		if variants[i].Key == variant {
+			winner = &variants[i]
+			break
+		}
+	}
+	if winner == nil {
+		return nil, fmt.Errorf("%w: unknown variant %q", ErrInvalidExperiment, variant)
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("Experimento %s: variante %s promovida", exp.Name, variant)
+	}
+	config, err := s.SetAppConfig(exp.AppID, exp.ConfigKey, winner.Value, "string", reason, "")
+	if err != nil {
+		return nil, err
+	}
+	if ruleID != nil {
+		s.db.Model(config).Updates(map[string]interface{}{"source": "rule", "source_id": *ruleID})
+	}
+
+	now := time.Now()
+	exp.Status = ExperimentCompleted
+	exp.WinnerVariant = variant
+	exp.PromotedAt = &now
+	if exp.StoppedAt == nil {
+		exp.StoppedAt = &now
+	}
+	exp.UpdatedAt = now
+	if err := s.db.Save(exp).Error; err != nil {
+		return nil, err
+	}
+
+	log.Printf("🏆 [EXPERIMENT] Promoted %s=%s in %s (%s)", exp.ConfigKey, winner.Value, exp.Name, variant)
+	return exp, nil
+}
+
+// findExperiment resolve experimento por ID ou nome dentro do app
+func (s *RulesService) findExperiment(appID uuid.UUID, idStr, name string) (*Experiment, error) {
+	if idStr != "" {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid experiment_id: %v", err)
+		}
+		return s.GetExperiment(id)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("experiment_id or experiment_name is required")
+	}
+	var exp Experiment
+	if err := s.db.Where("app_id = ? AND name = ?", appID, name).Order("created_at DESC").First(&exp).Error; err != nil {
+		return nil, ErrExperimentNotFound
+	}
+	return &exp, nil
+}
+
+// ========================================
+// ASSIGNMENT - Alocação sticky
+// ========================================
+
+// pickVariant escolhe variante de forma determinística pelo hash (experimento, usuário)
+func pickVariant(experimentID, userID uuid.UUID, variants []ExperimentVariant) string {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return ""
+	}
+
+	h := fnv.New64a()
+	h.Write(experimentID[:])
+	h.Write(userID[:])
+	bucket := int(h.Sum64() % uint64(total))
+
+	for _, v := range variants {
+		if bucket < v.Weight {
+			return v.Key
+		}
+		bucket -= v.Weight
+	}
+	return variants[len(variants)-1].Key
+}
+
+// AssignVariant retorna a variante do usuário, alocando na primeira chamada.
+// A alocação é persistida: mudar os pesos depois não troca usuários de grupo.
+func (s *RulesService) AssignVariant(experimentID, userID uuid.UUID) (*ExperimentAssignment, *ExperimentVariant, error) {
+	exp, err := s.GetExperiment(experimentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	variants := exp.GetVariants()
+
+	var assignment ExperimentAssignment
+	err = s.db.Where("experiment_id = ? AND user_id = ?", experimentID, userID).First(&assignment).Error
+	if err != nil {
+		// Só aloca novos usuários enquanto o experimento roda
+		if exp.Status != ExperimentRunning {
+			return nil, nil, ErrExperimentNotRunning
+		}
+		assignment = ExperimentAssignment{
+			ID:           uuid.New(),
+			ExperimentID: experimentID,
+			UserID:       userID,
+			Variant:      pickVariant(experimentID, userID, variants),
+			AssignedAt:   time.Now(),
+		}
+		// Corrida entre réplicas: o índice único garante uma única alocação
+		s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&assignment)
+		if err := s.db.Where("experiment_id = ? AND user_id = ?", experimentID, userID).First(&assignment).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Após promoção todos recebem o vencedor
+	key := assignment.Variant
+	if exp.Status == ExperimentCompleted && exp.WinnerVariant != "" {
+		key = exp.WinnerVariant
+	}
+	for i := range variants {
+		if variants[i].Key == key {
+			return &assignment, &variants[i], nil
+		}
+	}
+	return &assignment, nil, fmt.Errorf("%w: unknown variant %q", ErrInvalidExperiment, key)
+}
+
+// ========================================
+// RESULTADOS - Exposição, conversão e significância
+// ========================================
+
+// GetExperimentResults calcula exposição/conversão por variante a partir da telemetria
+// Exposto = usuário alocado com evento de exposição após o início
+// Convertido = exposto com evento de conversão após o início
+func (s *RulesService) GetExperimentResults(id uuid.UUID) (*ExperimentResults, error) {
+	exp, err := s.GetExperiment(id)
+	if err != nil {
+		return nil, err
+	}
+	variants := exp.GetVariants()
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("%w: experiment has no variants", ErrInvalidExperiment)
+	}
+
+	results := &ExperimentResults{
+		ExperimentID: exp.ID,
+		Status:       exp.Status,
+		Control:      variants[0].Key,
+		ComputedAt:   time.Now(),
+	}
+
+	from := exp.CreatedAt
+	if exp.StartedAt != nil {
+		from = *exp.StartedAt
+	}
+	to := time.Now()
+	if exp.StoppedAt != nil {
+		to = *exp.StoppedAt
+	}
+
+	for _, v := range variants {
+		vr := VariantResult{Key: v.Key}
+
+		s.db.Model(&ExperimentAssignment{}).
+			Where("experiment_id = ? AND variant = ?", exp.ID, v.Key).
+			Count(&vr.Assigned)
+
+		assigned := s.db.Model(&ExperimentAssignment{}).
+			Select("user_id").
+			Where("experiment_id = ? AND variant = ?", exp.ID, v.Key)
+
+		exposed := s.db.Table("telemetry_events").
+			Select("DISTINCT user_id").
+			Where("app_id = ? AND type = ? AND timestamp >= ? AND timestamp <= ? AND user_id IN (?)",
+				exp.AppID, exp.exposureEvent(), from, to, assigned)
+		s.db.Table("(?) AS exposed", exposed).Count(&vr.Exposed)
+
+		s.db.Table("telemetry_events").
+			Where("app_id = ? AND type = ? AND timestamp >= ? AND timestamp <= ? AND user_id IN (?)",
+				exp.AppID, exp.ConversionEvent, from, to, exposed).
+			Distinct("user_id").
+			Count(&vr.Conversions)
+
+		if vr.Exposed > 0 {
+			vr.ConversionRate = float64(vr.Conversions) / float64(vr.Exposed) * 100
+		}
+		results.Variants = append(results.Variants, vr)
+	}
+
+	// Cada variante contra o controle
+	control := results.Variants[0]
+	results.SampleReached = true
+	bestRate := -1.0
+	for i := range results.Variants {
+		vr := &results.Variants[i]
+		if vr.Exposed < int64(exp.MinSampleSize) {
+			results.SampleReached = false
+		}
+		if i == 0 {
+			continue
+		}
+		if control.ConversionRate > 0 {
+			vr.Lift = (vr.ConversionRate - control.ConversionRate) / control.ConversionRate * 100
+		}
+		vr.ZScore, vr.PValue = twoProportionZTest(control.Conversions, control.Exposed, vr.Conversions, vr.Exposed)
+		vr.Significant = vr.PValue < 1-exp.Confidence
+	}
+
+	// Vencedor: só com amostra mínima; a variante significativamente melhor com maior taxa,
+	// ou o controle se todas forem significativamente piores
+	if results.SampleReached {
+		allWorse := true
+		for _, vr := range results.Variants[1:] {
+			if vr.Significant && vr.ZScore > 0 && vr.ConversionRate > bestRate {
+				results.Winner = vr.Key
+				bestRate = vr.ConversionRate
+			}
+			if !vr.Significant || vr.ZScore >= 0 {
+				allWorse = false
+			}
+		}
+		if results.Winner == "" && allWorse {
+			results.Winner = control.Key
+		}
+	}
+
+	return results, nil
+}
+
+// twoProportionZTest teste z bicaudal para diferença entre duas proporções (b - a)
+func twoProportionZTest(convA, nA, convB, nB int64) (z, pValue float64) {
+	if nA == 0 || nB == 0 {
+		return 0, 1
+	}
+	pA := float64(convA) / float64(nA)
+	pB := float64(convB) / float64(nB)
+	pooled := float64(convA+convB) / float64(nA+nB)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(nA) + 1/float64(nB)))
+	if se == 0 {
+		return 0, 1
+	}
+	z = (pB - pA) / se
+	pValue = math.Erfc(math.Abs(z) / math.Sqrt2)
+	return z, pValue
+}
+
+// ========================================
+// AÇÃO - experiment
+// ========================================
+
+// executeExperimentAction inicia, para ou promove um experimento
+func (s *RulesService) executeExperimentAction(rule *Rule, metrics map[string]float64) (map[string]interface{}, error) {
+	var config ExperimentActionConfig
+	if err := json.Unmarshal([]byte(rule.ActionConfig), &config); err != nil {
+		return nil, fmt.Errorf("invalid experiment config: %v", err)
+	}
+
+	exp, err := s.findExperiment(rule.AppID, config.ExperimentID, config.ExperimentName)
+	if err != nil {
+		return nil, err
+	}
+	if exp.AppID != rule.AppID {
+		return nil, fmt.Errorf("experiment %s does not belong to app %s", exp.ID, rule.AppID)
+	}
+
+	switch config.Operation {
+	case "start":
+		exp, err = s.StartExperiment(exp.ID)
+	case "stop":
+		exp, err = s.StopExperiment(exp.ID)
+	case "promote":
+		reason := config.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("Promovido pela regra %s", rule.Name)
+		}
+		exp, err = s.PromoteExperiment(exp.ID, config.Variant, reason, &rule.ID)
+	default:
+		return nil, fmt.Errorf("unknown experiment operation: %q", config.Operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"experiment_id":  exp.ID.String(),
+		"operation":      config.Operation,
+		"status":         exp.Status,
+		"winner_variant": exp.WinnerVariant,
+	}, nil
+}
@@ -0,0 +1,233 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// EXPERIMENTS HANDLER - API de Testes A/B
+// ========================================
+
+// respondExperimentError mapeia erros de experimento para status HTTP
+func respondExperimentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrExperimentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Experimento não encontrado"})
+	case errors.Is(err, ErrInvalidExperiment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrExperimentNotRunning), errors.Is(err, ErrNoWinner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateExperiment cria um experimento em rascunho
+// POST /api/v1/admin/rules/experiments
+func (h *RulesHandler) CreateExperiment(c *gin.Context) {
+	var req struct {
+		AppID           uuid.UUID           `json:"app_id" binding:"required"`
+		Name            string              `json:"name" binding:"required"`
+		Description     string              `json:"description"`
+		ConfigKey       string              `json:"config_key" binding:"required"`
+		ExposureEvent   string              `json:"exposure_event"`
+		ConversionEvent string              `json:"conversion_event" binding:"required"`
+		Variants        []ExperimentVariant `json:"variants" binding:"required"`
+		Confidence      float64             `json:"confidence"`
+		MinSampleSize   int                 `json:"min_sample_size"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variants, _ := json.Marshal(req.Variants)
+	exp := &Experiment{
+		AppID:           req.AppID,
+		Name:            req.Name,
+		Description:     req.Description,
+		ConfigKey:       req.ConfigKey,
+		ExposureEvent:   req.ExposureEvent,
+		ConversionEvent: req.ConversionEvent,
+		Variants:        string(variants),
+		Confidence:      req.Confidence,
+		MinSampleSize:   req.MinSampleSize,
+	}
+	if err := h.service.CreateExperiment(exp); err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, exp)
+}
+
+// GetExperimentsByApp lista experimentos de um app
+// GET /api/v1/admin/rules/experiments/app/:appId
+func (h *RulesHandler) GetExperimentsByApp(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	experiments, err := h.service.GetExperimentsByApp(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"experiments": experiments,
+		"total":       len(experiments),
+	})
+}
+
+// GetExperiment busca um experimento
+// GET /api/v1/admin/rules/experiments/:expId
+func (h *RulesHandler) GetExperiment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	exp, err := h.service.GetExperiment(id)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// GetExperimentResults retorna exposição, conversão e significância por variante
+// GET /api/v1/admin/rules/experiments/:expId/results
+func (h *RulesHandler) GetExperimentResults(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	results, err := h.service.GetExperimentResults(id)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// StartExperiment inicia um experimento
+// POST /api/v1/admin/rules/experiments/:expId/start
+func (h *RulesHandler) StartExperiment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	exp, err := h.service.StartExperiment(id)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// StopExperiment para um experimento
+// POST /api/v1/admin/rules/experiments/:expId/stop
+func (h *RulesHandler) StopExperiment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	exp, err := h.service.StopExperiment(id)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// PromoteExperiment grava a variante vencedora na config do app
+// POST /api/v1/admin/rules/experiments/:expId/promote
+func (h *RulesHandler) PromoteExperiment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req struct {
+		Variant string `json:"variant"` // Vazio = vencedor estatístico
+		Reason  string `json:"reason"`
+	}
+	c.ShouldBindJSON(&req)
+
+	exp, err := h.service.PromoteExperiment(id, req.Variant, req.Reason, nil)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exp)
+}
+
+// GetExperimentAssignment retorna a variante de um usuário do app (sticky)
+// GET /api/v1/experiments/:expId/assignment?user_id=
+func (h *RulesHandler) GetExperimentAssignment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("expId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	userID, err := uuid.Parse(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id inválido"})
+		return
+	}
+
+	// O experimento precisa pertencer ao app autenticado
+	exp, err := h.service.GetExperiment(id)
+	if err != nil || exp.AppID.String() != c.GetString("app_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Experimento não encontrado"})
+		return
+	}
+
+	assignment, variant, err := h.service.AssignVariant(id, userID)
+	if err != nil {
+		respondExperimentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"experiment_id":  id,
+		"user_id":        userID,
+		"variant":        variant.Key,
+		"value":          variant.Value,
+		"assigned_at":    assignment.AssignedAt,
+		"exposure_event": exp.exposureEvent(),
+	})
+}
+
+// RegisterExperimentRoutes registra rotas de experimentos para apps (API Key)
+func RegisterExperimentRoutes(router *gin.RouterGroup, service *RulesService, appContextMiddleware, requireAppContext gin.HandlerFunc) {
+	handler := NewRulesHandler(service)
+
+	experiments := router.Group("/experiments")
+	experiments.Use(appContextMiddleware)
+	experiments.Use(requireAppContext)
+	{
+		experiments.GET("/:expId/assignment", handler.GetExperimentAssignment)
+	}
+}
@@ -0,0 +1,149 @@
+package rules
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ========================================
+// TESTES - Experiments
+// ========================================
+
+// testTelemetryEvent espelho mínimo de telemetry_events
+type testTelemetryEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	AppID     uuid.UUID `gorm:"type:uuid"`
+	UserID    uuid.UUID `gorm:"type:uuid"`
+	Type      string
+	Metadata  string
+	Timestamp time.Time
+}
+
+func (testTelemetryEvent) TableName() string {
+	return "telemetry_events"
+}
+
+func newTestRulesService(t *testing.T) *RulesService {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Falha ao criar banco de teste: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	db.AutoMigrate(&Rule{}, &AppConfig{}, &Experiment{}, &ExperimentAssignment{}, &testTelemetryEvent{}, &RuleVersion{}, &ActionAuditLog{}, &RuleMetaBudget{})
+	return &RulesService{db: db, stopEval: make(chan struct{})}
+}
+
+func TestTwoProportionZTest(t *testing.T) {
+	// 10% vs 15% com 1000 expostos cada (proporção combinada): z ≈ 3.38, p ≈ 0.00072
+	z, p := twoProportionZTest(100, 1000, 150, 1000)
+	if math.Abs(z-3.38) > 0.01 || math.Abs(p-0.00072) > 0.00001 {
+		t.Errorf("z=%.4f p=%.6f", z, p)
+	}
+
+	if _, p := twoProportionZTest(0, 0, 10, 100); p != 1 {
+		t.Errorf("sem amostra p deveria ser 1, obtido %f", p)
+	}
+}
+
+func TestPickVariantIsStickyAndWeighted(t *testing.T) {
+	expID := uuid.New()
+	variants := []ExperimentVariant{{Key: "control", Weight: 80}, {Key: "b", Weight: 20}}
+
+	counts := map[string]int{}
+	for i := 0; i < 5000; i++ {
+		user := uuid.New()
+		v := pickVariant(expID, user, variants)
+		if pickVariant(expID, user, variants) != v {
+			t.Fatal("alocação não é determinística")
+		}
+		counts[v]++
+	}
+	if share := float64(counts["b"]) / 5000; share < 0.17 || share > 0.23 {
+		t.Errorf("variante b recebeu %.2f do tráfego, esperado ~0.20", share)
+	}
+}
+
+func TestExperimentLifecycle(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	exp := &Experiment{
+		AppID:           appID,
+		Name:            "match_algo",
+		ConfigKey:       "match_algorithm",
+		ConversionEvent: "interaction.match.accepted",
+		Variants:        `[{"key":"control","weight":1,"value":"v1"},{"key":"b","weight":1,"value":"v2"}]`,
+		MinSampleSize:   50,
+	}
+	if err := s.CreateExperiment(exp); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.AssignVariant(exp.ID, uuid.New()); err != ErrExperimentNotRunning {
+		t.Fatalf("rascunho não deveria alocar: %v", err)
+	}
+	if _, err := s.StartExperiment(exp.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Controle converte 10%, variante b 40%
+	converted := map[string]int{}
+	for i := 0; i < 400; i++ {
+		user := uuid.New()
+		assignment, variant, err := s.AssignVariant(exp.ID, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _, _ := s.AssignVariant(exp.ID, user)
+		if again.Variant != assignment.Variant {
+			t.Fatal("alocação não é sticky")
+		}
+
+		now := time.Now()
+		s.db.Create(&testTelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, Type: defaultExposureEvent, Timestamp: now})
+		n := converted[variant.Key] % 10
+		if (variant.Key == "b" && n < 4) || (variant.Key == "control" && n < 1) {
+			s.db.Create(&testTelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, Type: exp.ConversionEvent, Timestamp: now})
+		}
+		converted[variant.Key]++
+	}
+
+	results, err := s.GetExperimentResults(exp.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.SampleReached || results.Winner != "b" {
+		t.Fatalf("esperado vencedor b: %+v", results)
+	}
+
+	promoted, err := s.PromoteExperiment(exp.ID, "", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Status != ExperimentCompleted || promoted.WinnerVariant != "b" {
+		t.Errorf("promoção inesperada: %+v", promoted)
+	}
+	if v := s.GetAppConfigValue(appID, "match_algorithm", ""); v != "v2" {
+		t.Errorf("config esperada v2, obtida %q", v)
+	}
+}
+
+func TestExperimentResultsWithoutVariants(t *testing.T) {
+	s := newTestRulesService(t)
+	exp := &Experiment{ID: uuid.New(), AppID: uuid.New(), Name: "vazio", Variants: "[]"}
+	s.db.Create(exp)
+
+	if _, err := s.GetExperimentResults(exp.ID); !errors.Is(err, ErrInvalidExperiment) {
+		t.Fatalf("esperado ErrInvalidExperiment, obtido %v", err)
+	}
+}
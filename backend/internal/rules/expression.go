@@ -0,0 +1,912 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ========================================
+// EXPRESSION LANGUAGE - Condições de regras
+// "Tokenizer → Parser → AST → Avaliação"
+// ========================================
+//
+// Gramática (menor para maior precedência):
+//
+//	expr       = or
+//	or         = and { ("OR" | "||") and }
+//	and        = not { ("AND" | "&&") not }
+//	not        = ("NOT" | "!") not | comparison
+//	comparison = additive [ ("<" | "<=" | ">" | ">=" | "==" | "!=") additive ]
+//	additive   = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/" | "%") unary }
+//	unary      = "-" unary | primary
+//	primary    = number | string | "true" | "false" | ident | call | "(" expr ")"
+//	call       = ident "(" [ expr { "," expr } ] ")"
+//
+// Identificadores são nomes de métricas (ex: online_now, retention_d1).
+// Strings usam aspas simples ou duplas.
+
+// ExpressionError erro de parsing/avaliação com posição (1-based) na condição
+type ExpressionError struct {
+	Pos     int    `json:"position"`
+	Message string `json:"message"`
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("condition error at position %d: %s", e.Pos, e.Message)
+}
+
+func exprErrorf(pos int, format string, args ...interface{}) *ExpressionError {
+	return &ExpressionError{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// ========================================
+// TOKENIZER
+// ========================================
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// twoCharOps operadores de dois caracteres (checados antes dos de um)
+var twoCharOps = []string{"<=", ">=", "==", "!=", "&&", "||"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			text := string(runes[start:i])
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, exprErrorf(pos, "invalid number %q", text)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, num: num, pos: pos})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: pos})
+
+		case r == '"' || r == '\'':
+			quote := r
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, exprErrorf(pos, "unterminated string")
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: pos})
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: pos})
+			i++
+
+		default:
+			matched := false
+			if i+1 < len(runes) {
+				pair := string(runes[i : i+2])
+				for _, op := range twoCharOps {
+					if pair == op {
+						tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+						i += 2
+						matched = true
+						break
+					}
+				}
+			}
+			if matched {
+				continue
+			}
+			if strings.ContainsRune("<>+-*/%!", r) {
+				tokens = append(tokens, token{kind: tokOp, text: string(r), pos: pos})
+				i++
+				continue
+			}
+			return nil, exprErrorf(pos, "unexpected character %q", r)
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// ========================================
+// AST
+// ========================================
+
+type exprNode interface {
+	position() int
+}
+
+type numberNode struct {
+	pos   int
+	value float64
+}
+
+type stringNode struct {
+	pos   int
+	value string
+}
+
+type boolNode struct {
+	pos   int
+	value bool
+}
+
+type identNode struct {
+	pos  int
+	name string
+}
+
+type unaryNode struct {
+	pos     int
+	op      string
+	operand exprNode
+}
+
+type binaryNode struct {
+	pos   int
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+type callNode struct {
+	pos  int
+	name string
+	args []exprNode
+}
+
+func (n *numberNode) position() int { return n.pos }
+func (n *stringNode) position() int { return n.pos }
+func (n *boolNode) position() int   { return n.pos }
+func (n *identNode) position() int  { return n.pos }
+func (n *unaryNode) position() int  { return n.pos }
+func (n *binaryNode) position() int { return n.pos }
+func (n *callNode) position() int   { return n.pos }
+
+// ========================================
+// PARSER
+// ========================================
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isKeyword verifica palavra-chave (AND/OR/NOT aceitam maiúsculas ou minúsculas)
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, keyword)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !(isKeyword(t, "OR") || (t.kind == tokOp && t.text == "||")) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{pos: t.pos, op: "OR", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !(isKeyword(t, "AND") || (t.kind == tokOp && t.text == "&&")) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{pos: t.pos, op: "AND", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	t := p.peek()
+	if isKeyword(t, "NOT") || (t.kind == tokOp && t.text == "!") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{pos: t.pos, op: "NOT", operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "<", "<=", ">", ">=", "==", "!=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			node := &binaryNode{pos: t.pos, op: t.text, left: left, right: right}
+			// Comparações não encadeiam (a < b < c é ambíguo)
+			if n := p.peek(); n.kind == tokOp && isComparisonOp(n.text) {
+				return nil, exprErrorf(n.pos, "chained comparison is not allowed, use AND")
+			}
+			return node, nil
+		}
+	}
+	return left, nil
+}
+
+func isComparisonOp(op string) bool {
+	switch op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{pos: t.pos, op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{pos: t.pos, op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokOp && t.text == "-" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{pos: t.pos, op: "-", operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &numberNode{pos: t.pos, value: t.num}, nil
+
+	case tokString:
+		return &stringNode{pos: t.pos, value: t.text}, nil
+
+	case tokIdent:
+		if isKeyword(t, "true") {
+			return &boolNode{pos: t.pos, value: true}, nil
+		}
+		if isKeyword(t, "false") {
+			return &boolNode{pos: t.pos, value: false}, nil
+		}
+		if isKeyword(t, "AND") || isKeyword(t, "OR") || isKeyword(t, "NOT") {
+			return nil, exprErrorf(t.pos, "unexpected keyword %s", strings.ToUpper(t.text))
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		return &identNode{pos: t.pos, name: t.text}, nil
+
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, exprErrorf(closing.pos, "expected ')' to close '(' at position %d", t.pos)
+		}
+		return inner, nil
+
+	case tokEOF:
+		return nil, exprErrorf(t.pos, "unexpected end of expression")
+
+	default:
+		return nil, exprErrorf(t.pos, "unexpected %q", t.text)
+	}
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	p.next() // (
+	call := &callNode{pos: name.pos, name: strings.ToLower(name.text)}
+
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if closing := p.next(); closing.kind != tokRParen {
+		return nil, exprErrorf(closing.pos, "expected ')' to close call to %s", name.text)
+	}
+
+	if err := validateCall(call); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// ========================================
+// FUNÇÕES
+// ========================================
+
+// exprFunction descreve uma função disponível nas condições
+type exprFunction struct {
+	MinArgs     int    `json:"min_args"`
+	MaxArgs     int    `json:"max_args"`
+	History     bool   `json:"history"` // Primeiro arg é métrica, segundo é janela ("1h", "7d")
+	Segment     bool   `json:"segment"` // Único arg é o nome de um segmento de telemetria
+	Description string `json:"description"`
+}
+
+// ExpressionFunctions funções suportadas nas condições
+var ExpressionFunctions = map[string]exprFunction{
+	"avg":        {MinArgs: 2, MaxArgs: 2, History: true, Description: "Média da métrica na janela: avg(online_now, \"1h\")"},
+	"min":        {MinArgs: 2, MaxArgs: 2, History: true, Description: "Mínimo da métrica na janela: min(online_now, \"1h\")"},
+	"max":        {MinArgs: 2, MaxArgs: 2, History: true, Description: "Máximo da métrica na janela: max(online_now, \"1h\")"},
+	"sum":        {MinArgs: 2, MaxArgs: 2, History: true, Description: "Soma da métrica na janela: sum(events_per_minute, \"1h\")"},
+	"delta":      {MinArgs: 2, MaxArgs: 2, History: true, Description: "Variação (atual - início da janela): delta(online_now, \"1h\")"},
+	"abs":        {MinArgs: 1, MaxArgs: 1, Description: "Valor absoluto: abs(delta(online_now, \"1h\"))"},
+	"round":      {MinArgs: 1, MaxArgs: 1, Description: "Arredonda para inteiro: round(bounce_rate)"},
+	"in_segment": {MinArgs: 1, MaxArgs: 1, Segment: true, Description: "Usuário do evento pertence ao segmento: in_segment(\"power_users\")"},
+}
+
+func validateCall(call *callNode) error {
+	fn, ok := ExpressionFunctions[call.name]
+	if !ok {
+		return exprErrorf(call.pos, "unknown function %s", call.name)
+	}
+	if len(call.args) < fn.MinArgs || len(call.args) > fn.MaxArgs {
+		if fn.MinArgs == fn.MaxArgs {
+			return exprErrorf(call.pos, "%s expects %d argument(s), got %d", call.name, fn.MinArgs, len(call.args))
+		}
+		return exprErrorf(call.pos, "%s expects %d to %d arguments, got %d", call.name, fn.MinArgs, fn.MaxArgs, len(call.args))
+	}
+	if fn.History {
+		if _, ok := call.args[0].(*identNode); !ok {
+			return exprErrorf(call.args[0].position(), "first argument of %s must be a metric name", call.name)
+		}
+		window, ok := call.args[1].(*stringNode)
+		if !ok {
+			return exprErrorf(call.args[1].position(), "second argument of %s must be a window string like \"1h\"", call.name)
+		}
+		if _, err := parseWindow(window.value); err != nil {
+			return exprErrorf(window.pos, "invalid window %q", window.value)
+		}
+	}
+	if fn.Segment {
+		if _, ok := call.args[0].(*stringNode); !ok {
+			return exprErrorf(call.args[0].position(), "argument of %s must be a segment name string", call.name)
+		}
+	}
+	return nil
+}
+
+// parseWindow interpreta janelas como "30m", "1h", "24h" e "7d"
+func parseWindow(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid window: %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window: %s", s)
+	}
+	return d, nil
+}
+
+// ========================================
+// EXPRESSION - API pública
+// ========================================
+
+// Expression condição compilada
+type Expression struct {
+	Source string
+	root   exprNode
+}
+
+// ExprEnv ambiente de avaliação
+type ExprEnv struct {
+	// Vars valores das métricas (float64, string ou bool)
+	Vars map[string]interface{}
+
+	// History retorna a série da métrica na janela, em ordem cronológica.
+	// Necessário para avg/min/max/sum/delta.
+	History func(metric string, window time.Duration) ([]float64, error)
+
+	// InSegment pertinência do usuário que disparou a regra a um segmento.
+	// Necessário para in_segment; nil quando não há usuário (ex.: regras agendadas).
+	InSegment func(segment string) (bool, error)
+}
+
+// ParseExpression compila uma condição
+func ParseExpression(src string) (*Expression, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, exprErrorf(t.pos, "unexpected %q after end of expression", t.text)
+	}
+	return &Expression{Source: src, root: root}, nil
+}
+
+// ValidateCondition valida a sintaxe de uma condição (vazia é válida)
+func ValidateCondition(condition string) error {
+	if strings.TrimSpace(condition) == "" {
+		return nil
+	}
+	_, err := ParseExpression(condition)
+	return err
+}
+
+// Identifiers retorna os nomes de métricas referenciados na expressão
+func (e *Expression) Identifiers() []string {
+	seen := make(map[string]bool)
+	var names []string
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch node := n.(type) {
+		case *identNode:
+			if !seen[node.name] {
+				seen[node.name] = true
+				names = append(names, node.name)
+			}
+		case *unaryNode:
+			walk(node.operand)
+		case *binaryNode:
+			walk(node.left)
+			walk(node.right)
+		case *callNode:
+			for _, arg := range node.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	return names
+}
+
+// segmentCall primeira chamada a in_segment (nil se não houver)
+func (e *Expression) segmentCall() *callNode {
+	var found *callNode
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		if found != nil {
+			return
+		}
+		switch node := n.(type) {
+		case *unaryNode:
+			walk(node.operand)
+		case *binaryNode:
+			walk(node.left)
+			walk(node.right)
+		case *callNode:
+			if ExpressionFunctions[node.name].Segment {
+				found = node
+				return
+			}
+			for _, arg := range node.args {
+				walk(arg)
+			}
+		}
+	}
+	walk(e.root)
+	return found
+}
+
+// Eval avalia a expressão e retorna float64, string ou bool
+func (e *Expression) Eval(env *ExprEnv) (interface{}, error) {
+	return evalNode(e.root, env)
+}
+
+// EvalBool avalia a expressão exigindo resultado booleano
+func (e *Expression) EvalBool(env *ExprEnv) (bool, error) {
+	v, err := e.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, exprErrorf(e.root.position(), "condition must evaluate to a boolean, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+// ========================================
+// AVALIAÇÃO
+// ========================================
+
+func evalNode(n exprNode, env *ExprEnv) (interface{}, error) {
+	switch node := n.(type) {
+	case *numberNode:
+		return node.value, nil
+	case *stringNode:
+		return node.value, nil
+	case *boolNode:
+		return node.value, nil
+
+	case *identNode:
+		v, ok := env.Vars[node.name]
+		if !ok {
+			return nil, exprErrorf(node.pos, "unknown metric %s", node.name)
+		}
+		return normalizeValue(v), nil
+
+	case *unaryNode:
+		v, err := evalNode(node.operand, env)
+		if err != nil {
+			return nil, err
+		}
+		if node.op == "NOT" {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, exprErrorf(node.pos, "NOT expects a boolean, got %s", typeName(v))
+			}
+			return !b, nil
+		}
+		f, ok := v.(float64)
+		if !ok {
+			return nil, exprErrorf(node.pos, "unary minus expects a number, got %s", typeName(v))
+		}
+		return -f, nil
+
+	case *binaryNode:
+		return evalBinary(node, env)
+
+	case *callNode:
+		return evalCall(node, env)
+	}
+	return nil, fmt.Errorf("unknown expression node")
+}
+
+func evalBinary(node *binaryNode, env *ExprEnv) (interface{}, error) {
+	// Curto-circuito para AND/OR
+	if node.op == "AND" || node.op == "OR" {
+		left, err := evalNode(node.left, env)
+		if err != nil {
+			return nil, err
+		}
+		lb, ok := left.(bool)
+		if !ok {
+			return nil, exprErrorf(node.pos, "%s expects booleans, got %s", node.op, typeName(left))
+		}
+		if node.op == "AND" && !lb {
+			return false, nil
+		}
+		if node.op == "OR" && lb {
+			return true, nil
+		}
+		right, err := evalNode(node.right, env)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := right.(bool)
+		if !ok {
+			return nil, exprErrorf(node.pos, "%s expects booleans, got %s", node.op, typeName(right))
+		}
+		return rb, nil
+	}
+
+	left, err := evalNode(node.left, env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalNode(node.right, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	}
+
+	if node.op == "<" || node.op == "<=" || node.op == ">" || node.op == ">=" {
+		if ls, ok := left.(string); ok {
+			if rs, ok := right.(string); ok {
+				return compareOrdered(node.op, strings.Compare(ls, rs)), nil
+			}
+		}
+	}
+
+	lf, lok := left.(float64)
+	rf, rok := right.(float64)
+	if !lok || !rok {
+		return nil, exprErrorf(node.pos, "operator %s expects numbers, got %s and %s", node.op, typeName(left), typeName(right))
+	}
+
+	switch node.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, exprErrorf(node.pos, "division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, exprErrorf(node.pos, "division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	case ">=":
+		return lf >= rf, nil
+	}
+	return nil, exprErrorf(node.pos, "unknown operator %s", node.op)
+}
+
+func evalCall(node *callNode, env *ExprEnv) (interface{}, error) {
+	fn := ExpressionFunctions[node.name]
+
+	if fn.History {
+		metric := node.args[0].(*identNode).name
+		window, _ := parseWindow(node.args[1].(*stringNode).value)
+		if env.History == nil {
+			return nil, exprErrorf(node.pos, "%s requires metric history, which is not available here", node.name)
+		}
+		series, err := env.History(metric, window)
+		if err != nil {
+			return nil, exprErrorf(node.pos, "%s(%s): %v", node.name, metric, err)
+		}
+		if len(series) == 0 {
+			return nil, exprErrorf(node.pos, "%s(%s): no history in window", node.name, metric)
+		}
+		return aggregateSeries(node.name, series), nil
+	}
+
+	if fn.Segment {
+		segment := node.args[0].(*stringNode).value
+		if env.InSegment == nil {
+			return nil, exprErrorf(node.pos, "%s requires a triggering user, which is not available here", node.name)
+		}
+		member, err := env.InSegment(segment)
+		if err != nil {
+			return nil, exprErrorf(node.pos, "%s(%q): %v", node.name, segment, err)
+		}
+		return member, nil
+	}
+
+	v, err := evalNode(node.args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, exprErrorf(node.pos, "%s expects a number, got %s", node.name, typeName(v))
+	}
+	switch node.name {
+	case "abs":
+		return math.Abs(f), nil
+	case "round":
+		return math.Round(f), nil
+	}
+	return nil, exprErrorf(node.pos, "unknown function %s", node.name)
+}
+
+func aggregateSeries(fn string, series []float64) float64 {
+	switch fn {
+	case "delta":
+		return series[len(series)-1] - series[0]
+	case "min":
+		m := series[0]
+		for _, v := range series[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	case "max":
+		m := series[0]
+		for _, v := range series[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}
+
+	sum := 0.0
+	for _, v := range series {
+		sum += v
+	}
+	if fn == "sum" {
+		return sum
+	}
+	return sum / float64(len(series))
+}
+
+// normalizeValue converte tipos numéricos para float64
+func normalizeValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if af, ok := a.(float64); ok {
+		if bf, ok := b.(float64); ok {
+			return af == bf
+		}
+		return false
+	}
+	return a == b
+}
+
+func compareOrdered(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
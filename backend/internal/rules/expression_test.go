@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// ========================================
+// TESTES - Expression Language
+// ========================================
+
+func TestExpressionEvaluation(t *testing.T) {
+	env := &ExprEnv{
+		Vars: map[string]interface{}{
+			"online":          3.0,
+			"online_now":      120.0,
+			"active_sessions": 10.0,
+			"bounce_rate":     45.5,
+			"plan":            "pro",
+			"maintenance":     false,
+		},
+		History: func(metric string, window time.Duration) ([]float64, error) {
+			return []float64{100, 110, 120}, nil
+		},
+		InSegment: func(segment string) (bool, error) {
+			return segment == "power_users", nil
+		},
+	}
+
+	cases := []struct {
+		condition string
+		expected  bool
+	}{
+		{"online_now > 100", true},
+		{"online < 5 AND online_now > 100", true}, // "online" não corrompe "online_now"
+		{"online_now > 100 AND bounce_rate > 50 OR plan == 'pro'", true},
+		{"online_now > 100 AND (bounce_rate > 50 OR plan == 'free')", false},
+		{"NOT maintenance", true},
+		{"!(online_now >= 120)", false},
+		{"online_now / active_sessions == 12", true},
+		{"online_now - 20 * 2 == 80", true},
+		{"-online + 3 == 0", true},
+		{"avg(online_now, \"1h\") == 110", true},
+		{"delta(online_now, '24h') > 15", true},
+		{"abs(delta(online_now, \"7d\")) == 20", true},
+		{"plan != \"free\" and not maintenance", true},
+		{"true || false && false", true},
+		{"in_segment(\"power_users\") AND online_now > 100", true},
+		{"in_segment('churn_risk')", false},
+	}
+
+	for _, tc := range cases {
+		expr, err := ParseExpression(tc.condition)
+		if err != nil {
+			t.Fatalf("%q: parse error: %v", tc.condition, err)
+		}
+		got, err := expr.EvalBool(env)
+		if err != nil {
+			t.Fatalf("%q: eval error: %v", tc.condition, err)
+		}
+		if got != tc.expected {
+			t.Errorf("%q: esperado %v, obtido %v", tc.condition, tc.expected, got)
+		}
+	}
+}
+
+func TestExpressionValidationErrors(t *testing.T) {
+	cases := []struct {
+		condition string
+		position  int
+	}{
+		{"online_now >", 13},
+		{"(online_now > 1", 16},
+		{"online_now > 1 AND", 19},
+		{"foo(online_now)", 1},
+		{"avg(online_now)", 1},
+		{"avg(online_now, \"1x\")", 17},
+		{"avg(10, \"1h\")", 5},
+		{"in_segment(power_users)", 12},
+		{"a < b < c", 7},
+		{"online_now # 2", 12},
+		{"'unterminated", 1},
+	}
+
+	for _, tc := range cases {
+		err := ValidateCondition(tc.condition)
+		var exprErr *ExpressionError
+		if !errors.As(err, &exprErr) {
+			t.Errorf("%q: esperado ExpressionError, obtido %v", tc.condition, err)
+			continue
+		}
+		if exprErr.Pos != tc.position {
+			t.Errorf("%q: posição esperada %d, obtida %d (%s)", tc.condition, tc.position, exprErr.Pos, exprErr.Message)
+		}
+	}
+
+	if err := ValidateCondition("  "); err != nil {
+		t.Errorf("condição vazia deveria ser válida: %v", err)
+	}
+}
+
+func TestExpressionRuntimeErrors(t *testing.T) {
+	env := &ExprEnv{Vars: map[string]interface{}{"online_now": 10.0, "plan": "pro"}}
+
+	for _, condition := range []string{
+		"missing_metric > 1",
+		"online_now + 1",
+		"plan > 1",
+		"online_now / 0 > 1",
+		"avg(online_now, \"1h\") > 1", // sem histórico disponível
+		"in_segment(\"power_users\")", // sem usuário gatilho
+	} {
+		expr, err := ParseExpression(condition)
+		if err != nil {
+			t.Fatalf("%q: parse error: %v", condition, err)
+		}
+		if _, err := expr.EvalBool(env); err == nil {
+			t.Errorf("%q: esperado erro de avaliação", condition)
+		}
+	}
+}
+
+func TestExpressionIdentifiers(t *testing.T) {
+	expr, err := ParseExpression("match_rate < 20 AND total_sessions > 10 AND avg(match_rate, \"1h\") < 30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := expr.Identifiers()
+	if len(ids) != 2 || ids[0] != "match_rate" || ids[1] != "total_sessions" {
+		t.Errorf("identificadores inesperados: %v", ids)
+	}
+}
+
+func TestInSegmentRequiresTriggeringUser(t *testing.T) {
+	condition := "in_segment(\"power_users\") AND online_now > 10"
+	for _, rule := range []Rule{
+		{TriggerType: TriggerEvent, TriggerConfig: `{"event_type":"session.start"}`},
+		{TriggerType: TriggerSequence, TriggerConfig: `{"steps":[{"event_type":"a"},{"event_type":"b"}],"within":"1h","group_by":"session_id"}`},
+		{TriggerType: TriggerSequence, TriggerConfig: `{"steps":[{"event_type":"a"},{"event_type":"b","absent":true}],"within":"1h"}`},
+	} {
+		rule.Condition = condition
+		if err := validateRule(&rule); err != nil {
+			t.Errorf("%s %s: regra com usuário gatilho deveria aceitar in_segment: %v", rule.TriggerType, rule.TriggerConfig, err)
+		}
+	}
+
+	for _, rule := range []Rule{
+		{TriggerType: TriggerThreshold},
+		{TriggerType: TriggerMetric},
+		{TriggerType: TriggerSchedule, TriggerConfig: `{"cron":"0 9 * * *"}`},
+		{TriggerType: TriggerSequence, TriggerConfig: `{"steps":[{"event_type":"a"},{"event_type":"b","absent":true}],"within":"1h","group_by":"app"}`},
+	} {
+		rule.Condition = condition
+		var exprErr *ExpressionError
+		if err := validateRule(&rule); !errors.As(err, &exprErr) || exprErr.Pos != 1 {
+			t.Errorf("%s %s: in_segment sem usuário gatilho deveria ser recusado: %v", rule.TriggerType, rule.TriggerConfig, err)
+		}
+	}
+}
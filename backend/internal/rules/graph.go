@@ -0,0 +1,502 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// GRAFO DE DEPENDÊNCIAS - Meta-regras sob controle
+// "Regra que mexe em regra precisa de limite"
+// ========================================
+
+var (
+	ErrRuleCycle           = errors.New("rule would form a dependency cycle")
+	ErrMetaDepthExceeded   = errors.New("meta-rule depth limit exceeded")
+	ErrMetaBudgetExhausted = errors.New("meta-action budget exhausted")
+)
+
+const (
+	// maxMetaRuleDepth meta-ações encadeadas numa mesma avaliação
+	// (a regra inicial está na profundidade 0; na profundidade 3 meta-ações são bloqueadas)
+	maxMetaRuleDepth = 3
+
+	// metaActionBudget meta-ações por app em cada janela de metaActionBudgetWindow
+	metaActionBudget       = 20
+	metaActionBudgetWindow = time.Hour
+
+	// configVarPrefix prefixo das configs do app nas condições (ex: config.ads_frequency)
+	configVarPrefix = "config."
+)
+
+// placeholderPattern variáveis {{metric}} substituídas por create_rule
+var placeholderPattern = regexp.MustCompile(`\{\{[^}]*\}\}`)
+
+// Tipos de aresta do grafo
+const (
+	EdgeCreates  = "creates"  // create_rule → regra que seria criada
+	EdgeDisables = "disables" // disable_rule → regra alvo
+	EdgeWrites   = "writes"   // adjust → config
+	EdgeReads    = "reads"    // config → regra que a lê na condição
+)
+
+// RuleGraphNode nó do grafo (regra, config ou regra-modelo de create_rule)
+type RuleGraphNode struct {
+	ID         string         `json:"id"`   // "rule:<id>", "config:<key>", "template:<id>"
+	Kind       string         `json:"kind"` // "rule", "config", "template"
+	Label      string         `json:"label"`
+	RuleID     *uuid.UUID     `json:"rule_id,omitempty"`
+	Status     RuleStatus     `json:"status,omitempty"`
+	ActionType RuleActionType `json:"action_type,omitempty"`
+	Depth      int            `json:"depth"`
+}
+
+// RuleGraphEdge aresta de influência (From afeta To)
+type RuleGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// RuleGraph grafo de dependências de um app
+type RuleGraph struct {
+	AppID  uuid.UUID       `json:"app_id"`
+	Nodes  []RuleGraphNode `json:"nodes"`
+	Edges  []RuleGraphEdge `json:"edges"`
+	Cycles [][]string      `json:"cycles"`
+
+	nodes map[string]bool
+	adj   map[string][]string
+	names map[string]string // nome da regra -> node ID
+}
+
+// RuleCycleError ciclo encontrado ao validar uma regra
+type RuleCycleError struct {
+	Path []string // node IDs, o primeiro se repete no fim
+}
+
+func (e *RuleCycleError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrRuleCycle, strings.Join(e.Path, " -> "))
+}
+
+func (e *RuleCycleError) Unwrap() error {
+	return ErrRuleCycle
+}
+
+func ruleNodeID(id uuid.UUID) string { return "rule:" + id.String() }
+func configNodeID(key string) string { return "config:" + key }
+
+func newRuleGraph(appID uuid.UUID) *RuleGraph {
+	return &RuleGraph{
+		AppID: appID,
+		nodes: make(map[string]bool),
+		adj:   make(map[string][]string),
+		names: make(map[string]string),
+	}
+}
+
+func (g *RuleGraph) addNode(node RuleGraphNode) {
+	if g.nodes[node.ID] {
+		return
+	}
+	g.Nodes = append(g.Nodes, node)
+	g.nodes[node.ID] = true
+}
+
+func (g *RuleGraph) addEdge(from, to, kind string) {
+	for _, existing := range g.adj[from] {
+		if existing == to {
+			return
+		}
+	}
+	g.Edges = append(g.Edges, RuleGraphEdge{From: from, To: to, Kind: kind})
+	g.adj[from] = append(g.adj[from], to)
+}
+
+// BuildRuleGraph monta o grafo das regras de um app
+func (s *RulesService) BuildRuleGraph(appID uuid.UUID) (*RuleGraph, error) {
+	var rules []Rule
+	if err := s.db.Where("app_id = ?", appID).Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	g := buildRuleGraph(appID, rules)
+	g.Cycles = g.findCycles()
+	return g, nil
+}
+
+// buildRuleGraph monta nós e arestas a partir das regras
+func buildRuleGraph(appID uuid.UUID, rules []Rule) *RuleGraph {
+	g := newRuleGraph(appID)
+
+	// Primeiro todos os nós de regra (disable_rule resolve alvo por nome)
+	for i := range rules {
+		r := &rules[i]
+		id := r.ID
+		g.addNode(RuleGraphNode{
+			ID:         ruleNodeID(r.ID),
+			Kind:       "rule",
+			Label:      r.Name,
+			RuleID:     &id,
+			Status:     r.Status,
+			ActionType: r.ActionType,
+			Depth:      r.Depth,
+		})
+		g.names[r.Name] = ruleNodeID(r.ID)
+	}
+
+	for i := range rules {
+		r := &rules[i]
+		g.addRuleEdges(ruleNodeID(r.ID), r.Condition, r.ActionType, r.ActionConfig, r.Depth)
+	}
+
+	return g
+}
+
+// addRuleEdges arestas de leitura (condição) e escrita (ação) de um nó
+func (g *RuleGraph) addRuleEdges(nodeID, condition string, actionType RuleActionType, actionConfig string, depth int) {
+	for _, key := range conditionConfigKeys(condition) {
+		g.addNode(RuleGraphNode{ID: configNodeID(key), Kind: "config", Label: key})
+		g.addEdge(configNodeID(key), nodeID, EdgeReads)
+	}
+
+	switch actionType {
+	case ActionAdjust:
+		var config AdjustActionConfig
+		if json.Unmarshal([]byte(actionConfig), &config) == nil && config.ConfigKey != "" {
+			g.addNode(RuleGraphNode{ID: configNodeID(config.ConfigKey), Kind: "config", Label: config.ConfigKey})
+			g.addEdge(nodeID, configNodeID(config.ConfigKey), EdgeWrites)
+		}
+
+	case ActionDisableRule:
+		var config DisableRuleActionConfig
+		if json.Unmarshal([]byte(actionConfig), &config) != nil {
+			return
+		}
+		target := ""
+		if id, err := uuid.Parse(config.TargetRuleID); err == nil {
+			target = ruleNodeID(id)
+		} else if config.TargetRuleName != "" {
+			target = g.names[config.TargetRuleName]
+		}
+		if g.nodes[target] {
+			g.addEdge(nodeID, target, EdgeDisables)
+		}
+
+	case ActionCreateRule:
+		var config CreateRuleActionConfig
+		if json.Unmarshal([]byte(actionConfig), &config) != nil {
+			return
+		}
+		// A regra criada ainda não existe: vira um nó-modelo com as mesmas arestas
+		templateID := "template:" + strings.TrimPrefix(nodeID, "rule:")
+		if strings.HasPrefix(nodeID, "template:") {
+			templateID = nodeID + "/" + strconv.Itoa(depth+1)
+		}
+		g.addNode(RuleGraphNode{
+			ID:         templateID,
+			Kind:       "template",
+			Label:      config.RuleName,
+			ActionType: RuleActionType(config.ActionType),
+			Depth:      depth + 1,
+		})
+		g.addEdge(nodeID, templateID, EdgeCreates)
+		if depth+1 <= maxMetaRuleDepth {
+			g.addRuleEdges(templateID, config.Condition, RuleActionType(config.ActionType), config.ActionConfig, depth+1)
+		}
+	}
+}
+
+// conditionConfigKeys configs referenciadas na condição (config.<key>)
+func conditionConfigKeys(condition string) []string {
+	if strings.TrimSpace(condition) == "" {
+		return nil
+	}
+	// Placeholders {{metric}} de create_rule não são expressões válidas
+	expr, err := ParseExpression(placeholderPattern.ReplaceAllString(condition, "0"))
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, id := range expr.Identifiers() {
+		if strings.HasPrefix(id, configVarPrefix) {
+			keys = append(keys, strings.TrimPrefix(id, configVarPrefix))
+		}
+	}
+	return keys
+}
+
+// findCycles ciclos elementares encontrados por DFS (um por aresta de retorno)
+func (g *RuleGraph) findCycles() [][]string {
+	const (
+		white = iota
+		gray
+		black
+	)
+	color := make(map[string]int, len(g.Nodes))
+	var stack []string
+	cycles := [][]string{}
+
+	var visit func(id string)
+	visit = func(id string) {
+		color[id] = gray
+		stack = append(stack, id)
+		for _, next := range g.adj[id] {
+			switch color[next] {
+			case white:
+				visit(next)
+			case gray:
+				// Aresta de retorno: o ciclo é o trecho da pilha a partir de next
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == next {
+						cycle := append(append([]string{}, stack[i:]...), next)
+						cycles = append(cycles, cycle)
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		color[id] = black
+	}
+
+	ids := make([]string, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if color[id] == white {
+			visit(id)
+		}
+	}
+	return cycles
+}
+
+// checkRuleDependencies rejeita a regra se ela fechar um ciclo no grafo do app.
+// Ciclos pré-existentes que não passam pela regra não bloqueiam a edição.
+func (s *RulesService) checkRuleDependencies(rule *Rule) error {
+	var rules []Rule
+	if err := s.db.Where("app_id = ? AND id <> ?", rule.AppID, rule.ID).Find(&rules).Error; err != nil {
+		return err
+	}
+	candidate := *rule
+	if candidate.ID == uuid.Nil {
+		candidate.ID = uuid.New()
+	}
+	rules = append(rules, candidate)
+
+	g := buildRuleGraph(rule.AppID, rules)
+	own := ruleNodeID(candidate.ID)
+	ownTemplates := "template:" + candidate.ID.String()
+
+	// Nós da regra: ela mesma e as regras-modelo que criaria (ordem estável)
+	starts := []string{own}
+	for _, n := range g.Nodes {
+		if strings.HasPrefix(n.ID, ownTemplates) {
+			starts = append(starts, n.ID)
+		}
+	}
+	for _, start := range starts {
+		if cycle := g.pathBack(start); cycle != nil {
+			return &RuleCycleError{Path: cycle}
+		}
+	}
+	return nil
+}
+
+// pathBack caminho mais curto que sai de start e volta a ele (nil se não houver).
+// Alcançabilidade a partir dos sucessores: encontra o ciclo mesmo quando o DFS
+// de findCycles o atribuiria a outra aresta de retorno.
+func (g *RuleGraph) pathBack(start string) []string {
+	parent := map[string]string{}
+	queue := []string{}
+	for _, next := range g.adj[start] {
+		if _, seen := parent[next]; !seen {
+			parent[next] = start
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == start {
+			path := []string{start}
+			for at := parent[start]; at != start; at = parent[at] {
+				path = append(path, at)
+			}
+			path = append(path, start)
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+		for _, next := range g.adj[id] {
+			if _, seen := parent[next]; !seen {
+				parent[next] = id
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// ========================================
+// LIMITES DE EXECUÇÃO
+// ========================================
+
+// ruleEvaluation contexto de uma avaliação. Depth conta as meta-ações encadeadas
+// desde a regra que iniciou a cadeia: uma config ajustada reavalia na hora as
+// regras que a leem, e uma regra criada é avaliada logo em seguida, um nível abaixo.
+type ruleEvaluation struct {
+	Events []SequenceMatchEvent
+	UserID uuid.UUID
+	Depth  int
+}
+
+// checkMetaDepth bloqueia meta-ações além do limite de encadeamento da avaliação
+func checkMetaDepth(rule *Rule, eval ruleEvaluation) error {
+	if eval.Depth >= maxMetaRuleDepth {
+		return fmt.Errorf("%w: rule %s reached chain depth %d (max %d)", ErrMetaDepthExceeded, rule.Name, eval.Depth, maxMetaRuleDepth)
+	}
+	return nil
+}
+
+// cascadeMetaAction reavalia, no mesmo contexto e um nível abaixo, as regras
+// periódicas afetadas por uma meta-ação executada
+func (s *RulesService) cascadeMetaAction(rule *Rule, result map[string]interface{}, eval ruleEvaluation) {
+	periodic := []RuleTriggerType{TriggerMetric, TriggerThreshold}
+	var affected []Rule
+
+	switch rule.ActionType {
+	case ActionAdjust:
+		key, _ := result["config_key"].(string)
+		if key == "" {
+			return
+		}
+		var candidates []Rule
+		s.db.Where("app_id = ? AND status = ? AND trigger_type IN ? AND id <> ?", rule.AppID, RuleStatusActive, periodic, rule.ID).
+			Find(&candidates)
+		for _, r := range candidates {
+			for _, read := range conditionConfigKeys(r.Condition) {
+				if read == key {
+					affected = append(affected, r)
+					break
+				}
+			}
+		}
+
+	case ActionCreateRule:
+		id, _ := result["new_rule_id"].(string)
+		if id == "" {
+			return
+		}
+		s.db.Where("id = ? AND status = ? AND trigger_type IN ?", id, RuleStatusActive, periodic).Find(&affected)
+
+	default:
+		return
+	}
+
+	next := ruleEvaluation{Depth: eval.Depth + 1}
+	for i := range affected {
+		s.evaluateRuleIn(&affected[i], next)
+	}
+}
+
+// isMetaAction ações que alteram regras ou configs lidas por regras
+func isMetaAction(actionType RuleActionType) bool {
+	return actionType == ActionCreateRule || actionType == ActionDisableRule || actionType == ActionAdjust
+}
+
+// RuleMetaBudget meta-ações consumidas por app numa janela fixa de metaActionBudgetWindow.
+// O incremento condicional (used < limite) é o claim: réplicas concorrentes
+// não conseguem passar do orçamento entre a checagem e a execução.
+type RuleMetaBudget struct {
+	AppID       uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	WindowStart time.Time `gorm:"primaryKey" json:"window_start"`
+	Used        int       `json:"used"`
+}
+
+func (RuleMetaBudget) TableName() string {
+	return "rule_meta_budgets"
+}
+
+// claimMetaBudget reserva uma meta-ação no orçamento do app e devolve a janela
+// da reserva (para liberar se a ação falhar)
+func (s *RulesService) claimMetaBudget(appID uuid.UUID) (time.Time, error) {
+	window := time.Now().UTC().Truncate(metaActionBudgetWindow)
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RuleMetaBudget{AppID: appID, WindowStart: window}).Error; err != nil {
+		return window, err
+	}
+	result := s.db.Model(&RuleMetaBudget{}).
+		Where("app_id = ? AND window_start = ? AND used < ?", appID, window, metaActionBudget).
+		Update("used", gorm.Expr("used + 1"))
+	if result.Error != nil {
+		return window, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return window, fmt.Errorf("%w: %d meta-actions in the current %v window (limit %d)", ErrMetaBudgetExhausted, metaActionBudget, metaActionBudgetWindow, metaActionBudget)
+	}
+	return window, nil
+}
+
+// releaseMetaBudget devolve a reserva de uma meta-ação que não executou
+func (s *RulesService) releaseMetaBudget(appID uuid.UUID, window time.Time) {
+	s.db.Model(&RuleMetaBudget{}).
+		Where("app_id = ? AND window_start = ? AND used > 0", appID, window).
+		Update("used", gorm.Expr("used - 1"))
+}
+
+// cleanupOldMetaBudgets remove janelas de orçamento encerradas
+func (s *RulesService) cleanupOldMetaBudgets() {
+	s.db.Where("window_start < ?", time.Now().UTC().Add(-2*metaActionBudgetWindow)).Delete(&RuleMetaBudget{})
+}
+
+// logMetaAction registra meta-ação executada (auditoria)
+func (s *RulesService) logMetaAction(rule *Rule, result map[string]interface{}, started time.Time) {
+	data, _ := json.Marshal(result)
+	s.db.Create(&ActionAuditLog{
+		ID:           uuid.New(),
+		AppID:        rule.AppID,
+		RuleID:       &rule.ID,
+		ActionType:   rule.ActionType,
+		ActionConfig: rule.ActionConfig,
+		WasAllowed:   true,
+		WasExecuted:  true,
+		Result:       string(data),
+		TriggeredBy:  "rule",
+		ExecutedAt:   time.Now(),
+		DurationMs:   time.Since(started).Milliseconds(),
+	})
+}
+
+// configVars configs do app expostas às condições como config.<key>
+func (s *RulesService) configVars(appID uuid.UUID) map[string]interface{} {
+	var configs []AppConfig
+	s.db.Where("app_id = ?", appID).Find(&configs)
+
+	vars := make(map[string]interface{}, len(configs))
+	for _, c := range configs {
+		switch c.ValueType {
+		case "boolean":
+			vars[configVarPrefix+c.Key] = c.Value == "true"
+		default:
+			if f, err := strconv.ParseFloat(c.Value, 64); err == nil {
+				vars[configVarPrefix+c.Key] = f
+			} else {
+				vars[configVarPrefix+c.Key] = c.Value
+			}
+		}
+	}
+	return vars
+}
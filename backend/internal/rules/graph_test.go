@@ -0,0 +1,203 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Grafo de dependências
+// ========================================
+
+func TestRuleCycleRejected(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	// A ajusta ads_frequency quando a retenção cai
+	adjuster := &Rule{
+		AppID:        appID,
+		Name:         "reduz-ads",
+		TriggerType:  TriggerMetric,
+		Condition:    "retention_d1 < 0.3",
+		ActionType:   ActionAdjust,
+		ActionConfig: `{"config_key":"ads_frequency","config_value":"2"}`,
+	}
+	if err := s.CreateRule(adjuster); err != nil {
+		t.Fatal(err)
+	}
+
+	// B lê ads_frequency e desativa A: A → config → B → A
+	disabler := &Rule{
+		AppID:        appID,
+		Name:         "para-ajuste",
+		TriggerType:  TriggerMetric,
+		Condition:    "config.ads_frequency < 3",
+		ActionType:   ActionDisableRule,
+		ActionConfig: `{"target_rule_name":"reduz-ads"}`,
+	}
+	err := s.CreateRule(disabler)
+	var cycleErr *RuleCycleError
+	if !errors.As(err, &cycleErr) || !errors.Is(err, ErrRuleCycle) {
+		t.Fatalf("esperado erro de ciclo, obtido %v", err)
+	}
+	if len(cycleErr.Path) != 4 {
+		t.Errorf("caminho inesperado: %v", cycleErr.Path)
+	}
+
+	// Sem ler a config não há ciclo
+	disabler.Condition = "online_now > 100"
+	if err := s.CreateRule(disabler); err != nil {
+		t.Fatalf("regra sem ciclo deveria ser aceita: %v", err)
+	}
+
+	graph, err := s.BuildRuleGraph(appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Nodes) != 3 || len(graph.Edges) != 2 || len(graph.Cycles) != 0 {
+		t.Errorf("grafo inesperado: %+v", graph)
+	}
+}
+
+func TestRuleCycleFoundBehindExistingCycle(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	// Ciclo legado k → Y → k (gravado direto): o DFS registra só esse ciclo
+	legacy := &Rule{
+		ID:           uuid.New(),
+		AppID:        appID,
+		Name:         "ajusta-k",
+		TriggerType:  TriggerMetric,
+		Condition:    "config.k > 0",
+		ActionType:   ActionAdjust,
+		ActionConfig: `{"config_key":"k","config_value":"2"}`,
+		Status:       RuleStatusActive,
+	}
+	if err := s.db.Create(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// C lê k e desativa Y: k → C → Y → k passa pela regra nova
+	disabler := &Rule{
+		AppID:        appID,
+		Name:         "para-k",
+		TriggerType:  TriggerMetric,
+		Condition:    "config.k > 1",
+		ActionType:   ActionDisableRule,
+		ActionConfig: `{"target_rule_name":"ajusta-k"}`,
+	}
+	err := s.CreateRule(disabler)
+	var cycleErr *RuleCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("esperado erro de ciclo, obtido %v", err)
+	}
+	if len(cycleErr.Path) != 4 || cycleErr.Path[1] != ruleNodeID(legacy.ID) || cycleErr.Path[2] != configNodeID("k") {
+		t.Errorf("caminho inesperado: %v", cycleErr.Path)
+	}
+}
+
+func TestMetaBudgetClaimIsAtomic(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	// Mais réplicas/avaliações concorrentes do que o orçamento
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var window time.Time
+	claimed, exhausted := 0, 0
+	for i := 0; i < metaActionBudget+10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimWindow, err := s.claimMetaBudget(appID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				claimed++
+				window = claimWindow
+			case errors.Is(err, ErrMetaBudgetExhausted):
+				exhausted++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if claimed != metaActionBudget || exhausted != 10 {
+		t.Fatalf("esperadas %d reservas e 10 recusas, obtidas %d e %d", metaActionBudget, claimed, exhausted)
+	}
+
+	// Ação que falhou devolve a reserva
+	s.releaseMetaBudget(appID, window)
+	if _, err := s.claimMetaBudget(appID); err != nil {
+		t.Errorf("reserva devolvida deveria ficar disponível: %v", err)
+	}
+}
+
+func TestMetaRuleDepthLimit(t *testing.T) {
+	s := newTestRulesService(t)
+
+	// A geração da regra não limita: uma regra gerada pode gerar outras em nova avaliação
+	parent := &Rule{
+		ID:           uuid.New(),
+		AppID:        uuid.New(),
+		Name:         "gera",
+		ActionType:   ActionCreateRule,
+		ActionConfig: `{"rule_name":"filha","trigger_type":"metric","condition":"online_now > 1","action_type":"alert"}`,
+		Depth:        maxMetaRuleDepth,
+	}
+	if _, err := s.executeAction(parent, nil, ruleEvaluation{}); err != nil {
+		t.Fatalf("regra gerada deveria poder criar em nova avaliação: %v", err)
+	}
+	if _, err := s.executeAction(parent, nil, ruleEvaluation{Depth: maxMetaRuleDepth}); !errors.Is(err, ErrMetaDepthExceeded) {
+		t.Fatalf("esperado limite de profundidade, obtido %v", err)
+	}
+}
+
+func TestMetaRuleCascadeIsBounded(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&RuleExecution{}, &testMetricsSnapshot{}, &testTelemetrySession{})
+	appID := uuid.New()
+
+	// Cadeia step0 → config.k1 → step1 → config.k2 → ... → step4
+	for i := 0; i < 5; i++ {
+		condition := "online_now >= 0"
+		if i > 0 {
+			condition = fmt.Sprintf("config.k%d > 0", i)
+		}
+		rule := &Rule{
+			AppID:        appID,
+			Name:         fmt.Sprintf("step%d", i),
+			TriggerType:  TriggerMetric,
+			Condition:    condition,
+			ActionType:   ActionAdjust,
+			ActionConfig: fmt.Sprintf(`{"config_key":"k%d","config_value":"1"}`, i+1),
+		}
+		if err := s.CreateRule(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first Rule
+	s.db.Where("app_id = ? AND name = ?", appID, "step0").First(&first)
+	s.evaluateRule(&first)
+
+	// step0..step2 executam; step3 (profundidade 3) é bloqueada e step4 nunca é avaliada
+	var configs []AppConfig
+	s.db.Where("app_id = ?", appID).Find(&configs)
+	if len(configs) != maxMetaRuleDepth {
+		t.Fatalf("esperadas %d configs ajustadas na cadeia, obtidas %d", maxMetaRuleDepth, len(configs))
+	}
+	var blocked int64
+	s.db.Model(&RuleExecution{}).Where("app_id = ? AND error LIKE ?", appID, "%depth%").Count(&blocked)
+	if blocked != 1 {
+		t.Errorf("esperada 1 execução bloqueada por profundidade, obtidas %d", blocked)
+	}
+}
@@ -1,6 +1,11 @@
 package rules
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
@@ -48,7 +53,7 @@ func (h *RulesHandler) CreateRule(c *gin.Context) {
 	}
 	
 	if err := h.service.CreateRule(&rule); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondRuleError(c, err)
 		return
 	}
 	
@@ -106,21 +111,204 @@ func (h *RulesHandler) UpdateRule(c *gin.Context) {
 		return
 	}
 	
-	var rule Rule
-	if err := c.ShouldBindJSON(&rule); err != nil {
+	var req struct {
+		Rule
+		ChangeReason string `json:"change_reason"` // Motivo registrado na versão
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
+	rule := req.Rule
 	rule.ID = id
-	if err := h.service.UpdateRule(&rule); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.service.UpdateRule(&rule, contextUserID(c), req.ChangeReason); err != nil {
+		respondRuleError(c, err)
 		return
 	}
 	
 	c.JSON(http.StatusOK, rule)
 }
 
+// contextUserID user_id do contexto (uuid.Nil se ausente)
+func contextUserID(c *gin.Context) uuid.UUID {
+	if userID, exists := c.Get("user_id"); exists {
+		if id, ok := userID.(uuid.UUID); ok {
+			return id
+		}
+	}
+	return uuid.Nil
+}
+
+// ValidateCondition valida uma condição sem salvar
+// POST /api/v1/admin/rules/validate-condition
+func (h *RulesHandler) ValidateCondition(c *gin.Context) {
+	var req struct {
+		Condition string `json:"condition"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	expr, err := ParseExpression(req.Condition)
+	if err != nil {
+		var exprErr *ExpressionError
+		if errors.As(err, &exprErr) {
+			c.JSON(http.StatusOK, gin.H{
+				"valid":    false,
+				"error":    exprErr.Message,
+				"position": exprErr.Pos,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"valid": false, "error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       true,
+		"identifiers": expr.Identifiers(),
+		"functions":   ExpressionFunctions,
+	})
+}
+
+// GetRuleGraph retorna o grafo de dependências das regras de um app
+// GET /api/v1/admin/rules/app/:appId/graph
+func (h *RulesHandler) GetRuleGraph(c *gin.Context) {
+	appIDStr := c.Param("appId")
+	appID, err := uuid.Parse(appIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+	
+	graph, err := h.service.BuildRuleGraph(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"graph": graph,
+		"limits": gin.H{
+			"max_depth":          maxMetaRuleDepth,
+			"meta_action_budget": metaActionBudget,
+			"meta_action_window": metaActionBudgetWindow.String(),
+		},
+	})
+}
+
+// GetMetricBaselines retorna os baselines das métricas usadas por regras de anomalia
+// GET /api/v1/admin/rules/app/:appId/baselines
+func (h *RulesHandler) GetMetricBaselines(c *gin.Context) {
+	appIDStr := c.Param("appId")
+	appID, err := uuid.Parse(appIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+	
+	baselines, err := h.service.GetMetricBaselines(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"baselines": baselines,
+		"total":     len(baselines),
+	})
+}
+
+// respondRuleError responde 400 para condição inválida, 500 para o resto
+func respondRuleError(c *gin.Context, err error) {
+	var exprErr *ExpressionError
+	if errors.As(err, &exprErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Condição inválida: " + exprErr.Message,
+			"position": exprErr.Pos,
+		})
+		return
+	}
+	var cycleErr *RuleCycleError
+	if errors.As(err, &cycleErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Regra criaria um ciclo de dependências",
+			"cycle": cycleErr.Path,
+		})
+		return
+	}
+	if errors.Is(err, ErrRuleNotFound) || errors.Is(err, ErrRuleVersionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrInvalidTriggerConfig) || errors.Is(err, ErrInvalidBacktest) || errors.Is(err, ErrInvalidRuleBundle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// BacktestRule simula uma regra (ainda não salva) contra a telemetria histórica
+// POST /api/v1/admin/rules/backtest
+func (h *RulesHandler) BacktestRule(c *gin.Context) {
+	var req BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	ctx, cancel := context.WithTimeout(c.Request.Context(), BacktestTimeout)
+	defer cancel()
+
+	result, err := h.service.Backtest(ctx, req)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, result)
+}
+
+// BacktestExistingRule simula uma regra existente contra a telemetria histórica
+// POST /api/v1/admin/rules/:id/backtest
+func (h *RulesHandler) BacktestExistingRule(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	
+	var req struct {
+		From time.Time `json:"from" binding:"required"`
+		To   time.Time `json:"to" binding:"required"`
+		Step string    `json:"step"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	rule, err := h.service.GetRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra não encontrada"})
+		return
+	}
+	
+	ctx, cancel := context.WithTimeout(c.Request.Context(), BacktestTimeout)
+	defer cancel()
+
+	result, err := h.service.Backtest(ctx, BacktestRequest{Rule: *rule, From: req.From, To: req.To, Step: req.Step})
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+	
+	c.JSON(http.StatusOK, result)
+}
+
 // DeleteRule deleta uma regra
 // DELETE /api/v1/admin/rules/:id
 func (h *RulesHandler) DeleteRule(c *gin.Context) {
@@ -170,6 +358,101 @@ func (h *RulesHandler) ToggleRule(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Regra " + status})
 }
 
+// ========================================
+// AGENDAMENTO - Regras com cron
+// ========================================
+
+// PreviewSchedule mostra os próximos disparos de um cron
+// POST /api/v1/admin/rules/schedule/preview
+func (h *RulesHandler) PreviewSchedule(c *gin.Context) {
+	var req struct {
+		Cron     string `json:"cron" binding:"required"`
+		Timezone string `json:"timezone"`
+		Count    int    `json:"count"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	config, _ := json.Marshal(ScheduleTriggerConfig{Cron: req.Cron, Timezone: req.Timezone})
+	h.respondSchedulePreview(c, string(config), req.Count)
+}
+
+// GetRuleSchedule mostra os próximos disparos de uma regra agendada
+// GET /api/v1/admin/rules/:id/schedule
+func (h *RulesHandler) GetRuleSchedule(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	
+	rule, err := h.service.GetRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra não encontrada"})
+		return
+	}
+	if rule.TriggerType != TriggerSchedule {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Regra não é agendada"})
+		return
+	}
+	
+	count, _ := strconv.Atoi(c.Query("count"))
+	h.respondSchedulePreview(c, rule.TriggerConfig, count)
+}
+
+func (h *RulesHandler) respondSchedulePreview(c *gin.Context, triggerConfig string, count int) {
+	if count <= 0 || count > 50 {
+		count = 5
+	}
+	
+	next, err := h.service.PreviewSchedule(triggerConfig, count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var config ScheduleTriggerConfig
+	json.Unmarshal([]byte(triggerConfig), &config)
+	
+	c.JSON(http.StatusOK, gin.H{
+		"cron":       config.Cron,
+		"timezone":   config.Timezone,
+		"next_fires": next,
+	})
+}
+
+// GetRuleScheduleFires lista disparos recentes de uma regra agendada
+// GET /api/v1/admin/rules/:id/schedule/fires
+func (h *RulesHandler) GetRuleScheduleFires(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 500 {
+			limit = parsed
+		}
+	}
+	
+	fires, err := h.service.GetScheduleFires(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{
+		"fires": fires,
+		"total": len(fires),
+	})
+}
+
 // ========================================
 // TEMPLATES DE REGRAS
 // ========================================
@@ -223,7 +506,7 @@ func (h *RulesHandler) CreateFromTemplate(c *gin.Context) {
 	}
 	
 	if err := h.service.CreateRule(&rule); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondRuleError(c, err)
 		return
 	}
 	
@@ -314,6 +597,28 @@ func RegisterRulesRoutes(router *gin.RouterGroup, service *RulesService, authMid
 		// Por app
 		rules.GET("/app/:appId", handler.GetRulesByApp)
 		rules.GET("/app/:appId/executions", handler.GetAppRuleExecutions)
+		rules.GET("/app/:appId/graph", handler.GetRuleGraph)
+		rules.GET("/app/:appId/baselines", handler.GetMetricBaselines)
+		rules.GET("/app/:appId/export", handler.ExportRules)
+		rules.POST("/app/:appId/import", handler.ImportRules)
+		
+		// Versionamento
+		rules.GET("/:id/versions", handler.GetRuleVersions)
+		rules.GET("/:id/versions/:version", handler.GetRuleVersion)
+		rules.GET("/:id/diff", handler.DiffRuleVersions)
+		rules.POST("/:id/rollback", handler.RollbackRule)
+		
+		// Condições
+		rules.POST("/validate-condition", handler.ValidateCondition)
+		
+		// Backtest (dry-run contra histórico)
+		rules.POST("/backtest", handler.BacktestRule)
+		rules.POST("/:id/backtest", handler.BacktestExistingRule)
+		
+		// Agendamento (cron)
+		rules.POST("/schedule/preview", handler.PreviewSchedule)
+		rules.GET("/:id/schedule", handler.GetRuleSchedule)
+		rules.GET("/:id/schedule/fires", handler.GetRuleScheduleFires)
 		
 		// Templates
 		rules.GET("/templates", handler.GetPredefinedRules)
@@ -322,6 +627,15 @@ func RegisterRulesRoutes(router *gin.RouterGroup, service *RulesService, authMid
 		// Execuções
 		rules.GET("/:id/executions", handler.GetRuleExecutions)
 		
+		// Experimentos (A/B)
+		rules.POST("/experiments", handler.CreateExperiment)
+		rules.GET("/experiments/app/:appId", handler.GetExperimentsByApp)
+		rules.GET("/experiments/:expId", handler.GetExperiment)
+		rules.GET("/experiments/:expId/results", handler.GetExperimentResults)
+		rules.POST("/experiments/:expId/start", handler.StartExperiment)
+		rules.POST("/experiments/:expId/stop", handler.StopExperiment)
+		rules.POST("/experiments/:expId/promote", handler.PromoteExperiment)
+		
 		// App Configs (configurações dinâmicas)
 		rules.GET("/app/:appId/configs", handler.GetAppConfigs)
 		rules.POST("/app/:appId/configs", handler.SetAppConfig)
@@ -331,6 +645,7 @@ func RegisterRulesRoutes(router *gin.RouterGroup, service *RulesService, authMid
 		rules.GET("/killswitch", handler.GetKillSwitchStatus)
 		rules.POST("/killswitch/activate", handler.ActivateKillSwitchHandler)
 		rules.POST("/killswitch/deactivate", handler.DeactivateKillSwitchHandler)
+		rules.GET("/controls", handler.GetControlStatus)
 		
 		// Políticas de Ações
 		rules.GET("/policies", handler.GetActionPolicies)
@@ -452,6 +767,7 @@ func (h *RulesHandler) ActivateKillSwitchHandler(c *gin.Context) {
 	var req struct {
 		Reason          string `json:"reason" binding:"required"`
 		AutoResumeAfter string `json:"auto_resume_after"` // Ex: "1h", "30m"
+		Scope           string `json:"scope"`             // "global" (padrão) ou app_id
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -463,28 +779,41 @@ func (h *RulesHandler) ActivateKillSwitchHandler(c *gin.Context) {
 		activatedBy = user.(string)
 	}
 	
-	var autoResume *time.Duration
-	if req.AutoResumeAfter != "" {
-		if d, err := time.ParseDuration(req.AutoResumeAfter); err == nil {
-			autoResume = &d
-		}
+	autoResume, err := parseControlDuration(req.AutoResumeAfter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	
-	ActivateKillSwitch(activatedBy, req.Reason, autoResume)
+	if err := h.service.ActivateKillSwitch(req.Scope, activatedBy, req.Reason, autoResume); err != nil {
+		respondControlError(c, err)
+		return
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Kill switch ativado - todas as ações automáticas pausadas",
 		"activated_by": activatedBy,
 		"reason":       req.Reason,
+		"scope":        scopeOrGlobal(req.Scope),
 	})
 }
 
 // DeactivateKillSwitchHandler desativa o kill switch
 // POST /api/v1/admin/rules/killswitch/deactivate
 func (h *RulesHandler) DeactivateKillSwitchHandler(c *gin.Context) {
-	DeactivateKillSwitch()
+	var req struct {
+		Scope string `json:"scope"` // "global" (padrão) ou app_id
+	}
+	c.ShouldBindJSON(&req)
+	
+	if err := h.service.DeactivateKillSwitch(req.Scope); err != nil {
+		respondControlError(c, err)
+		return
+	}
+	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Kill switch desativado - ações automáticas retomadas",
+		"scope":   scopeOrGlobal(req.Scope),
 	})
 }
 
@@ -492,10 +821,39 @@ func (h *RulesHandler) DeactivateKillSwitchHandler(c *gin.Context) {
 // POST /api/v1/admin/rules/actions/:type/pause
 func (h *RulesHandler) PauseActionTypeHandler(c *gin.Context) {
 	actionType := RuleActionType(c.Param("type"))
-	PauseActionType(actionType)
+	
+	var req struct {
+		Scope    string `json:"scope"`    // "global" (padrão) ou app_id
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"` // Ex: "1h" (vazio = até retomar)
+	}
+	// Corpo é opcional (pausa global até retomar), mas JSON inválido não vira pausa
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	activatedBy := "admin"
+	if user, exists := c.Get("user_email"); exists {
+		activatedBy = user.(string)
+	}
+	
+	// Duração inválida não pode virar pausa indefinida
+	duration, err := parseControlDuration(req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if err := h.service.PauseActionType(req.Scope, actionType, activatedBy, req.Reason, duration); err != nil {
+		respondControlError(c, err)
+		return
+	}
+	
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "Tipo de ação pausado",
 		"action_type": actionType,
+		"scope":       scopeOrGlobal(req.Scope),
 	})
 }
 
@@ -503,13 +861,64 @@ func (h *RulesHandler) PauseActionTypeHandler(c *gin.Context) {
 // POST /api/v1/admin/rules/actions/:type/resume
 func (h *RulesHandler) ResumeActionTypeHandler(c *gin.Context) {
 	actionType := RuleActionType(c.Param("type"))
-	ResumeActionType(actionType)
+	
+	var req struct {
+		Scope string `json:"scope"` // "global" (padrão) ou app_id
+	}
+	c.ShouldBindJSON(&req)
+	
+	if err := h.service.ResumeActionType(req.Scope, actionType); err != nil {
+		respondControlError(c, err)
+		return
+	}
+	
 	c.JSON(http.StatusOK, gin.H{
 		"message":     "Tipo de ação retomado",
 		"action_type": actionType,
+		"scope":       scopeOrGlobal(req.Scope),
 	})
 }
 
+// GetControlStatus retorna kill switch, pausas e shadow mode do rules engine
+// junto com o kill switch da plataforma
+// GET /api/v1/admin/rules/controls
+func (h *RulesHandler) GetControlStatus(c *gin.Context) {
+	status, err := h.service.GetControlStatus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// respondControlError 400 para escopo inválido, 500 para o resto
+func respondControlError(c *gin.Context, err error) {
+	if errors.Is(err, ErrInvalidControlScope) || errors.Is(err, ErrUnknownActionType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// parseControlDuration duração opcional de um controle (vazio = até desativar)
+func parseControlDuration(value string) (*time.Duration, error) {
+	if value == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("duração inválida: %q (use, por exemplo, \"30m\" ou \"1h\")", value)
+	}
+	return &d, nil
+}
+
+func scopeOrGlobal(scope string) string {
+	if scope == "" {
+		return ControlScopeGlobal
+	}
+	return scope
+}
+
 // GetActionPolicies retorna políticas de ações
 // GET /api/v1/admin/rules/policies
 func (h *RulesHandler) GetActionPolicies(c *gin.Context) {
@@ -550,11 +959,10 @@ func (h *RulesHandler) ActivateShadowModeHandler(c *gin.Context) {
 		activatedBy = user.(string)
 	}
 	
-	var duration *time.Duration
-	if req.Duration != "" {
-		if d, err := time.ParseDuration(req.Duration); err == nil {
-			duration = &d
-		}
+	duration, err := parseControlDuration(req.Duration)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 	
 	// Converter app IDs
@@ -565,7 +973,11 @@ func (h *RulesHandler) ActivateShadowModeHandler(c *gin.Context) {
 		}
 	}
 	
-	ActivateShadowMode(activatedBy, req.Reason, duration, appIDs, req.ActionTypes, req.Domains)
+	filters := ShadowModeFilters{AppIDs: appIDs, ActionTypes: req.ActionTypes, Domains: req.Domains}
+	if err := h.service.ActivateShadowMode(activatedBy, req.Reason, duration, filters); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Shadow mode ativado - ações serão simuladas sem execução real",
@@ -583,7 +995,10 @@ func (h *RulesHandler) ActivateShadowModeHandler(c *gin.Context) {
 // DeactivateShadowModeHandler desativa o shadow mode
 // POST /api/v1/admin/rules/shadow/deactivate
 func (h *RulesHandler) DeactivateShadowModeHandler(c *gin.Context) {
-	DeactivateShadowMode()
+	if err := h.service.DeactivateShadowMode(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Shadow mode desativado - ações serão executadas normalmente",
 	})
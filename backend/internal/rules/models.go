@@ -28,6 +28,8 @@ const (
 	TriggerEvent     RuleTriggerType = "event"      // Baseado em evento (ex: session.end)
 	TriggerSchedule  RuleTriggerType = "schedule"   // Baseado em horário (ex: todo dia 9h)
 	TriggerThreshold RuleTriggerType = "threshold"  // Baseado em threshold (ex: online_now > 100)
+	TriggerAnomaly   RuleTriggerType = "anomaly"    // Desvio estatístico do baseline (ex: z-score > 3)
+	TriggerSequence  RuleTriggerType = "sequence"   // Sequência de eventos (ex: 3x payment.failed em 10min)
 )
 
 // RuleActionType tipo de ação
@@ -70,6 +72,13 @@ type Rule struct {
 	LastTriggeredAt *time.Time `json:"last_triggered_at"`
 	TriggerCount    int       `gorm:"default:0" json:"trigger_count"`
 	
+	// Geração da regra: 0 = criada por humano, N = criada por meta-regra de geração N-1.
+	// Só informativo; o limite de encadeamento vale por avaliação (ruleEvaluation.Depth).
+	Depth int `gorm:"default:0" json:"depth"`
+	
+	// Versão atual da definição (histórico em RuleVersion)
+	Version int `gorm:"default:1" json:"version"`
+	
 	// Metadata
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -80,6 +89,7 @@ type Rule struct {
 type RuleExecution struct {
 	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	RuleID      uuid.UUID `gorm:"type:uuid;index" json:"rule_id"`
+	RuleVersion int       `gorm:"default:0" json:"rule_version"` // Versão da regra que rodou
 	AppID       uuid.UUID `gorm:"type:uuid;index" json:"app_id"`
 	
 	// Contexto da execução
@@ -91,11 +101,44 @@ type RuleExecution struct {
 	ActionResult string `gorm:"type:text" json:"action_result"`  // JSON com resultado
 	Error        string `gorm:"size:500" json:"error"`           // Erro se houver
 	
+	// Eventos que completaram o padrão (trigger sequence) - JSON []SequenceMatchEvent
+	MatchedEvents string `gorm:"type:text" json:"matched_events,omitempty"`
+	
 	// Timing
 	ExecutedAt   time.Time `json:"executed_at"`
 	DurationMs   int64     `json:"duration_ms"`
 }
 
+// MetricWindow janela usada no cálculo das métricas de uma avaliação
+type MetricWindow struct {
+	Period           string     `json:"period"`          // "1h", "24h", "7d" ou "lifetime"
+	Start            *time.Time `json:"start,omitempty"` // nil = desde sempre
+	End              time.Time  `json:"end"`
+	RetentionCohorts int        `json:"retention_cohorts"` // Coortes diários usados em retention_d1/d7
+}
+
+// ExecutionTriggerData conteúdo de RuleExecution.TriggerData
+type ExecutionTriggerData struct {
+	Metrics map[string]float64 `json:"metrics"`
+	Window  MetricWindow       `json:"window"`
+}
+
+// RuleMetricSample amostra das métricas de um app (1 por app por tick do avaliador)
+// Base do histórico usado por avg()/delta() nas condições.
+// O índice único (app_id, tick) é o claim entre réplicas: só quem inserir a
+// amostra do tick atualiza os baselines de anomalia.
+type RuleMetricSample struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID     uuid.UUID  `gorm:"type:uuid;index:idx_metric_sample_app_time;uniqueIndex:idx_metric_sample_app_tick" json:"app_id"`
+	Metrics   string     `gorm:"type:text" json:"metrics"` // JSON map[string]float64
+	SampledAt time.Time  `gorm:"index:idx_metric_sample_app_time" json:"sampled_at"`
+	Tick      *time.Time `gorm:"uniqueIndex:idx_metric_sample_app_tick" json:"tick,omitempty"` // Nulo em amostras anteriores ao claim
+}
+
+func (RuleMetricSample) TableName() string {
+	return "rule_metric_samples"
+}
+
 // ========================================
 // TRIGGER CONFIGS
 // ========================================
@@ -96,6 +96,14 @@ var DefaultActionPolicies = map[RuleActionType]ActionPolicy{
 		RequiresApproval: false,
 		Description:      "Escalação é segura, só muda severidade",
 	},
+	ActionExperiment: {
+		ActionType:       ActionExperiment,
+		Permission:       PermissionAutomatic,
+		MaxBlastRadius:   BlastRadius{Scope: "config", MaxAffected: 1},
+		MaxDuration:      "",
+		RequiresApproval: false,
+		Description:      "Experimentos só promovem variantes já testadas",
+	},
 	ActionNotify: {
 		ActionType:       ActionNotify,
 		Permission:       PermissionAutomatic,
@@ -139,67 +147,59 @@ func IsProhibitedAction(action string) bool {
 // KILL SWITCH GLOBAL - Pausa Humana
 // ========================================
 
-// GlobalKillSwitch controle global de ações automáticas
+// GlobalKillSwitch cache em memória dos controles persistidos (ver control.go)
+// Escopo "global" vale para todos os apps; demais escopos são app IDs
 type GlobalKillSwitch struct {
-	mu              sync.RWMutex
-	active          bool
-	activatedAt     *time.Time
-	activatedBy     string
-	reason          string
-	autoResumeAt    *time.Time
-	pausedActions   map[RuleActionType]bool // Ações específicas pausadas
+	mu            sync.RWMutex
+	switches      map[string]RulesControl                    // scope -> kill switch ativo
+	pausedActions map[string]map[RuleActionType]RulesControl // scope -> tipo -> pausa ativa
 }
 
 var globalKillSwitch = &GlobalKillSwitch{
-	pausedActions: make(map[RuleActionType]bool),
+	switches:      make(map[string]RulesControl),
+	pausedActions: make(map[string]map[RuleActionType]RulesControl),
 }
 
-// ActivateKillSwitch ativa o kill switch global
-func ActivateKillSwitch(activatedBy, reason string, autoResumeAfter *time.Duration) {
-	globalKillSwitch.mu.Lock()
-	defer globalKillSwitch.mu.Unlock()
-	
-	now := time.Now()
-	globalKillSwitch.active = true
-	globalKillSwitch.activatedAt = &now
-	globalKillSwitch.activatedBy = activatedBy
-	globalKillSwitch.reason = reason
-	
-	if autoResumeAfter != nil {
-		resumeAt := now.Add(*autoResumeAfter)
-		globalKillSwitch.autoResumeAt = &resumeAt
+// setKillSwitchCache substitui o cache pelos controles ativos lidos do banco
+func setKillSwitchCache(switches []RulesControl, pauses []RulesControl) {
+	byScope := make(map[string]RulesControl, len(switches))
+	for _, c := range switches {
+		byScope[c.Scope] = c
 	}
-}
-
-// DeactivateKillSwitch desativa o kill switch
-func DeactivateKillSwitch() {
+	paused := make(map[string]map[RuleActionType]RulesControl)
+	for _, c := range pauses {
+		if paused[c.Scope] == nil {
+			paused[c.Scope] = make(map[RuleActionType]RulesControl)
+		}
+		paused[c.Scope][c.ActionType] = c
+	}
+	
 	globalKillSwitch.mu.Lock()
 	defer globalKillSwitch.mu.Unlock()
-	
-	globalKillSwitch.active = false
-	globalKillSwitch.activatedAt = nil
-	globalKillSwitch.activatedBy = ""
-	globalKillSwitch.reason = ""
-	globalKillSwitch.autoResumeAt = nil
+	globalKillSwitch.switches = byScope
+	globalKillSwitch.pausedActions = paused
 }
 
-// IsKillSwitchActive verifica se o kill switch está ativo
+// IsKillSwitchActive verifica se o kill switch global está ativo
 func IsKillSwitchActive() bool {
+	return IsKillSwitchActiveForApp(uuid.Nil)
+}
+
+// IsKillSwitchActiveForApp verifica kill switch global ou do app
+func IsKillSwitchActiveForApp(appID uuid.UUID) bool {
 	globalKillSwitch.mu.RLock()
 	defer globalKillSwitch.mu.RUnlock()
 	
-	if !globalKillSwitch.active {
-		return false
+	now := time.Now()
+	if c, ok := globalKillSwitch.switches[ControlScopeGlobal]; ok && c.isEffective(now) {
+		return true
 	}
-	
-	// Verificar auto-resume
-	if globalKillSwitch.autoResumeAt != nil && time.Now().After(*globalKillSwitch.autoResumeAt) {
-		// Auto-resume expirou, desativar
-		globalKillSwitch.active = false
-		return false
+	if appID != uuid.Nil {
+		if c, ok := globalKillSwitch.switches[appID.String()]; ok && c.isEffective(now) {
+			return true
+		}
 	}
-	
-	return true
+	return false
 }
 
 // GetKillSwitchStatus retorna status do kill switch
@@ -207,35 +207,70 @@ func GetKillSwitchStatus() map[string]interface{} {
 	globalKillSwitch.mu.RLock()
 	defer globalKillSwitch.mu.RUnlock()
 	
-	return map[string]interface{}{
-		"active":          globalKillSwitch.active,
-		"activated_at":    globalKillSwitch.activatedAt,
-		"activated_by":    globalKillSwitch.activatedBy,
-		"reason":          globalKillSwitch.reason,
-		"auto_resume_at":  globalKillSwitch.autoResumeAt,
-		"paused_actions":  globalKillSwitch.pausedActions,
+	now := time.Now()
+	status := map[string]interface{}{
+		"active":         false,
+		"activated_at":   nil,
+		"activated_by":   "",
+		"reason":         "",
+		"auto_resume_at": nil,
 	}
+	if c, ok := globalKillSwitch.switches[ControlScopeGlobal]; ok && c.isEffective(now) {
+		status["active"] = true
+		status["activated_at"] = c.ActivatedAt
+		status["activated_by"] = c.ActivatedBy
+		status["reason"] = c.Reason
+		status["auto_resume_at"] = c.ExpiresAt
+	}
+	
+	appSwitches := []RulesControl{}
+	for scope, c := range globalKillSwitch.switches {
+		if scope != ControlScopeGlobal && c.isEffective(now) {
+			appSwitches = append(appSwitches, c)
+		}
+	}
+	
+	pausedActions := make(map[RuleActionType]bool)
+	appPausedActions := []RulesControl{}
+	for scope, byType := range globalKillSwitch.pausedActions {
+		for actionType, c := range byType {
+			if !c.isEffective(now) {
+				continue
+			}
+			if scope == ControlScopeGlobal {
+				pausedActions[actionType] = true
+			} else {
+				appPausedActions = append(appPausedActions, c)
+			}
+		}
+	}
+	
+	status["paused_actions"] = pausedActions
+	status["app_switches"] = appSwitches
+	status["app_paused_actions"] = appPausedActions
+	return status
 }
 
-// PauseActionType pausa um tipo específico de ação
-func PauseActionType(actionType RuleActionType) {
-	globalKillSwitch.mu.Lock()
-	defer globalKillSwitch.mu.Unlock()
-	globalKillSwitch.pausedActions[actionType] = true
-}
-
-// ResumeActionType resume um tipo específico de ação
-func ResumeActionType(actionType RuleActionType) {
-	globalKillSwitch.mu.Lock()
-	defer globalKillSwitch.mu.Unlock()
-	delete(globalKillSwitch.pausedActions, actionType)
+// IsActionTypePaused verifica se um tipo de ação está pausado globalmente
+func IsActionTypePaused(actionType RuleActionType) bool {
+	return IsActionTypePausedForApp(actionType, uuid.Nil)
 }
 
-// IsActionTypePaused verifica se um tipo de ação está pausado
-func IsActionTypePaused(actionType RuleActionType) bool {
+// IsActionTypePausedForApp verifica pausa global ou do app
+func IsActionTypePausedForApp(actionType RuleActionType, appID uuid.UUID) bool {
 	globalKillSwitch.mu.RLock()
 	defer globalKillSwitch.mu.RUnlock()
-	return globalKillSwitch.pausedActions[actionType]
+	
+	now := time.Now()
+	if c, ok := globalKillSwitch.pausedActions[ControlScopeGlobal][actionType]; ok && c.isEffective(now) {
+		return true
+	}
+	if appID != uuid.Nil {
+		if c, ok := globalKillSwitch.pausedActions[appID.String()][actionType]; ok && c.isEffective(now) {
+			return true
+		}
+	}
+	return false
 }
 
 // ========================================
@@ -251,8 +286,8 @@ type ActionValidationResult struct {
 
 // ValidateAction valida se uma ação pode ser executada
 func ValidateAction(actionType RuleActionType, appID uuid.UUID, config interface{}) ActionValidationResult {
-	// 1. Kill switch global
-	if IsKillSwitchActive() {
+	// 1. Kill switch (global ou do app)
+	if IsKillSwitchActiveForApp(appID) {
 		return ActionValidationResult{
 			Allowed: false,
 			Reason:  "Kill switch global ativo - todas as ações automáticas pausadas",
@@ -260,7 +295,7 @@ func ValidateAction(actionType RuleActionType, appID uuid.UUID, config interface
 	}
 	
 	// 2. Ação específica pausada
-	if IsActionTypePaused(actionType) {
+	if IsActionTypePausedForApp(actionType, appID) {
 		return ActionValidationResult{
 			Allowed: false,
 			Reason:  fmt.Sprintf("Ação %s está pausada", actionType),
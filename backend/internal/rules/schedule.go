@@ -0,0 +1,157 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// SCHEDULER - Regras agendadas (cron)
+// "Um disparo por tick, mesmo com várias réplicas"
+// ========================================
+
+var (
+	ErrInvalidTriggerConfig = errors.New("invalid trigger config")
+)
+
+const (
+	// schedulerInterval frequência com que o scheduler procura disparos devidos
+	schedulerInterval = 15 * time.Second
+
+	// scheduleLookback janela para recuperar disparos perdidos (atraso do ticker, restart)
+	scheduleLookback = 2 * time.Minute
+
+	// scheduleFireRetention quanto tempo manter o registro de disparos
+	scheduleFireRetention = 7 * 24 * time.Hour
+)
+
+// RuleScheduleFire registro de um disparo agendado.
+// O índice único (rule_id, fire_at) é o lock distribuído: só a réplica que
+// conseguir inserir a linha executa a regra naquele tick.
+type RuleScheduleFire struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	RuleID     uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_schedule_fire_rule_time" json:"rule_id"`
+	FireAt     time.Time `gorm:"uniqueIndex:idx_schedule_fire_rule_time" json:"fire_at"`
+	InstanceID string    `gorm:"size:100" json:"instance_id"`
+	ClaimedAt  time.Time `json:"claimed_at"`
+}
+
+func (RuleScheduleFire) TableName() string {
+	return "rule_schedule_fires"
+}
+
+// newInstanceID identifica esta réplica nos registros de disparo
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// ParseScheduleConfig lê e compila o TriggerConfig de uma regra agendada
+func ParseScheduleConfig(triggerConfig string) (*CronSchedule, error) {
+	var config ScheduleTriggerConfig
+	if triggerConfig == "" {
+		return nil, fmt.Errorf("%w: schedule rules require trigger_config with cron", ErrInvalidTriggerConfig)
+	}
+	if err := json.Unmarshal([]byte(triggerConfig), &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTriggerConfig, err)
+	}
+	if config.Cron == "" {
+		return nil, fmt.Errorf("%w: cron is required", ErrInvalidTriggerConfig)
+	}
+	sched, err := ParseCron(config.Cron, config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTriggerConfig, err)
+	}
+	return sched, nil
+}
+
+func (s *RulesService) startScheduler() {
+	s.evalWg.Add(1)
+	go func() {
+		defer s.evalWg.Done()
+		ticker := time.NewTicker(schedulerInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.runScheduledRules(time.Now())
+			case <-s.stopEval:
+				return
+			}
+		}
+	}()
+	log.Printf("⏰ [RULES] Scheduler started (interval: %v, instance: %s)", schedulerInterval, s.instanceID)
+}
+
+// runScheduledRules dispara regras agendadas cujo horário caiu na janela
+func (s *RulesService) runScheduledRules(now time.Time) {
+	var rules []Rule
+	s.db.Where("status = ? AND trigger_type = ?", RuleStatusActive, TriggerSchedule).Find(&rules)
+
+	for i := range rules {
+		rule := rules[i]
+		sched, err := ParseScheduleConfig(rule.TriggerConfig)
+		if err != nil {
+			log.Printf("⚠️ [SCHEDULER] Rule %s has invalid schedule: %v", rule.ID, err)
+			continue
+		}
+
+		from := now.Add(-scheduleLookback)
+		if rule.CreatedAt.After(from) {
+			from = rule.CreatedAt
+		}
+
+		for fireAt := sched.Next(from); !fireAt.IsZero() && !fireAt.After(now); fireAt = sched.Next(fireAt) {
+			if !s.claimScheduleFire(rule.ID, fireAt) {
+				continue // Outra réplica já disparou este tick
+			}
+			log.Printf("⏰ [SCHEDULER] Firing rule %s (%s) for %s", rule.Name, rule.ID, fireAt.Format(time.RFC3339))
+			go s.evaluateRule(&rule)
+		}
+	}
+}
+
+// claimScheduleFire tenta reservar o disparo; retorna true se esta réplica ganhou
+func (s *RulesService) claimScheduleFire(ruleID uuid.UUID, fireAt time.Time) bool {
+	fire := RuleScheduleFire{
+		ID:         uuid.New(),
+		RuleID:     ruleID,
+		FireAt:     fireAt.UTC(),
+		InstanceID: s.instanceID,
+		ClaimedAt:  time.Now(),
+	}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&fire)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// cleanupOldScheduleFires remove registros de disparo antigos
+func (s *RulesService) cleanupOldScheduleFires() {
+	s.db.Where("fire_at < ?", time.Now().Add(-scheduleFireRetention)).Delete(&RuleScheduleFire{})
+}
+
+// PreviewSchedule retorna os próximos disparos de uma configuração de agendamento
+func (s *RulesService) PreviewSchedule(triggerConfig string, count int) ([]time.Time, error) {
+	sched, err := ParseScheduleConfig(triggerConfig)
+	if err != nil {
+		return nil, err
+	}
+	return sched.NextN(time.Now(), count), nil
+}
+
+// GetScheduleFires retorna os disparos recentes de uma regra
+func (s *RulesService) GetScheduleFires(ruleID uuid.UUID, limit int) ([]RuleScheduleFire, error) {
+	var fires []RuleScheduleFire
+	err := s.db.Where("rule_id = ?", ruleID).Order("fire_at DESC").Limit(limit).Find(&fires).Error
+	return fires, err
+}
@@ -0,0 +1,490 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// SEQUÊNCIAS DE EVENTOS (CEP) - Padrões no stream de telemetria
+// "3 pagamentos falhos em 10 minutos" / "cadastro sem sessão em 24h"
+// ========================================
+
+const (
+	// Agrupamentos de sequência
+	GroupByUser    = "user_id"
+	GroupBySession = "session_id"
+	GroupByApp     = "app"
+
+	// groupByMetadataPrefix agrupa por um campo do metadata (ex: metadata.order_id)
+	groupByMetadataPrefix = "metadata."
+
+	// sequenceWriteRetries releituras do estado quando outra réplica o alterou antes
+	sequenceWriteRetries = 5
+)
+
+// errSequenceConflict o estado mudou entre a leitura e a escrita
+var errSequenceConflict = errors.New("sequence state changed concurrently")
+
+// SequenceStep passo do padrão
+type SequenceStep struct {
+	EventType string            `json:"event_type"`
+	Filters   map[string]string `json:"filters,omitempty"` // Igualdade no metadata
+	Count     int               `json:"count,omitempty"`   // Ocorrências necessárias (default 1)
+	Absent    bool              `json:"absent,omitempty"`  // O evento NÃO pode ocorrer (só no último passo)
+}
+
+// SequenceTriggerConfig config para trigger de sequência
+type SequenceTriggerConfig struct {
+	Steps   []SequenceStep `json:"steps"`    // Em ordem
+	Within  string         `json:"within"`   // Janela do padrão a partir do primeiro evento (ex: "10m", "24h")
+	GroupBy string         `json:"group_by"` // "user_id" (default), "session_id", "app" ou "metadata.<campo>"
+
+	window time.Duration
+}
+
+// ParseSequenceConfig lê e valida o trigger_config de uma regra de sequência
+func ParseSequenceConfig(raw string) (*SequenceTriggerConfig, error) {
+	var config SequenceTriggerConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTriggerConfig, err)
+	}
+	if len(config.Steps) == 0 {
+		return nil, fmt.Errorf("%w: sequence rules require at least one step", ErrInvalidTriggerConfig)
+	}
+	window, err := parseWindow(config.Within)
+	if err != nil {
+		return nil, fmt.Errorf("%w: within: %v", ErrInvalidTriggerConfig, err)
+	}
+	config.window = window
+
+	for i := range config.Steps {
+		step := &config.Steps[i]
+		if step.EventType == "" {
+			return nil, fmt.Errorf("%w: step %d has no event_type", ErrInvalidTriggerConfig, i+1)
+		}
+		if step.Count < 0 {
+			return nil, fmt.Errorf("%w: step %d has a negative count", ErrInvalidTriggerConfig, i+1)
+		}
+		if step.Count == 0 {
+			step.Count = 1
+		}
+		if step.Absent {
+			if i != len(config.Steps)-1 || i == 0 {
+				return nil, fmt.Errorf("%w: only the last step (after at least one event) can be absent", ErrInvalidTriggerConfig)
+			}
+			if step.Count != 1 {
+				return nil, fmt.Errorf("%w: absent steps cannot have a count", ErrInvalidTriggerConfig)
+			}
+		}
+	}
+
+	switch {
+	case config.GroupBy == "":
+		config.GroupBy = GroupByUser
+	case config.GroupBy == GroupByUser, config.GroupBy == GroupBySession, config.GroupBy == GroupByApp:
+	case strings.HasPrefix(config.GroupBy, groupByMetadataPrefix) && len(config.GroupBy) > len(groupByMetadataPrefix):
+	default:
+		return nil, fmt.Errorf("%w: group_by must be user_id, session_id, app or metadata.<field>", ErrInvalidTriggerConfig)
+	}
+	return &config, nil
+}
+
+// presenceSteps passos que precisam ocorrer (sem o passo de ausência final)
+func (c *SequenceTriggerConfig) presenceSteps() []SequenceStep {
+	if c.Steps[len(c.Steps)-1].Absent {
+		return c.Steps[:len(c.Steps)-1]
+	}
+	return c.Steps
+}
+
+// absentStep passo de ausência final (nil se não houver)
+func (c *SequenceTriggerConfig) absentStep() *SequenceStep {
+	if last := &c.Steps[len(c.Steps)-1]; last.Absent {
+		return last
+	}
+	return nil
+}
+
+// involves algum passo (inclusive o de ausência) usa o tipo de evento
+func (c *SequenceTriggerConfig) involves(eventType string) bool {
+	for _, step := range c.Steps {
+		if step.EventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// groupKey chave de agrupamento do evento ("" = evento sem a chave, ignorado)
+func (c *SequenceTriggerConfig) groupKey(event *StreamEvent) string {
+	switch c.GroupBy {
+	case GroupByApp:
+		return event.AppID.String()
+	case GroupBySession:
+		if event.SessionID == uuid.Nil {
+			return ""
+		}
+		return event.SessionID.String()
+	case GroupByUser:
+		if event.UserID == uuid.Nil {
+			return ""
+		}
+		return event.UserID.String()
+	}
+	value, ok := event.Metadata[strings.TrimPrefix(c.GroupBy, groupByMetadataPrefix)]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// StreamEvent evento de telemetria entregue ao rules engine
+type StreamEvent struct {
+	ID        uuid.UUID              `json:"id"`
+	AppID     uuid.UUID              `json:"app_id"`
+	UserID    uuid.UUID              `json:"user_id"`
+	SessionID uuid.UUID              `json:"session_id"`
+	Type      string                 `json:"type"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// matches evento corresponde ao passo (tipo + filtros)
+func (step *SequenceStep) matches(event *StreamEvent) bool {
+	if step.EventType != event.Type {
+		return false
+	}
+	for key, value := range step.Filters {
+		if fmt.Sprint(event.Metadata[key]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// SequenceMatchEvent evento que compõe um match (anexado à RuleExecution)
+type SequenceMatchEvent struct {
+	EventID   uuid.UUID `json:"event_id"`
+	Type      string    `json:"type"`
+	Step      int       `json:"step"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SequenceState match parcial de uma regra para uma chave
+type SequenceState struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	RuleID    uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_sequence_state" json:"rule_id"`
+	GroupKey  string     `gorm:"size:200;uniqueIndex:idx_sequence_state" json:"group_key"`
+	AppID     uuid.UUID  `gorm:"type:uuid;index" json:"app_id"`
+	Events    string     `gorm:"type:text" json:"events"`           // JSON []SequenceMatchEvent
+	Deadline  *time.Time `gorm:"index" json:"deadline"`             // Aguardando ausência até aqui
+	Version   int        `gorm:"not null;default:0" json:"version"` // Escrita condicional entre réplicas
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (SequenceState) TableName() string {
+	return "rule_sequence_states"
+}
+
+// ========================================
+// MATCHING
+// ========================================
+
+// sequenceMatcher máquina de estados de um padrão para uma chave
+type sequenceMatcher struct {
+	config *SequenceTriggerConfig
+	events []SequenceMatchEvent
+}
+
+// progress passo atual e ocorrências já vistas nele
+func (m *sequenceMatcher) progress() (step, seen int) {
+	for _, e := range m.events {
+		if e.Step > step {
+			step, seen = e.Step, 0
+		}
+		seen++
+	}
+	if len(m.events) > 0 && seen == m.config.Steps[step].Count {
+		return step + 1, 0
+	}
+	return step, seen
+}
+
+// complete todos os passos presenciais satisfeitos
+func (m *sequenceMatcher) complete() bool {
+	step, _ := m.progress()
+	return step >= len(m.config.presenceSteps())
+}
+
+// feed tenta consumir um evento no passo atual
+func (m *sequenceMatcher) feed(event SequenceMatchEvent, source *StreamEvent) bool {
+	step, _ := m.progress()
+	presence := m.config.presenceSteps()
+	if step >= len(presence) || !presence[step].matches(source) {
+		return false
+	}
+	event.Step = step
+	m.events = append(m.events, event)
+	return true
+}
+
+// slide descarta eventos fora da janela e recompõe o match com os que sobram
+// (janela deslizante: "3 em 10 minutos" conta os 3 mais recentes)
+func (m *sequenceMatcher) slide(now time.Time, sources map[uuid.UUID]*StreamEvent) {
+	for len(m.events) > 0 && now.Sub(m.events[0].Timestamp) > m.config.window {
+		rest := m.events[1:]
+		m.events = nil
+		for _, e := range rest {
+			m.feed(e, sources[e.EventID])
+		}
+	}
+}
+
+// ProcessEvent entrega um evento de telemetria às regras de evento e de sequência
+func (s *RulesService) ProcessEvent(event StreamEvent) {
+	s.triggerByEvent(event.AppID, event.UserID, event.Type, event.Metadata)
+	if err := s.processSequenceEvent(&event); err != nil {
+		log.Printf("⚠️ [RULES] Sequence processing failed for app %s: %v", event.AppID, err)
+	}
+}
+
+// processSequenceEvent avança os matches parciais das regras de sequência do app
+func (s *RulesService) processSequenceEvent(event *StreamEvent) error {
+	var rules []Rule
+	if err := s.db.Where("app_id = ? AND status = ? AND trigger_type = ?", event.AppID, RuleStatusActive, TriggerSequence).Find(&rules).Error; err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		config, err := ParseSequenceConfig(rule.TriggerConfig)
+		if err != nil {
+			continue
+		}
+		if !config.involves(event.Type) {
+			continue
+		}
+		key := config.groupKey(event)
+		if key == "" {
+			continue
+		}
+		if err := s.advanceSequence(rule, config, key, event); err != nil {
+			log.Printf("⚠️ [RULES] Sequence rule %s: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// advanceSequence aplica o evento ao estado (rule, key). Réplicas processam eventos
+// da mesma chave em paralelo: toda escrita é condicional à versão lida e, se outra
+// réplica chegou antes, o estado é relido e o evento reaplicado.
+func (s *RulesService) advanceSequence(rule *Rule, config *SequenceTriggerConfig, key string, event *StreamEvent) error {
+	for attempt := 0; attempt < sequenceWriteRetries; attempt++ {
+		err := s.applySequenceEvent(rule, config, key, event)
+		if !errors.Is(err, errSequenceConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w after %d attempts", errSequenceConflict, sequenceWriteRetries)
+}
+
+// applySequenceEvent uma tentativa de advanceSequence (errSequenceConflict = reler)
+func (s *RulesService) applySequenceEvent(rule *Rule, config *SequenceTriggerConfig, key string, event *StreamEvent) error {
+	var state SequenceState
+	err := s.db.Where("rule_id = ? AND group_key = ?", rule.ID, key).First(&state).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	matcher := &sequenceMatcher{config: config}
+	if state.ID != uuid.Nil {
+		if err := json.Unmarshal([]byte(state.Events), &matcher.events); err != nil {
+			matcher.events = nil
+		}
+	}
+
+	// Aguardando ausência: só o evento proibido (dentro do prazo) importa
+	if state.Deadline != nil {
+		if absent := config.absentStep(); absent != nil && absent.matches(event) && !event.Timestamp.After(*state.Deadline) {
+			return s.deleteSequenceState(&state)
+		}
+		return nil
+	}
+
+	// Os eventos já guardados passaram pelos filtros: basta o tipo para recompor o match
+	sources := make(map[uuid.UUID]*StreamEvent, len(matcher.events))
+	for _, e := range matcher.events {
+		sources[e.EventID] = &StreamEvent{Type: e.Type, Metadata: stepFilters(config, e.Step)}
+	}
+	before := len(matcher.events)
+	matcher.slide(event.Timestamp, sources)
+
+	if !matcher.feed(SequenceMatchEvent{EventID: event.ID, Type: event.Type, Timestamp: event.Timestamp}, event) {
+		if len(matcher.events) != before {
+			return s.saveSequenceState(&state, rule, key, matcher, nil)
+		}
+		return nil
+	}
+
+	if !matcher.complete() {
+		return s.saveSequenceState(&state, rule, key, matcher, nil)
+	}
+	if config.absentStep() != nil {
+		deadline := matcher.events[0].Timestamp.Add(config.window)
+		return s.saveSequenceState(&state, rule, key, matcher, &deadline)
+	}
+
+	// Só quem remover o estado lido dispara: se outra réplica o alterou, reaplica
+	if state.ID != uuid.Nil {
+		if err := s.deleteSequenceState(&state); err != nil {
+			return err
+		}
+	}
+	s.fireSequence(rule, matcher.events, event.UserID)
+	return nil
+}
+
+// stepFilters reconstrói um metadata que satisfaz os filtros do passo
+// (eventos guardados já passaram pelos filtros quando entraram)
+func stepFilters(config *SequenceTriggerConfig, step int) map[string]interface{} {
+	metadata := make(map[string]interface{}, len(config.Steps[step].Filters))
+	for key, value := range config.Steps[step].Filters {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// saveSequenceState grava o match parcial se o estado ainda estiver na versão lida
+func (s *RulesService) saveSequenceState(state *SequenceState, rule *Rule, key string, matcher *sequenceMatcher, deadline *time.Time) error {
+	if len(matcher.events) == 0 {
+		if state.ID != uuid.Nil {
+			return s.deleteSequenceState(state)
+		}
+		return nil
+	}
+	data, err := json.Marshal(matcher.events)
+	if err != nil {
+		return err
+	}
+
+	if state.ID == uuid.Nil {
+		// Índice único (rule_id, group_key): outra réplica pode ter criado o estado
+		state.ID = uuid.New()
+		state.RuleID = rule.ID
+		state.GroupKey = key
+		state.AppID = rule.AppID
+		state.Events = string(data)
+		state.Deadline = deadline
+		state.Version = 1
+		state.UpdatedAt = time.Now()
+		result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(state)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errSequenceConflict
+		}
+		return nil
+	}
+
+	result := s.db.Model(&SequenceState{}).Where("id = ? AND version = ?", state.ID, state.Version).Updates(map[string]interface{}{
+		"events":     string(data),
+		"deadline":   deadline,
+		"version":    state.Version + 1,
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errSequenceConflict
+	}
+	return nil
+}
+
+// deleteSequenceState remove o estado se ainda estiver na versão lida
+func (s *RulesService) deleteSequenceState(state *SequenceState) error {
+	result := s.db.Where("id = ? AND version = ?", state.ID, state.Version).Delete(&SequenceState{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errSequenceConflict
+	}
+	return nil
+}
+
+// fireSequence avalia a regra com os eventos do match anexados
+func (s *RulesService) fireSequence(rule *Rule, events []SequenceMatchEvent, userID uuid.UUID) {
+	log.Printf("🔗 [RULES] Sequence matched: %s (%d events)", rule.Name, len(events))
+	go s.evaluateRuleWithEvents(rule, events, userID)
+}
+
+// ========================================
+// AUSÊNCIA E LIMPEZA (a cada minuto)
+// ========================================
+
+// sweepSequenceStates dispara padrões de ausência vencidos e remove matches expirados
+func (s *RulesService) sweepSequenceStates(now time.Time) {
+	var rules []Rule
+	s.db.Where("status = ? AND trigger_type = ?", RuleStatusActive, TriggerSequence).Find(&rules)
+	active := make(map[uuid.UUID]bool, len(rules))
+
+	for i := range rules {
+		rule := &rules[i]
+		active[rule.ID] = true
+		config, err := ParseSequenceConfig(rule.TriggerConfig)
+		if err != nil {
+			continue
+		}
+
+		// Ausência confirmada: o prazo passou sem o evento proibido
+		var due []SequenceState
+		s.db.Where("rule_id = ? AND deadline IS NOT NULL AND deadline <= ?", rule.ID, now).Find(&due)
+		for i := range due {
+			s.fireAbsence(rule, config, &due[i])
+		}
+
+		// Matches parciais sem atividade além da janela não se completam mais
+		s.db.Where("rule_id = ? AND deadline IS NULL AND updated_at < ?", rule.ID, now.Add(-config.window)).
+			Delete(&SequenceState{})
+	}
+
+	// Estados de regras desativadas/removidas
+	var stale []uuid.UUID
+	s.db.Model(&SequenceState{}).Distinct("rule_id").Pluck("rule_id", &stale)
+	for _, ruleID := range stale {
+		if !active[ruleID] {
+			s.db.Where("rule_id = ?", ruleID).Delete(&SequenceState{})
+		}
+	}
+}
+
+// fireAbsence dispara uma ausência vencida. Todas as réplicas varrem:
+// só a que remover o estado (na versão lida) dispara. Retorna true se disparou.
+func (s *RulesService) fireAbsence(rule *Rule, config *SequenceTriggerConfig, state *SequenceState) bool {
+	if s.deleteSequenceState(state) != nil {
+		return false
+	}
+	var events []SequenceMatchEvent
+	json.Unmarshal([]byte(state.Events), &events)
+	// Ausência não tem evento final: o usuário só é conhecido quando agrupado por ele
+	userID := uuid.Nil
+	if config.GroupBy == GroupByUser {
+		userID, _ = uuid.Parse(state.GroupKey)
+	}
+	s.fireSequence(rule, events, userID)
+	return true
+}
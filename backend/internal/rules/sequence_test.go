@@ -0,0 +1,194 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Sequências de eventos
+// ========================================
+
+// testMetricsSnapshot espelho mínimo de telemetry_metrics_snapshots
+type testMetricsSnapshot struct {
+	AppID             uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OnlineNow         int64
+	ActiveSessions    int64
+	TotalSessions     int64
+	TotalEvents       int64
+	EventsPerMinute   float64
+	TotalInteractions int64
+	ActiveUsers24h    int64 `gorm:"column:active_users_24h"`
+	TotalUsers        int64
+}
+
+func (testMetricsSnapshot) TableName() string {
+	return "telemetry_metrics_snapshots"
+}
+
+// waitExecutions espera as execuções assíncronas de uma regra
+func waitExecutions(t *testing.T, s *RulesService, ruleID uuid.UUID, want int) []RuleExecution {
+	t.Helper()
+	var executions []RuleExecution
+	for i := 0; i < 100; i++ {
+		s.db.Where("rule_id = ?", ruleID).Find(&executions)
+		if len(executions) >= want {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return executions
+}
+
+func TestSequenceCountWithinSlidingWindow(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&SequenceState{}, &RuleExecution{}, &testMetricsSnapshot{}, &testTelemetrySession{})
+	appID, user := uuid.New(), uuid.New()
+
+	rule := &Rule{
+		AppID:         appID,
+		Name:          "pagamentos falhando",
+		Status:        RuleStatusActive,
+		TriggerType:   TriggerSequence,
+		TriggerConfig: `{"steps":[{"event_type":"payment.failed","count":3}],"within":"10m"}`,
+		ActionType:    ActionAlert,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	send := func(offset time.Duration, userID uuid.UUID) uuid.UUID {
+		id := uuid.New()
+		s.processSequenceEvent(&StreamEvent{ID: id, AppID: appID, UserID: userID, Type: "payment.failed", Timestamp: base.Add(offset)})
+		return id
+	}
+
+	// 0, 8 e 15min: o primeiro sai da janela antes do terceiro chegar
+	send(0, user)
+	send(8*time.Minute, user)
+	send(9*time.Minute, uuid.New()) // Outro usuário não conta
+	send(15*time.Minute, user)
+	if executions := waitExecutions(t, s, rule.ID, 1); len(executions) != 0 {
+		t.Fatalf("não deveria disparar ainda: %d execuções", len(executions))
+	}
+
+	last := send(17*time.Minute, user)
+	executions := waitExecutions(t, s, rule.ID, 1)
+	if len(executions) != 1 {
+		t.Fatalf("esperada 1 execução, obtidas %d", len(executions))
+	}
+	var matched []SequenceMatchEvent
+	json.Unmarshal([]byte(executions[0].MatchedEvents), &matched)
+	if len(matched) != 3 || matched[2].EventID != last || !matched[0].Timestamp.Equal(base.Add(8*time.Minute)) {
+		t.Errorf("eventos anexados inesperados: %+v", matched)
+	}
+}
+
+func TestSequenceAbsence(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&SequenceState{}, &RuleExecution{}, &testMetricsSnapshot{}, &testTelemetrySession{})
+	appID := uuid.New()
+
+	rule := &Rule{
+		AppID:         appID,
+		Name:          "cadastro sem sessão",
+		Status:        RuleStatusActive,
+		TriggerType:   TriggerSequence,
+		TriggerConfig: `{"steps":[{"event_type":"user.signup"},{"event_type":"session.start","absent":true}],"within":"24h"}`,
+		ActionType:    ActionAlert,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Now().Add(-48 * time.Hour)
+	active, idle := uuid.New(), uuid.New()
+	for _, user := range []uuid.UUID{active, idle} {
+		s.processSequenceEvent(&StreamEvent{ID: uuid.New(), AppID: appID, UserID: user, Type: "user.signup", Timestamp: base})
+	}
+	s.processSequenceEvent(&StreamEvent{ID: uuid.New(), AppID: appID, UserID: active, Type: "session.start", Timestamp: base.Add(time.Hour)})
+
+	var states int64
+	s.db.Model(&SequenceState{}).Where("rule_id = ?", rule.ID).Count(&states)
+	if states != 1 {
+		t.Fatalf("só o usuário sem sessão deveria aguardar: %d estados", states)
+	}
+
+	// Duas réplicas com o mesmo estado vencido em mãos: só uma dispara
+	var due SequenceState
+	s.db.Where("rule_id = ?", rule.ID).First(&due)
+	config, _ := ParseSequenceConfig(rule.TriggerConfig)
+	stale := due
+	if !s.fireAbsence(rule, config, &due) || s.fireAbsence(rule, config, &stale) {
+		t.Fatal("apenas a primeira remoção do estado deveria disparar")
+	}
+	s.sweepSequenceStates(time.Now())
+	if executions := waitExecutions(t, s, rule.ID, 1); len(executions) != 1 {
+		t.Fatalf("ausência deveria disparar 1 vez, obtidas %d", len(executions))
+	}
+
+	if err := validateRule(&Rule{TriggerType: TriggerSequence, TriggerConfig: `{"steps":[{"event_type":"a","absent":true}],"within":"1h"}`}); err == nil {
+		t.Error("ausência sem evento anterior deveria falhar")
+	}
+}
+
+func TestSequenceStateWritesAreConditional(t *testing.T) {
+	s := newTestRulesService(t)
+	s.db.AutoMigrate(&SequenceState{}, &RuleExecution{}, &testMetricsSnapshot{}, &testTelemetrySession{})
+	appID, user := uuid.New(), uuid.New()
+
+	rule := &Rule{
+		AppID:         appID,
+		Name:          "pagamentos falhando",
+		Status:        RuleStatusActive,
+		TriggerType:   TriggerSequence,
+		TriggerConfig: `{"steps":[{"event_type":"payment.failed","count":3}],"within":"1h"}`,
+		ActionType:    ActionAlert,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	config, _ := ParseSequenceConfig(rule.TriggerConfig)
+	base := time.Now().Add(-30 * time.Minute)
+	event := func(offset time.Duration) *StreamEvent {
+		return &StreamEvent{ID: uuid.New(), AppID: appID, UserID: user, Type: "payment.failed", Timestamp: base.Add(offset)}
+	}
+
+	// Réplica com leitura antiga não sobrescreve o evento gravado por outra
+	if err := s.advanceSequence(rule, config, user.String(), event(0)); err != nil {
+		t.Fatal(err)
+	}
+	var stale SequenceState
+	s.db.Where("rule_id = ?", rule.ID).First(&stale)
+	if err := s.advanceSequence(rule, config, user.String(), event(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	matcher := &sequenceMatcher{config: config}
+	json.Unmarshal([]byte(stale.Events), &matcher.events)
+	if err := s.saveSequenceState(&stale, rule, user.String(), matcher, nil); !errors.Is(err, errSequenceConflict) {
+		t.Fatalf("escrita sobre versão antiga deveria conflitar: %v", err)
+	}
+
+	// Eventos concorrentes da mesma chave: nenhum se perde (6 eventos, 2 matches de 3)
+	s.db.Where("rule_id = ?", rule.ID).Delete(&SequenceState{})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.advanceSequence(rule, config, user.String(), event(time.Duration(i)*time.Second)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if executions := waitExecutions(t, s, rule.ID, 2); len(executions) != 2 {
+		t.Fatalf("esperados 2 disparos, obtidos %d", len(executions))
+	}
+}
@@ -2,10 +2,11 @@ package rules
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -13,6 +14,9 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"prost-qs/backend/internal/killswitch"
 )
 
 // ========================================
@@ -23,28 +27,44 @@ type RulesService struct {
 	db          *gorm.DB
 	stopEval    chan struct{}
 	evalWg      sync.WaitGroup
+	instanceID  string // Identifica a réplica (scheduler)
+	
+	// Controles persistidos (kill switch, pausas, shadow mode)
+	platformKillSwitch *killswitch.KillSwitchService
+	controlsMu         sync.RWMutex
+	controlsSyncedAt   time.Time
 	
 	// Callbacks para ações
 	alertCallback   func(appID uuid.UUID, alertType, message string, data map[string]interface{})
 	webhookCallback func(url, method string, headers map[string]string, body string) error
 	flagCallback    func(appID uuid.UUID, target, flagName, flagValue string, ttl time.Duration) error
+	
+	// Pertinência a segmentos de telemetria (in_segment)
+	segmentResolver func(appID, userID uuid.UUID, segment string) (bool, error)
 }
 
 func NewRulesService(db *gorm.DB) *RulesService {
 	// Auto-migrate
-	db.AutoMigrate(&Rule{}, &RuleExecution{}, &AppConfig{}, &TemporaryRule{}, &ActionAuditLog{}, &ShadowExecution{}, &AuthorityGrant{})
+	db.AutoMigrate(&Rule{}, &RuleExecution{}, &AppConfig{}, &TemporaryRule{}, &ActionAuditLog{}, &ShadowExecution{}, &AuthorityGrant{}, &RuleMetricSample{}, &RuleScheduleFire{}, &RuleMetaBudget{}, &Experiment{}, &ExperimentAssignment{}, &RulesControl{}, &RuleVersion{}, &MetricBaseline{}, &SequenceState{})
 	
 	svc := &RulesService{
-		db:       db,
-		stopEval: make(chan struct{}),
+		db:         db,
+		stopEval:   make(chan struct{}),
+		instanceID: newInstanceID(),
 	}
 	
 	// Seed regras padrão para VOX-BRIDGE
 	svc.seedDefaultRules()
 	
+	// Carregar kill switch/shadow mode do banco antes de avaliar qualquer regra
+	svc.startControlSync()
+	
 	// Iniciar avaliador periódico
 	svc.startPeriodicEvaluator()
 	
+	// Iniciar scheduler de regras agendadas (cron)
+	svc.startScheduler()
+	
 	// Iniciar cleanup de regras temporárias
 	svc.startTemporaryRulesCleanup()
 	
@@ -171,6 +191,11 @@ func (s *RulesService) SetFlagCallback(cb func(appID uuid.UUID, target, flagName
 	s.flagCallback = cb
 }
 
+// SetSegmentResolver define a consulta de pertinência a segmentos (in_segment)
+func (s *RulesService) SetSegmentResolver(resolver func(appID, userID uuid.UUID, segment string) (bool, error)) {
+	s.segmentResolver = resolver
+}
+
 // Stop para o avaliador
 func (s *RulesService) Stop() {
 	close(s.stopEval)
@@ -192,6 +217,7 @@ func (s *RulesService) startPeriodicEvaluator() {
 			select {
 			case <-ticker.C:
 				s.evaluateAllMetricRules()
+				s.sweepSequenceStates(time.Now())
 			case <-s.stopEval:
 				return
 			}
@@ -213,6 +239,9 @@ func (s *RulesService) startTemporaryRulesCleanup() {
 			case <-ticker.C:
 				s.cleanupExpiredTemporaryRules()
 				s.cleanupExpiredConfigs()
+				s.cleanupOldMetricSamples()
+				s.cleanupOldScheduleFires()
+				s.cleanupOldMetaBudgets()
 			case <-s.stopEval:
 				return
 			}
@@ -265,12 +294,23 @@ func (s *RulesService) cleanupExpiredConfigs() {
 	}
 }
 
+// cleanupOldMetricSamples remove amostras além da retenção
+func (s *RulesService) cleanupOldMetricSamples() {
+	result := s.db.Where("sampled_at < ?", time.Now().Add(-metricSampleRetention)).Delete(&RuleMetricSample{})
+	if result.RowsAffected > 0 {
+		log.Printf("🧹 [CLEANUP] %d amostras de métricas antigas removidas", result.RowsAffected)
+	}
+}
+
 // evaluateAllMetricRules avalia todas as regras baseadas em métricas
 func (s *RulesService) evaluateAllMetricRules() {
+	s.recordMetricSamples()
+	
 	var rules []Rule
-	s.db.Where("status = ? AND trigger_type IN ?", RuleStatusActive, []RuleTriggerType{TriggerMetric, TriggerThreshold}).Find(&rules)
+	s.db.Where("status = ? AND trigger_type IN ?", RuleStatusActive, []RuleTriggerType{TriggerMetric, TriggerThreshold, TriggerAnomaly}).Find(&rules)
 	
 	for _, rule := range rules {
+		rule := rule
 		go s.evaluateRule(&rule)
 	}
 }
@@ -281,10 +321,77 @@ func (s *RulesService) evaluateAllMetricRules() {
 
 // CreateRule cria uma nova regra
 func (s *RulesService) CreateRule(rule *Rule) error {
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+	if err := s.checkRuleDependencies(rule); err != nil {
+		return err
+	}
+	
 	rule.ID = uuid.New()
 	rule.CreatedAt = time.Now()
 	rule.UpdatedAt = time.Now()
-	return s.db.Create(rule).Error
+	return s.createRuleWithVersion(rule, "created")
+}
+
+// validateRule valida condição e configuração do trigger
+func validateRule(rule *Rule) error {
+	if err := ValidateCondition(rule.Condition); err != nil {
+		return err
+	}
+	if err := validateSegmentCondition(rule); err != nil {
+		return err
+	}
+	if rule.TriggerType == TriggerSchedule {
+		if _, err := ParseScheduleConfig(rule.TriggerConfig); err != nil {
+			return err
+		}
+	}
+	if rule.TriggerType == TriggerAnomaly {
+		if _, err := ParseAnomalyConfig(rule.TriggerConfig); err != nil {
+			return err
+		}
+	}
+	if rule.TriggerType == TriggerSequence {
+		if _, err := ParseSequenceConfig(rule.TriggerConfig); err != nil {
+			return err
+		}
+	}
+	if rule.TriggerType == TriggerMetric && rule.TriggerConfig != "" {
+		var config MetricTriggerConfig
+		if err := json.Unmarshal([]byte(rule.TriggerConfig), &config); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTriggerConfig, err)
+		}
+		if config.Period != "" {
+			if _, err := parseWindow(config.Period); err != nil {
+				return fmt.Errorf("%w: invalid period %q", ErrInvalidTriggerConfig, config.Period)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSegmentCondition in_segment só em regras com usuário gatilho: por evento ou
+// por sequência (a ausência só tem usuário quando agrupada por user_id)
+func validateSegmentCondition(rule *Rule) error {
+	if strings.TrimSpace(rule.Condition) == "" {
+		return nil
+	}
+	expr, err := ParseExpression(rule.Condition)
+	if err != nil {
+		return err
+	}
+	call := expr.segmentCall()
+	if call == nil || rule.TriggerType == TriggerEvent {
+		return nil
+	}
+	if rule.TriggerType == TriggerSequence {
+		config, err := ParseSequenceConfig(rule.TriggerConfig)
+		if err != nil || config.GroupBy == GroupByUser || !config.Steps[len(config.Steps)-1].Absent {
+			return nil // Config inválida é reportada pela validação do gatilho
+		}
+	}
+	return exprErrorf(call.pos, "%s requires a triggering user: use an event trigger or a sequence grouped by user_id", call.name)
 }
 
 // GetRule busca uma regra por ID
@@ -302,9 +409,54 @@ func (s *RulesService) GetRulesByApp(appID uuid.UUID) ([]Rule, error) {
 }
 
 // UpdateRule atualiza uma regra
-func (s *RulesService) UpdateRule(rule *Rule) error {
-	rule.UpdatedAt = time.Now()
-	return s.db.Save(rule).Error
+// Toda mudança na definição gera uma nova versão imutável (autor, diff e motivo)
+func (s *RulesService) UpdateRule(rule *Rule, changedBy uuid.UUID, reason string) error {
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+	if err := s.checkRuleDependencies(rule); err != nil {
+		return err
+	}
+	
+	current, err := s.GetRule(rule.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, rule.ID)
+	}
+	if err != nil {
+		return err
+	}
+	
+	changes := diffDefinitions(ruleDefinitionOf(current), ruleDefinitionOf(rule))
+	
+	// Contadores, depth e autoria não vêm do request
+	updated := *current
+	ruleDefinitionOf(rule).applyTo(&updated)
+	if rule.Status != "" {
+		updated.Status = rule.Status
+	}
+	updated.UpdatedAt = time.Now()
+	
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if len(changes) > 0 {
+			if err := s.ensureBaselineVersion(tx, current); err != nil {
+				return err
+			}
+			updated.Version = current.Version + 1
+		}
+		if err := tx.Save(&updated).Error; err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		return createRuleVersion(tx, &updated, changes, changedBy, reason)
+	})
+	if err != nil {
+		return err
+	}
+	
+	*rule = updated
+	return nil
 }
 
 // DeleteRule deleta uma regra
@@ -327,25 +479,51 @@ func (s *RulesService) ToggleRule(id uuid.UUID, active bool) error {
 
 // EvaluateRule avalia uma regra específica
 func (s *RulesService) evaluateRule(rule *Rule) {
+	s.evaluateRuleWithEvents(rule, nil, uuid.Nil)
+}
+
+// evaluateRuleWithEvents avalia a regra anexando os eventos que a dispararam.
+// userID é o usuário do evento gatilho (uuid.Nil quando não há um).
+func (s *RulesService) evaluateRuleWithEvents(rule *Rule, events []SequenceMatchEvent, userID uuid.UUID) {
+	s.evaluateRuleIn(rule, ruleEvaluation{Events: events, UserID: userID})
+}
+
+// evaluateRuleIn avalia a regra dentro de uma cadeia de avaliação (ver ruleEvaluation)
+func (s *RulesService) evaluateRuleIn(rule *Rule, eval ruleEvaluation) {
+	events, userID := eval.Events, eval.UserID
 	start := time.Now()
 	
-	// Verificar cooldown
-	if rule.LastTriggeredAt != nil {
+	// Verificar cooldown (agendadas são limitadas pelo cron; sequências, pelo match por chave)
+	if rule.LastTriggeredAt != nil && rule.TriggerType != TriggerSchedule && rule.TriggerType != TriggerSequence {
 		cooldown := time.Duration(rule.CooldownMinutes) * time.Minute
 		if time.Since(*rule.LastTriggeredAt) < cooldown {
 			return // Ainda em cooldown
 		}
 	}
 	
-	// Buscar métricas do app
-	metrics, err := s.getAppMetrics(rule.AppID)
+	// Buscar métricas do app na janela da regra
+	window := ruleMetricWindow(rule, time.Now())
+	metrics, err := s.getAppMetrics(rule.AppID, window)
 	if err != nil {
 		log.Printf("⚠️ [RULES] Error getting metrics for app %s: %v", rule.AppID, err)
 		return
 	}
 	
+	// Anomalia: o desvio precisa passar do z-score antes da condição (opcional)
+	if rule.TriggerType == TriggerAnomaly {
+		deviation, fired, err := s.evaluateAnomaly(rule)
+		if err != nil {
+			log.Printf("⚠️ [RULES] Error evaluating anomaly for rule %s: %v", rule.ID, err)
+			return
+		}
+		if !fired {
+			return
+		}
+		deviation.addTo(metrics)
+	}
+	
 	// Avaliar condição
-	conditionMet, err := s.evaluateCondition(rule.Condition, metrics)
+	conditionMet, err := s.evaluateCondition(rule.AppID, rule.Condition, metrics, userID)
 	if err != nil {
 		log.Printf("⚠️ [RULES] Error evaluating condition for rule %s: %v", rule.ID, err)
 		return
@@ -355,19 +533,25 @@ func (s *RulesService) evaluateRule(rule *Rule) {
 	execution := &RuleExecution{
 		ID:           uuid.New(),
 		RuleID:       rule.ID,
+		RuleVersion:  rule.Version,
 		AppID:        rule.AppID,
 		ConditionMet: conditionMet,
 		ExecutedAt:   time.Now(),
 		DurationMs:   time.Since(start).Milliseconds(),
 	}
 	
-	if triggerData, err := json.Marshal(metrics); err == nil {
+	if triggerData, err := json.Marshal(ExecutionTriggerData{Metrics: metrics, Window: window}); err == nil {
 		execution.TriggerData = string(triggerData)
 	}
+	if len(events) > 0 {
+		if matched, err := json.Marshal(events); err == nil {
+			execution.MatchedEvents = string(matched)
+		}
+	}
 	
 	if conditionMet {
 		// Executar ação
-		result, err := s.executeAction(rule, metrics)
+		result, err := s.executeAction(rule, metrics, eval)
 		execution.ActionTaken = true
 		
 		if err != nil {
@@ -392,8 +576,46 @@ func (s *RulesService) evaluateRule(rule *Rule) {
 	s.db.Create(execution)
 }
 
+// defaultRetentionCohorts coortes usados quando a regra não define período
+const defaultRetentionCohorts = 7
+
+// ruleMetricWindow monta a janela de métricas a partir de MetricTriggerConfig.Period
+// Sem período (ou trigger que não é de métrica) = métricas acumuladas, como antes
+func ruleMetricWindow(rule *Rule, end time.Time) MetricWindow {
+	window := MetricWindow{
+		Period:           "lifetime",
+		End:              end,
+		RetentionCohorts: defaultRetentionCohorts,
+	}
+	
+	if rule.TriggerType != TriggerMetric || rule.TriggerConfig == "" {
+		return window
+	}
+	
+	var config MetricTriggerConfig
+	if err := json.Unmarshal([]byte(rule.TriggerConfig), &config); err != nil || config.Period == "" {
+		return window
+	}
+	
+	period, err := parseWindow(config.Period)
+	if err != nil {
+		return window
+	}
+	
+	start := end.Add(-period)
+	window.Period = config.Period
+	window.Start = &start
+	window.RetentionCohorts = int(math.Ceil(period.Hours() / 24))
+	if window.RetentionCohorts < 1 {
+		window.RetentionCohorts = 1
+	}
+	return window
+}
+
 // getAppMetrics busca métricas do app para avaliação
-func (s *RulesService) getAppMetrics(appID uuid.UUID) (map[string]float64, error) {
+// Métricas de presença (online_now, active_sessions) são sempre do snapshot atual;
+// contagens e taxas respeitam a janela.
+func (s *RulesService) getAppMetrics(appID uuid.UUID, window MetricWindow) (map[string]float64, error) {
 	metrics := make(map[string]float64)
 	
 	// Buscar snapshot de métricas
@@ -419,145 +641,251 @@ func (s *RulesService) getAppMetrics(appID uuid.UUID) (map[string]float64, error
 	
 	metrics["online_now"] = float64(snapshot.OnlineNow)
 	metrics["active_sessions"] = float64(snapshot.ActiveSessions)
-	metrics["total_sessions"] = float64(snapshot.TotalSessions)
-	metrics["total_events"] = float64(snapshot.TotalEvents)
-	metrics["events_per_minute"] = snapshot.EventsPerMinute
-	metrics["total_interactions"] = float64(snapshot.TotalInteractions)
 	metrics["active_users_24h"] = float64(snapshot.ActiveUsers24h)
 	metrics["total_users"] = float64(snapshot.TotalUsers)
 	
-	// Calcular métricas derivadas
-	if snapshot.TotalSessions > 0 {
+	// Sem janela, contagens acumuladas vêm prontas do snapshot
+	if window.Start == nil {
+		metrics["total_sessions"] = float64(snapshot.TotalSessions)
+		metrics["total_events"] = float64(snapshot.TotalEvents)
+		metrics["events_per_minute"] = snapshot.EventsPerMinute
+		metrics["total_interactions"] = float64(snapshot.TotalInteractions)
+	}
+	
+	s.rangeMetrics(appID, window, metrics, window.Start != nil)
+	
+	return metrics, nil
+}
+
+// rangeMetrics calcula contagens (se withTotals), taxas e retenção a partir da
+// telemetria bruta, considerando apenas dados anteriores a window.End
+func (s *RulesService) rangeMetrics(appID uuid.UUID, window MetricWindow, metrics map[string]float64, withTotals bool) {
+	sessions := s.db.Table("telemetry_sessions").Where("app_id = ? AND started_at < ?", appID, window.End)
+	events := s.db.Table("telemetry_events").Where("app_id = ? AND timestamp < ?", appID, window.End)
+	if window.Start != nil {
+		sessions = sessions.Where("started_at >= ?", *window.Start)
+		events = events.Where("timestamp >= ?", *window.Start)
+	}
+	
+	if withTotals {
+		var totalSessions, totalEvents, totalInteractions, activeUsers int64
+		sessions.Session(&gorm.Session{}).Count(&totalSessions)
+		sessions.Session(&gorm.Session{}).Distinct("user_id").Count(&activeUsers)
+		events.Session(&gorm.Session{}).Count(&totalEvents)
+		events.Session(&gorm.Session{}).Where("type LIKE 'interaction.%'").Count(&totalInteractions)
+		
+		metrics["total_sessions"] = float64(totalSessions)
+		metrics["total_events"] = float64(totalEvents)
+		metrics["total_interactions"] = float64(totalInteractions)
+		metrics["active_users"] = float64(activeUsers)
+		
+		if window.Start != nil {
+			if minutes := window.End.Sub(*window.Start).Minutes(); minutes > 0 {
+				metrics["events_per_minute"] = float64(totalEvents) / minutes
+			}
+		} else {
+			// Mesma definição do snapshot: média dos últimos 5 minutos
+			var events5min int64
+			s.db.Table("telemetry_events").
+				Where("app_id = ? AND timestamp >= ? AND timestamp < ?", appID, window.End.Add(-5*time.Minute), window.End).
+				Count(&events5min)
+			metrics["events_per_minute"] = float64(events5min) / 5.0
+		}
+	}
+	
+	// Calcular métricas derivadas (sobre as sessões da janela)
+	if total := metrics["total_sessions"]; total > 0 {
 		// Bounce rate (sessões < 30s / total)
 		var bounceSessions int64
-		s.db.Table("app_sessions").
-			Where("app_id = ? AND ended_at IS NOT NULL AND duration_ms < 30000", appID).
+		sessions.Session(&gorm.Session{}).
+			Where("ended_at IS NOT NULL AND duration_ms < 30000").
 			Count(&bounceSessions)
-		metrics["bounce_rate"] = float64(bounceSessions) / float64(snapshot.TotalSessions) * 100
+		metrics["bounce_rate"] = float64(bounceSessions) / total * 100
 		
 		// Match rate
 		var sessionsWithMatch int64
-		s.db.Table("app_sessions").
-			Where("app_id = ? AND interaction_count > 0", appID).
+		sessions.Session(&gorm.Session{}).
+			Where("interaction_count > 0").
 			Count(&sessionsWithMatch)
-		metrics["match_rate"] = float64(sessionsWithMatch) / float64(snapshot.TotalSessions) * 100
+		metrics["match_rate"] = float64(sessionsWithMatch) / total * 100
 	}
 	
-	// Retenção D1 (simplificado - média dos últimos 7 dias)
-	// TODO: Implementar cálculo real de retenção
-	metrics["retention_d1"] = 0
-	metrics["retention_d7"] = 0
+	// Retenção D1/D7 (média ponderada dos coortes da janela)
+	metrics["retention_d1"] = s.cohortRetention(appID, window.End, 1, window.RetentionCohorts)
+	metrics["retention_d7"] = s.cohortRetention(appID, window.End, 7, window.RetentionCohorts)
+}
+
+// cohortRetention retenção DN (%) ponderada dos últimos `cohorts` coortes diários
+// cujo dia N já terminou antes de `end`. Mesma definição de TelemetryService.GetRetention:
+// coorte = usuários com sessão iniciada no dia; retido = iniciou sessão N dias depois.
+func (s *RulesService) cohortRetention(appID uuid.UUID, end time.Time, dayN, cohorts int) float64 {
+	end = end.UTC()
+	today := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	
+	var cohortUsers, retainedUsers int64
+	for i := 0; i < cohorts; i++ {
+		// Coorte mais recente elegível: dia N terminou até hoje 00:00
+		cohortStart := today.AddDate(0, 0, -(dayN + 1 + i))
+		cohortEnd := cohortStart.Add(24 * time.Hour)
+		
+		var newUsers int64
+		s.db.Table("telemetry_sessions").
+			Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, cohortStart, cohortEnd).
+			Distinct("user_id").
+			Count(&newUsers)
+		if newUsers == 0 {
+			continue
+		}
+		
+		subQuery := s.db.Table("telemetry_sessions").
+			Select("DISTINCT user_id").
+			Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, cohortStart, cohortEnd)
+		
+		returnStart := cohortStart.AddDate(0, 0, dayN)
+		returnEnd := returnStart.Add(24 * time.Hour)
+		var retained int64
+		s.db.Table("telemetry_sessions").
+			Where("app_id = ? AND started_at >= ? AND started_at < ? AND user_id IN (?)", appID, returnStart, returnEnd, subQuery).
+			Distinct("user_id").
+			Count(&retained)
+		
+		cohortUsers += newUsers
+		retainedUsers += retained
+	}
 	
-	return metrics, nil
+	if cohortUsers == 0 {
+		return 0
+	}
+	return float64(retainedUsers) / float64(cohortUsers) * 100
 }
 
-// evaluateCondition avalia uma expressão de condição
-func (s *RulesService) evaluateCondition(condition string, metrics map[string]float64) (bool, error) {
-	if condition == "" {
+// evaluateCondition avalia uma expressão de condição (ver expression.go)
+func (s *RulesService) evaluateCondition(appID uuid.UUID, condition string, metrics map[string]float64, userID uuid.UUID) (bool, error) {
+	if strings.TrimSpace(condition) == "" {
 		return true, nil
 	}
 	
-	// Parser simples de condições
-	// Suporta: metric < value, metric > value, metric == value
-	// Suporta: AND, OR
-	
-	// Substituir métricas por valores
-	evaluated := condition
-	for name, value := range metrics {
-		evaluated = strings.ReplaceAll(evaluated, name, fmt.Sprintf("%f", value))
+	expr, err := ParseExpression(condition)
+	if err != nil {
+		return false, err
 	}
 	
-	// Avaliar expressão
-	return s.evalExpression(evaluated)
+	env := s.newExprEnv(appID, metrics, time.Now())
+	if userID != uuid.Nil && s.segmentResolver != nil {
+		env.InSegment = func(segment string) (bool, error) {
+			return s.segmentResolver(appID, userID, segment)
+		}
+	}
+	return expr.EvalBool(env)
 }
 
-// evalExpression avalia uma expressão booleana simples
-func (s *RulesService) evalExpression(expr string) (bool, error) {
-	expr = strings.TrimSpace(expr)
-	
-	// Tratar AND
-	if strings.Contains(expr, " AND ") {
-		parts := strings.Split(expr, " AND ")
-		for _, part := range parts {
-			result, err := s.evalExpression(part)
-			if err != nil {
-				return false, err
-			}
-			if !result {
-				return false, nil
-			}
-		}
-		return true, nil
+// newExprEnv monta o ambiente de avaliação com as métricas e o histórico até `at`
+func (s *RulesService) newExprEnv(appID uuid.UUID, metrics map[string]float64, at time.Time) *ExprEnv {
+	// Configs do app (config.<key>) + métricas
+	vars := s.configVars(appID)
+	for name, value := range metrics {
+		vars[name] = value
 	}
 	
-	// Tratar OR
-	if strings.Contains(expr, " OR ") {
-		parts := strings.Split(expr, " OR ")
-		for _, part := range parts {
-			result, err := s.evalExpression(part)
+	return &ExprEnv{
+		Vars: vars,
+		History: func(metric string, window time.Duration) ([]float64, error) {
+			series, err := s.getMetricHistory(appID, metric, at.Add(-window), at)
 			if err != nil {
-				return false, err
+				return nil, err
 			}
-			if result {
-				return true, nil
+			// Valor atual fecha a série
+			if current, ok := metrics[metric]; ok {
+				series = append(series, current)
 			}
-		}
-		return false, nil
+			return series, nil
+		},
 	}
-	
-	// Avaliar comparação simples
-	return s.evalComparison(expr)
 }
 
-// evalComparison avalia uma comparação simples (ex: "10.5 < 20")
-func (s *RulesService) evalComparison(expr string) (bool, error) {
-	// Regex para capturar: número operador número
-	re := regexp.MustCompile(`([\d.]+)\s*(<=|>=|<|>|==|!=)\s*([\d.]+)`)
-	matches := re.FindStringSubmatch(expr)
-	
-	if len(matches) != 4 {
-		return false, fmt.Errorf("invalid comparison: %s", expr)
-	}
-	
-	left, err := strconv.ParseFloat(matches[1], 64)
-	if err != nil {
-		return false, err
+// ========================================
+// HISTÓRICO DE MÉTRICAS
+// ========================================
+
+// metricSampleRetention quanto tempo manter amostras (cobre janelas de até 7d)
+const metricSampleRetention = 8 * 24 * time.Hour
+
+// metricSampleTick granularidade do claim de amostragem (intervalo do avaliador)
+const metricSampleTick = time.Minute
+
+// recordMetricSamples grava uma amostra por app com regras ativas.
+// Todas as réplicas rodam o ticker; só a que inserir a amostra do tick
+// atualiza os baselines, para o EWMA receber uma observação por tick.
+func (s *RulesService) recordMetricSamples() {
+	s.recordMetricSamplesAt(time.Now())
+}
+
+func (s *RulesService) recordMetricSamplesAt(now time.Time) {
+	var appIDs []uuid.UUID
+	s.db.Model(&Rule{}).Where("status = ?", RuleStatusActive).Distinct("app_id").Pluck("app_id", &appIDs)
+	
+	tick := now.UTC().Truncate(metricSampleTick)
+	for _, appID := range appIDs {
+		// Tick já amostrado por outra réplica: evita recalcular as métricas
+		var claimed int64
+		s.db.Model(&RuleMetricSample{}).Where("app_id = ? AND tick = ?", appID, tick).Count(&claimed)
+		if claimed > 0 {
+			continue
+		}
+		metrics, err := s.getAppMetrics(appID, MetricWindow{Period: "lifetime", End: now, RetentionCohorts: defaultRetentionCohorts})
+		if err != nil {
+			continue
+		}
+		data, err := json.Marshal(metrics)
+		if err != nil {
+			continue
+		}
+		result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&RuleMetricSample{
+			ID:        uuid.New(),
+			AppID:     appID,
+			Metrics:   string(data),
+			SampledAt: now,
+			Tick:      &tick,
+		})
+		if result.Error != nil || result.RowsAffected != 1 {
+			continue // Outra réplica ganhou o tick
+		}
+		s.updateAnomalyBaselines(appID, metrics, now)
 	}
-	
-	right, err := strconv.ParseFloat(matches[3], 64)
+}
+
+// getMetricHistory retorna a série de uma métrica na janela (ordem cronológica)
+func (s *RulesService) getMetricHistory(appID uuid.UUID, metric string, from, to time.Time) ([]float64, error) {
+	var samples []RuleMetricSample
+	err := s.db.Where("app_id = ? AND sampled_at >= ? AND sampled_at < ?", appID, from, to).
+		Order("sampled_at ASC").
+		Find(&samples).Error
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	
-	op := matches[2]
-	
-	switch op {
-	case "<":
-		return left < right, nil
-	case ">":
-		return left > right, nil
-	case "<=":
-		return left <= right, nil
-	case ">=":
-		return left >= right, nil
-	case "==":
-		return left == right, nil
-	case "!=":
-		return left != right, nil
-	default:
-		return false, fmt.Errorf("unknown operator: %s", op)
+	series := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		var values map[string]float64
+		if json.Unmarshal([]byte(sample.Metrics), &values) != nil {
+			continue
+		}
+		if v, ok := values[metric]; ok {
+			series = append(series, v)
+		}
 	}
+	return series, nil
 }
 
 // ========================================
 // EXECUÇÃO DE AÇÕES
 // ========================================
 
-func (s *RulesService) executeAction(rule *Rule, metrics map[string]float64) (map[string]interface{}, error) {
+func (s *RulesService) executeAction(rule *Rule, metrics map[string]float64, eval ruleEvaluation) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 	
 	// VALIDAÇÃO DE POLÍTICA - Antes de qualquer ação
-	validation := ValidateAction(rule.ActionType, rule.AppID, rule.ActionConfig)
+	validation := s.validateAction(rule)
 	
 	// SHADOW MODE - Se ativo, apenas registra sem executar
 	if IsShadowModeActive(rule.AppID, rule.ActionType) {
@@ -580,6 +908,42 @@ func (s *RulesService) executeAction(rule *Rule, metrics map[string]float64) (ma
 		}, fmt.Errorf("action blocked: %s", validation.Reason)
 	}
 	
+	// META-AÇÕES - Orçamento por app (evita cascatas e oscilação)
+	if isMetaAction(rule.ActionType) {
+		if err := checkMetaDepth(rule, eval); err != nil {
+			s.logBlockedAction(rule, err.Error())
+			return map[string]interface{}{
+				"blocked": true,
+				"reason":  err.Error(),
+			}, err
+		}
+		window, err := s.claimMetaBudget(rule.AppID)
+		if err != nil {
+			s.logBlockedAction(rule, err.Error())
+			return map[string]interface{}{
+				"blocked": true,
+				"reason":  err.Error(),
+			}, err
+		}
+		started := time.Now()
+		var metaResult map[string]interface{}
+		switch rule.ActionType {
+		case ActionAdjust:
+			metaResult, err = s.executeAdjustAction(rule, metrics)
+		case ActionCreateRule:
+			metaResult, err = s.executeCreateRuleAction(rule, metrics)
+		case ActionDisableRule:
+			metaResult, err = s.executeDisableRuleAction(rule, metrics)
+		}
+		if err != nil {
+			s.releaseMetaBudget(rule.AppID, window)
+			return metaResult, err
+		}
+		s.logMetaAction(rule, metaResult, started)
+		s.cascadeMetaAction(rule, metaResult, eval)
+		return metaResult, nil
+	}
+	
 	switch rule.ActionType {
 	case ActionAlert:
 		return s.executeAlertAction(rule, metrics)
@@ -589,14 +953,10 @@ func (s *RulesService) executeAction(rule *Rule, metrics map[string]float64) (ma
 		return s.executeFlagAction(rule, metrics)
 	case ActionNotify:
 		return s.executeNotifyAction(rule, metrics)
-	case ActionAdjust:
-		return s.executeAdjustAction(rule, metrics)
-	case ActionCreateRule:
-		return s.executeCreateRuleAction(rule, metrics)
-	case ActionDisableRule:
-		return s.executeDisableRuleAction(rule, metrics)
 	case ActionEscalate:
 		return s.executeEscalateAction(rule, metrics)
+	case ActionExperiment:
+		return s.executeExperimentAction(rule, metrics)
 	default:
 		return result, fmt.Errorf("unknown action type: %s", rule.ActionType)
 	}
@@ -632,8 +992,13 @@ func (s *RulesService) executeAlertAction(rule *Rule, metrics map[string]float64
 	if config.Severity == "" {
 		config.Severity = "warning"
 	}
+	anomaly := anomalyFromMetrics(rule, metrics)
 	if config.Message == "" {
 		config.Message = fmt.Sprintf("Regra '%s' disparada", rule.Name)
+		if anomaly != nil {
+			config.Message = fmt.Sprintf("Anomalia em %s: %.2f (esperado %.2f ± %.2f, z=%.1f)",
+				anomaly.Metric, anomaly.Value, anomaly.Expected, anomaly.StdDev, anomaly.ZScore)
+		}
 	}
 	
 	// Chamar callback se configurado
@@ -645,6 +1010,9 @@ func (s *RulesService) executeAlertAction(rule *Rule, metrics map[string]float64
 			"metrics":   metrics,
 			"severity":  config.Severity,
 		}
+		if anomaly != nil {
+			data["anomaly"] = anomaly
+		}
 		s.alertCallback(rule.AppID, config.AlertType, config.Message, data)
 	}
 	
@@ -909,6 +1277,10 @@ func (s *RulesService) executeCreateRuleAction(rule *Rule, metrics map[string]fl
 	}
 	ruleName = strings.ReplaceAll(ruleName, "{{timestamp}}", time.Now().Format("2006-01-02 15:04"))
 	
+	if err := ValidateCondition(condition); err != nil {
+		return nil, fmt.Errorf("invalid condition for new rule: %v", err)
+	}
+	
 	// Criar nova regra
 	newRule := Rule{
 		ID:              uuid.New(),
@@ -924,13 +1296,18 @@ func (s *RulesService) executeCreateRuleAction(rule *Rule, metrics map[string]fl
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 		CreatedBy:       rule.ID, // Regra pai
+		Depth:           rule.Depth + 1,
 	}
 	
 	if newRule.CooldownMinutes == 0 {
 		newRule.CooldownMinutes = 60
 	}
 	
-	if err := s.db.Create(&newRule).Error; err != nil {
+	if err := s.checkRuleDependencies(&newRule); err != nil {
+		return nil, err
+	}
+	
+	if err := s.createRuleWithVersion(&newRule, "created by rule "+rule.Name); err != nil {
 		return nil, fmt.Errorf("failed to create rule: %v", err)
 	}
 	
@@ -1067,6 +1444,11 @@ func (s *RulesService) GetAppRuleExecutions(appID uuid.UUID, limit int) ([]RuleE
 
 // TriggerByEvent dispara regras baseadas em evento
 func (s *RulesService) TriggerByEvent(appID uuid.UUID, eventType string, eventData map[string]interface{}) {
+	s.triggerByEvent(appID, uuid.Nil, eventType, eventData)
+}
+
+// triggerByEvent idem, com o usuário do evento para condições in_segment
+func (s *RulesService) triggerByEvent(appID, userID uuid.UUID, eventType string, eventData map[string]interface{}) {
 	var rules []Rule
 	s.db.Where("app_id = ? AND status = ? AND trigger_type = ?", appID, RuleStatusActive, TriggerEvent).Find(&rules)
 	
@@ -1081,19 +1463,24 @@ func (s *RulesService) TriggerByEvent(appID uuid.UUID, eventType string, eventDa
 			continue
 		}
 		
-		// Verificar filtros
-		match := true
-		for key, value := range config.Filters {
-			if eventData[key] != value {
-				match = false
-				break
-			}
+		if eventMatchesFilters(eventData, config.Filters) {
+			rule := rule
+			go s.evaluateRuleWithEvents(&rule, nil, userID)
 		}
-		
-		if match {
-			go s.evaluateRule(&rule)
+	}
+}
+
+// eventMatchesFilters filtros do trigger contra os dados do evento.
+// Usado pelo disparo real e pelo backtest: valores comparados como texto
+// (filtro "3" casa com o número 3), chave ausente nunca casa.
+func eventMatchesFilters(eventData map[string]interface{}, filters map[string]string) bool {
+	for key, value := range filters {
+		actual, ok := eventData[key]
+		if !ok || fmt.Sprint(actual) != value {
+			return false
 		}
 	}
+	return true
 }
 
 // ========================================
@@ -30,39 +30,42 @@ type ShadowMode struct {
 
 var globalShadowMode = &ShadowMode{}
 
-// ActivateShadowMode ativa o modo shadow
-func ActivateShadowMode(activatedBy, reason string, duration *time.Duration, appIDs []uuid.UUID, actionTypes []RuleActionType, domains []ActionDomain) {
-	globalShadowMode.mu.Lock()
-	defer globalShadowMode.mu.Unlock()
-	
-	now := time.Now()
-	globalShadowMode.active = true
-	globalShadowMode.activatedAt = &now
-	globalShadowMode.activatedBy = activatedBy
-	globalShadowMode.reason = reason
-	globalShadowMode.appIDs = appIDs
-	globalShadowMode.actionTypes = actionTypes
-	globalShadowMode.domains = domains
-	
-	if duration != nil {
-		expiresAt := now.Add(*duration)
-		globalShadowMode.expiresAt = &expiresAt
-	}
+// ShadowModeFilters filtros do shadow mode (persistidos em RulesControl.Filters)
+type ShadowModeFilters struct {
+	AppIDs      []uuid.UUID      `json:"app_ids,omitempty"`
+	ActionTypes []RuleActionType `json:"action_types,omitempty"`
+	Domains     []ActionDomain   `json:"domains,omitempty"`
 }
 
-// DeactivateShadowMode desativa o modo shadow
-func DeactivateShadowMode() {
+// setShadowModeCache aplica o controle persistido ao cache (nil = desativado)
+func setShadowModeCache(control *RulesControl) {
 	globalShadowMode.mu.Lock()
 	defer globalShadowMode.mu.Unlock()
 	
-	globalShadowMode.active = false
-	globalShadowMode.activatedAt = nil
-	globalShadowMode.activatedBy = ""
-	globalShadowMode.reason = ""
-	globalShadowMode.expiresAt = nil
-	globalShadowMode.appIDs = nil
-	globalShadowMode.actionTypes = nil
-	globalShadowMode.domains = nil
+	if control == nil {
+		globalShadowMode.active = false
+		globalShadowMode.activatedAt = nil
+		globalShadowMode.activatedBy = ""
+		globalShadowMode.reason = ""
+		globalShadowMode.expiresAt = nil
+		globalShadowMode.appIDs = nil
+		globalShadowMode.actionTypes = nil
+		globalShadowMode.domains = nil
+		return
+	}
+	
+	var filters ShadowModeFilters
+	json.Unmarshal([]byte(control.Filters), &filters)
+	
+	activatedAt := control.ActivatedAt
+	globalShadowMode.active = true
+	globalShadowMode.activatedAt = &activatedAt
+	globalShadowMode.activatedBy = control.ActivatedBy
+	globalShadowMode.reason = control.Reason
+	globalShadowMode.expiresAt = control.ExpiresAt
+	globalShadowMode.appIDs = filters.AppIDs
+	globalShadowMode.actionTypes = filters.ActionTypes
+	globalShadowMode.domains = filters.Domains
 }
 
 // IsShadowModeActive verifica se shadow mode está ativo para uma ação específica
@@ -0,0 +1,248 @@
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// VERSIONAMENTO DE REGRAS - Histórico imutável
+// "Qual versão da condição disparou esta execução?"
+// ========================================
+
+var (
+	ErrRuleNotFound        = errors.New("rule not found")
+	ErrRuleVersionNotFound = errors.New("rule version not found")
+)
+
+// RuleDefinition campos que definem o comportamento da regra.
+// Status, contadores e depth são estado de execução e não entram na versão.
+type RuleDefinition struct {
+	Name            string          `json:"name" yaml:"name"`
+	Description     string          `json:"description,omitempty" yaml:"description,omitempty"`
+	Priority        int             `json:"priority" yaml:"priority"`
+	TriggerType     RuleTriggerType `json:"trigger_type" yaml:"trigger_type"`
+	TriggerConfig   string          `json:"trigger_config,omitempty" yaml:"trigger_config,omitempty"`
+	Condition       string          `json:"condition,omitempty" yaml:"condition,omitempty"`
+	ActionType      RuleActionType  `json:"action_type" yaml:"action_type"`
+	ActionConfig    string          `json:"action_config,omitempty" yaml:"action_config,omitempty"`
+	CooldownMinutes int             `json:"cooldown_minutes" yaml:"cooldown_minutes"`
+}
+
+// RuleFieldChange alteração de um campo entre duas versões
+type RuleFieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// RuleVersion versão imutável de uma regra
+type RuleVersion struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	RuleID     uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_rule_version" json:"rule_id"`
+	AppID      uuid.UUID `gorm:"type:uuid;index" json:"app_id"`
+	Version    int       `gorm:"uniqueIndex:idx_rule_version" json:"version"`
+	Definition string    `gorm:"type:text" json:"definition"` // JSON RuleDefinition
+	Changes    string    `gorm:"type:text" json:"changes"`    // JSON []RuleFieldChange em relação à versão anterior
+	ChangedBy  uuid.UUID `gorm:"type:uuid" json:"changed_by"` // Usuário (ou regra pai, para meta-regras)
+	Reason     string    `gorm:"size:500" json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (RuleVersion) TableName() string {
+	return "rule_versions"
+}
+
+// ParsedDefinition decodifica a definição salva
+func (v *RuleVersion) ParsedDefinition() (RuleDefinition, error) {
+	var def RuleDefinition
+	err := json.Unmarshal([]byte(v.Definition), &def)
+	return def, err
+}
+
+// ruleDefinitionOf extrai a definição de uma regra
+func ruleDefinitionOf(rule *Rule) RuleDefinition {
+	return RuleDefinition{
+		Name:            rule.Name,
+		Description:     rule.Description,
+		Priority:        rule.Priority,
+		TriggerType:     rule.TriggerType,
+		TriggerConfig:   rule.TriggerConfig,
+		Condition:       rule.Condition,
+		ActionType:      rule.ActionType,
+		ActionConfig:    rule.ActionConfig,
+		CooldownMinutes: rule.CooldownMinutes,
+	}
+}
+
+// applyTo copia a definição para a regra
+func (d RuleDefinition) applyTo(rule *Rule) {
+	rule.Name = d.Name
+	rule.Description = d.Description
+	rule.Priority = d.Priority
+	rule.TriggerType = d.TriggerType
+	rule.TriggerConfig = d.TriggerConfig
+	rule.Condition = d.Condition
+	rule.ActionType = d.ActionType
+	rule.ActionConfig = d.ActionConfig
+	rule.CooldownMinutes = d.CooldownMinutes
+}
+
+// diffDefinitions campos alterados de `from` para `to`
+func diffDefinitions(from, to RuleDefinition) []RuleFieldChange {
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"name", from.Name, to.Name},
+		{"description", from.Description, to.Description},
+		{"priority", strconv.Itoa(from.Priority), strconv.Itoa(to.Priority)},
+		{"trigger_type", string(from.TriggerType), string(to.TriggerType)},
+		{"trigger_config", from.TriggerConfig, to.TriggerConfig},
+		{"condition", from.Condition, to.Condition},
+		{"action_type", string(from.ActionType), string(to.ActionType)},
+		{"action_config", from.ActionConfig, to.ActionConfig},
+		{"cooldown_minutes", strconv.Itoa(from.CooldownMinutes), strconv.Itoa(to.CooldownMinutes)},
+	}
+
+	changes := []RuleFieldChange{}
+	for _, f := range fields {
+		if f.from != f.to {
+			changes = append(changes, RuleFieldChange{Field: f.name, From: f.from, To: f.to})
+		}
+	}
+	return changes
+}
+
+// createRuleVersion grava a versão atual da regra (rule.Version)
+func createRuleVersion(tx *gorm.DB, rule *Rule, changes []RuleFieldChange, changedBy uuid.UUID, reason string) error {
+	def, err := json.Marshal(ruleDefinitionOf(rule))
+	if err != nil {
+		return err
+	}
+	if changes == nil {
+		changes = []RuleFieldChange{}
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&RuleVersion{
+		ID:         uuid.New(),
+		RuleID:     rule.ID,
+		AppID:      rule.AppID,
+		Version:    rule.Version,
+		Definition: string(def),
+		Changes:    string(diff),
+		ChangedBy:  changedBy,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}).Error
+}
+
+// createRuleWithVersion insere a regra e sua versão 1
+func (s *RulesService) createRuleWithVersion(rule *Rule, reason string) error {
+	rule.Version = 1
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+		return createRuleVersion(tx, rule, nil, rule.CreatedBy, reason)
+	})
+}
+
+// ensureBaselineVersion regras anteriores ao versionamento (ex: seeds) ganham
+// a versão atual como base antes da primeira edição
+func (s *RulesService) ensureBaselineVersion(tx *gorm.DB, rule *Rule) error {
+	var count int64
+	if err := tx.Model(&RuleVersion{}).Where("rule_id = ? AND version = ?", rule.ID, rule.Version).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if rule.Version == 0 {
+		rule.Version = 1
+	}
+	return createRuleVersion(tx, rule, nil, rule.CreatedBy, "baseline")
+}
+
+// ========================================
+// CONSULTA
+// ========================================
+
+// GetRuleVersions lista as versões de uma regra (mais recente primeiro)
+func (s *RulesService) GetRuleVersions(ruleID uuid.UUID) ([]RuleVersion, error) {
+	var versions []RuleVersion
+	err := s.db.Where("rule_id = ?", ruleID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetRuleVersion busca uma versão específica
+func (s *RulesService) GetRuleVersion(ruleID uuid.UUID, version int) (*RuleVersion, error) {
+	var v RuleVersion
+	err := s.db.Where("rule_id = ? AND version = ?", ruleID, version).First(&v).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: rule %s v%d", ErrRuleVersionNotFound, ruleID, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DiffRuleVersions campos alterados entre duas versões
+func (s *RulesService) DiffRuleVersions(ruleID uuid.UUID, from, to int) ([]RuleFieldChange, error) {
+	defs := make([]RuleDefinition, 2)
+	for i, version := range []int{from, to} {
+		v, err := s.GetRuleVersion(ruleID, version)
+		if err != nil {
+			return nil, err
+		}
+		if defs[i], err = v.ParsedDefinition(); err != nil {
+			return nil, err
+		}
+	}
+	return diffDefinitions(defs[0], defs[1]), nil
+}
+
+// ========================================
+// ROLLBACK
+// ========================================
+
+// RollbackRule restaura a definição de uma versão anterior.
+// O rollback é uma nova versão: o histórico nunca é reescrito.
+func (s *RulesService) RollbackRule(ruleID uuid.UUID, version int, changedBy uuid.UUID, reason string) (*Rule, error) {
+	current, err := s.GetRule(ruleID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := s.GetRuleVersion(ruleID, version)
+	if err != nil {
+		return nil, err
+	}
+	def, err := target.ParsedDefinition()
+	if err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("rollback to v%d", version)
+	}
+	rule := *current
+	def.applyTo(&rule)
+	if err := s.UpdateRule(&rule, changedBy, reason); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
@@ -0,0 +1,211 @@
+package rules
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// VERSÕES, ROLLBACK E EXPORT/IMPORT - Handlers
+// ========================================
+
+// GetRuleVersions lista o histórico de versões de uma regra
+// GET /api/v1/admin/rules/:id/versions
+func (h *RulesHandler) GetRuleVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	rule, err := h.service.GetRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Regra não encontrada"})
+		return
+	}
+
+	versions, err := h.service.GetRuleVersions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"current_version": rule.Version,
+		"versions":        versions,
+		"total":           len(versions),
+	})
+}
+
+// GetRuleVersion busca uma versão específica
+// GET /api/v1/admin/rules/:id/versions/:version
+func (h *RulesHandler) GetRuleVersion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Versão inválida"})
+		return
+	}
+
+	v, err := h.service.GetRuleVersion(id, version)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+	def, _ := v.ParsedDefinition()
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":    v,
+		"definition": def,
+	})
+}
+
+// DiffRuleVersions compara duas versões (to vazio = versão atual)
+// GET /api/v1/admin/rules/:id/diff?from=1&to=3
+func (h *RulesHandler) DiffRuleVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro from inválido"})
+		return
+	}
+
+	to := 0
+	if toStr := c.Query("to"); toStr != "" {
+		if to, err = strconv.Atoi(toStr); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parâmetro to inválido"})
+			return
+		}
+	} else {
+		rule, err := h.service.GetRule(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Regra não encontrada"})
+			return
+		}
+		to = rule.Version
+	}
+
+	changes, err := h.service.DiffRuleVersions(id, from, to)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"changes": changes,
+	})
+}
+
+// RollbackRule restaura uma versão anterior (gera nova versão)
+// POST /api/v1/admin/rules/:id/rollback
+func (h *RulesHandler) RollbackRule(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return
+	}
+
+	var req struct {
+		Version int    `json:"version" binding:"required"`
+		Reason  string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.RollbackRule(id, req.Version, contextUserID(c), req.Reason)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Regra restaurada",
+		"restored_from": req.Version,
+		"rule":          rule,
+	})
+}
+
+// ExportRules exporta as regras do app em JSON ou YAML
+// GET /api/v1/admin/rules/app/:appId/export?format=yaml
+func (h *RulesHandler) ExportRules(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	bundle, err := h.service.ExportRules(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := strings.ToLower(c.DefaultQuery("format", BundleFormatJSON))
+	data, err := MarshalRuleBundle(bundle, format)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	contentType := "application/json"
+	if format != BundleFormatJSON {
+		format = BundleFormatYAML
+		contentType = "application/yaml"
+	}
+	c.Header("Content-Disposition", "attachment; filename=rules-"+appID.String()+"."+format)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportRules importa regras (JSON ou YAML) para o app
+// POST /api/v1/admin/rules/app/:appId/import?format=yaml&dry_run=true&reason=...
+func (h *RulesHandler) ImportRules(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("appId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Formato: query ou Content-Type
+	format := strings.ToLower(c.Query("format"))
+	if format == "" && strings.Contains(c.ContentType(), "yaml") {
+		format = BundleFormatYAML
+	}
+
+	bundle, err := UnmarshalRuleBundle(data, format)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+	result, err := h.service.ImportRules(appID, bundle, contextUserID(c), c.Query("reason"), dryRun)
+	if err != nil {
+		respondRuleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
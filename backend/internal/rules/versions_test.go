@@ -0,0 +1,159 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Versionamento e export/import
+// ========================================
+
+func TestRuleVersionsAndRollback(t *testing.T) {
+	s := newTestRulesService(t)
+	author := uuid.New()
+
+	rule := &Rule{
+		AppID:       uuid.New(),
+		Name:        "pico",
+		TriggerType: TriggerThreshold,
+		Condition:   "online_now > 100",
+		ActionType:  ActionAlert,
+		CreatedBy:   author,
+	}
+	if err := s.CreateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	edit := *rule
+	edit.Condition = "online_now > 200"
+	if err := s.UpdateRule(&edit, author, "menos ruído"); err != nil {
+		t.Fatal(err)
+	}
+	if edit.Version != 2 {
+		t.Fatalf("versão esperada 2, obtida %d", edit.Version)
+	}
+
+	// Sem mudança de definição não gera versão
+	same := edit
+	if err := s.UpdateRule(&same, author, ""); err != nil || same.Version != 2 {
+		t.Fatalf("update sem mudança não deveria versionar: v%d, %v", same.Version, err)
+	}
+
+	changes, err := s.DiffRuleVersions(rule.ID, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Field != "condition" || changes[0].To != "online_now > 200" {
+		t.Errorf("diff inesperado: %+v", changes)
+	}
+
+	restored, err := s.RollbackRule(rule.ID, 1, author, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Version != 3 || restored.Condition != "online_now > 100" {
+		t.Errorf("rollback inesperado: v%d %q", restored.Version, restored.Condition)
+	}
+
+	versions, _ := s.GetRuleVersions(rule.ID)
+	if len(versions) != 3 || versions[0].Reason != "rollback to v1" || versions[1].Reason != "menos ruído" {
+		t.Errorf("histórico inesperado: %+v", versions)
+	}
+
+	if _, err := s.RollbackRule(rule.ID, 9, author, ""); err == nil {
+		t.Error("versão inexistente deveria falhar")
+	}
+}
+
+func TestRuleExportImport(t *testing.T) {
+	s := newTestRulesService(t)
+	staging, prod := uuid.New(), uuid.New()
+
+	for _, name := range []string{"a", "b"} {
+		if err := s.CreateRule(&Rule{
+			AppID:       staging,
+			Name:        name,
+			Status:      RuleStatusActive,
+			TriggerType: TriggerMetric,
+			Condition:   "total_users > 10",
+			ActionType:  ActionAlert,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle, err := s.ExportRules(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalRuleBundle(bundle, BundleFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := UnmarshalRuleBundle(data, BundleFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dry-run não grava
+	result, err := s.ImportRules(prod, parsed, uuid.Nil, "", true)
+	if err != nil || len(result.Created) != 2 {
+		t.Fatalf("dry-run inesperado: %+v, %v", result, err)
+	}
+	if rules, _ := s.GetRulesByApp(prod); len(rules) != 0 {
+		t.Fatal("dry-run não deveria criar regras")
+	}
+
+	if _, err := s.ImportRules(prod, parsed, uuid.Nil, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reimport com uma mudança: 1 atualizada, 1 inalterada
+	parsed.Rules[0].Condition = "total_users > 20"
+	result, err = s.ImportRules(prod, parsed, uuid.Nil, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Updated) != 1 || len(result.Unchanged) != 1 || result.Updated[0].Version != 2 {
+		t.Errorf("reimport inesperado: %+v", result)
+	}
+
+	parsed.Rules[1].Name = parsed.Rules[0].Name
+	if _, err := s.ImportRules(prod, parsed, uuid.Nil, "", false); err == nil {
+		t.Error("nomes duplicados deveriam falhar")
+	}
+
+	// Espaços no nome não criam uma regra duplicada
+	parsed.Rules[1].Name = " " + parsed.Rules[0].Name + " "
+	if _, err := s.ImportRules(prod, parsed, uuid.Nil, "", false); err == nil {
+		t.Error("nomes iguais após normalização deveriam falhar")
+	}
+	parsed.Rules = parsed.Rules[:1]
+	parsed.Rules[0].Name = " " + parsed.Rules[0].Name
+	result, err = s.ImportRules(prod, parsed, uuid.Nil, "", false)
+	if err != nil || len(result.Unchanged) != 1 || len(result.Created) != 0 {
+		t.Errorf("nome com espaços deveria casar com a regra existente: %+v, %v", result, err)
+	}
+}
+
+func TestRuleImportIsAtomic(t *testing.T) {
+	s := newTestRulesService(t)
+	appID := uuid.New()
+
+	// A segunda regra fecha um ciclo com a primeira: nenhuma deve ser gravada
+	bundle := &RuleBundle{Format: ruleBundleFormat, Rules: []RuleBundleEntry{
+		{RuleDefinition: RuleDefinition{Name: "reduz-ads", TriggerType: TriggerMetric, Condition: "online_now > 1",
+			ActionType: ActionAdjust, ActionConfig: `{"config_key":"ads_frequency","config_value":"2"}`}},
+		{RuleDefinition: RuleDefinition{Name: "para-ajuste", TriggerType: TriggerMetric, Condition: "config.ads_frequency < 3",
+			ActionType: ActionDisableRule, ActionConfig: `{"target_rule_name":"reduz-ads"}`}},
+	}}
+	if _, err := s.ImportRules(appID, bundle, uuid.Nil, "", false); !errors.Is(err, ErrRuleCycle) {
+		t.Fatalf("esperado erro de ciclo, obtido %v", err)
+	}
+	if rules, _ := s.GetRulesByApp(appID); len(rules) != 0 {
+		t.Errorf("import com falha não deveria gravar regras, encontradas %d", len(rules))
+	}
+}
@@ -0,0 +1,225 @@
+package telemetry
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// COHORTS - Matriz de retenção (coorte × período N)
+// ========================================
+
+// Critério da coorte
+const (
+	CohortByFirstSeen = "first_seen" // Primeira sessão no app
+	CohortBySignup    = "signup"     // Criação do usuário implícito
+)
+
+// Granularidade das coortes e dos períodos de retorno
+const (
+	CohortDaily  = "day"
+	CohortWeekly = "week"
+)
+
+const (
+	CohortDefaultDays  = 14
+	CohortMaxDays      = 90
+	CohortDefaultWeeks = 8
+	CohortMaxWeeks     = 26
+)
+
+// CohortQuery parâmetros da matriz
+type CohortQuery struct {
+	CohortBy    string     // first_seen (padrão) ou signup
+	Granularity string     // day (padrão) ou week
+	Periods     int        // Quantidade de coortes (e de colunas N)
+	SegmentID   *uuid.UUID // Restringe a um segmento (opcional)
+}
+
+// CohortRow linha da matriz: Retained[N] = usuários ativos no período N
+type CohortRow struct {
+	Cohort   string    `json:"cohort"` // YYYY-MM-DD do início do período
+	Users    int64     `json:"users"`
+	Retained []int64   `json:"retained"`
+	Rates    []float64 `json:"rates"` // % de Users
+}
+
+// CohortMatrix matriz triangular (períodos futuros ficam de fora)
+type CohortMatrix struct {
+	CohortBy    string      `json:"cohort_by"`
+	Granularity string      `json:"granularity"`
+	Periods     int         `json:"periods"`
+	SegmentID   *uuid.UUID  `json:"segment_id,omitempty"`
+	Cohorts     []CohortRow `json:"cohorts"`
+}
+
+// normalize aplica padrões e limites
+func (q *CohortQuery) normalize() error {
+	if q.CohortBy == "" {
+		q.CohortBy = CohortByFirstSeen
+	}
+	if q.CohortBy != CohortByFirstSeen && q.CohortBy != CohortBySignup {
+		return fmt.Errorf("cohort_by deve ser %q ou %q", CohortByFirstSeen, CohortBySignup)
+	}
+	if q.Granularity == "" {
+		q.Granularity = CohortDaily
+	}
+	switch q.Granularity {
+	case CohortDaily:
+		if q.Periods <= 0 || q.Periods > CohortMaxDays {
+			q.Periods = CohortDefaultDays
+		}
+	case CohortWeekly:
+		if q.Periods <= 0 || q.Periods > CohortMaxWeeks {
+			q.Periods = CohortDefaultWeeks
+		}
+	default:
+		return fmt.Errorf("granularity deve ser %q ou %q", CohortDaily, CohortWeekly)
+	}
+	return nil
+}
+
+// periodStart início (UTC) do dia ou da semana (segunda-feira) de t
+func (q *CohortQuery) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if q.Granularity == CohortWeekly {
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// offset períodos inteiros entre dois inícios de período
+func (q *CohortQuery) offset(from, to time.Time) int {
+	days := int(to.Sub(from).Hours() / 24)
+	if q.Granularity == CohortWeekly {
+		return days / 7
+	}
+	return days
+}
+
+// GetCohortMatrix retenção por coorte: cada linha é uma coorte (dia/semana de
+// entrada) e a coluna N conta quem teve sessão no N-ésimo período seguinte.
+func (s *TelemetryService) GetCohortMatrix(appID uuid.UUID, query CohortQuery) (*CohortMatrix, error) {
+	if err := query.normalize(); err != nil {
+		return nil, err
+	}
+	members, err := s.segmentMembers(appID, query.SegmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	current := query.periodStart(now)
+	rangeStart := current.AddDate(0, 0, -(query.Periods - 1))
+	if query.Granularity == CohortWeekly {
+		rangeStart = current.AddDate(0, 0, -7*(query.Periods-1))
+	}
+
+	// Coorte de cada usuário: início do período de entrada
+	var cohortUsers *gorm.DB
+	entered := make(map[uuid.UUID]time.Time)
+	if query.CohortBy == CohortBySignup {
+		var users []struct {
+			ID        uuid.UUID
+			CreatedAt time.Time
+		}
+		usersQuery := s.db.Table("implicit_users").Where("app_id = ? AND created_at >= ?", appID, rangeStart)
+		if members != nil {
+			usersQuery = usersQuery.Where("id IN (?)", members)
+		}
+		if err := usersQuery.Select("id, created_at").Scan(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			entered[user.ID] = query.periodStart(user.CreatedAt)
+		}
+		cohortUsers = s.db.Table("implicit_users").Select("id").Where("app_id = ? AND created_at >= ?", appID, rangeStart)
+	} else {
+		// Primeira sessão dentro do intervalo = nenhuma sessão antes dele
+		cohortUsers = s.db.Model(&AppSession{}).Select("user_id").
+			Where("app_id = ?", appID).Scopes(inSegment(members)).
+			Group("user_id").Having("MIN(started_at) >= ?", rangeStart)
+	}
+
+	var sessions []AppSession
+	err = s.db.Model(&AppSession{}).Select("user_id, started_at").
+		Where("app_id = ? AND started_at >= ? AND user_id IN (?)", appID, rangeStart, cohortUsers).
+		Order("started_at").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Períodos ativos de cada usuário
+	active := make(map[uuid.UUID]map[int]bool)
+	for _, session := range sessions {
+		if query.CohortBy == CohortByFirstSeen {
+			if _, ok := entered[session.UserID]; !ok {
+				entered[session.UserID] = query.periodStart(session.StartedAt) // Ordenado: a 1ª é a de entrada
+			}
+		}
+		cohort, ok := entered[session.UserID]
+		if !ok {
+			continue
+		}
+		n := query.offset(cohort, query.periodStart(session.StartedAt))
+		if n < 0 {
+			continue
+		}
+		if active[session.UserID] == nil {
+			active[session.UserID] = make(map[int]bool)
+		}
+		active[session.UserID][n] = true
+	}
+
+	// Linhas: uma por período de entrada, colunas até o período atual
+	rows := make(map[string]*CohortRow, query.Periods)
+	matrix := &CohortMatrix{
+		CohortBy:    query.CohortBy,
+		Granularity: query.Granularity,
+		Periods:     query.Periods,
+		SegmentID:   query.SegmentID,
+	}
+	for i := 0; i < query.Periods; i++ {
+		start := rangeStart.AddDate(0, 0, i)
+		if query.Granularity == CohortWeekly {
+			start = rangeStart.AddDate(0, 0, 7*i)
+		}
+		columns := query.offset(start, current) + 1
+		matrix.Cohorts = append(matrix.Cohorts, CohortRow{
+			Cohort:   start.Format("2006-01-02"),
+			Retained: make([]int64, columns),
+			Rates:    make([]float64, columns),
+		})
+	}
+	for i := range matrix.Cohorts {
+		rows[matrix.Cohorts[i].Cohort] = &matrix.Cohorts[i]
+	}
+
+	for userID, cohort := range entered {
+		row, ok := rows[cohort.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		row.Users++
+		for n := range active[userID] {
+			if n < len(row.Retained) {
+				row.Retained[n]++
+			}
+		}
+	}
+	for i := range matrix.Cohorts {
+		row := &matrix.Cohorts[i]
+		if row.Users == 0 {
+			continue
+		}
+		for n, retained := range row.Retained {
+			row.Rates[n] = float64(retained) / float64(row.Users) * 100
+		}
+	}
+	return matrix, nil
+}
@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// FUNNEL HANDLERS - CRUD e relatório
+// ========================================
+
+// funnelRequest payload de criação/atualização
+type funnelRequest struct {
+	Name          string                 `json:"name" binding:"required"`
+	Description   string                 `json:"description"`
+	Steps         []FunnelStepDefinition `json:"steps" binding:"required"`
+	WindowSeconds int64                  `json:"window_seconds"`
+	Ordering      string                 `json:"ordering"`
+}
+
+func (r *funnelRequest) definition() *FunnelDefinition {
+	return &FunnelDefinition{
+		Name:          r.Name,
+		Description:   r.Description,
+		Steps:         r.Steps,
+		WindowSeconds: r.WindowSeconds,
+		Ordering:      r.Ordering,
+	}
+}
+
+// funnelError mapeia erros do serviço para status HTTP
+func funnelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrFunnelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Funil não encontrado"})
+	case errors.Is(err, ErrInvalidFunnel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListFunnels lista os funis de um app
+// GET /api/v1/admin/telemetry/apps/:id/funnels
+func (h *TelemetryHandler) ListFunnels(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	funnels, err := h.service.ListFunnels(appID)
+	if err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"funnels": funnels, "total": len(funnels)})
+}
+
+// CreateFunnel cria um funil para o app
+// POST /api/v1/admin/telemetry/apps/:id/funnels
+func (h *TelemetryHandler) CreateFunnel(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	var req funnelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	funnel := req.definition()
+	funnel.AppID = appID
+	funnel.CreatedBy = c.GetString("userID")
+	if err := h.service.CreateFunnel(funnel); err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, funnel)
+}
+
+// GetFunnelDefinition retorna um funil
+// GET /api/v1/admin/telemetry/funnels/:funnelId
+func (h *TelemetryHandler) GetFunnelDefinition(c *gin.Context) {
+	funnelID, err := uuid.Parse(c.Param("funnelId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Funnel ID inválido"})
+		return
+	}
+
+	funnel, err := h.service.GetFunnelDefinition(funnelID)
+	if err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, funnel)
+}
+
+// UpdateFunnel substitui a definição de um funil
+// PUT /api/v1/admin/telemetry/funnels/:funnelId
+func (h *TelemetryHandler) UpdateFunnel(c *gin.Context) {
+	funnelID, err := uuid.Parse(c.Param("funnelId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Funnel ID inválido"})
+		return
+	}
+
+	var req funnelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	funnel, err := h.service.UpdateFunnel(funnelID, req.definition())
+	if err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, funnel)
+}
+
+// DeleteFunnel remove um funil
+// DELETE /api/v1/admin/telemetry/funnels/:funnelId
+func (h *TelemetryHandler) DeleteFunnel(c *gin.Context) {
+	funnelID, err := uuid.Parse(c.Param("funnelId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Funnel ID inválido"})
+		return
+	}
+
+	if err := h.service.DeleteFunnel(funnelID); err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Funil removido"})
+}
+
+// GetFunnelReport calcula o funil
+// GET /api/v1/admin/telemetry/funnels/:funnelId/report?since=168h
+func (h *TelemetryHandler) GetFunnelReport(c *gin.Context) {
+	funnelID, err := uuid.Parse(c.Param("funnelId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Funnel ID inválido"})
+		return
+	}
+
+	since := 24 * time.Hour
+	if s := c.Query("since"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			since = d
+		}
+	}
+
+	funnel, err := h.service.GetFunnelDefinition(funnelID)
+	if err != nil {
+		funnelError(c, err)
+		return
+	}
+	report, err := h.service.ComputeFunnel(funnel, since)
+	if err != nil {
+		funnelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,596 @@
+package telemetry
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// FUNNELS - Funis configuráveis por app
+// "O app define a jornada; o kernel mede quem chega"
+// ========================================
+
+// Ordenação dos passos
+const (
+	FunnelOrderLoose  = "loose"  // Em ordem, com outros eventos no meio
+	FunnelOrderStrict = "strict" // Em ordem, sem outros eventos entre os passos
+)
+
+const (
+	FunnelMinSteps      = 2
+	FunnelMaxSteps      = 20
+	FunnelDefaultWindow = 24 * time.Hour
+	FunnelMaxWindow     = 90 * 24 * time.Hour
+)
+
+var (
+	ErrFunnelNotFound = errors.New("funnel not found")
+	ErrInvalidFunnel  = errors.New("invalid funnel definition")
+)
+
+// Heartbeats não quebram a sequência de um funil strict
+var funnelIgnoredTypes = map[string]bool{
+	EventSessionPing:  true,
+	EventPresencePing: true,
+}
+
+// FunnelFilter filtro de propriedade de um passo.
+// Property: feature, target_id, target_type, context.<campo> ou metadata.<campo>
+type FunnelFilter struct {
+	Property string      `json:"property"`
+	Operator string      `json:"operator"` // ==, !=, >, >=, <, <=, contains, exists
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// FunnelStepDefinition passo do funil: tipo de evento + filtros opcionais
+type FunnelStepDefinition struct {
+	Name      string         `json:"name"`
+	EventType string         `json:"event_type"`
+	Filters   []FunnelFilter `json:"filters,omitempty"`
+}
+
+// FunnelStepList lista de passos (JSON)
+type FunnelStepList []FunnelStepDefinition
+
+func (l FunnelStepList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *FunnelStepList) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		*l = FunnelStepList{}
+		return nil
+	}
+	return json.Unmarshal(b, l)
+}
+
+// FunnelDefinition funil salvo de um app
+type FunnelDefinition struct {
+	ID            uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID         uuid.UUID      `gorm:"type:uuid;index" json:"app_id"`
+	Name          string         `gorm:"size:100;not null" json:"name"`
+	Description   string         `gorm:"size:500" json:"description,omitempty"`
+	Steps         FunnelStepList `gorm:"type:text" json:"steps"`
+	WindowSeconds int64          `gorm:"not null" json:"window_seconds"` // Janela de conversão a partir do 1º passo
+	Ordering      string         `gorm:"size:10;not null;default:'loose'" json:"ordering"`
+	CreatedBy     string         `gorm:"size:100" json:"created_by,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+func (FunnelDefinition) TableName() string {
+	return "telemetry_funnels"
+}
+
+// Window janela de conversão
+func (f *FunnelDefinition) Window() time.Duration {
+	return time.Duration(f.WindowSeconds) * time.Second
+}
+
+// FunnelTiming percentis do tempo de conversão desde o passo anterior (ms)
+type FunnelTiming struct {
+	P50 int64 `json:"p50_ms"`
+	P90 int64 `json:"p90_ms"`
+	P95 int64 `json:"p95_ms"`
+}
+
+// FunnelReport resultado de um funil
+type FunnelReport struct {
+	FunnelID uuid.UUID    `json:"funnel_id"`
+	Name     string       `json:"name"`
+	Ordering string       `json:"ordering"`
+	Window   string       `json:"window"`
+	Since    string       `json:"since"`
+	Steps    []FunnelStep `json:"steps"`
+}
+
+// defaultFunnel funil de matchmaking que o endpoint /funnel calculava antes dos funis
+// configuráveis. ID derivado do app: o seed é idempotente entre réplicas.
+func defaultFunnel(appID uuid.UUID) *FunnelDefinition {
+	return &FunnelDefinition{
+		ID:          uuid.NewSHA1(appID, []byte("default-funnel")),
+		AppID:       appID,
+		Name:        "Matchmaking",
+		Description: "Funil padrão: sessão → fila → match → mensagem → match de mais de 1 minuto",
+		Steps: FunnelStepList{
+			{Name: "Sessão Iniciada", EventType: EventSessionStart},
+			{Name: "Entrou na Fila", EventType: EventInteractionQueueJoined},
+			{Name: "Match Criado", EventType: EventInteractionMatchCreated},
+			{Name: "Mensagem Enviada", EventType: EventInteractionMessageSent},
+			{Name: "Match Completo (>1min)", EventType: EventInteractionMatchEnded,
+				Filters: []FunnelFilter{{Property: "metadata.duration_ms", Operator: ">", Value: 60000}}},
+		},
+		WindowSeconds: int64(FunnelDefaultWindow.Seconds()),
+		Ordering:      FunnelOrderLoose,
+		CreatedBy:     "system",
+	}
+}
+
+// ========================================
+// CRUD
+// ========================================
+
+// validateFunnel normaliza e valida a definição
+func validateFunnel(f *FunnelDefinition) error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return fmt.Errorf("%w: nome obrigatório", ErrInvalidFunnel)
+	}
+	if len(f.Steps) < FunnelMinSteps || len(f.Steps) > FunnelMaxSteps {
+		return fmt.Errorf("%w: o funil precisa de %d a %d passos", ErrInvalidFunnel, FunnelMinSteps, FunnelMaxSteps)
+	}
+	for i := range f.Steps {
+		step := &f.Steps[i]
+		step.EventType = strings.TrimSpace(step.EventType)
+		if step.EventType == "" {
+			return fmt.Errorf("%w: passo %d sem event_type", ErrInvalidFunnel, i+1)
+		}
+		if step.Name == "" {
+			step.Name = step.EventType
+		}
+		for _, filter := range step.Filters {
+			if filter.Property == "" {
+				return fmt.Errorf("%w: passo %d com filtro sem property", ErrInvalidFunnel, i+1)
+			}
+			switch filter.Operator {
+			case "==", "!=", ">", ">=", "<", "<=", "contains", "exists":
+			default:
+				return fmt.Errorf("%w: operador %q inválido no passo %d", ErrInvalidFunnel, filter.Operator, i+1)
+			}
+		}
+	}
+
+	if f.WindowSeconds == 0 {
+		f.WindowSeconds = int64(FunnelDefaultWindow.Seconds())
+	}
+	if f.WindowSeconds < 0 || f.Window() > FunnelMaxWindow {
+		return fmt.Errorf("%w: janela de conversão deve ser até %v", ErrInvalidFunnel, FunnelMaxWindow)
+	}
+	if f.Ordering == "" {
+		f.Ordering = FunnelOrderLoose
+	}
+	if f.Ordering != FunnelOrderLoose && f.Ordering != FunnelOrderStrict {
+		return fmt.Errorf("%w: ordering deve ser %q ou %q", ErrInvalidFunnel, FunnelOrderLoose, FunnelOrderStrict)
+	}
+	return nil
+}
+
+// seedDefaultFunnel grava o funil padrão para um app sem funis
+func (s *TelemetryService) seedDefaultFunnel(appID uuid.UUID) (*FunnelDefinition, error) {
+	funnel := defaultFunnel(appID)
+	funnel.CreatedAt = time.Now()
+	funnel.UpdatedAt = funnel.CreatedAt
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(funnel).Error; err != nil {
+		return nil, err
+	}
+	return s.GetFunnelDefinition(funnel.ID)
+}
+
+// CreateFunnel salva um funil para o app
+func (s *TelemetryService) CreateFunnel(funnel *FunnelDefinition) error {
+	if err := validateFunnel(funnel); err != nil {
+		return err
+	}
+	funnel.ID = uuid.New()
+	funnel.CreatedAt = time.Now()
+	funnel.UpdatedAt = funnel.CreatedAt
+	return s.db.Create(funnel).Error
+}
+
+// ListFunnels funis de um app
+func (s *TelemetryService) ListFunnels(appID uuid.UUID) ([]FunnelDefinition, error) {
+	var funnels []FunnelDefinition
+	err := s.db.Where("app_id = ?", appID).Order("created_at").Find(&funnels).Error
+	return funnels, err
+}
+
+// GetFunnelDefinition busca um funil
+func (s *TelemetryService) GetFunnelDefinition(id uuid.UUID) (*FunnelDefinition, error) {
+	var funnel FunnelDefinition
+	if err := s.db.Where("id = ?", id).First(&funnel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFunnelNotFound
+		}
+		return nil, err
+	}
+	return &funnel, nil
+}
+
+// UpdateFunnel substitui nome, passos, janela e ordenação
+func (s *TelemetryService) UpdateFunnel(id uuid.UUID, changes *FunnelDefinition) (*FunnelDefinition, error) {
+	funnel, err := s.GetFunnelDefinition(id)
+	if err != nil {
+		return nil, err
+	}
+	funnel.Name = changes.Name
+	funnel.Description = changes.Description
+	funnel.Steps = changes.Steps
+	funnel.WindowSeconds = changes.WindowSeconds
+	funnel.Ordering = changes.Ordering
+	if err := validateFunnel(funnel); err != nil {
+		return nil, err
+	}
+	funnel.UpdatedAt = time.Now()
+	if err := s.db.Save(funnel).Error; err != nil {
+		return nil, err
+	}
+	return funnel, nil
+}
+
+// DeleteFunnel remove um funil
+func (s *TelemetryService) DeleteFunnel(id uuid.UUID) error {
+	result := s.db.Where("id = ?", id).Delete(&FunnelDefinition{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFunnelNotFound
+	}
+	return nil
+}
+
+// ========================================
+// CÁLCULO - Progressão ordenada por usuário
+// ========================================
+
+// funnelEvent evento do funil; context/metadata só são decodificados se um filtro pedir
+type funnelEvent struct {
+	event    TelemetryEvent
+	decoded  bool
+	context  map[string]interface{}
+	metadata map[string]interface{}
+}
+
+func (fe *funnelEvent) decode() {
+	if fe.decoded {
+		return
+	}
+	fe.decoded = true
+	json.Unmarshal([]byte(fe.event.Context), &fe.context)
+	json.Unmarshal([]byte(fe.event.Metadata), &fe.metadata)
+}
+
+// ComputeFunnel mede o funil para usuários cujo 1º passo ocorreu em since.
+// Cada usuário conta até o passo mais profundo alcançado dentro da janela.
+// Os eventos chegam ordenados por usuário e são avaliados um a um, sem acumular.
+func (s *TelemetryService) ComputeFunnel(funnel *FunnelDefinition, since time.Duration) (*FunnelReport, error) {
+	if since <= 0 {
+		since = 24 * time.Hour
+	}
+	end := time.Now()
+	start := end.Add(-since)
+
+	query := s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND timestamp >= ? AND timestamp < ?", funnel.AppID, start, end)
+	if funnel.Ordering == FunnelOrderLoose {
+		// Só os tipos do funil importam
+		types := make([]string, 0, len(funnel.Steps))
+		for _, step := range funnel.Steps {
+			types = append(types, step.EventType)
+		}
+		query = query.Where("type IN ?", types)
+	} else {
+		// Strict lê todos os tipos: só dos usuários que iniciaram o funil no período
+		ignored := make([]string, 0, len(funnelIgnoredTypes))
+		for eventType := range funnelIgnoredTypes {
+			ignored = append(ignored, eventType)
+		}
+		starters := s.db.Model(&TelemetryEvent{}).Select("user_id").
+			Where("app_id = ? AND type = ? AND timestamp >= ? AND timestamp < ?", funnel.AppID, funnel.Steps[0].EventType, start, end)
+		query = query.Where("type NOT IN ?", ignored).Where("user_id IN (?)", starters)
+	}
+	rows, err := query.Order("user_id, timestamp").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reached := make([]int64, len(funnel.Steps))
+	durations := make([][]int64, len(funnel.Steps))
+	var userID uuid.UUID
+	var progress *funnelProgress
+
+	flush := func() {
+		times := progress.best
+		for i := range times {
+			reached[i]++
+			if i > 0 {
+				durations[i] = append(durations[i], times[i].Sub(times[i-1]).Milliseconds())
+			}
+		}
+	}
+
+	for rows.Next() {
+		var event TelemetryEvent
+		if err := s.db.ScanRows(rows, &event); err != nil {
+			return nil, err
+		}
+		if funnelIgnoredTypes[event.Type] {
+			continue
+		}
+		if progress == nil || event.UserID != userID {
+			if progress != nil {
+				flush()
+			}
+			userID, progress = event.UserID, newFunnelProgress(funnel, start)
+		}
+		progress.add(&funnelEvent{event: event})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		flush()
+	}
+
+	report := &FunnelReport{
+		FunnelID: funnel.ID,
+		Name:     funnel.Name,
+		Ordering: funnel.Ordering,
+		Window:   funnel.Window().String(),
+		Since:    since.String(),
+	}
+	for i, step := range funnel.Steps {
+		result := FunnelStep{Step: step.Name, EventType: step.EventType, Users: reached[i]}
+		if reached[0] > 0 {
+			result.Percentage = float64(reached[i]) / float64(reached[0]) * 100
+		}
+		if i > 0 {
+			if reached[i-1] > 0 {
+				result.DropOff = (1 - float64(reached[i])/float64(reached[i-1])) * 100
+			}
+			result.TimeToConvert = funnelTiming(durations[i])
+		}
+		report.Steps = append(report.Steps, result)
+	}
+	return report, nil
+}
+
+// funnelAttempt tentativa iniciada numa ocorrência do 1º passo
+type funnelAttempt struct {
+	times    []time.Time // Instante de cada passo alcançado
+	deadline time.Time
+}
+
+// funnelProgress progressão de um usuário, evento a evento: O(eventos × passos).
+// Guarda a tentativa mais profunda (a primeira a chegar a cada profundidade).
+type funnelProgress struct {
+	funnel   *FunnelDefinition
+	start    time.Time
+	attempts []*funnelAttempt // loose: por profundidade, a de início mais recente; strict: as vivas
+	best     []time.Time
+}
+
+func newFunnelProgress(funnel *FunnelDefinition, start time.Time) *funnelProgress {
+	p := &funnelProgress{funnel: funnel, start: start}
+	if funnel.Ordering == FunnelOrderLoose {
+		p.attempts = make([]*funnelAttempt, len(funnel.Steps))
+	}
+	return p
+}
+
+func (p *funnelProgress) add(fe *funnelEvent) {
+	steps := p.funnel.Steps
+	if len(p.best) == len(steps) {
+		return // Funil completo
+	}
+	at := fe.event.Timestamp
+
+	if p.funnel.Ordering == FunnelOrderStrict {
+		// Vivas avançam no evento seguinte ou terminam (outro evento entre os passos)
+		alive := p.attempts[:0]
+		for _, attempt := range p.attempts {
+			if at.After(attempt.deadline) || !stepMatches(&steps[len(attempt.times)], fe) {
+				continue
+			}
+			attempt.times = append(attempt.times, at)
+			p.record(attempt.times)
+			if len(attempt.times) < len(steps) {
+				alive = append(alive, attempt)
+			}
+		}
+		p.attempts = alive
+		if attempt := p.begin(fe); attempt != nil {
+			p.attempts = append(p.attempts, attempt)
+		}
+		return
+	}
+
+	// Loose: entre tentativas na mesma profundidade, a de início mais recente domina
+	// (prazo maior, mesmos eventos pela frente). Do fim para o início: um evento, um passo.
+	for depth := len(steps) - 1; depth >= 1; depth-- {
+		previous := p.attempts[depth-1]
+		if previous == nil || at.After(previous.deadline) || !stepMatches(&steps[depth], fe) {
+			continue
+		}
+		if current := p.attempts[depth]; current != nil && !previous.times[0].After(current.times[0]) {
+			continue
+		}
+		times := make([]time.Time, depth+1)
+		copy(times, previous.times)
+		times[depth] = at
+		p.attempts[depth] = &funnelAttempt{times: times, deadline: previous.deadline}
+		p.record(times)
+	}
+	if attempt := p.begin(fe); attempt != nil {
+		p.attempts[0] = attempt
+	}
+}
+
+// begin nova tentativa se o evento é o 1º passo dentro do período
+func (p *funnelProgress) begin(fe *funnelEvent) *funnelAttempt {
+	at := fe.event.Timestamp
+	if at.Before(p.start) || !stepMatches(&p.funnel.Steps[0], fe) {
+		return nil
+	}
+	attempt := &funnelAttempt{times: []time.Time{at}, deadline: at.Add(p.funnel.Window())}
+	p.record(attempt.times)
+	if len(p.funnel.Steps) == 1 {
+		return nil
+	}
+	return attempt
+}
+
+func (p *funnelProgress) record(times []time.Time) {
+	if len(times) > len(p.best) {
+		p.best = times
+	}
+}
+
+// stepMatches tipo do evento + todos os filtros do passo
+func stepMatches(step *FunnelStepDefinition, fe *funnelEvent) bool {
+	if fe.event.Type != step.EventType {
+		return false
+	}
+	for _, filter := range step.Filters {
+		if !filterMatches(filter, fe) {
+			return false
+		}
+	}
+	return true
+}
+
+func filterMatches(filter FunnelFilter, fe *funnelEvent) bool {
+	value, ok := fe.property(filter.Property)
+	if filter.Operator == "exists" {
+		return ok
+	}
+	if !ok {
+		return filter.Operator == "!="
+	}
+
+	switch filter.Operator {
+	case "==":
+		return fmt.Sprint(value) == fmt.Sprint(filter.Value)
+	case "!=":
+		return fmt.Sprint(value) != fmt.Sprint(filter.Value)
+	case "contains":
+		return strings.Contains(fmt.Sprint(value), fmt.Sprint(filter.Value))
+	}
+
+	left, lok := toFloat(value)
+	right, rok := toFloat(filter.Value)
+	if !lok || !rok {
+		return false
+	}
+	switch filter.Operator {
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	}
+	return false
+}
+
+// property resolve feature, target_*, context.<campo> e metadata.<campo>
+func (fe *funnelEvent) property(path string) (interface{}, bool) {
+	switch path {
+	case "feature":
+		return fe.event.Feature, fe.event.Feature != ""
+	case "target_id":
+		return fe.event.TargetID, fe.event.TargetID != ""
+	case "target_type":
+		return fe.event.TargetType, fe.event.TargetType != ""
+	}
+
+	fe.decode()
+	var source map[string]interface{}
+	switch {
+	case strings.HasPrefix(path, "context."):
+		source, path = fe.context, strings.TrimPrefix(path, "context.")
+	case strings.HasPrefix(path, "metadata."):
+		source, path = fe.metadata, strings.TrimPrefix(path, "metadata.")
+	default:
+		source = fe.metadata
+	}
+
+	var current interface{} = source
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, current != nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// funnelTiming percentis (nearest-rank) das durações
+func funnelTiming(durations []int64) *FunnelTiming {
+	if len(durations) == 0 {
+		return nil
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	percentile := func(p float64) int64 {
+		rank := int(math.Ceil(p/100*float64(len(durations)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return durations[rank]
+	}
+	return &FunnelTiming{P50: percentile(50), P90: percentile(90), P95: percentile(95)}
+}
@@ -0,0 +1,135 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Funis configuráveis
+// ========================================
+
+func TestComputeFunnelOrderingWindowAndFilters(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	appID := uuid.New()
+	t0 := time.Now().Add(-3 * time.Hour)
+
+	emit := func(user uuid.UUID, eventType string, at time.Duration, metadata string) {
+		s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, SessionID: user, Type: eventType,
+			Metadata: metadata, Timestamp: t0.Add(at), IngestedAt: time.Now()})
+	}
+	full, interleaved, late, wrongMode := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	emit(full, EventInteractionQueueJoined, 0, "")
+	emit(full, EventSessionPing, time.Minute, "") // Heartbeat não quebra strict
+	emit(full, EventInteractionMatchCreated, 2*time.Minute, `{"mode":"video"}`)
+	emit(full, EventInteractionMessageSent, 5*time.Minute, "")
+
+	emit(interleaved, EventInteractionQueueJoined, 0, "")
+	emit(interleaved, EventNavScreenView, time.Minute, "")
+	emit(interleaved, EventInteractionMatchCreated, 4*time.Minute, `{"mode":"video"}`)
+
+	emit(late, EventInteractionQueueJoined, 0, "")
+	emit(late, EventInteractionMatchCreated, 2*time.Hour, `{"mode":"video"}`) // Fora da janela
+
+	emit(wrongMode, EventInteractionQueueJoined, 0, "")
+	emit(wrongMode, EventInteractionMatchCreated, time.Minute, `{"mode":"text"}`) // Filtro não bate
+
+	funnel := &FunnelDefinition{AppID: appID, Name: "matchmaking", WindowSeconds: 3600, Steps: FunnelStepList{
+		{Name: "Fila", EventType: EventInteractionQueueJoined},
+		{Name: "Match em vídeo", EventType: EventInteractionMatchCreated, Filters: []FunnelFilter{{Property: "metadata.mode", Operator: "==", Value: "video"}}},
+		{Name: "Mensagem", EventType: EventInteractionMessageSent},
+	}}
+	if err := s.CreateFunnel(funnel); err != nil {
+		t.Fatal(err)
+	}
+	if funnel.Ordering != FunnelOrderLoose {
+		t.Errorf("ordering padrão deveria ser loose: %q", funnel.Ordering)
+	}
+
+	report, err := s.ComputeFunnel(funnel, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Steps[0].Users != 4 || report.Steps[1].Users != 2 || report.Steps[2].Users != 1 {
+		t.Fatalf("loose deveria contar 4/2/1: %+v", report.Steps)
+	}
+	timing := report.Steps[1].TimeToConvert
+	if timing == nil || timing.P50 != (2*time.Minute).Milliseconds() || timing.P95 != (4*time.Minute).Milliseconds() {
+		t.Errorf("percentis do passo 2 inesperados: %+v", timing)
+	}
+	if report.Steps[1].DropOff != 50 {
+		t.Errorf("drop-off do passo 2 deveria ser 50%%: %v", report.Steps[1].DropOff)
+	}
+
+	funnel.Ordering = FunnelOrderStrict
+	updated, err := s.UpdateFunnel(funnel.ID, funnel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, _ := s.ComputeFunnel(updated, 24*time.Hour)
+	if strict.Steps[1].Users != 1 || strict.Steps[2].Users != 1 {
+		t.Errorf("strict não deveria aceitar eventos entre passos: %+v", strict.Steps)
+	}
+
+	if err := s.CreateFunnel(&FunnelDefinition{AppID: appID, Name: "curto", Steps: FunnelStepList{{EventType: EventSessionStart}}}); !errors.Is(err, ErrInvalidFunnel) {
+		t.Errorf("funil de um passo deveria ser inválido: %v", err)
+	}
+	if err := s.DeleteFunnel(funnel.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFunnel(appID, &funnel.ID, time.Hour); !errors.Is(err, ErrFunnelNotFound) {
+		t.Errorf("funil removido deveria retornar ErrFunnelNotFound: %v", err)
+	}
+}
+
+func TestDefaultFunnelKeepsLegacyMatchmakingSteps(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	appID := uuid.New()
+	t0 := time.Now().Add(-3 * time.Hour)
+
+	emit := func(user uuid.UUID, eventType string, at time.Duration, metadata string) {
+		s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, SessionID: user, Type: eventType,
+			Metadata: metadata, Timestamp: t0.Add(at), IngestedAt: time.Now()})
+	}
+	long, short, retried := uuid.New(), uuid.New(), uuid.New()
+	for _, user := range []uuid.UUID{long, short} {
+		emit(user, EventSessionStart, 0, "")
+		emit(user, EventInteractionQueueJoined, time.Minute, "")
+		emit(user, EventInteractionMatchCreated, 2*time.Minute, "")
+		emit(user, EventInteractionMessageSent, 3*time.Minute, "")
+	}
+	emit(long, EventInteractionMatchEnded, 5*time.Minute, `{"duration_ms":180000}`)
+	emit(short, EventInteractionMatchEnded, 5*time.Minute, `{"duration_ms":20000}`) // Match curto não completa
+
+	// Primeira sessão sem fila; a segunda, 25h depois, entra na fila dentro da sua janela
+	emit(retried, EventSessionStart, -26*time.Hour, "")
+	emit(retried, EventSessionStart, -time.Hour, "")
+	emit(retried, EventInteractionQueueJoined, -30*time.Minute, "")
+
+	report, err := s.GetFunnel(appID, nil, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Steps) != 5 || report.Name != "Matchmaking" {
+		t.Fatalf("app sem funis deveria receber o funil padrão: %+v", report)
+	}
+	users := []int64{3, 3, 2, 2, 1}
+	for i, step := range report.Steps {
+		if step.Users != users[i] {
+			t.Fatalf("passo %q: esperado %d usuários, obtido %d (%+v)", step.Step, users[i], step.Users, report.Steps)
+		}
+	}
+
+	// Seed idempotente: o mesmo funil, não um novo
+	again, _ := s.GetFunnel(appID, nil, 48*time.Hour)
+	funnels, _ := s.ListFunnels(appID)
+	if len(funnels) != 1 || again.FunnelID != report.FunnelID {
+		t.Errorf("funil padrão deveria ser gravado uma vez: %d funis", len(funnels))
+	}
+}
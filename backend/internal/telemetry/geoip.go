@@ -0,0 +1,262 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oschwald/maxminddb-golang"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// GEOIP - Enriquecimento offline pelo IP da requisição
+// "O app não precisa mandar o país; o kernel sabe de onde veio"
+// ========================================
+
+// GeoInfo localização de um IP
+type GeoInfo struct {
+	Country string `json:"country,omitempty"` // ISO 3166-1 alpha-2
+	Region  string `json:"region,omitempty"`  // Subdivisão (ex.: SP)
+	City    string `json:"city,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+}
+
+// GeoLocator resolve a localização de um IP (nil, nil = desconhecido).
+// Um erro pode vir junto com o resultado parcial dos bancos que responderam.
+type GeoLocator interface {
+	Locate(ip net.IP) (*GeoInfo, error)
+}
+
+// mmdbRecord campos usados dos bancos City/Country/ASN da MaxMind
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoReader um arquivo MMDB aberto (*maxminddb.Reader)
+type geoReader interface {
+	Lookup(ip net.IP, result any) error
+	Close() error
+}
+
+// GeoIP leitor de um ou mais arquivos MMDB (ex.: GeoLite2-City + GeoLite2-ASN)
+type GeoIP struct {
+	readers []geoReader
+}
+
+// OpenGeoIP abre os arquivos MMDB (memory-mapped)
+func OpenGeoIP(paths ...string) (*GeoIP, error) {
+	geo := &GeoIP{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			geo.Close()
+			return nil, fmt.Errorf("geoip: %s: %w", path, err)
+		}
+		log.Printf("🌍 [TELEMETRY] GeoIP database loaded: %s (%s, %s)", path, reader.Metadata.DatabaseType,
+			time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC().Format("2006-01-02"))
+		geo.readers = append(geo.readers, reader)
+	}
+	if len(geo.readers) == 0 {
+		return nil, errors.New("geoip: nenhum arquivo MMDB informado")
+	}
+	return geo, nil
+}
+
+// Locate combina os campos encontrados em todos os bancos.
+// Falha em um banco não descarta o que os outros encontraram.
+func (g *GeoIP) Locate(ip net.IP) (*GeoInfo, error) {
+	info := &GeoInfo{}
+	var errs []error
+	for _, reader := range g.readers {
+		var record mmdbRecord
+		if err := reader.Lookup(ip, &record); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if record.Country.ISOCode != "" {
+			info.Country = record.Country.ISOCode
+		}
+		if len(record.Subdivisions) > 0 {
+			if region := record.Subdivisions[0].ISOCode; region != "" {
+				info.Region = region
+			} else if name := record.Subdivisions[0].Names["en"]; name != "" {
+				info.Region = name
+			}
+		}
+		if city := record.City.Names["en"]; city != "" {
+			info.City = city
+		}
+		if record.ASN != 0 {
+			info.ASN, info.ASOrg = record.ASN, record.ASOrg
+		}
+	}
+	err := errors.Join(errs...)
+	if *info == (GeoInfo{}) {
+		return nil, err
+	}
+	return info, err
+}
+
+// Close libera os arquivos
+func (g *GeoIP) Close() {
+	for _, reader := range g.readers {
+		reader.Close()
+	}
+	g.readers = nil
+}
+
+// GeoErrorLogInterval intervalo mínimo entre logs de falha do GeoIP (um por evento inundaria o log)
+const GeoErrorLogInterval = time.Minute
+
+// SetGeoLocator habilita o enriquecimento geográfico (opcional)
+func (s *TelemetryService) SetGeoLocator(locator GeoLocator) {
+	s.geoLocator = locator
+}
+
+// ========================================
+// PRIVACIDADE - Configuração por app
+// ========================================
+
+const privacySettingsTTL = time.Minute
+
+// AppPrivacySettings como o IP de origem é tratado em um app
+type AppPrivacySettings struct {
+	AppID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	AnonymizeIP   bool      `gorm:"not null" json:"anonymize_ip"`   // Trunca o IP antes de gravar
+	GeoEnrichment bool      `gorm:"not null" json:"geo_enrichment"` // Resolve país/região/cidade/ASN
+	UpdatedBy     string    `gorm:"size:100" json:"updated_by,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func (AppPrivacySettings) TableName() string {
+	return "telemetry_privacy_settings"
+}
+
+// defaultPrivacySettings apps sem configuração: IP anonimizado, geo ligado
+func defaultPrivacySettings(appID uuid.UUID) *AppPrivacySettings {
+	return &AppPrivacySettings{AppID: appID, AnonymizeIP: true, GeoEnrichment: true}
+}
+
+type cachedPrivacySettings struct {
+	settings *AppPrivacySettings
+	loadedAt time.Time
+}
+
+// GetPrivacySettings configuração do app (padrão se nunca configurado)
+func (s *TelemetryService) GetPrivacySettings(appID uuid.UUID) (*AppPrivacySettings, error) {
+	var settings AppPrivacySettings
+	err := s.db.Where("app_id = ?", appID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return defaultPrivacySettings(appID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdatePrivacySettings grava a configuração do app (vale para eventos futuros)
+func (s *TelemetryService) UpdatePrivacySettings(settings *AppPrivacySettings) error {
+	settings.UpdatedAt = time.Now()
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "app_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"anonymize_ip", "geo_enrichment", "updated_by", "updated_at"}),
+	}).Create(settings).Error
+	if err != nil {
+		return err
+	}
+	s.privacyCache.Delete(settings.AppID)
+	return nil
+}
+
+// privacySettings versão em cache (falha de leitura = padrão mais restritivo)
+func (s *TelemetryService) privacySettings(appID uuid.UUID) *AppPrivacySettings {
+	if cached, ok := s.privacyCache.Load(appID); ok {
+		entry := cached.(cachedPrivacySettings)
+		if time.Since(entry.loadedAt) < privacySettingsTTL {
+			return entry.settings
+		}
+	}
+	settings, err := s.GetPrivacySettings(appID)
+	if err != nil {
+		return defaultPrivacySettings(appID)
+	}
+	s.privacyCache.Store(appID, cachedPrivacySettings{settings: settings, loadedAt: time.Now()})
+	return settings
+}
+
+// ========================================
+// ORIGEM - IP gravado + localização
+// ========================================
+
+// eventOrigin o que é gravado sobre a origem de um evento
+type eventOrigin struct {
+	IP  string
+	Geo GeoInfo
+}
+
+// resolveOrigin localiza o IP (antes de truncar) e aplica a anonimização do app
+func (s *TelemetryService) resolveOrigin(appID uuid.UUID, rawIP string) eventOrigin {
+	ip := net.ParseIP(strings.TrimSpace(rawIP))
+	if ip == nil {
+		return eventOrigin{IP: rawIP}
+	}
+	settings := s.privacySettings(appID)
+
+	origin := eventOrigin{IP: ip.String()}
+	if settings.GeoEnrichment && s.geoLocator != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() {
+		geo, err := s.geoLocator.Locate(ip)
+		if err != nil {
+			s.logGeoError(appID, err)
+		}
+		if geo != nil {
+			origin.Geo = *geo // Parcial quando um dos bancos falhou
+		}
+	}
+	if settings.AnonymizeIP {
+		origin.IP = AnonymizeIP(ip).String()
+	}
+	return origin
+}
+
+// logGeoError no máximo um log por GeoErrorLogInterval, com as falhas suprimidas no período
+func (s *TelemetryService) logGeoError(appID uuid.UUID, err error) {
+	s.geoFailures.Add(1)
+	now := time.Now().UnixNano()
+	last := s.geoLoggedAt.Load()
+	if now-last < int64(GeoErrorLogInterval) || !s.geoLoggedAt.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("⚠️ [TELEMETRY] GeoIP lookup failed: failures=%d (last %v) app=%s err=%v",
+		s.geoFailures.Swap(0), GeoErrorLogInterval, appID, err)
+}
+
+// AnonymizeIP zera o último octeto do IPv4 (/24) ou os últimos 80 bits do IPv6 (/48)
+func AnonymizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(48, 128))
+}
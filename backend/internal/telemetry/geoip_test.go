@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - GeoIP e anonimização
+// ========================================
+
+type fakeGeoLocator map[string]*GeoInfo
+
+func (f fakeGeoLocator) Locate(ip net.IP) (*GeoInfo, error) {
+	return f[ip.String()], nil
+}
+
+func TestIngestEnrichesGeoAndAnonymizesIP(t *testing.T) {
+	s := newTestTelemetryService(t)
+	appID, rawApp := uuid.New(), uuid.New()
+	s.SetGeoLocator(fakeGeoLocator{
+		"203.0.113.57": {Country: "BR", Region: "SP", City: "São Paulo", ASN: 64500, ASOrg: "Example Telecom"},
+	})
+	if err := s.UpdatePrivacySettings(&AppPrivacySettings{AppID: rawApp, AnonymizeIP: false, GeoEnrichment: false}); err != nil {
+		t.Fatal(err)
+	}
+
+	userID, sessionID := uuid.New(), uuid.New()
+	reqs := []IngestEventRequest{{UserID: userID.String(), SessionID: sessionID.String(), Type: EventSessionStart}}
+	if _, _, err := s.IngestBatch(appID, reqs, "203.0.113.57", "test"); err != nil {
+		t.Fatal(err)
+	}
+	rawSession := uuid.New()
+	if _, _, err := s.IngestBatch(rawApp, []IngestEventRequest{{UserID: userID.String(), SessionID: rawSession.String(),
+		Type: EventSessionStart}}, "203.0.113.57", "test"); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	var event TelemetryEvent
+	s.db.Where("app_id = ?", appID).First(&event)
+	if event.IPAddress != "203.0.113.0" || event.Country != "BR" || event.Region != "SP" ||
+		event.City != "São Paulo" || event.ASN != 64500 || event.ASOrg != "Example Telecom" {
+		t.Errorf("evento deveria ser enriquecido com IP truncado: %+v", event)
+	}
+	var session AppSession
+	s.db.Where("id = ?", sessionID).First(&session)
+	if session.IPAddress != "203.0.113.0" || session.Country != "BR" || session.City != "São Paulo" || session.ASN != 64500 {
+		t.Errorf("sessão deveria herdar a origem do evento: %+v", session)
+	}
+
+	var raw TelemetryEvent
+	s.db.Where("app_id = ?", rawApp).First(&raw)
+	if raw.IPAddress != "203.0.113.57" || raw.Country != "" {
+		t.Errorf("app sem anonimização e sem geo deveria guardar o IP completo: %+v", raw)
+	}
+
+	geo, _ := s.GetGeoDistribution(appID, 0, 10, "city")
+	if len(geo) != 1 || geo[0].City != "São Paulo" || geo[0].Country != "BR" || geo[0].Sessions != 1 {
+		t.Errorf("distribuição por cidade inesperada: %+v", geo)
+	}
+
+	if got := AnonymizeIP(net.ParseIP("2001:db8:1234:5678::1")).String(); got != "2001:db8:1234::" {
+		t.Errorf("IPv6 deveria manter só o /48: %s", got)
+	}
+}
+
+// fakeGeoReader banco MMDB com um registro fixo (ou falha)
+type fakeGeoReader struct {
+	record mmdbRecord
+	err    error
+}
+
+func (f fakeGeoReader) Lookup(ip net.IP, result any) error {
+	if f.err != nil {
+		return f.err
+	}
+	*result.(*mmdbRecord) = f.record
+	return nil
+}
+
+func (f fakeGeoReader) Close() error { return nil }
+
+func TestGeoIPMergesPartialResultsAndThrottlesLogs(t *testing.T) {
+	var asn mmdbRecord
+	asn.ASN, asn.ASOrg = 64500, "Example Telecom"
+	geo := &GeoIP{readers: []geoReader{fakeGeoReader{err: errors.New("city database corrupted")}, fakeGeoReader{record: asn}}}
+
+	// Banco de cidades falhou: o ASN encontrado não é descartado
+	info, err := geo.Locate(net.ParseIP("203.0.113.57"))
+	if err == nil || info == nil || info.ASN != 64500 || info.ASOrg != "Example Telecom" || info.Country != "" {
+		t.Fatalf("esperado resultado parcial com erro: %+v %v", info, err)
+	}
+
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	s.SetGeoLocator(geo)
+	origin := s.resolveOrigin(uuid.New(), "203.0.113.57")
+	if origin.Geo.ASN != 64500 {
+		t.Errorf("origem deveria receber o parcial: %+v", origin)
+	}
+
+	// Primeira falha loga; as seguintes no intervalo só são contadas
+	for i := 0; i < 5; i++ {
+		s.resolveOrigin(uuid.New(), "203.0.113.57")
+	}
+	if failures := s.geoFailures.Load(); failures != 5 {
+		t.Errorf("falhas suprimidas deveriam ser contadas até o próximo log: %d", failures)
+	}
+}
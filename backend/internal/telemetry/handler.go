@@ -1,6 +1,7 @@
 package telemetry
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -62,11 +63,11 @@ func (h *TelemetryHandler) IngestEvent(c *gin.Context) {
 	userAgent := c.GetHeader("User-Agent")
 	
 	if err := h.service.IngestEvent(appID, &req, ip, userAgent); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondIngestError(c, err)
 		return
 	}
 	
-	c.JSON(http.StatusCreated, gin.H{"status": "ok", "message": "Evento registrado"})
+	c.JSON(http.StatusAccepted, gin.H{"status": "ok", "message": "Evento recebido"})
 }
 
 // IngestBatch recebe múltiplos eventos de uma vez
@@ -100,21 +101,21 @@ func (h *TelemetryHandler) IngestBatch(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if len(req.Events) > IngestMaxBatchEvents {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Lote excede o limite de eventos", "max_events": IngestMaxBatchEvents})
+		return
+	}
 	
 	ip := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 	
-	success := 0
-	failed := 0
-	for _, event := range req.Events {
-		if err := h.service.IngestEvent(appID, &event, ip, userAgent); err != nil {
-			failed++
-		} else {
-			success++
-		}
+	success, failed, err := h.service.IngestBatch(appID, req.Events, ip, userAgent)
+	if err != nil {
+		respondIngestError(c, err)
+		return
 	}
 	
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusAccepted, gin.H{
 		"status":  "ok",
 		"success": success,
 		"failed":  failed,
@@ -122,6 +123,25 @@ func (h *TelemetryHandler) IngestBatch(c *gin.Context) {
 	})
 }
 
+// respondIngestError fila cheia → 429 com Retry-After; pipeline parado → 503
+func respondIngestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrIngestQueueFull):
+		c.Header("Retry-After", strconv.Itoa(int(IngestRetryAfter.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Fila de ingestão cheia, tente novamente"})
+	case errors.Is(err, ErrIngestStopped):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ingestão indisponível"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// GetIngestStats estado da fila de ingestão
+// GET /api/v1/admin/telemetry/ingest/stats
+func (h *TelemetryHandler) GetIngestStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.IngestStats())
+}
+
 // ========================================
 // MÉTRICAS SNAPSHOT
 // ========================================
@@ -378,6 +398,9 @@ func RegisterTelemetryRoutes(router *gin.RouterGroup, service *TelemetryService,
 		adminTelemetry.GET("/apps/:id/sessions", handler.GetActiveSessionsAdmin)
 		adminTelemetry.GET("/apps/:id/alerts", handler.GetAlertsAdmin)
 		adminTelemetry.GET("/alerts", handler.GetAllAlertsAdmin)
+		adminTelemetry.GET("/ingest/stats", handler.GetIngestStats)
+		adminTelemetry.GET("/apps/:id/purges", handler.ListRetentionRunsAdmin)
+		adminTelemetry.POST("/apps/:id/purges", handler.PurgeAppAdmin)
 		
 		// Alerts Management
 		adminTelemetry.GET("/alerts/filtered", handler.GetAlertsFiltered)
@@ -388,6 +411,23 @@ func RegisterTelemetryRoutes(router *gin.RouterGroup, service *TelemetryService,
 		// Analytics
 		adminTelemetry.GET("/apps/:id/retention", handler.GetRetentionAdmin)
 		adminTelemetry.GET("/apps/:id/funnel", handler.GetFunnelAdmin)
+		
+		// Funis configuráveis
+		adminTelemetry.GET("/apps/:id/funnels", handler.ListFunnels)
+		adminTelemetry.POST("/apps/:id/funnels", handler.CreateFunnel)
+		adminTelemetry.GET("/funnels/:funnelId", handler.GetFunnelDefinition)
+		adminTelemetry.PUT("/funnels/:funnelId", handler.UpdateFunnel)
+		adminTelemetry.DELETE("/funnels/:funnelId", handler.DeleteFunnel)
+		adminTelemetry.GET("/funnels/:funnelId/report", handler.GetFunnelReport)
+		
+		// Segmentos e coortes
+		adminTelemetry.GET("/apps/:id/segments", handler.ListSegments)
+		adminTelemetry.POST("/apps/:id/segments", handler.CreateSegment)
+		adminTelemetry.GET("/segments/:segmentId", handler.GetSegment)
+		adminTelemetry.PUT("/segments/:segmentId", handler.UpdateSegment)
+		adminTelemetry.DELETE("/segments/:segmentId", handler.DeleteSegment)
+		adminTelemetry.POST("/segments/:segmentId/refresh", handler.RefreshSegment)
+		adminTelemetry.GET("/apps/:id/cohorts", handler.GetCohortsAdmin)
 		adminTelemetry.GET("/apps/:id/engagement", handler.GetEngagementAdmin)
 		adminTelemetry.GET("/apps/:id/compare", handler.GetCompareAdmin)
 		adminTelemetry.GET("/apps/:id/top-users", handler.GetTopUsersAdmin)
@@ -396,6 +436,8 @@ func RegisterTelemetryRoutes(router *gin.RouterGroup, service *TelemetryService,
 		adminTelemetry.GET("/apps/:id/heatmap", handler.GetHeatmapAdmin)
 		adminTelemetry.GET("/apps/:id/journey", handler.GetJourneyAdmin)
 		adminTelemetry.GET("/apps/:id/geo", handler.GetGeoAdmin)
+		adminTelemetry.GET("/apps/:id/privacy", handler.GetPrivacySettingsAdmin)
+		adminTelemetry.PUT("/apps/:id/privacy", handler.UpdatePrivacySettingsAdmin)
 		adminTelemetry.GET("/apps/:id/live", handler.GetLiveEventsAdmin)
 	}
 }
@@ -461,7 +503,7 @@ func (h *TelemetryHandler) GetAllAlertsAdmin(c *gin.Context) {
 // ========================================
 
 // GetRetentionAdmin retorna dados de retenção D1/D7/D30
-// GET /api/v1/admin/telemetry/apps/:id/retention
+// GET /api/v1/admin/telemetry/apps/:id/retention?days=30&segment_id=
 func (h *TelemetryHandler) GetRetentionAdmin(c *gin.Context) {
 	appIDStr := c.Param("id")
 	appID, err := uuid.Parse(appIDStr)
@@ -477,9 +519,14 @@ func (h *TelemetryHandler) GetRetentionAdmin(c *gin.Context) {
 		}
 	}
 	
-	retention, err := h.service.GetRetention(appID, days)
+	segmentID, ok := segmentParam(c)
+	if !ok {
+		return
+	}
+	
+	retention, err := h.service.GetRetention(appID, days, segmentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		segmentError(c, err)
 		return
 	}
 	
@@ -506,15 +553,36 @@ func (h *TelemetryHandler) GetFunnelAdmin(c *gin.Context) {
 		}
 	}
 	
-	funnel, err := h.service.GetFunnel(appID, since)
+	// funnel_id opcional: sem ele, o primeiro funil configurado do app
+	var funnelID *uuid.UUID
+	if f := c.Query("funnel_id"); f != "" {
+		id, err := uuid.Parse(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Funnel ID inválido"})
+			return
+		}
+		funnelID = &id
+	}
+	
+	report, err := h.service.GetFunnel(appID, funnelID, since)
+	if errors.Is(err, ErrFunnelNotFound) {
+		c.JSON(http.StatusOK, gin.H{
+			"funnel":  []FunnelStep{},
+			"since":   since.String(),
+			"message": "Nenhum funil configurado para este app",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
 	c.JSON(http.StatusOK, gin.H{
-		"funnel": funnel,
-		"since":  since.String(),
+		"funnel":    report.Steps,
+		"funnel_id": report.FunnelID,
+		"name":      report.Name,
+		"since":     since.String(),
 	})
 }
 
@@ -535,9 +603,14 @@ func (h *TelemetryHandler) GetEngagementAdmin(c *gin.Context) {
 		}
 	}
 	
-	engagement, err := h.service.GetEngagementMetrics(appID, since)
+	segmentID, ok := segmentParam(c)
+	if !ok {
+		return
+	}
+	
+	engagement, err := h.service.GetEngagementMetrics(appID, since, segmentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		segmentError(c, err)
 		return
 	}
 	
@@ -598,9 +671,14 @@ func (h *TelemetryHandler) GetTopUsersAdmin(c *gin.Context) {
 		}
 	}
 	
-	users, err := h.service.GetTopUsers(appID, since, limit)
+	segmentID, ok := segmentParam(c)
+	if !ok {
+		return
+	}
+	
+	users, err := h.service.GetTopUsers(appID, since, limit, segmentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		segmentError(c, err)
 		return
 	}
 	
@@ -664,7 +742,7 @@ func (h *TelemetryHandler) GetJourneyAdmin(c *gin.Context) {
 }
 
 // GetGeoAdmin retorna distribuição geográfica
-// GET /api/v1/admin/telemetry/apps/:id/geo
+// GET /api/v1/admin/telemetry/apps/:id/geo?since=168h&limit=10&level=country
 func (h *TelemetryHandler) GetGeoAdmin(c *gin.Context) {
 	appIDStr := c.Param("id")
 	appID, err := uuid.Parse(appIDStr)
@@ -687,7 +765,13 @@ func (h *TelemetryHandler) GetGeoAdmin(c *gin.Context) {
 		}
 	}
 	
-	geo, err := h.service.GetGeoDistribution(appID, since, limit)
+	level := c.DefaultQuery("level", "country")
+	if _, ok := geoLevels[level]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level deve ser country, region, city ou asn"})
+		return
+	}
+	
+	geo, err := h.service.GetGeoDistribution(appID, since, limit, level)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -696,6 +780,7 @@ func (h *TelemetryHandler) GetGeoAdmin(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"countries": geo,
 		"total":     len(geo),
+		"level":     level,
 		"since":     since.String(),
 	})
 }
@@ -32,6 +32,10 @@ type AppSession struct {
 	IPAddress   string     `gorm:"size:45" json:"ip_address,omitempty"`
 	UserAgent   string     `gorm:"size:500" json:"user_agent,omitempty"`
 	Country     string     `gorm:"size:2" json:"country,omitempty"`
+	Region      string     `gorm:"size:100" json:"region,omitempty"`
+	City        string     `gorm:"size:100" json:"city,omitempty"`
+	ASN         uint       `json:"asn,omitempty"`
+	ASOrg       string     `gorm:"size:200" json:"as_org,omitempty"`
 	
 	// Estado atual
 	CurrentFeature string   `gorm:"size:100" json:"current_feature,omitempty"` // video_chat, queue, lobby
@@ -92,9 +96,16 @@ type TelemetryEvent struct {
 	Metadata    string     `gorm:"type:text" json:"metadata,omitempty"`  // JSON com dados extras
 	
 	// Origem
-	IPAddress   string     `gorm:"size:45" json:"ip_address,omitempty"`
+	IPAddress   string     `gorm:"size:45" json:"ip_address,omitempty"` // Truncado se o app anonimiza
 	UserAgent   string     `gorm:"size:500" json:"user_agent,omitempty"`
 	
+	// Localização (GeoIP no servidor)
+	Country     string     `gorm:"size:2;index:idx_event_country" json:"country,omitempty"`
+	Region      string     `gorm:"size:100" json:"region,omitempty"`
+	City        string     `gorm:"size:100" json:"city,omitempty"`
+	ASN         uint       `json:"asn,omitempty"`
+	ASOrg       string     `gorm:"size:200" json:"as_org,omitempty"`
+	
 	// Timestamp do evento (quando aconteceu no app)
 	Timestamp   time.Time  `gorm:"not null;index:idx_event_timestamp" json:"timestamp"`
 	
@@ -0,0 +1,448 @@
+package telemetry
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"prost-qs/backend/internal/observability"
+)
+
+// ========================================
+// INGEST PIPELINE - Fila, lotes e workers
+// "Aceitar rápido, gravar em lote, processar em paralelo"
+// ========================================
+
+// Configuração do pipeline
+const (
+	IngestQueueCapacity  = 10000                  // Eventos aguardando gravação
+	IngestBatchSize      = 500                    // Linhas por INSERT
+	IngestFlushInterval  = 200 * time.Millisecond // Lote parcial é gravado após esse tempo
+	IngestWorkers        = 4                      // Atualização de sessões/métricas
+	IngestWorkerBacklog  = 1024                   // Tarefas por worker
+	IngestMaxBatchEvents = 1000                   // Máximo de eventos por request de batch
+	IngestRetryAfter     = 2 * time.Second        // Sugestão ao cliente quando a fila está cheia
+	IngestWriteRetries   = 5                      // Retentativas do INSERT antes do spill em disco
+	IngestRetryBackoff   = 100 * time.Millisecond // Dobra a cada retentativa (100ms … 1.6s)
+	IngestSpillInterval  = time.Minute            // Regravação dos lotes em spill
+	ingestRateWindow     = 10                     // Segundos na janela de throughput
+)
+
+var (
+	ErrIngestQueueFull = errors.New("telemetry ingest queue full")
+	ErrIngestStopped   = errors.New("telemetry ingest pipeline stopped")
+)
+
+// IngestStats estado do pipeline
+type IngestStats struct {
+	QueueDepth      int     `json:"queue_depth"`
+	QueueCapacity   int     `json:"queue_capacity"`
+	Workers         int     `json:"workers"`
+	Ingested        int64   `json:"ingested"` // Gravados
+	Rejected        int64   `json:"rejected"` // Recusados por backpressure
+	Failed          int64   `json:"failed"`   // Perdidos: falha na gravação e no spill
+	Retries         int64   `json:"retries"`  // Retentativas de INSERT
+	Spilled         int64   `json:"spilled"`  // Gravados em disco para regravação posterior
+	Batches         int64   `json:"batches"`
+	EventsPerSecond float64 `json:"events_per_second"` // Média dos últimos 10s
+}
+
+type ingestPipeline struct {
+	s       *TelemetryService
+	queue   chan *TelemetryEvent
+	workers []chan func()
+
+	mu      sync.Mutex // Serializa enqueue (checagem + envio) e stop
+	stopped bool
+
+	writerWg sync.WaitGroup
+	workerWg sync.WaitGroup
+
+	pendingSnapshots sync.Map // appID → snapshot já agendado
+
+	spillDir    atomic.Value  // string: diretório dos lotes que não puderam ser gravados
+	replaySpill chan struct{} // Pede regravação imediata do spill
+
+	ingested, rejected, failed, batches, retries, spilled int64
+
+	// Throughput: eventos gravados por segundo (janela circular)
+	rateMu      sync.Mutex
+	rateBuckets [ingestRateWindow]int64
+	rateSecond  int64
+}
+
+func newIngestPipeline(s *TelemetryService) *ingestPipeline {
+	p := &ingestPipeline{
+		s:           s,
+		queue:       make(chan *TelemetryEvent, IngestQueueCapacity),
+		workers:     make([]chan func(), IngestWorkers),
+		replaySpill: make(chan struct{}, 1),
+	}
+	for i := range p.workers {
+		tasks := make(chan func(), IngestWorkerBacklog)
+		p.workers[i] = tasks
+		p.workerWg.Add(1)
+		go func() {
+			defer p.workerWg.Done()
+			for task := range tasks {
+				task()
+			}
+		}()
+	}
+	p.writerWg.Add(1)
+	go p.writeLoop()
+	return p
+}
+
+// ========================================
+// ENTRADA
+// ========================================
+
+// enqueue aceita todos os eventos ou nenhum (backpressure)
+func (p *ingestPipeline) enqueue(events ...*TelemetryEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return ErrIngestStopped
+	}
+	if len(p.queue)+len(events) > cap(p.queue) {
+		atomic.AddInt64(&p.rejected, int64(len(events)))
+		observability.RecordTelemetryRejected(len(events))
+		return ErrIngestQueueFull
+	}
+	for _, event := range events {
+		p.queue <- event // Não bloqueia: espaço verificado sob o lock
+	}
+	observability.SetTelemetryQueueDepth(len(p.queue))
+	return nil
+}
+
+// stop recusa novos eventos, grava o que está na fila e espera os workers
+func (p *ingestPipeline) stop() {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return
+	}
+	p.stopped = true
+	close(p.queue)
+	p.mu.Unlock()
+
+	p.writerWg.Wait()
+	p.workerWg.Wait()
+}
+
+// ========================================
+// GRAVAÇÃO EM LOTE
+// ========================================
+
+func (p *ingestPipeline) writeLoop() {
+	defer p.writerWg.Done()
+	ticker := time.NewTicker(IngestFlushInterval)
+	defer ticker.Stop()
+
+	spillTicker := time.NewTicker(IngestSpillInterval)
+	defer spillTicker.Stop()
+
+	batch := make([]*TelemetryEvent, 0, IngestBatchSize)
+	for {
+		select {
+		case event, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				for _, tasks := range p.workers {
+					close(tasks)
+				}
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= IngestBatchSize {
+				p.flush(batch)
+				batch = make([]*TelemetryEvent, 0, IngestBatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = make([]*TelemetryEvent, 0, IngestBatchSize)
+			}
+			observability.SetTelemetryQueueDepth(len(p.queue))
+		case <-spillTicker.C:
+			p.replaySpilled()
+		case <-p.replaySpill:
+			p.replaySpilled()
+		}
+	}
+}
+
+// flush grava o lote (INSERT multi-linha) e agenda o processamento.
+// Evento aceito não é descartado: após as retentativas o lote vai para o spill em disco.
+func (p *ingestPipeline) flush(batch []*TelemetryEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	inserted, err := p.writeWithRetry(batch)
+	if err != nil {
+		p.spill(batch, err)
+		return
+	}
+	if inserted {
+		p.process(batch)
+	}
+}
+
+// writeWithRetry tenta o INSERT com backoff exponencial (bloqueia o writer: a fila
+// enche e a ingestão responde 429 em vez de aceitar o que não consegue gravar)
+func (p *ingestPipeline) writeWithRetry(batch []*TelemetryEvent) (bool, error) {
+	backoff := IngestRetryBackoff
+	var err error
+	for attempt := 0; attempt <= IngestWriteRetries; attempt++ {
+		if attempt > 0 {
+			atomic.AddInt64(&p.retries, 1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var inserted bool
+		if inserted, err = p.writeBatch(batch); err == nil {
+			return inserted, nil
+		}
+		log.Printf("⚠️ [TELEMETRY] Batch insert failed: events=%d attempt=%d err=%v", len(batch), attempt+1, err)
+	}
+	return false, err
+}
+
+// writeBatch INSERT idempotente + contadores dos rollups na mesma transação.
+// O lote é atômico: inserted=false quando já estava gravado (spill de um commit
+// sem resposta) e então não é somado nem processado de novo.
+func (p *ingestPipeline) writeBatch(batch []*TelemetryEvent) (inserted bool, err error) {
+	err = p.s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(batch, IngestBatchSize)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		inserted = true
+		return recordEventRollups(tx, batch)
+	})
+	return inserted && err == nil, err
+}
+
+// process contadores, rollups, sessões, alertas e snapshot de um lote gravado
+func (p *ingestPipeline) process(batch []*TelemetryEvent) {
+	atomic.AddInt64(&p.ingested, int64(len(batch)))
+	atomic.AddInt64(&p.batches, 1)
+	observability.RecordTelemetryBatch(len(batch))
+	p.recordRate(len(batch))
+
+	// Sessão + stream (rules) no worker da sessão: preserva a ordem por sessão
+	errorEvents := make(map[uuid.UUID]*TelemetryEvent)
+	apps := make(map[uuid.UUID]bool)
+	for _, event := range batch {
+		event := event
+		p.dispatch(event.SessionID, func() {
+			p.s.updateSession(event)
+			if p.s.eventCallback != nil {
+				p.s.eventCallback(event)
+			}
+		})
+		apps[event.AppID] = true
+		if strings.HasPrefix(event.Type, "error.") {
+			errorEvents[event.AppID] = event
+		}
+	}
+
+	// Alertas e snapshot: uma vez por app por lote
+	for appID, event := range errorEvents {
+		appID, event := appID, event
+		p.dispatch(appID, func() { p.s.checkAlerts(appID, event) })
+	}
+	for appID := range apps {
+		if _, scheduled := p.pendingSnapshots.LoadOrStore(appID, struct{}{}); scheduled {
+			continue // Snapshot já agendado cobre este lote
+		}
+		appID := appID
+		p.dispatch(appID, func() {
+			p.pendingSnapshots.Delete(appID)
+			p.s.updateMetricsSnapshot(appID)
+		})
+	}
+}
+
+// dispatch envia a tarefa ao worker da chave (bloqueia se o worker está cheio)
+func (p *ingestPipeline) dispatch(key uuid.UUID, task func()) {
+	h := fnv.New32a()
+	h.Write(key[:])
+	p.workers[h.Sum32()%uint32(len(p.workers))] <- task
+}
+
+// ========================================
+// SPILL - Lotes que o banco recusou, em disco até a regravação
+// ========================================
+
+// SetIngestSpillDir diretório dos lotes não gravados (NDJSON). Lotes já existentes
+// (de uma execução anterior) são regravados em seguida.
+func (s *TelemetryService) SetIngestSpillDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("telemetry spill: %w", err)
+	}
+	s.pipeline.spillDir.Store(dir)
+	select {
+	case s.pipeline.replaySpill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (p *ingestPipeline) spillPath() string {
+	dir, _ := p.spillDir.Load().(string)
+	return dir
+}
+
+// spill grava o lote em disco (fsync); sem diretório configurado o lote é perdido
+func (p *ingestPipeline) spill(batch []*TelemetryEvent, cause error) {
+	dir := p.spillPath()
+	if dir == "" {
+		atomic.AddInt64(&p.failed, int64(len(batch)))
+		observability.RecordTelemetryFailed(len(batch))
+		log.Printf("❌ [TELEMETRY] Batch lost (no spill dir): events=%d err=%v", len(batch), cause)
+		return
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("events-%s-%s.ndjson", time.Now().UTC().Format("20060102T150405.000"), uuid.NewString()[:8]))
+	if err := writeSpillFile(path, batch); err != nil {
+		os.Remove(path)
+		atomic.AddInt64(&p.failed, int64(len(batch)))
+		observability.RecordTelemetryFailed(len(batch))
+		log.Printf("❌ [TELEMETRY] Batch lost (spill failed): events=%d insert=%v spill=%v", len(batch), cause, err)
+		return
+	}
+	atomic.AddInt64(&p.spilled, int64(len(batch)))
+	log.Printf("💾 [TELEMETRY] Batch spilled to %s: events=%d err=%v", path, len(batch), cause)
+}
+
+func writeSpillFile(path string, batch []*TelemetryEvent) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, event := range batch {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func readSpillFile(path string) ([]*TelemetryEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []*TelemetryEvent
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		var event TelemetryEvent
+		if err := dec.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
+
+// replaySpilled regrava os lotes em disco (no writer: mesma ordem de processamento).
+// Para no primeiro erro; o restante fica para o próximo ciclo.
+func (p *ingestPipeline) replaySpilled() {
+	dir := p.spillPath()
+	if dir == "" {
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "events-*.ndjson"))
+	for _, path := range paths {
+		events, err := readSpillFile(path)
+		if err != nil {
+			log.Printf("⚠️ [TELEMETRY] Unreadable spill file %s: %v", path, err)
+			continue
+		}
+		inserted, err := p.writeBatch(events)
+		if err != nil {
+			log.Printf("⚠️ [TELEMETRY] Spill replay failed: file=%s err=%v", path, err)
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("⚠️ [TELEMETRY] Removing spill file %s: %v", path, err)
+		}
+		if inserted {
+			p.process(events)
+		}
+	}
+}
+
+// ========================================
+// ESTATÍSTICAS
+// ========================================
+
+func (p *ingestPipeline) recordRate(n int) {
+	now := time.Now().Unix()
+	p.rateMu.Lock()
+	defer p.rateMu.Unlock()
+	p.advanceRate(now)
+	p.rateBuckets[now%ingestRateWindow] += int64(n)
+}
+
+// advanceRate zera os buckets dos segundos sem gravação (chamar com rateMu)
+func (p *ingestPipeline) advanceRate(now int64) {
+	if now-p.rateSecond >= ingestRateWindow {
+		p.rateBuckets = [ingestRateWindow]int64{}
+	} else {
+		for second := p.rateSecond + 1; second <= now; second++ {
+			p.rateBuckets[second%ingestRateWindow] = 0
+		}
+	}
+	if now > p.rateSecond {
+		p.rateSecond = now
+	}
+}
+
+func (p *ingestPipeline) stats() IngestStats {
+	p.rateMu.Lock()
+	p.advanceRate(time.Now().Unix())
+	var window int64
+	for _, count := range p.rateBuckets {
+		window += count
+	}
+	p.rateMu.Unlock()
+
+	return IngestStats{
+		QueueDepth:      len(p.queue),
+		QueueCapacity:   cap(p.queue),
+		Workers:         len(p.workers),
+		Ingested:        atomic.LoadInt64(&p.ingested),
+		Rejected:        atomic.LoadInt64(&p.rejected),
+		Failed:          atomic.LoadInt64(&p.failed),
+		Retries:         atomic.LoadInt64(&p.retries),
+		Spilled:         atomic.LoadInt64(&p.spilled),
+		Batches:         atomic.LoadInt64(&p.batches),
+		EventsPerSecond: float64(window) / ingestRateWindow,
+	}
+}
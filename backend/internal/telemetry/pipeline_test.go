@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// TESTES - Pipeline de ingestão
+// ========================================
+
+func newTestTelemetryService(t *testing.T) *TelemetryService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "telemetry.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1) // writer e workers compartilham o arquivo
+	return NewTelemetryService(db)
+}
+
+func TestIngestBatchWritesAndDrainsOnStop(t *testing.T) {
+	s := newTestTelemetryService(t)
+	appID, userID, sessionID := uuid.New(), uuid.New(), uuid.New()
+
+	var streamed int
+	s.SetEventCallback(func(event *TelemetryEvent) { streamed++ }) // Mesmo worker por sessão: sem corrida
+
+	reqs := make([]IngestEventRequest, 0, 601)
+	for i := 0; i < 600; i++ {
+		reqs = append(reqs, IngestEventRequest{UserID: userID.String(), SessionID: sessionID.String(), Type: "interaction.click"})
+	}
+	reqs = append(reqs, IngestEventRequest{UserID: "inválido", Type: "interaction.click"})
+
+	accepted, failed, err := s.IngestBatch(appID, reqs, "127.0.0.1", "test")
+	if err != nil || accepted != 600 || failed != 1 {
+		t.Fatalf("lote inesperado: accepted=%d failed=%d err=%v", accepted, failed, err)
+	}
+
+	s.Stop() // Drena fila e workers
+
+	var events int64
+	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", appID).Count(&events)
+	if events != 600 {
+		t.Fatalf("todos os eventos deveriam ser gravados no stop: %d", events)
+	}
+	var session AppSession
+	if err := s.db.Where("id = ?", sessionID).First(&session).Error; err != nil || session.EventCount != 600 || session.InteractionCount != 599 {
+		t.Fatalf("sessão deveria refletir os eventos em ordem: %+v %v", session, err)
+	}
+	if streamed != 600 {
+		t.Errorf("stream deveria receber todos os eventos: %d", streamed)
+	}
+
+	stats := s.IngestStats()
+	if stats.Ingested != 600 || stats.Batches < 2 || stats.QueueDepth != 0 {
+		t.Errorf("estatísticas inesperadas: %+v", stats)
+	}
+	if err := s.IngestEvent(appID, &reqs[0], "", ""); !errors.Is(err, ErrIngestStopped) {
+		t.Errorf("pipeline parado deveria recusar eventos: %v", err)
+	}
+}
+
+func TestIngestBackpressureReturns429(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Fila pequena sem writer: nada é consumido
+	p := &ingestPipeline{queue: make(chan *TelemetryEvent, 2)}
+	if err := p.enqueue(&TelemetryEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.enqueue(&TelemetryEvent{}, &TelemetryEvent{}); !errors.Is(err, ErrIngestQueueFull) {
+		t.Fatalf("fila cheia deveria recusar: %v", err)
+	}
+	if len(p.queue) != 1 || p.stats().Rejected != 2 {
+		t.Fatalf("lote recusado não deveria entrar parcialmente: depth=%d", len(p.queue))
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondIngestError(c, ErrIngestQueueFull)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("esperado 429 com Retry-After: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestIngestSpillReplaysFailedBatch(t *testing.T) {
+	s := newTestTelemetryService(t)
+	s.pipeline.spillDir.Store(t.TempDir()) // Sem o gatilho de SetIngestSpillDir: regravação só pelo teste
+	appID, userID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	batch := make([]*TelemetryEvent, 3)
+	for i := range batch {
+		batch[i] = &TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: userID, SessionID: sessionID,
+			Type: "interaction.click", Timestamp: time.Now(), IngestedAt: time.Now()}
+	}
+
+	// Banco indisponível depois das retentativas: lote vai para o disco, não é perdido
+	s.pipeline.spill(batch, errors.New("database unavailable"))
+	if stats := s.IngestStats(); stats.Spilled != 3 || stats.Failed != 0 {
+		t.Fatalf("lote deveria ir para o spill: %+v", stats)
+	}
+
+	s.pipeline.replaySpilled()
+	s.pipeline.replaySpilled() // Arquivo removido: não regrava de novo
+	s.Stop()
+
+	var events int64
+	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", appID).Count(&events)
+	if events != 3 {
+		t.Fatalf("spill deveria ser regravado uma vez: %d", events)
+	}
+	var session AppSession
+	if err := s.db.Where("id = ?", sessionID).First(&session).Error; err != nil || session.EventCount != 3 {
+		t.Errorf("lote regravado deveria ser processado: %+v %v", session, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(s.pipeline.spillPath(), "*.ndjson")); len(files) != 0 {
+		t.Errorf("arquivo de spill deveria ser removido: %v", files)
+	}
+}
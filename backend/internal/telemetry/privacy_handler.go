@@ -0,0 +1,70 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// PRIVACY HANDLERS - Anonimização de IP e GeoIP por app
+// ========================================
+
+// privacyRequest payload de atualização (campos omitidos mantêm o valor atual)
+type privacyRequest struct {
+	AnonymizeIP   *bool `json:"anonymize_ip"`
+	GeoEnrichment *bool `json:"geo_enrichment"`
+}
+
+// GetPrivacySettingsAdmin configuração de privacidade do app
+// GET /api/v1/admin/telemetry/apps/:id/privacy
+func (h *TelemetryHandler) GetPrivacySettingsAdmin(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	settings, err := h.service.GetPrivacySettings(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePrivacySettingsAdmin altera a configuração (vale para eventos futuros)
+// PUT /api/v1/admin/telemetry/apps/:id/privacy
+func (h *TelemetryHandler) UpdatePrivacySettingsAdmin(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	var req privacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings, err := h.service.GetPrivacySettings(appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AnonymizeIP != nil {
+		settings.AnonymizeIP = *req.AnonymizeIP
+	}
+	if req.GeoEnrichment != nil {
+		settings.GeoEnrichment = *req.GeoEnrichment
+	}
+	settings.UpdatedBy = c.GetString("userID")
+
+	if err := h.service.UpdatePrivacySettings(settings); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
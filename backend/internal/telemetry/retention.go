@@ -0,0 +1,367 @@
+package telemetry
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"prost-qs/backend/internal/usage"
+)
+
+// ========================================
+// RETENTION - Expurgo de dados brutos por plano
+// "Agregados ficam; eventos brutos expiram"
+// ========================================
+
+// Destino dos dados expirados
+const (
+	RetentionModeDelete  = "delete"  // Apaga
+	RetentionModeArchive = "archive" // Exporta NDJSON gzip em disco e apaga
+)
+
+const (
+	RetentionChunkSize = 1000
+	RetentionInterval  = time.Hour // Intervalo entre execuções do job
+)
+
+// RetentionOptions como os dados expirados são tratados
+type RetentionOptions struct {
+	Mode       string // delete (padrão) ou archive
+	ArchiveDir string // Obrigatório em archive
+	// Rollup garante que os agregados cobrem os eventos antes de apagar:
+	// espera o backfill inicial e compacta os minutos pendentes em horas.
+	Rollup bool
+}
+
+// retentionTable tabela bruta sujeita a retenção
+type retentionTable struct {
+	name   string
+	model  interface{}
+	column string // Coluna de tempo comparada com o corte
+}
+
+// Sessões entram pelo último sinal de vida: sessões ativas nunca expiram
+var retentionTables = []retentionTable{
+	{name: "events", model: &TelemetryEvent{}, column: "timestamp"},
+	{name: "sessions", model: &AppSession{}, column: "last_seen_at"},
+	{name: "alerts", model: &AlertHistory{}, column: "created_at"},
+}
+
+// RetentionRun relatório de um expurgo (só gravado quando algo aconteceu)
+type RetentionRun struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID         uuid.UUID  `gorm:"type:uuid;index" json:"app_id"`
+	Plan          string     `gorm:"size:50" json:"plan"`
+	RetentionDays int        `json:"retention_days"`
+	Cutoff        time.Time  `json:"cutoff"`
+	Mode          string     `gorm:"size:10" json:"mode"`
+	Rollup        bool       `json:"rollup"`
+	Events        int64      `json:"events"`
+	Sessions      int64      `json:"sessions"`
+	Alerts        int64      `json:"alerts"`
+	Archives      string     `gorm:"type:text" json:"archives,omitempty"` // Arquivos gerados (separados por vírgula)
+	Complete      bool       `json:"complete"`                            // false = interrompido, continua na próxima execução
+	Error         string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt     time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+func (RetentionRun) TableName() string {
+	return "telemetry_retention_runs"
+}
+
+// purged total apagado no run
+func (r *RetentionRun) purged() int64 {
+	return r.Events + r.Sessions + r.Alerts
+}
+
+// SetPlanResolver define como descobrir o plano de um app (padrão: free).
+// Erro = plano desconhecido: o app não é expurgado nessa execução.
+func (s *TelemetryService) SetPlanResolver(resolver func(appID uuid.UUID) (string, error)) {
+	s.planResolver = resolver
+}
+
+// SetRetentionOptions define o tratamento dos dados expirados
+func (s *TelemetryService) SetRetentionOptions(opts RetentionOptions) error {
+	if opts.Mode == "" {
+		opts.Mode = RetentionModeDelete
+	}
+	switch opts.Mode {
+	case RetentionModeDelete:
+	case RetentionModeArchive:
+		if opts.ArchiveDir == "" {
+			return fmt.Errorf("retention: archive exige um diretório")
+		}
+		if err := os.MkdirAll(opts.ArchiveDir, 0o750); err != nil {
+			return fmt.Errorf("retention: diretório de arquivo: %w", err)
+		}
+	default:
+		return fmt.Errorf("retention: modo %q inválido", opts.Mode)
+	}
+	s.retention = opts
+	return nil
+}
+
+// retentionPlan plano e dias de retenção do app
+func (s *TelemetryService) retentionPlan(appID uuid.UUID) (string, int, error) {
+	plan := ""
+	if s.planResolver != nil {
+		var err error
+		if plan, err = s.planResolver(appID); err != nil {
+			return "", 0, err
+		}
+	}
+	limit := usage.GetLimit(plan)
+	return limit.PlanID, limit.TelemetryRetention, nil
+}
+
+// RunRetention expurga todos os apps com dados, até ctx expirar.
+// Retorna os relatórios e se todos os apps foram concluídos.
+func (s *TelemetryService) RunRetention(ctx context.Context) ([]RetentionRun, bool) {
+	var appIDs []uuid.UUID
+	var alertApps []uuid.UUID
+	s.db.Model(&AppMetricsSnapshot{}).Pluck("app_id", &appIDs)
+	s.db.Model(&AlertHistory{}).Distinct("app_id").Pluck("app_id", &alertApps)
+	seen := make(map[uuid.UUID]bool, len(appIDs))
+	for _, appID := range appIDs {
+		seen[appID] = true
+	}
+	for _, appID := range alertApps {
+		if !seen[appID] {
+			appIDs = append(appIDs, appID)
+		}
+	}
+
+	var runs []RetentionRun
+	for _, appID := range appIDs {
+		if ctx.Err() != nil {
+			return runs, false
+		}
+		run, err := s.PurgeApp(ctx, appID)
+		if err != nil {
+			log.Printf("⚠️ [TELEMETRY] Retention failed for app %s: %v", appID, err)
+		}
+		if run != nil && (run.purged() > 0 || !run.Complete) {
+			runs = append(runs, *run)
+		}
+		if run != nil && !run.Complete {
+			return runs, false
+		}
+	}
+	return runs, true
+}
+
+// PurgeApp expurga em blocos os dados do app anteriores ao corte do plano
+func (s *TelemetryService) PurgeApp(ctx context.Context, appID uuid.UUID) (*RetentionRun, error) {
+	opts := s.retention
+	if opts.Mode == "" {
+		opts.Mode = RetentionModeDelete
+	}
+	plan, days, err := s.retentionPlan(appID)
+	if err != nil {
+		return nil, fmt.Errorf("retention: plano do app %s: %w", appID, err)
+	}
+	now := time.Now()
+	run := &RetentionRun{
+		ID:            uuid.New(),
+		AppID:         appID,
+		Plan:          plan,
+		RetentionDays: days,
+		Mode:          opts.Mode,
+		Rollup:        opts.Rollup,
+		StartedAt:     now,
+	}
+	if days <= 0 {
+		run.Complete = true // Retenção ilimitada
+		return run, nil
+	}
+	run.Cutoff = now.AddDate(0, 0, -days)
+
+	if opts.Rollup {
+		if !s.rollupsReady.Load() {
+			// Backfill em andamento: nada é apagado antes de estar agregado
+			run.Error = "aguardando backfill dos rollups"
+			return run, nil
+		}
+		if err := s.compactRollups(); err != nil {
+			return s.finishRetentionRun(run, err)
+		}
+	}
+
+	var archives []string
+	for _, table := range retentionTables {
+		purged, archive, err := s.purgeTable(ctx, run, table, opts)
+		if archive != "" {
+			archives = append(archives, archive)
+		}
+		switch table.name {
+		case "events":
+			run.Events = purged
+		case "sessions":
+			run.Sessions = purged
+		case "alerts":
+			run.Alerts = purged
+		}
+		run.Archives = strings.Join(archives, ",")
+		if err != nil {
+			return s.finishRetentionRun(run, err)
+		}
+		if ctx.Err() != nil {
+			return s.finishRetentionRun(run, nil)
+		}
+	}
+
+	run.Complete = true
+	return s.finishRetentionRun(run, nil)
+}
+
+// finishRetentionRun grava o relatório quando houve expurgo, erro ou interrupção
+func (s *TelemetryService) finishRetentionRun(run *RetentionRun, runErr error) (*RetentionRun, error) {
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+	if run.purged() > 0 || runErr != nil || !run.Complete {
+		if err := s.db.Create(run).Error; err != nil && runErr == nil {
+			runErr = err
+		}
+		log.Printf("🧹 [TELEMETRY] Retention app=%s plan=%s days=%d events=%d sessions=%d alerts=%d complete=%v",
+			run.AppID, run.Plan, run.RetentionDays, run.Events, run.Sessions, run.Alerts, run.Complete)
+	}
+	return run, runErr
+}
+
+// purgeTable apaga (e opcionalmente arquiva) em blocos de RetentionChunkSize.
+// Cada bloco é gravado e sincronizado em disco antes de ser apagado.
+func (s *TelemetryService) purgeTable(ctx context.Context, run *RetentionRun, table retentionTable, opts RetentionOptions) (int64, string, error) {
+	var purged int64
+	var archive *retentionArchive
+	defer func() {
+		if archive != nil {
+			archive.close()
+		}
+	}()
+
+	for ctx.Err() == nil {
+		var rows []map[string]interface{}
+		query := s.db.Model(table.model).
+			Where("app_id = ? AND "+table.column+" < ?", run.AppID, run.Cutoff).
+			Order(table.column).
+			Limit(RetentionChunkSize)
+		if opts.Mode == RetentionModeArchive {
+			if err := query.Find(&rows).Error; err != nil {
+				return purged, archivePath(archive), err
+			}
+		} else {
+			var ids []string
+			if err := query.Pluck("id", &ids).Error; err != nil {
+				return purged, archivePath(archive), err
+			}
+			for _, id := range ids {
+				rows = append(rows, map[string]interface{}{"id": id})
+			}
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		if opts.Mode == RetentionModeArchive {
+			if archive == nil {
+				var err error
+				if archive, err = openRetentionArchive(opts.ArchiveDir, run, table.name); err != nil {
+					return purged, "", err
+				}
+			}
+			if err := archive.write(rows); err != nil {
+				return purged, archive.path, err
+			}
+		}
+
+		ids := make([]interface{}, len(rows))
+		for i, row := range rows {
+			ids[i] = row["id"]
+		}
+		result := s.db.Where("id IN ?", ids).Delete(table.model)
+		if result.Error != nil {
+			return purged, archivePath(archive), result.Error
+		}
+		purged += result.RowsAffected
+		if len(rows) < RetentionChunkSize {
+			break
+		}
+	}
+	return purged, archivePath(archive), nil
+}
+
+// ListRetentionRuns relatórios de expurgo de um app (mais recentes primeiro)
+func (s *TelemetryService) ListRetentionRuns(appID uuid.UUID, limit int) ([]RetentionRun, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	var runs []RetentionRun
+	err := s.db.Where("app_id = ?", appID).Order("started_at DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// ========================================
+// ARCHIVE - NDJSON gzip em disco local
+// ========================================
+
+// retentionArchive um arquivo por app/tabela/run: <dir>/<app>/<tabela>-<data>-<run>.ndjson.gz
+type retentionArchive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func openRetentionArchive(dir string, run *RetentionRun, table string) (*retentionArchive, error) {
+	appDir := filepath.Join(dir, run.AppID.String())
+	if err := os.MkdirAll(appDir, 0o750); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s-%s-%s.ndjson.gz", table, run.StartedAt.UTC().Format("20060102T150405"), run.ID.String()[:8])
+	path := filepath.Join(appDir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &retentionArchive{path: path, file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// write grava o bloco e força o disco (só então o bloco pode ser apagado)
+func (a *retentionArchive) write(rows []map[string]interface{}) error {
+	for _, row := range rows {
+		if err := a.enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *retentionArchive) close() {
+	if err := a.gz.Close(); err != nil {
+		log.Printf("⚠️ [TELEMETRY] Closing archive %s: %v", a.path, err)
+	}
+	a.file.Close()
+}
+
+func archivePath(a *retentionArchive) string {
+	if a == nil {
+		return ""
+	}
+	return a.path
+}
@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// RETENTION HANDLERS - Relatórios e expurgo manual
+// ========================================
+
+// ListRetentionRunsAdmin relatórios de expurgo do app
+// GET /api/v1/admin/telemetry/apps/:id/purges?limit=50
+func (h *TelemetryHandler) ListRetentionRunsAdmin(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	runs, err := h.service.ListRetentionRuns(appID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "total": len(runs)})
+}
+
+// PurgeAppAdmin aplica a retenção do plano agora (até 25s; o restante fica para o job)
+// POST /api/v1/admin/telemetry/apps/:id/purges
+func (h *TelemetryHandler) PurgeAppAdmin(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 25*time.Second)
+	defer cancel()
+
+	run, err := h.service.PurgeApp(ctx, appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "run": run})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,76 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"prost-qs/backend/internal/jobs"
+)
+
+// ========================================
+// RETENTION JOB - Execução periódica via JobService
+// ========================================
+
+const JobTypeTelemetryRetention = "telemetry_retention"
+
+// RetentionJobPayload app_id vazio = todos os apps
+type RetentionJobPayload struct {
+	AppID string `json:"app_id,omitempty"`
+}
+
+// RegisterRetentionJobHandlers registra o job de retenção e agenda a primeira execução.
+// O job se reagenda: RetentionInterval depois de concluir, ou em seguida se foi interrompido.
+func RegisterRetentionJobHandlers(jobService *jobs.JobService, telemetryService *TelemetryService) {
+	jobService.RegisterHandler(JobTypeTelemetryRetention, func(ctx context.Context, job *jobs.Job) error {
+		return handleRetention(ctx, job, jobService, telemetryService)
+	})
+
+	if _, err := jobService.EnqueueIfIdle(JobTypeTelemetryRetention, RetentionJobPayload{}); err != nil {
+		log.Printf("⚠️ [TELEMETRY] Failed to schedule retention job: %v", err)
+	}
+}
+
+// handleRetention processa job de retenção
+func handleRetention(ctx context.Context, job *jobs.Job, jobService *jobs.JobService, telemetryService *TelemetryService) error {
+	var payload RetentionJobPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	// Deixa folga antes do timeout do worker para gravar o relatório
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-2*time.Second))
+		defer cancel()
+	}
+
+	if payload.AppID != "" {
+		appID, err := uuid.Parse(payload.AppID)
+		if err != nil {
+			return fmt.Errorf("invalid app id: %w", err)
+		}
+		_, err = telemetryService.PurgeApp(ctx, appID)
+		return err
+	}
+
+	runs, complete := telemetryService.RunRetention(ctx)
+	var purged int64
+	for i := range runs {
+		purged += runs[i].purged()
+	}
+	log.Printf("🧹 [TELEMETRY] Retention pass: apps=%d purged=%d complete=%v", len(runs), purged, complete)
+
+	next := RetentionInterval
+	if !complete {
+		next = time.Minute
+	}
+	if _, err := jobService.Enqueue(JobTypeTelemetryRetention, RetentionJobPayload{}, jobs.WithDelay(next)); err != nil {
+		return fmt.Errorf("reschedule retention: %w", err)
+	}
+	return nil
+}
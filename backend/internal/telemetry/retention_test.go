@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Retenção por plano
+// ========================================
+
+func TestPurgeAppArchivesAndDeletesExpiredData(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	appID, proApp, unknownApp := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+	old := now.AddDate(0, 0, -10) // Além dos 7 dias do free, dentro dos 30 do pro
+
+	s.SetPlanResolver(func(id uuid.UUID) (string, error) {
+		switch id {
+		case proApp:
+			return "pro", nil
+		case unknownApp:
+			return "", errors.New("billing indisponível") // Não vira free: fica para a próxima execução
+		}
+		return "", nil
+	})
+	dir := t.TempDir()
+	if err := s.SetRetentionOptions(RetentionOptions{Mode: RetentionModeArchive, ArchiveDir: dir, Rollup: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, app := range []uuid.UUID{appID, proApp, unknownApp} {
+		s.db.Create(&AppMetricsSnapshot{ID: uuid.New(), AppID: app})
+		for i := 0; i < 3; i++ {
+			s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: app, UserID: uuid.New(), SessionID: uuid.New(),
+				Type: EventInteractionMatchCreated, Timestamp: old, IngestedAt: old})
+		}
+		s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: app, UserID: uuid.New(), SessionID: uuid.New(),
+			Type: EventSessionStart, Timestamp: now, IngestedAt: now})
+		s.db.Create(&AppSession{ID: uuid.New(), AppID: app, UserID: uuid.New(), StartedAt: old, LastSeenAt: old.Add(time.Minute)})
+		s.db.Create(&AppSession{ID: uuid.New(), AppID: app, UserID: uuid.New(), StartedAt: now, LastSeenAt: now})
+		s.db.Create(&AlertHistory{ID: uuid.New(), AppID: app, Type: "error_spike", CreatedAt: old})
+	}
+
+	runs, complete := s.RunRetention(context.Background())
+	if !complete || len(runs) != 1 {
+		t.Fatalf("só o app free deveria ter expurgo: complete=%v runs=%+v", complete, runs)
+	}
+	run := runs[0]
+	if run.AppID != appID || run.Plan != "free" || run.RetentionDays != 7 ||
+		run.Events != 3 || run.Sessions != 1 || run.Alerts != 1 || !run.Complete {
+		t.Fatalf("relatório inesperado: %+v", run)
+	}
+
+	var events, sessions, alerts int64
+	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", appID).Count(&events)
+	s.db.Model(&AppSession{}).Where("app_id = ?", appID).Count(&sessions)
+	s.db.Model(&AlertHistory{}).Where("app_id = ?", appID).Count(&alerts)
+	if events != 1 || sessions != 1 || alerts != 0 {
+		t.Errorf("deveriam restar só os dados recentes: events=%d sessions=%d alerts=%d", events, sessions, alerts)
+	}
+	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", proApp).Count(&events)
+	if events != 4 {
+		t.Errorf("pro retém 30 dias: %d eventos", events)
+	}
+	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", unknownApp).Count(&events)
+	if events != 4 {
+		t.Errorf("app sem plano resolvido não deveria ser expurgado: %d eventos", events)
+	}
+
+	// Arquivo NDJSON gzip com os 3 eventos expurgados
+	archives := strings.Split(run.Archives, ",")
+	if len(archives) != 3 || !strings.Contains(archives[0], "events-") {
+		t.Fatalf("esperado um arquivo por tabela: %q", run.Archives)
+	}
+	f, err := os.Open(archives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := 0
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		if !strings.Contains(scanner.Text(), EventInteractionMatchCreated) {
+			t.Errorf("linha arquivada inesperada: %s", scanner.Text())
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Errorf("arquivo deveria ter 3 eventos: %d", lines)
+	}
+
+	stored, _ := s.ListRetentionRuns(appID, 10)
+	if len(stored) != 1 || stored[0].Events != 3 {
+		t.Errorf("relatório deveria ser persistido: %+v", stored)
+	}
+	if again, complete := s.RunRetention(context.Background()); !complete || len(again) != 0 {
+		t.Errorf("segunda execução não deveria expurgar nada: %+v", again)
+	}
+}
@@ -0,0 +1,758 @@
+package telemetry
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ========================================
+// ROLLUPS - Agregação incremental
+// "Contar uma vez, na entrada. Ler somas, não eventos."
+// ========================================
+
+const (
+	RollupCompactInterval = time.Minute    // Minutos fechados → horas
+	MinuteRollupRetention = 26 * time.Hour // Minutos compactados mantidos (bordas exatas em janelas de 24h)
+	BounceDuration        = 30 * time.Second
+	rollupBackfillBatch   = 1000
+)
+
+// EventRollupMinute eventos por app/minuto/tipo.
+// Pending é a parte ainda não somada em EventRollupHour; o compactor a zera.
+type EventRollupMinute struct {
+	AppID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	Bucket  time.Time `gorm:"primaryKey;index:idx_rollup_minute_bucket" json:"bucket"`
+	Type    string    `gorm:"size:100;primaryKey" json:"type"`
+	Events  int64     `gorm:"not null;default:0" json:"events"`
+	Pending int64     `gorm:"not null;default:0" json:"pending"`
+}
+
+func (EventRollupMinute) TableName() string {
+	return "telemetry_rollup_minutes"
+}
+
+// EventRollupHour eventos por app/hora/tipo (já compactados)
+type EventRollupHour struct {
+	AppID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	Bucket time.Time `gorm:"primaryKey" json:"bucket"`
+	Type   string    `gorm:"size:100;primaryKey" json:"type"`
+	Events int64     `gorm:"not null;default:0" json:"events"`
+}
+
+func (EventRollupHour) TableName() string {
+	return "telemetry_rollup_hours"
+}
+
+// SessionRollupHour sessões por app e hora de início
+type SessionRollupHour struct {
+	AppID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	Bucket          time.Time `gorm:"primaryKey" json:"bucket"`
+	Started         int64     `gorm:"not null;default:0" json:"started"`
+	Ended           int64     `gorm:"not null;default:0" json:"ended"`
+	DurationMsTotal int64     `gorm:"not null;default:0" json:"duration_ms_total"` // Soma das encerradas
+	Bounces         int64     `gorm:"not null;default:0" json:"bounces"`           // Encerradas em < 30s
+	Interactive     int64     `gorm:"not null;default:0" json:"interactive"`       // Com ao menos uma interação
+}
+
+func (SessionRollupHour) TableName() string {
+	return "telemetry_rollup_sessions"
+}
+
+// UserRollupHour usuários que emitiram eventos em cada hora
+type UserRollupHour struct {
+	AppID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"app_id"`
+	Bucket time.Time `gorm:"primaryKey" json:"bucket"`
+	UserID uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+}
+
+func (UserRollupHour) TableName() string {
+	return "telemetry_rollup_users"
+}
+
+type eventRollupKey struct {
+	AppID  uuid.UUID
+	Bucket time.Time
+	Type   string
+}
+
+func minuteBucket(t time.Time) time.Time { return t.UTC().Truncate(time.Minute) }
+func hourBucket(t time.Time) time.Time   { return t.UTC().Truncate(time.Hour) }
+
+// nextHourBucket primeira hora cheia a partir de t
+func nextHourBucket(t time.Time) time.Time {
+	bucket := hourBucket(t)
+	if bucket.Before(t) {
+		bucket = bucket.Add(time.Hour)
+	}
+	return bucket
+}
+
+// ========================================
+// ESCRITA - Contadores
+// ========================================
+
+// insertEvent grava um evento avulso e soma nos rollups na mesma transação
+func (s *TelemetryService) insertEvent(event *TelemetryEvent) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return recordEventRollups(tx, []*TelemetryEvent{event})
+	})
+}
+
+// eventTotals contadores de um lote por app
+type eventTotals struct {
+	events, interactions int64
+	lastEventAt          time.Time
+}
+
+// recordEventRollups soma eventos nos rollups e nos totais do snapshot.
+// Roda na transação do INSERT: evento gravado é evento contado.
+func recordEventRollups(tx *gorm.DB, events []*TelemetryEvent) error {
+	totals, err := addEventRollups(tx, events)
+	if err != nil {
+		return err
+	}
+	for appID, t := range totals {
+		if err := ensureSnapshot(tx, appID); err != nil {
+			return err
+		}
+		if err := tx.Model(&AppMetricsSnapshot{}).Where("app_id = ?", appID).Updates(map[string]interface{}{
+			"total_events":       gorm.Expr("total_events + ?", t.events),
+			"total_interactions": gorm.Expr("total_interactions + ?", t.interactions),
+		}).Error; err != nil {
+			return err
+		}
+		if err := touchLastEventAt(tx, appID, t.lastEventAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addEventRollups soma os minutos e usuários por hora; devolve os totais por app
+func addEventRollups(tx *gorm.DB, events []*TelemetryEvent) (map[uuid.UUID]*eventTotals, error) {
+	totals := make(map[uuid.UUID]*eventTotals)
+	if len(events) == 0 {
+		return totals, nil
+	}
+
+	minutes := make(map[eventRollupKey]int64)
+	users := make(map[UserRollupHour]struct{})
+	for _, event := range events {
+		minutes[eventRollupKey{event.AppID, minuteBucket(event.Timestamp), event.Type}]++
+		users[UserRollupHour{AppID: event.AppID, Bucket: hourBucket(event.Timestamp), UserID: event.UserID}] = struct{}{}
+
+		t := totals[event.AppID]
+		if t == nil {
+			t = &eventTotals{}
+			totals[event.AppID] = t
+		}
+		t.events++
+		if strings.HasPrefix(event.Type, "interaction.") {
+			t.interactions++
+		}
+		if event.Timestamp.After(t.lastEventAt) {
+			t.lastEventAt = event.Timestamp
+		}
+	}
+
+	minuteRows := make([]EventRollupMinute, 0, len(minutes))
+	for key, n := range minutes {
+		minuteRows = append(minuteRows, EventRollupMinute{AppID: key.AppID, Bucket: key.Bucket, Type: key.Type, Events: n, Pending: n})
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "app_id"}, {Name: "bucket"}, {Name: "type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"events":  gorm.Expr("telemetry_rollup_minutes.events + excluded.events"),
+			"pending": gorm.Expr("telemetry_rollup_minutes.pending + excluded.pending"),
+		}),
+	}).Create(&minuteRows).Error; err != nil {
+		return nil, err
+	}
+
+	userRows := make([]UserRollupHour, 0, len(users))
+	for row := range users {
+		userRows = append(userRows, row)
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userRows).Error; err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
+
+// touchLastEventAt só avança (seguro com lotes fora de ordem)
+func touchLastEventAt(tx *gorm.DB, appID uuid.UUID, at time.Time) error {
+	return tx.Model(&AppMetricsSnapshot{}).
+		Where("app_id = ? AND (last_event_at IS NULL OR last_event_at < ?)", appID, at).
+		Update("last_event_at", at).Error
+}
+
+// recordSessionStart conta uma sessão nova (e interativa, se já tiver interações)
+func (s *TelemetryService) recordSessionStart(session *AppSession) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := addSessionStartRollup(tx, session); err != nil {
+			return err
+		}
+		return tx.Model(&AppMetricsSnapshot{}).Where("app_id = ?", session.AppID).
+			Update("total_sessions", gorm.Expr("total_sessions + 1")).Error
+	})
+}
+
+// addSessionStartRollup hora de início e last_session_at (sem o total do snapshot)
+func addSessionStartRollup(tx *gorm.DB, session *AppSession) error {
+	delta := SessionRollupHour{AppID: session.AppID, Bucket: hourBucket(session.StartedAt), Started: 1}
+	if session.InteractionCount > 0 {
+		delta.Interactive = 1
+	}
+	if err := addSessionRollup(tx, delta); err != nil {
+		return err
+	}
+	if err := ensureSnapshot(tx, session.AppID); err != nil {
+		return err
+	}
+	return tx.Model(&AppMetricsSnapshot{}).
+		Where("app_id = ? AND (last_session_at IS NULL OR last_session_at < ?)", session.AppID, session.StartedAt).
+		Update("last_session_at", session.StartedAt).Error
+}
+
+// recordSessionEnd conta (sign=1) ou desconta (sign=-1, sessão reaberta) um encerramento
+func (s *TelemetryService) recordSessionEnd(session *AppSession, durationMs int64, sign int64) error {
+	return addSessionEndRollup(s.db, session, durationMs, sign)
+}
+
+func addSessionEndRollup(db *gorm.DB, session *AppSession, durationMs int64, sign int64) error {
+	delta := SessionRollupHour{
+		AppID:           session.AppID,
+		Bucket:          hourBucket(session.StartedAt),
+		Ended:           sign,
+		DurationMsTotal: sign * durationMs,
+	}
+	if durationMs < BounceDuration.Milliseconds() {
+		delta.Bounces = sign
+	}
+	return addSessionRollup(db, delta)
+}
+
+// recordSessionInteractive conta a primeira interação de uma sessão
+func (s *TelemetryService) recordSessionInteractive(session *AppSession) error {
+	return addSessionRollup(s.db, SessionRollupHour{AppID: session.AppID, Bucket: hourBucket(session.StartedAt), Interactive: 1})
+}
+
+func addSessionRollup(db *gorm.DB, delta SessionRollupHour) error {
+	increments := make(map[string]interface{})
+	for _, column := range []string{"started", "ended", "duration_ms_total", "bounces", "interactive"} {
+		increments[column] = gorm.Expr("telemetry_rollup_sessions." + column + " + excluded." + column)
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "app_id"}, {Name: "bucket"}},
+		DoUpdates: clause.Assignments(increments),
+	}).Create(&delta).Error
+}
+
+// ensureSnapshot garante a linha do snapshot para os contadores incrementais
+func ensureSnapshot(db *gorm.DB, appID uuid.UUID) error {
+	return db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "app_id"}}, DoNothing: true}).
+		Create(&AppMetricsSnapshot{ID: uuid.New(), AppID: appID}).Error
+}
+
+// ========================================
+// COMPACTOR - Minutos fechados → horas
+// ========================================
+
+// compactRollups soma o pendente dos minutos fechados nas horas e poda minutos antigos.
+// O decremento condicional torna a compactação segura entre réplicas.
+func (s *TelemetryService) compactRollups() error {
+	var rows []EventRollupMinute
+	if err := s.db.Where("pending > 0 AND bucket < ?", minuteBucket(time.Now())).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	activeApps := make(map[uuid.UUID]bool)
+	if len(rows) > 0 {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			hours := make(map[eventRollupKey]int64)
+			for _, row := range rows {
+				result := tx.Model(&EventRollupMinute{}).
+					Where("app_id = ? AND bucket = ? AND type = ? AND pending >= ?", row.AppID, row.Bucket, row.Type, row.Pending).
+					Update("pending", gorm.Expr("pending - ?", row.Pending))
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					continue // Outra réplica já compactou
+				}
+				hours[eventRollupKey{row.AppID, hourBucket(row.Bucket), row.Type}] += row.Pending
+				activeApps[row.AppID] = true
+			}
+			if len(hours) == 0 {
+				return nil
+			}
+
+			hourRows := make([]EventRollupHour, 0, len(hours))
+			for key, n := range hours {
+				hourRows = append(hourRows, EventRollupHour{AppID: key.AppID, Bucket: key.Bucket, Type: key.Type, Events: n})
+			}
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "app_id"}, {Name: "bucket"}, {Name: "type"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"events": gorm.Expr("telemetry_rollup_hours.events + excluded.events")}),
+			}).Create(&hourRows).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Poda: só minutos já compactados
+	if err := s.db.Where("pending = 0 AND bucket < ?", time.Now().UTC().Add(-MinuteRollupRetention)).
+		Delete(&EventRollupMinute{}).Error; err != nil {
+		return err
+	}
+
+	// Total de usuários (identidade) só para apps com atividade, uma vez por ciclo
+	for appID := range activeApps {
+		var totalUsers int64
+		s.db.Table("implicit_users").Where("app_id = ?", appID).Count(&totalUsers)
+		s.db.Model(&AppMetricsSnapshot{}).Where("app_id = ?", appID).Update("total_users", totalUsers)
+	}
+	return nil
+}
+
+// ========================================
+// LEITURA - Somas por janela
+// ========================================
+
+// countEvents eventos por tipo em [start, end).
+// Horas cheias vêm de EventRollupHour (+ pendente); bordas parciais, dos minutos.
+// Bordas anteriores à retenção de minutos (já podados) caem para a hora inteira
+// que as contém: a borda conta a mais, até uma hora de eventos, mas não some.
+func (s *TelemetryService) countEvents(appID uuid.UUID, start, end time.Time) (map[string]int64, error) {
+	start, end = start.UTC(), end.UTC()
+	counts := make(map[string]int64)
+	pruned := time.Now().UTC().Add(-MinuteRollupRetention)
+
+	firstHour, lastHour := nextHourBucket(start), hourBucket(end)
+	if !firstHour.Before(lastHour) {
+		return counts, s.sumEventEdge(counts, appID, start, end, pruned)
+	}
+
+	if err := s.sumEventEdge(counts, appID, start, firstHour, pruned); err != nil {
+		return nil, err
+	}
+	if err := s.sumEventHours(counts, appID, firstHour, lastHour); err != nil {
+		return nil, err
+	}
+	if err := s.sumEventEdge(counts, appID, lastHour, end, pruned); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// sumEventEdge borda parcial [from, to): minutos exatos enquanto retidos,
+// senão as horas que a contêm
+func (s *TelemetryService) sumEventEdge(into map[string]int64, appID uuid.UUID, from, to, pruned time.Time) error {
+	if !from.Before(to) {
+		return nil
+	}
+	if !from.Before(pruned) {
+		return s.sumEventRollups(into, &EventRollupMinute{}, "events", appID, from, to)
+	}
+	return s.sumEventHours(into, appID, hourBucket(from), nextHourBucket(to))
+}
+
+// sumEventHours horas cheias [from, to): compactado + pendente
+func (s *TelemetryService) sumEventHours(into map[string]int64, appID uuid.UUID, from, to time.Time) error {
+	if err := s.sumEventRollups(into, &EventRollupHour{}, "events", appID, from, to); err != nil {
+		return err
+	}
+	return s.sumEventRollups(into, &EventRollupMinute{}, "pending", appID, from, to)
+}
+
+func (s *TelemetryService) sumEventRollups(into map[string]int64, model interface{}, column string, appID uuid.UUID, from, to time.Time) error {
+	type typeTotal struct {
+		Type  string
+		Total int64
+	}
+	var rows []typeTotal
+	err := s.db.Model(model).
+		Select("type, SUM("+column+") as total").
+		Where("app_id = ? AND bucket >= ? AND bucket < ?", appID, from, to).
+		Group("type").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		into[row.Type] += row.Total
+	}
+	return nil
+}
+
+// eventsByHour eventos por hora a partir de since (compactado + pendente)
+func (s *TelemetryService) eventsByHour(appID uuid.UUID, since time.Time) (map[time.Time]int64, error) {
+	from := hourBucket(since)
+	var hours []EventRollupHour
+	if err := s.db.Where("app_id = ? AND bucket >= ?", appID, from).Find(&hours).Error; err != nil {
+		return nil, err
+	}
+	var minutes []EventRollupMinute
+	if err := s.db.Where("app_id = ? AND bucket >= ? AND pending > 0", appID, from).Find(&minutes).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[time.Time]int64)
+	for _, row := range hours {
+		result[hourBucket(row.Bucket)] += row.Events
+	}
+	for _, row := range minutes {
+		result[hourBucket(row.Bucket)] += row.Pending
+	}
+	return result, nil
+}
+
+// activeUsersSince usuários distintos com eventos desde a hora de since
+func (s *TelemetryService) activeUsersSince(appID uuid.UUID, since time.Time) int64 {
+	var count int64
+	s.db.Model(&UserRollupHour{}).
+		Where("app_id = ? AND bucket >= ?", appID, hourBucket(since)).
+		Distinct("user_id").
+		Count(&count)
+	return count
+}
+
+// ========================================
+// BACKFILL - Histórico anterior aos rollups
+// ========================================
+
+// RollupBackfill estado do backfill (linha única): corte fixo, dono e marca d'água.
+// Antes do corte conta o backfill; depois, a ingestão. Retomável por qualquer réplica.
+type RollupBackfill struct {
+	Name            string     `gorm:"size:50;primaryKey" json:"name"`
+	Cutoff          time.Time  `json:"cutoff"`
+	Owner           uuid.UUID  `gorm:"type:uuid" json:"owner"`
+	HeartbeatAt     time.Time  `json:"heartbeat_at"`
+	EventsAfter     *time.Time `json:"events_after,omitempty"` // (ingested_at, id) do último lote somado
+	EventsAfterID   uuid.UUID  `gorm:"type:uuid" json:"events_after_id"`
+	EventsDone      bool       `json:"events_done"`
+	SessionsAfter   *time.Time `json:"sessions_after,omitempty"` // (created_at, id) do último lote somado
+	SessionsAfterID uuid.UUID  `gorm:"type:uuid" json:"sessions_after_id"`
+	Events          int64      `json:"events"`
+	Sessions        int64      `json:"sessions"`
+	StartedAt       time.Time  `json:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+func (RollupBackfill) TableName() string {
+	return "telemetry_rollup_backfills"
+}
+
+const (
+	rollupBackfillName  = "rollups"
+	RollupBackfillLease = 2 * time.Minute  // Dono sem heartbeat por esse tempo perde o backfill
+	RollupBackfillPoll  = 10 * time.Second // Réplicas sem o backfill conferem o andamento
+)
+
+var (
+	errRollupBackfillLost    = errors.New("rollup backfill claimed by another replica")
+	errRollupBackfillStopped = errors.New("rollup backfill interrupted")
+)
+
+// startRollupBackfill reivindica (ou acompanha) o backfill antes da ingestão começar:
+// o corte fica anterior a qualquer incremento desta réplica.
+func (s *TelemetryService) startRollupBackfill() {
+	owner := uuid.New()
+	state, err := s.claimRollupBackfill(owner)
+	if err == nil && state == nil {
+		s.rollupsReady.Store(true)
+		return
+	}
+
+	s.cleanupWg.Add(1)
+	go func() {
+		defer s.cleanupWg.Done()
+		ticker := time.NewTicker(RollupBackfillPoll)
+		defer ticker.Stop()
+		for {
+			if err == nil && state.Owner == owner {
+				if err = s.backfillRollups(state); err == nil {
+					s.rollupsReady.Store(true)
+					return
+				}
+			}
+			if err != nil && !errors.Is(err, errRollupBackfillStopped) {
+				log.Printf("⚠️ [TELEMETRY] Rollup backfill: %v", err)
+			}
+
+			select {
+			case <-s.stopCleanup:
+				return
+			case <-ticker.C:
+			}
+			if state, err = s.claimRollupBackfill(owner); err == nil && state == nil {
+				s.rollupsReady.Store(true)
+				return
+			}
+		}
+	}()
+}
+
+// claimRollupBackfill nil quando não há backfill pendente; senão o estado atual
+// (Owner == owner quando esta réplica o criou ou assumiu um dono sem heartbeat)
+func (s *TelemetryService) claimRollupBackfill(owner uuid.UUID) (*RollupBackfill, error) {
+	var state RollupBackfill
+	err := s.db.Where("name = ?", rollupBackfillName).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if !s.needsRollupBackfill() {
+			return nil, nil
+		}
+		return s.createRollupBackfill(owner)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.CompletedAt != nil {
+		return nil, nil
+	}
+	if state.Owner == owner {
+		return &state, nil
+	}
+
+	now := time.Now()
+	result := s.db.Model(&RollupBackfill{}).
+		Where("name = ? AND owner = ? AND heartbeat_at < ?", rollupBackfillName, state.Owner, now.Add(-RollupBackfillLease)).
+		Updates(map[string]interface{}{"owner": owner, "heartbeat_at": now})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		log.Printf("📦 [TELEMETRY] Rollup backfill taken over from %s", state.Owner)
+		state.Owner, state.HeartbeatAt = owner, now
+	}
+	return &state, nil
+}
+
+// createRollupBackfill grava o corte e os totais do snapshot até ele, na mesma transação.
+// Quem perde a corrida recebe o estado do vencedor.
+func (s *TelemetryService) createRollupBackfill(owner uuid.UUID) (*RollupBackfill, error) {
+	now := time.Now()
+	state := &RollupBackfill{Name: rollupBackfillName, Cutoff: now, Owner: owner, HeartbeatAt: now, StartedAt: now}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(state)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Where("name = ?", rollupBackfillName).First(state).Error
+		}
+		return setSnapshotTotals(tx, state.Cutoff)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// setSnapshotTotals totais de eventos, interações e sessões anteriores ao corte.
+// A ingestão depois do corte soma sobre eles.
+func setSnapshotTotals(tx *gorm.DB, cutoff time.Time) error {
+	type appTotal struct {
+		AppID        uuid.UUID
+		Events       int64
+		Interactions int64
+		Sessions     int64
+	}
+	var events, sessions []appTotal
+	if err := tx.Model(&TelemetryEvent{}).
+		Select("app_id, COUNT(*) AS events, SUM(CASE WHEN type LIKE 'interaction.%' THEN 1 ELSE 0 END) AS interactions").
+		Where("ingested_at < ?", cutoff).Group("app_id").Scan(&events).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&AppSession{}).Select("app_id, COUNT(*) AS sessions").
+		Where("created_at < ?", cutoff).Group("app_id").Scan(&sessions).Error; err != nil {
+		return err
+	}
+
+	totals := make(map[uuid.UUID]*appTotal)
+	for i := range events {
+		totals[events[i].AppID] = &events[i]
+	}
+	for _, row := range sessions {
+		if t := totals[row.AppID]; t != nil {
+			t.Sessions = row.Sessions
+		} else {
+			row := row
+			totals[row.AppID] = &row
+		}
+	}
+
+	// Snapshot sem histórico antes do corte começa do zero
+	if err := tx.Model(&AppMetricsSnapshot{}).Where("1 = 1").Updates(map[string]interface{}{
+		"total_events": 0, "total_interactions": 0, "total_sessions": 0,
+	}).Error; err != nil {
+		return err
+	}
+	for appID, t := range totals {
+		if err := ensureSnapshot(tx, appID); err != nil {
+			return err
+		}
+		if err := tx.Model(&AppMetricsSnapshot{}).Where("app_id = ?", appID).Updates(map[string]interface{}{
+			"total_events": t.Events, "total_interactions": t.Interactions, "total_sessions": t.Sessions,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// needsRollupBackfill rollups vazios com eventos já gravados
+func (s *TelemetryService) needsRollupBackfill() bool {
+	var rollups, events int64
+	s.db.Model(&EventRollupHour{}).Limit(1).Count(&rollups)
+	if rollups > 0 {
+		return false
+	}
+	s.db.Model(&EventRollupMinute{}).Limit(1).Count(&rollups)
+	if rollups > 0 {
+		return false
+	}
+	s.db.Model(&TelemetryEvent{}).Limit(1).Count(&events)
+	return events > 0
+}
+
+// backfillRollups reconstrói os rollups de eventos e sessões anteriores ao corte.
+// Cada lote soma e avança a marca d'água na mesma transação: interrompido, retoma de onde parou.
+func (s *TelemetryService) backfillRollups(state *RollupBackfill) error {
+	started := time.Now()
+	for !state.EventsDone {
+		if s.rollupBackfillStopped() {
+			return errRollupBackfillStopped
+		}
+		var batch []TelemetryEvent
+		query := s.db.Where("ingested_at < ?", state.Cutoff)
+		if state.EventsAfter != nil {
+			query = query.Where("ingested_at > ? OR (ingested_at = ? AND id > ?)", *state.EventsAfter, *state.EventsAfter, state.EventsAfterID)
+		}
+		if err := query.Order("ingested_at, id").Limit(rollupBackfillBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"events_done": true}
+		if len(batch) > 0 {
+			last := batch[len(batch)-1]
+			updates = map[string]interface{}{"events_after": last.IngestedAt, "events_after_id": last.ID, "events": state.Events + int64(len(batch))}
+		}
+		err := s.advanceRollupBackfill(state, updates, func(tx *gorm.DB) error {
+			events := make([]*TelemetryEvent, len(batch))
+			for i := range batch {
+				events[i] = &batch[i]
+			}
+			totals, err := addEventRollups(tx, events)
+			if err != nil {
+				return err
+			}
+			for appID, t := range totals {
+				if err := ensureSnapshot(tx, appID); err != nil {
+					return err
+				}
+				if err := touchLastEventAt(tx, appID, t.lastEventAt); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			state.EventsDone = true
+		} else {
+			last := batch[len(batch)-1]
+			state.EventsAfter, state.EventsAfterID = &last.IngestedAt, last.ID
+			state.Events += int64(len(batch))
+		}
+	}
+
+	for {
+		if s.rollupBackfillStopped() {
+			return errRollupBackfillStopped
+		}
+		var batch []AppSession
+		query := s.db.Where("created_at < ?", state.Cutoff)
+		if state.SessionsAfter != nil {
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", *state.SessionsAfter, *state.SessionsAfter, state.SessionsAfterID)
+		}
+		if err := query.Order("created_at, id").Limit(rollupBackfillBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		last := batch[len(batch)-1]
+		updates := map[string]interface{}{"sessions_after": last.CreatedAt, "sessions_after_id": last.ID, "sessions": state.Sessions + int64(len(batch))}
+		err := s.advanceRollupBackfill(state, updates, func(tx *gorm.DB) error {
+			for i := range batch {
+				session := &batch[i]
+				if err := addSessionStartRollup(tx, session); err != nil {
+					return err
+				}
+				// Encerradas depois do corte são contadas pela ingestão
+				if session.EndedAt != nil && session.EndedAt.Before(state.Cutoff) {
+					if err := addSessionEndRollup(tx, session, session.DurationMs, 1); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		state.SessionsAfter, state.SessionsAfterID = &last.CreatedAt, last.ID
+		state.Sessions += int64(len(batch))
+	}
+
+	if err := s.compactRollups(); err != nil {
+		log.Printf("⚠️ [TELEMETRY] Rollup compaction after backfill failed: %v", err)
+	}
+	if err := s.advanceRollupBackfill(state, map[string]interface{}{"completed_at": time.Now()}, nil); err != nil {
+		return err
+	}
+	log.Printf("📦 [TELEMETRY] Rollups backfilled: events=%d sessions=%d (%v)", state.Events, state.Sessions, time.Since(started))
+	return nil
+}
+
+// advanceRollupBackfill aplica o lote e grava o progresso (com heartbeat) numa transação.
+// Só o dono avança: se outra réplica assumiu, nada é somado.
+func (s *TelemetryService) advanceRollupBackfill(state *RollupBackfill, updates map[string]interface{}, apply func(tx *gorm.DB) error) error {
+	updates["heartbeat_at"] = time.Now()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&RollupBackfill{}).Where("name = ? AND owner = ?", state.Name, state.Owner).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRollupBackfillLost
+		}
+		if apply == nil {
+			return nil
+		}
+		return apply(tx)
+	})
+}
+
+func (s *TelemetryService) rollupBackfillStopped() bool {
+	select {
+	case <-s.stopCleanup:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Rollups incrementais
+// ========================================
+
+func TestRollupsFeedSnapshotAndAnalytics(t *testing.T) {
+	s := newTestTelemetryService(t)
+	appID, userID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now().UTC()
+	past := now.Add(-3 * time.Hour).Truncate(time.Hour).Add(10 * time.Minute)
+
+	reqs := []IngestEventRequest{
+		{UserID: userID.String(), SessionID: sessionID.String(), Type: EventSessionStart, Timestamp: past.Format(time.RFC3339)},
+		{UserID: userID.String(), SessionID: sessionID.String(), Type: EventInteractionMatchCreated, Timestamp: past.Add(time.Minute).Format(time.RFC3339)},
+		{UserID: userID.String(), SessionID: sessionID.String(), Type: EventInteractionMatchCreated, Timestamp: now.Format(time.RFC3339)},
+		{UserID: userID.String(), SessionID: sessionID.String(), Type: EventSessionEnd, Timestamp: now.Format(time.RFC3339)},
+	}
+	if _, _, err := s.IngestBatch(appID, reqs, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	// Minutos fechados → horas; a leitura não muda
+	before, _ := s.GetEventsByType(appID, 24*time.Hour)
+	if err := s.compactRollups(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := s.GetEventsByType(appID, 24*time.Hour)
+	if before[EventInteractionMatchCreated] != 2 || after[EventInteractionMatchCreated] != 2 || after[EventSessionStart] != 1 {
+		t.Fatalf("contagem por tipo deveria sobreviver à compactação: antes=%v depois=%v", before, after)
+	}
+	var hours int64
+	s.db.Model(&EventRollupHour{}).Count(&hours)
+	if hours == 0 {
+		t.Fatal("compactor deveria gerar linhas por hora")
+	}
+	if recent, _ := s.GetEventsByType(appID, time.Hour); recent[EventSessionStart] != 0 || recent[EventInteractionMatchCreated] != 1 {
+		t.Errorf("janela de 1h deveria ver só os eventos recentes: %v", recent)
+	}
+
+	s.updateMetricsSnapshot(appID)
+	snapshot, _ := s.GetMetricsSnapshot(appID)
+	if snapshot.TotalEvents != 4 || snapshot.TotalInteractions != 2 || snapshot.TotalSessions != 1 ||
+		snapshot.Events24h != 4 || snapshot.Events1h != 2 || snapshot.ActiveUsers24h != 1 || snapshot.LastEventAt == nil {
+		t.Fatalf("snapshot deveria vir dos contadores e rollups: %+v", snapshot)
+	}
+
+	heatmap, _ := s.GetActivityHeatmap(appID, 7)
+	var cells int64
+	for _, cell := range heatmap.Cells {
+		if cell.DayOfWeek == int(past.Weekday()) && cell.Hour == past.Hour() {
+			cells = cell.Count
+		}
+	}
+	if cells != 2 {
+		t.Errorf("heatmap deveria contar a hora passada: %d", cells)
+	}
+
+	comparison, _ := s.ComparePeriods(appID, 1)
+	current := comparison.Current
+	if current.TotalSessions != 1 || current.UniquUsers != 1 || current.TotalEvents != 4 || current.TotalMatches != 2 ||
+		current.MatchRate != 100 || current.AvgSessionDuration <= 0 {
+		t.Errorf("comparação deveria vir dos rollups: %+v", current)
+	}
+}
+
+func TestRollupBackfillResumesFromCutoffWithoutDoubleCounting(t *testing.T) {
+	first := newTestTelemetryService(t)
+	first.Stop()
+	db := first.db
+	appID, userID, sessionID := uuid.New(), uuid.New(), uuid.New()
+
+	// Histórico de antes dos rollups, com totais antigos no snapshot
+	past := time.Now().Add(-2 * time.Hour)
+	for i, eventType := range []string{"page.view", "interaction.click", "interaction.click"} {
+		at := past.Add(time.Duration(i) * time.Minute)
+		db.Create(&TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: userID, SessionID: sessionID, Type: eventType, Timestamp: at, IngestedAt: at})
+	}
+	ended := past.Add(5 * time.Minute)
+	db.Create(&AppSession{ID: sessionID, AppID: appID, UserID: userID, StartedAt: past, LastSeenAt: ended, EndedAt: &ended, DurationMs: 300000, CreatedAt: past})
+	db.Create(&AppMetricsSnapshot{ID: uuid.New(), AppID: appID, TotalEvents: 99, TotalSessions: 99})
+
+	// Réplica que reivindicou o corte e morreu: a próxima assume sem refazer o corte
+	if _, err := first.createRollupBackfill(uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	db.Model(&RollupBackfill{}).Where("name = ?", rollupBackfillName).Update("heartbeat_at", time.Now().Add(-time.Hour))
+
+	s := NewTelemetryService(db)
+	live := []IngestEventRequest{{UserID: userID.String(), SessionID: uuid.New().String(), Type: "interaction.click"}}
+	if _, _, err := s.IngestBatch(appID, live, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); !s.rollupsReady.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("backfill deveria concluir")
+		}
+	}
+	s.Stop()
+
+	// Segunda inicialização: backfill concluído, nada é somado de novo
+	NewTelemetryService(db).Stop()
+
+	var snapshot AppMetricsSnapshot
+	db.Where("app_id = ?", appID).First(&snapshot)
+	if snapshot.TotalEvents != 4 || snapshot.TotalInteractions != 3 || snapshot.TotalSessions != 2 {
+		t.Fatalf("totais = histórico até o corte + ingestão depois dele: %+v", snapshot)
+	}
+	counts, _ := s.GetEventsByType(appID, 24*time.Hour)
+	if counts["interaction.click"] != 3 || counts["page.view"] != 1 {
+		t.Errorf("rollups deveriam contar cada evento uma vez: %v", counts)
+	}
+	var state RollupBackfill
+	db.Where("name = ?", rollupBackfillName).First(&state)
+	if state.CompletedAt == nil || state.Events != 3 || state.Sessions != 1 {
+		t.Errorf("estado do backfill inesperado: %+v", state)
+	}
+}
+
+func TestCountEventsFallsBackToHourWhenMinutesArePruned(t *testing.T) {
+	s := newTestTelemetryService(t)
+	s.Stop()
+	appID := uuid.New()
+	now := time.Now().UTC()
+
+	// Hora antiga: minutos já podados, só a hora compactada
+	old := hourBucket(now.Add(-30 * time.Hour))
+	s.db.Create(&EventRollupHour{AppID: appID, Bucket: old, Type: EventSessionStart, Events: 5})
+	// Hora recente: minutos retidos, borda exata
+	recent := hourBucket(now.Add(-2 * time.Hour))
+	s.db.Create(&EventRollupHour{AppID: appID, Bucket: recent, Type: EventSessionEnd, Events: 3})
+	s.db.Create(&EventRollupMinute{AppID: appID, Bucket: recent.Add(10 * time.Minute), Type: EventSessionEnd, Events: 3})
+
+	counts, err := s.countEvents(appID, old.Add(20*time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[EventSessionStart] != 5 {
+		t.Errorf("borda sem minutos deveria cair para a hora: %v", counts)
+	}
+
+	counts, _ = s.countEvents(appID, recent.Add(20*time.Minute), now)
+	if counts[EventSessionEnd] != 0 {
+		t.Errorf("borda com minutos retidos deveria continuar exata: %v", counts)
+	}
+}
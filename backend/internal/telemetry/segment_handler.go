@@ -0,0 +1,208 @@
+package telemetry
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ========================================
+// SEGMENT HANDLERS - CRUD, membros e coortes
+// ========================================
+
+// segmentRequest payload de criação/atualização
+type segmentRequest struct {
+	Name        string             `json:"name" binding:"required"`
+	Description string             `json:"description"`
+	Predicates  []SegmentPredicate `json:"predicates" binding:"required"`
+	Match       string             `json:"match"`
+}
+
+func (r *segmentRequest) segment() *Segment {
+	return &Segment{
+		Name:        r.Name,
+		Description: r.Description,
+		Predicates:  r.Predicates,
+		Match:       r.Match,
+	}
+}
+
+// segmentError mapeia erros do serviço para status HTTP
+func segmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrSegmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segmento não encontrado"})
+	case errors.Is(err, ErrInvalidSegment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// segmentParam lê ?segment_id= (ausente = nil). Responde 400 se inválido.
+func segmentParam(c *gin.Context) (*uuid.UUID, bool) {
+	raw := c.Query("segment_id")
+	if raw == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Segment ID inválido"})
+		return nil, false
+	}
+	return &id, true
+}
+
+// ListSegments lista os segmentos de um app
+// GET /api/v1/admin/telemetry/apps/:id/segments
+func (h *TelemetryHandler) ListSegments(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	segments, err := h.service.ListSegments(appID)
+	if err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"segments": segments, "total": len(segments)})
+}
+
+// CreateSegment cria um segmento para o app
+// POST /api/v1/admin/telemetry/apps/:id/segments
+func (h *TelemetryHandler) CreateSegment(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+
+	var req segmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seg := req.segment()
+	seg.AppID = appID
+	seg.CreatedBy = c.GetString("userID")
+	if err := h.service.CreateSegment(seg); err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, seg)
+}
+
+// GetSegment retorna um segmento
+// GET /api/v1/admin/telemetry/segments/:segmentId
+func (h *TelemetryHandler) GetSegment(c *gin.Context) {
+	segmentID, err := uuid.Parse(c.Param("segmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Segment ID inválido"})
+		return
+	}
+
+	seg, err := h.service.GetSegment(segmentID)
+	if err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, seg)
+}
+
+// UpdateSegment substitui a definição de um segmento
+// PUT /api/v1/admin/telemetry/segments/:segmentId
+func (h *TelemetryHandler) UpdateSegment(c *gin.Context) {
+	segmentID, err := uuid.Parse(c.Param("segmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Segment ID inválido"})
+		return
+	}
+
+	var req segmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seg, err := h.service.UpdateSegment(segmentID, req.segment())
+	if err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, seg)
+}
+
+// DeleteSegment remove um segmento
+// DELETE /api/v1/admin/telemetry/segments/:segmentId
+func (h *TelemetryHandler) DeleteSegment(c *gin.Context) {
+	segmentID, err := uuid.Parse(c.Param("segmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Segment ID inválido"})
+		return
+	}
+
+	if err := h.service.DeleteSegment(segmentID); err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Segmento removido"})
+}
+
+// RefreshSegment recalcula os membros agora
+// POST /api/v1/admin/telemetry/segments/:segmentId/refresh
+func (h *TelemetryHandler) RefreshSegment(c *gin.Context) {
+	segmentID, err := uuid.Parse(c.Param("segmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Segment ID inválido"})
+		return
+	}
+
+	seg, err := h.service.RefreshSegment(segmentID)
+	if err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, seg)
+}
+
+// GetCohortsAdmin matriz de retenção por coorte
+// GET /api/v1/admin/telemetry/apps/:id/cohorts?cohort_by=first_seen&granularity=week&periods=8&segment_id=
+func (h *TelemetryHandler) GetCohortsAdmin(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "App ID inválido"})
+		return
+	}
+	segmentID, ok := segmentParam(c)
+	if !ok {
+		return
+	}
+
+	query := CohortQuery{
+		CohortBy:    c.Query("cohort_by"),
+		Granularity: c.Query("granularity"),
+		SegmentID:   segmentID,
+	}
+	if p := c.Query("periods"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			query.Periods = parsed
+		}
+	}
+	if err := query.normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	matrix, err := h.service.GetCohortMatrix(appID, query)
+	if err != nil {
+		segmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, matrix)
+}
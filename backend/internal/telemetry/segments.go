@@ -0,0 +1,541 @@
+package telemetry
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ========================================
+// SEGMENTS - Grupos de usuários salvos por app
+// "Quem fez X pelo menos N vezes em 7 dias"
+// ========================================
+
+// Combinação dos predicados
+const (
+	SegmentMatchAll = "all"
+	SegmentMatchAny = "any"
+)
+
+const (
+	SegmentMaxPredicates   = 10
+	SegmentDefaultWindow   = 30 * 24 * time.Hour
+	SegmentMaxWindow       = 90 * 24 * time.Hour
+	SegmentRefreshInterval = 5 * time.Minute // Membros materializados valem por esse tempo
+)
+
+var (
+	ErrSegmentNotFound = errors.New("segment not found")
+	ErrInvalidSegment  = errors.New("invalid segment definition")
+)
+
+// SegmentPredicate "fez event_type (com filtros) <operator> count vezes na janela"
+type SegmentPredicate struct {
+	EventType     string         `json:"event_type"`
+	Filters       []FunnelFilter `json:"filters,omitempty"`
+	Operator      string         `json:"operator"` // >=, >, ==, !=, <, <=
+	Count         int64          `json:"count"`
+	WindowSeconds int64          `json:"window_seconds"`
+}
+
+// Window janela do predicado
+func (p *SegmentPredicate) Window() time.Duration {
+	return time.Duration(p.WindowSeconds) * time.Second
+}
+
+// satisfied compara a contagem do usuário com o predicado
+func (p *SegmentPredicate) satisfied(count int64) bool {
+	switch p.Operator {
+	case ">":
+		return count > p.Count
+	case "==":
+		return count == p.Count
+	case "!=":
+		return count != p.Count
+	case "<":
+		return count < p.Count
+	case "<=":
+		return count <= p.Count
+	}
+	return count >= p.Count
+}
+
+// SegmentPredicateList lista de predicados (JSON)
+type SegmentPredicateList []SegmentPredicate
+
+func (l SegmentPredicateList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (l *SegmentPredicateList) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		*l = SegmentPredicateList{}
+		return nil
+	}
+	return json.Unmarshal(b, l)
+}
+
+// Segment segmento salvo de um app (membros materializados em SegmentMember)
+type Segment struct {
+	ID          uuid.UUID            `gorm:"type:uuid;primaryKey" json:"id"`
+	AppID       uuid.UUID            `gorm:"type:uuid;uniqueIndex:idx_segment_app_name" json:"app_id"`
+	Name        string               `gorm:"size:100;not null;uniqueIndex:idx_segment_app_name" json:"name"`
+	Description string               `gorm:"size:500" json:"description,omitempty"`
+	Predicates  SegmentPredicateList `gorm:"type:text" json:"predicates"`
+	Match       string               `gorm:"size:10;not null;default:'all'" json:"match"`
+	MemberCount int64                `json:"member_count"`
+	RefreshedAt *time.Time           `json:"refreshed_at,omitempty"`
+	CreatedBy   string               `gorm:"size:100" json:"created_by,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+func (Segment) TableName() string {
+	return "telemetry_segments"
+}
+
+// SegmentMember usuário pertencente a um segmento no último refresh
+type SegmentMember struct {
+	SegmentID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+}
+
+func (SegmentMember) TableName() string {
+	return "telemetry_segment_members"
+}
+
+// ========================================
+// CRUD
+// ========================================
+
+// validateSegment normaliza e valida a definição
+func validateSegment(seg *Segment) error {
+	seg.Name = strings.TrimSpace(seg.Name)
+	if seg.Name == "" {
+		return fmt.Errorf("%w: nome obrigatório", ErrInvalidSegment)
+	}
+	if len(seg.Predicates) == 0 || len(seg.Predicates) > SegmentMaxPredicates {
+		return fmt.Errorf("%w: o segmento precisa de 1 a %d predicados", ErrInvalidSegment, SegmentMaxPredicates)
+	}
+	for i := range seg.Predicates {
+		p := &seg.Predicates[i]
+		p.EventType = strings.TrimSpace(p.EventType)
+		if p.EventType == "" {
+			return fmt.Errorf("%w: predicado %d sem event_type", ErrInvalidSegment, i+1)
+		}
+		if p.Operator == "" {
+			p.Operator = ">="
+			if p.Count == 0 {
+				p.Count = 1
+			}
+		}
+		switch p.Operator {
+		case ">=", ">", "==", "!=", "<", "<=":
+		default:
+			return fmt.Errorf("%w: operador %q inválido no predicado %d", ErrInvalidSegment, p.Operator, i+1)
+		}
+		if p.Count < 0 {
+			return fmt.Errorf("%w: contagem negativa no predicado %d", ErrInvalidSegment, i+1)
+		}
+		for _, filter := range p.Filters {
+			if filter.Property == "" {
+				return fmt.Errorf("%w: predicado %d com filtro sem property", ErrInvalidSegment, i+1)
+			}
+			switch filter.Operator {
+			case "==", "!=", ">", ">=", "<", "<=", "contains", "exists":
+			default:
+				return fmt.Errorf("%w: operador de filtro %q inválido no predicado %d", ErrInvalidSegment, filter.Operator, i+1)
+			}
+		}
+		if p.WindowSeconds == 0 {
+			p.WindowSeconds = int64(SegmentDefaultWindow.Seconds())
+		}
+		if p.WindowSeconds < 0 || p.Window() > SegmentMaxWindow {
+			return fmt.Errorf("%w: janela do predicado %d deve ser até %v", ErrInvalidSegment, i+1, SegmentMaxWindow)
+		}
+	}
+	if seg.Match == "" {
+		seg.Match = SegmentMatchAll
+	}
+	if seg.Match != SegmentMatchAll && seg.Match != SegmentMatchAny {
+		return fmt.Errorf("%w: match deve ser %q ou %q", ErrInvalidSegment, SegmentMatchAll, SegmentMatchAny)
+	}
+	return nil
+}
+
+// CreateSegment salva um segmento para o app
+func (s *TelemetryService) CreateSegment(seg *Segment) error {
+	if err := validateSegment(seg); err != nil {
+		return err
+	}
+	var existing int64
+	s.db.Model(&Segment{}).Where("app_id = ? AND name = ?", seg.AppID, seg.Name).Count(&existing)
+	if existing > 0 {
+		return fmt.Errorf("%w: já existe um segmento %q neste app", ErrInvalidSegment, seg.Name)
+	}
+	seg.ID = uuid.New()
+	seg.MemberCount = 0
+	seg.RefreshedAt = nil
+	seg.CreatedAt = time.Now()
+	seg.UpdatedAt = seg.CreatedAt
+	if err := s.db.Create(seg).Error; err != nil {
+		return err
+	}
+
+	// Primeira materialização aqui: IsUserInSegment só lê membros prontos
+	mu := s.segmentLock(seg.AppID)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := s.refreshSegment(seg); err != nil {
+		log.Printf("⚠️ [TELEMETRY] Segment %s first refresh failed (retried on use): %v", seg.ID, err)
+	}
+	return nil
+}
+
+// ListSegments segmentos de um app
+func (s *TelemetryService) ListSegments(appID uuid.UUID) ([]Segment, error) {
+	var segments []Segment
+	err := s.db.Where("app_id = ?", appID).Order("name").Find(&segments).Error
+	return segments, err
+}
+
+// GetSegment busca um segmento
+func (s *TelemetryService) GetSegment(id uuid.UUID) (*Segment, error) {
+	var seg Segment
+	if err := s.db.Where("id = ?", id).First(&seg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSegmentNotFound
+		}
+		return nil, err
+	}
+	return &seg, nil
+}
+
+// UpdateSegment substitui a definição; os membros são recalculados no próximo uso
+func (s *TelemetryService) UpdateSegment(id uuid.UUID, changes *Segment) (*Segment, error) {
+	seg, err := s.GetSegment(id)
+	if err != nil {
+		return nil, err
+	}
+	seg.Name = changes.Name
+	seg.Description = changes.Description
+	seg.Predicates = changes.Predicates
+	seg.Match = changes.Match
+	if err := validateSegment(seg); err != nil {
+		return nil, err
+	}
+	var existing int64
+	s.db.Model(&Segment{}).Where("app_id = ? AND name = ? AND id <> ?", seg.AppID, seg.Name, seg.ID).Count(&existing)
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: já existe um segmento %q neste app", ErrInvalidSegment, seg.Name)
+	}
+
+	mu := s.segmentLock(seg.AppID)
+	mu.Lock()
+	defer mu.Unlock()
+	seg.RefreshedAt = nil
+	seg.UpdatedAt = time.Now()
+	if err := s.db.Save(seg).Error; err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// DeleteSegment remove um segmento e seus membros
+func (s *TelemetryService) DeleteSegment(id uuid.UUID) error {
+	seg, err := s.GetSegment(id)
+	if err != nil {
+		return err
+	}
+	mu := s.segmentLock(seg.AppID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&Segment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSegmentNotFound
+		}
+		return tx.Where("segment_id = ?", id).Delete(&SegmentMember{}).Error
+	})
+}
+
+// ========================================
+// MEMBROS - Materialização com refresh preguiçoso
+// ========================================
+
+// segmentLock lock do app: refresh de segmentos de apps diferentes não se bloqueia
+func (s *TelemetryService) segmentLock(appID uuid.UUID) *sync.Mutex {
+	mu, _ := s.segmentLocks.LoadOrStore(appID, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// RefreshSegment recalcula os membros agora
+func (s *TelemetryService) RefreshSegment(id uuid.UUID) (*Segment, error) {
+	seg, err := s.GetSegment(id)
+	if err != nil {
+		return nil, err
+	}
+	mu := s.segmentLock(seg.AppID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Definição atual (pode ter mudado enquanto esperávamos)
+	if seg, err = s.GetSegment(id); err != nil {
+		return nil, err
+	}
+	if err := s.refreshSegment(seg); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// freshSegment garante membros com no máximo SegmentRefreshInterval de idade
+func (s *TelemetryService) freshSegment(seg *Segment) error {
+	if seg.RefreshedAt != nil && time.Since(*seg.RefreshedAt) < SegmentRefreshInterval {
+		return nil
+	}
+
+	mu := s.segmentLock(seg.AppID)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Outra chamada pode ter atualizado enquanto esperávamos
+	current, err := s.GetSegment(seg.ID)
+	if err != nil {
+		return err
+	}
+	*seg = *current
+	if seg.RefreshedAt != nil && time.Since(*seg.RefreshedAt) < SegmentRefreshInterval {
+		return nil
+	}
+	return s.refreshSegment(seg)
+}
+
+// refreshSegmentInBackground agenda o refresh sem bloquear quem chamou (um por segmento)
+func (s *TelemetryService) refreshSegmentInBackground(id uuid.UUID) {
+	if _, running := s.segmentBusy.LoadOrStore(id, true); running {
+		return
+	}
+	select {
+	case <-s.stopCleanup:
+		s.segmentBusy.Delete(id)
+		return
+	default:
+	}
+
+	s.cleanupWg.Add(1)
+	go func() {
+		defer s.cleanupWg.Done()
+		defer s.segmentBusy.Delete(id)
+		seg, err := s.GetSegment(id)
+		if err == nil {
+			err = s.freshSegment(seg)
+		}
+		if err != nil && !errors.Is(err, ErrSegmentNotFound) {
+			log.Printf("⚠️ [TELEMETRY] Segment %s background refresh failed: %v", id, err)
+		}
+	}()
+}
+
+// refreshSegment substitui os membros (chamar com o segmentLock do app)
+func (s *TelemetryService) refreshSegment(seg *Segment) error {
+	users, err := s.segmentUsers(seg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	members := make([]SegmentMember, 0, len(users))
+	for userID := range users {
+		members = append(members, SegmentMember{SegmentID: seg.ID, UserID: userID})
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("segment_id = ?", seg.ID).Delete(&SegmentMember{}).Error; err != nil {
+			return err
+		}
+		if len(members) > 0 {
+			if err := tx.CreateInBatches(members, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Segment{}).Where("id = ?", seg.ID).
+			Updates(map[string]interface{}{"member_count": len(members), "refreshed_at": now}).Error
+	})
+	if err != nil {
+		return err
+	}
+	seg.MemberCount = int64(len(members))
+	seg.RefreshedAt = &now
+	return nil
+}
+
+// segmentUsers avalia os predicados. Quando zero ocorrências satisfaz algum
+// predicado (ex.: "< 1"), o universo são os usuários com sessão no app.
+func (s *TelemetryService) segmentUsers(seg *Segment, now time.Time) (map[uuid.UUID]bool, error) {
+	counts := make([]map[uuid.UUID]int64, len(seg.Predicates))
+	candidates := make(map[uuid.UUID]bool)
+	needsUniverse := false
+
+	for i := range seg.Predicates {
+		p := &seg.Predicates[i]
+		c, err := s.predicateCounts(seg.AppID, p, now.Add(-p.Window()))
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = c
+		for userID := range c {
+			candidates[userID] = true
+		}
+		if p.satisfied(0) {
+			needsUniverse = true
+		}
+	}
+
+	if needsUniverse {
+		var users []uuid.UUID
+		if err := s.db.Model(&AppSession{}).Where("app_id = ?", seg.AppID).Distinct("user_id").Pluck("user_id", &users).Error; err != nil {
+			return nil, err
+		}
+		for _, userID := range users {
+			candidates[userID] = true
+		}
+	}
+
+	members := make(map[uuid.UUID]bool)
+	for userID := range candidates {
+		if userID == uuid.Nil {
+			continue
+		}
+		matched := seg.Match == SegmentMatchAll
+		for i := range seg.Predicates {
+			ok := seg.Predicates[i].satisfied(counts[i][userID])
+			if seg.Match == SegmentMatchAny && ok {
+				matched = true
+				break
+			}
+			if seg.Match == SegmentMatchAll && !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			members[userID] = true
+		}
+	}
+	return members, nil
+}
+
+// predicateCounts ocorrências por usuário desde since (filtros avaliados em Go)
+func (s *TelemetryService) predicateCounts(appID uuid.UUID, p *SegmentPredicate, since time.Time) (map[uuid.UUID]int64, error) {
+	counts := make(map[uuid.UUID]int64)
+	query := s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND type = ? AND timestamp >= ?", appID, p.EventType, since)
+
+	if len(p.Filters) == 0 {
+		var rows []struct {
+			UserID uuid.UUID
+			Count  int64
+		}
+		if err := query.Select("user_id, COUNT(*) as count").Group("user_id").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			counts[row.UserID] = row.Count
+		}
+		return counts, nil
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	step := FunnelStepDefinition{EventType: p.EventType, Filters: p.Filters}
+	for rows.Next() {
+		var event TelemetryEvent
+		if err := s.db.ScanRows(rows, &event); err != nil {
+			return nil, err
+		}
+		fe := funnelEvent{event: event}
+		json.Unmarshal([]byte(event.Context), &fe.context)
+		json.Unmarshal([]byte(event.Metadata), &fe.metadata)
+		if stepMatches(&step, &fe) {
+			counts[event.UserID]++
+		}
+	}
+	return counts, rows.Err()
+}
+
+// segmentMembers subquery com os user_id do segmento (nil = sem segmento)
+func (s *TelemetryService) segmentMembers(appID uuid.UUID, segmentID *uuid.UUID) (*gorm.DB, error) {
+	if segmentID == nil {
+		return nil, nil
+	}
+	seg, err := s.GetSegment(*segmentID)
+	if err != nil {
+		return nil, err
+	}
+	if seg.AppID != appID {
+		return nil, ErrSegmentNotFound
+	}
+	if err := s.freshSegment(seg); err != nil {
+		return nil, err
+	}
+	return s.db.Model(&SegmentMember{}).Select("user_id").Where("segment_id = ?", seg.ID), nil
+}
+
+// inSegment restringe uma query com user_id aos membros (nil = sem filtro)
+func inSegment(members *gorm.DB) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if members == nil {
+			return db
+		}
+		return db.Where("user_id IN (?)", members)
+	}
+}
+
+// IsUserInSegment pertinência de um usuário a um segmento do app (por nome).
+// Usado como condição de regras: in_segment("power_users"). Roda nos workers
+// de ingestão/regras: responde dos últimos membros materializados e, se
+// vencidos, agenda o refresh em background.
+func (s *TelemetryService) IsUserInSegment(appID, userID uuid.UUID, name string) (bool, error) {
+	var seg Segment
+	if err := s.db.Where("app_id = ? AND name = ?", appID, name).First(&seg).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, fmt.Errorf("%w: %s", ErrSegmentNotFound, name)
+		}
+		return false, err
+	}
+	if seg.RefreshedAt == nil || time.Since(*seg.RefreshedAt) >= SegmentRefreshInterval {
+		s.refreshSegmentInBackground(seg.ID)
+	}
+	var count int64
+	err := s.db.Model(&SegmentMember{}).Where("segment_id = ? AND user_id = ?", seg.ID, userID).Count(&count).Error
+	return count > 0, err
+}
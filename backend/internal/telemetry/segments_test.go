@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ========================================
+// TESTES - Segmentos e coortes
+// ========================================
+
+func TestSegmentsScopeAnalyticsAndCohorts(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	appID := uuid.New()
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	session := func(user uuid.UUID, startedAt time.Time) {
+		ended := startedAt.Add(time.Minute)
+		s.db.Create(&AppSession{ID: uuid.New(), AppID: appID, UserID: user, StartedAt: startedAt, LastSeenAt: ended,
+			EndedAt: &ended, DurationMs: 60000})
+	}
+	match := func(user uuid.UUID, at time.Time, mode string) {
+		s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, SessionID: user,
+			Type: EventInteractionMatchCreated, Metadata: `{"mode":"` + mode + `"}`, Timestamp: at, IngestedAt: now})
+	}
+
+	// power: 3 matches em vídeo; casual: 1 match; texter: 3 matches em texto
+	power, casual, texter := uuid.New(), uuid.New(), uuid.New()
+	session(power, today.AddDate(0, 0, -2).Add(time.Hour))
+	session(power, today.AddDate(0, 0, -1).Add(time.Hour))
+	session(casual, today.AddDate(0, 0, -2).Add(2*time.Hour))
+	session(texter, today.AddDate(0, 0, -1).Add(3*time.Hour))
+	for i := 0; i < 3; i++ {
+		match(power, now.Add(-time.Duration(i+1)*time.Hour), "video")
+		match(texter, now.Add(-time.Duration(i+1)*time.Hour), "text")
+	}
+	match(casual, now.Add(-time.Hour), "video")
+
+	seg := &Segment{AppID: appID, Name: "power_users", Predicates: SegmentPredicateList{{
+		EventType: EventInteractionMatchCreated, Operator: ">=", Count: 3, WindowSeconds: 7 * 24 * 3600,
+		Filters: []FunnelFilter{{Property: "metadata.mode", Operator: "==", Value: "video"}},
+	}}}
+	if err := s.CreateSegment(seg); err != nil {
+		t.Fatal(err)
+	}
+
+	if in, err := s.IsUserInSegment(appID, power, "power_users"); err != nil || !in {
+		t.Fatalf("power deveria pertencer ao segmento: %v %v", in, err)
+	}
+	if in, _ := s.IsUserInSegment(appID, texter, "power_users"); in {
+		t.Error("filtro de modo deveria excluir texter")
+	}
+	if _, err := s.IsUserInSegment(appID, power, "missing"); !errors.Is(err, ErrSegmentNotFound) {
+		t.Errorf("segmento inexistente deveria retornar ErrSegmentNotFound: %v", err)
+	}
+	if refreshed, _ := s.GetSegment(seg.ID); refreshed.MemberCount != 1 || refreshed.RefreshedAt == nil {
+		t.Errorf("membros deveriam estar materializados: %+v", refreshed)
+	}
+
+	top, err := s.GetTopUsers(appID, 7*24*time.Hour, 10, &seg.ID)
+	if err != nil || len(top) != 1 || top[0].UserID != power.String() {
+		t.Fatalf("top users deveria se limitar ao segmento: %+v %v", top, err)
+	}
+	engagement, _ := s.GetEngagementMetrics(appID, 7*24*time.Hour, &seg.ID)
+	if engagement.AvgMatchesPerUser != 3 {
+		t.Errorf("engajamento do segmento deveria ter 3 matches por usuário: %+v", engagement)
+	}
+	retention, _ := s.GetRetention(appID, 2, &seg.ID)
+	if len(retention) != 2 || retention[0].NewUsers != 1 || retention[0].D1Count != 1 {
+		t.Errorf("retenção do segmento inesperada: %+v", retention)
+	}
+	if _, err := s.GetTopUsers(uuid.New(), time.Hour, 10, &seg.ID); !errors.Is(err, ErrSegmentNotFound) {
+		t.Errorf("segmento de outro app deveria ser rejeitado: %v", err)
+	}
+
+	// Coortes diárias: dia -2 = {power, casual}, dia -1 = {texter}
+	matrix, err := s.GetCohortMatrix(appID, CohortQuery{Periods: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matrix.Cohorts) != 3 {
+		t.Fatalf("deveria haver 3 coortes: %+v", matrix.Cohorts)
+	}
+	first := matrix.Cohorts[0]
+	if first.Users != 2 || len(first.Retained) != 3 || first.Retained[0] != 2 || first.Retained[1] != 1 || first.Rates[1] != 50 {
+		t.Errorf("coorte do dia -2 inesperada: %+v", first)
+	}
+	if second := matrix.Cohorts[1]; second.Users != 1 || len(second.Retained) != 2 {
+		t.Errorf("coorte do dia -1 inesperada: %+v", second)
+	}
+	scoped, _ := s.GetCohortMatrix(appID, CohortQuery{Periods: 3, SegmentID: &seg.ID})
+	if scoped.Cohorts[0].Users != 1 || scoped.Cohorts[1].Users != 0 {
+		t.Errorf("coortes do segmento deveriam conter só power: %+v", scoped.Cohorts)
+	}
+}
+
+func TestSegmentRefreshLocksPerApp(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	busyApp, otherApp := uuid.New(), uuid.New()
+
+	seg := &Segment{AppID: otherApp, Name: "ativos", Predicates: SegmentPredicateList{{
+		EventType: EventSessionStart, Operator: ">=", Count: 1, WindowSeconds: 24 * 3600,
+	}}}
+	if err := s.CreateSegment(seg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh longo em um app não segura os segmentos dos outros
+	busy := s.segmentLock(busyApp)
+	busy.Lock()
+	defer busy.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.RefreshSegment(seg.ID)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh de outro app não deveria esperar o lock")
+	}
+	if s.segmentLock(otherApp) == busy {
+		t.Error("apps diferentes deveriam ter locks diferentes")
+	}
+}
+
+func TestStaleSegmentAnswersFromMembersAndRefreshesInBackground(t *testing.T) {
+	s := newTestTelemetryService(t)
+	defer s.Stop()
+	appID := uuid.New()
+	now := time.Now().UTC()
+	start := func(user uuid.UUID) {
+		s.db.Create(&TelemetryEvent{ID: uuid.New(), AppID: appID, UserID: user, SessionID: user,
+			Type: EventSessionStart, Timestamp: now.Add(-time.Hour), IngestedAt: now})
+	}
+
+	old, late := uuid.New(), uuid.New()
+	start(old)
+	seg := &Segment{AppID: appID, Name: "ativos", Predicates: SegmentPredicateList{{
+		EventType: EventSessionStart, Operator: ">=", Count: 1, WindowSeconds: 24 * 3600,
+	}}}
+	if err := s.CreateSegment(seg); err != nil {
+		t.Fatal(err)
+	}
+	start(late)
+	s.db.Model(&Segment{}).Where("id = ?", seg.ID).Update("refreshed_at", now.Add(-2*SegmentRefreshInterval))
+
+	// Refresh travado: a resposta sai dos membros materializados, sem esperar
+	mu := s.segmentLock(appID)
+	mu.Lock()
+	done := make(chan [2]bool, 1)
+	go func() {
+		inOld, _ := s.IsUserInSegment(appID, old, "ativos")
+		inLate, _ := s.IsUserInSegment(appID, late, "ativos")
+		done <- [2]bool{inOld, inLate}
+	}()
+	select {
+	case got := <-done:
+		if !got[0] || got[1] {
+			t.Errorf("segmento vencido deveria responder dos membros atuais: %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("IsUserInSegment não deveria esperar o refresh")
+	}
+	mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if in, _ := s.IsUserInSegment(appID, late, "ativos"); in {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("refresh em background deveria incluir o novo membro")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
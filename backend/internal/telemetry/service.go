@@ -6,6 +6,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -29,18 +30,37 @@ type TelemetryService struct {
 	db            *gorm.DB
 	stopCleanup   chan struct{}
 	cleanupWg     sync.WaitGroup
+	pipeline      *ingestPipeline
+	segmentLocks  sync.Map    // appID → *sync.Mutex: serializa o refresh dos membros por app
+	segmentBusy   sync.Map    // segmentID → refresh em background em andamento
+	rollupsReady  atomic.Bool // false enquanto o backfill inicial roda
+	planResolver  func(appID uuid.UUID) (string, error)
+	retention     RetentionOptions
+	geoLocator    GeoLocator
+	geoFailures   atomic.Int64 // Falhas de GeoIP desde o último log
+	geoLoggedAt   atomic.Int64 // UnixNano do último log de falha
+	privacyCache  sync.Map     // appID → cachedPrivacySettings (a ingestão consulta a cada evento)
 	alertCallback func(appID uuid.UUID, alertType string, data map[string]interface{})
+	eventCallback func(event *TelemetryEvent)
 }
 
 func NewTelemetryService(db *gorm.DB) *TelemetryService {
 	// Auto-migrate das tabelas
-	db.AutoMigrate(&AppSession{}, &TelemetryEvent{}, &AppMetricsSnapshot{}, &AlertHistory{})
+	db.AutoMigrate(&AppSession{}, &TelemetryEvent{}, &AppMetricsSnapshot{}, &AlertHistory{},
+		&EventRollupMinute{}, &EventRollupHour{}, &SessionRollupHour{}, &UserRollupHour{}, &FunnelDefinition{},
+		&Segment{}, &SegmentMember{}, &RetentionRun{}, &AppPrivacySettings{}, &RollupBackfill{})
 	
 	svc := &TelemetryService{
 		db:          db,
 		stopCleanup: make(chan struct{}),
 	}
 	
+	// Histórico anterior aos rollups (uma réplica, em background; antes da ingestão começar)
+	svc.startRollupBackfill()
+	
+	// Fila de ingestão (gravação em lote + workers)
+	svc.pipeline = newIngestPipeline(svc)
+	
 	// Iniciar cleanup automático de sessões zumbi
 	svc.startSessionCleanup()
 	
@@ -52,8 +72,15 @@ func (s *TelemetryService) SetAlertCallback(cb func(appID uuid.UUID, alertType s
 	s.alertCallback = cb
 }
 
-// Stop para o cleanup gracefully
+// SetEventCallback define callback chamado para cada evento ingerido (opcional)
+// Usado pelo rules engine (triggers de evento e sequência)
+func (s *TelemetryService) SetEventCallback(cb func(event *TelemetryEvent)) {
+	s.eventCallback = cb
+}
+
+// Stop drena a fila de ingestão e para o cleanup gracefully
 func (s *TelemetryService) Stop() {
+	s.pipeline.stop()
 	close(s.stopCleanup)
 	s.cleanupWg.Wait()
 }
@@ -73,10 +100,18 @@ func (s *TelemetryService) startSessionCleanup() {
 		healthTicker := time.NewTicker(5 * time.Minute)
 		defer healthTicker.Stop()
 		
+		// Compactação dos rollups (minutos → horas)
+		compactTicker := time.NewTicker(RollupCompactInterval)
+		defer compactTicker.Stop()
+		
 		for {
 			select {
 			case <-ticker.C:
 				s.cleanupZombieSessions()
+			case <-compactTicker.C:
+				if err := s.compactRollups(); err != nil {
+					log.Printf("⚠️ [TELEMETRY] Rollup compaction failed: %v", err)
+				}
 			case <-healthTicker.C:
 				s.logSystemHealth()
 			case <-s.stopCleanup:
@@ -130,6 +165,7 @@ func (s *TelemetryService) cleanupZombieSessions() {
 			"duration_ms": duration,
 			"updated_at":  now,
 		})
+		s.recordSessionEnd(&session, duration, 1)
 		
 		// Criar evento de timeout
 		event := &TelemetryEvent{
@@ -142,7 +178,7 @@ func (s *TelemetryService) cleanupZombieSessions() {
 			Timestamp:  now,
 			IngestedAt: now,
 		}
-		s.db.Create(event)
+		s.insertEvent(event)
 		
 		log.Printf("🧟 [TELEMETRY] Zombie session killed: session=%s user=%s app=%s (last_seen: %v ago)", 
 			session.ID, session.UserID, session.AppID, now.Sub(session.LastSeenAt))
@@ -177,12 +213,72 @@ type IngestEventRequest struct {
 	Timestamp string            `json:"timestamp"`
 }
 
-// IngestEvent processa um evento de um app
+// IngestEvent enfileira um evento de um app.
+// Retorna ErrIngestQueueFull quando a fila está cheia (backpressure).
 func (s *TelemetryService) IngestEvent(appID uuid.UUID, req *IngestEventRequest, ip, userAgent string) error {
+	event, err := s.buildEvent(appID, req, ip, userAgent)
+	if err != nil {
+		return err
+	}
+	
+	// SPECIAL: Session Recover - reconexão sem inflar métricas
+	if req.Type == EventSessionRecover {
+		return s.handleSessionRecover(appID, event.UserID, event.SessionID, req, ip, userAgent, event.Timestamp)
+	}
+	
+	// Gravação, sessão, alertas e stream (rules engine) ficam com o pipeline
+	if err := s.pipeline.enqueue(event); err != nil {
+		return err
+	}
+	
+	log.Printf("📊 [TELEMETRY] Event queued: app=%s type=%s user=%s", appID, req.Type, event.UserID)
+	return nil
+}
+
+// IngestBatch enfileira vários eventos de uma vez: os válidos entram juntos ou nenhum entra.
+// Retorna quantos foram aceitos e quantos eram inválidos.
+func (s *TelemetryService) IngestBatch(appID uuid.UUID, reqs []IngestEventRequest, ip, userAgent string) (int, int, error) {
+	events := make([]*TelemetryEvent, 0, len(reqs))
+	recovered, failed := 0, 0
+	for i := range reqs {
+		req := &reqs[i]
+		event, err := s.buildEvent(appID, req, ip, userAgent)
+		if err != nil {
+			failed++
+			continue
+		}
+		if req.Type == EventSessionRecover {
+			if err := s.handleSessionRecover(appID, event.UserID, event.SessionID, req, ip, userAgent, event.Timestamp); err != nil {
+				failed++
+			} else {
+				recovered++
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+	
+	if len(events) > 0 {
+		if err := s.pipeline.enqueue(events...); err != nil {
+			return recovered, failed, err
+		}
+	}
+	
+	log.Printf("📊 [TELEMETRY] Batch queued: app=%s events=%d invalid=%d", appID, len(events)+recovered, failed)
+	return len(events) + recovered, failed, nil
+}
+
+// IngestStats estado atual da fila de ingestão
+func (s *TelemetryService) IngestStats() IngestStats {
+	return s.pipeline.stats()
+}
+
+// buildEvent valida o payload e monta o evento (sem gravar)
+func (s *TelemetryService) buildEvent(appID uuid.UUID, req *IngestEventRequest, ip, userAgent string) (*TelemetryEvent, error) {
 	// Parse user_id
 	userID, err := uuid.Parse(req.UserID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	
 	// Parse ou gerar session_id
@@ -216,13 +312,10 @@ func (s *TelemetryService) IngestEvent(appID uuid.UUID, req *IngestEventRequest,
 		}
 	}
 	
-	// SPECIAL: Session Recover - reconexão sem inflar métricas
-	if req.Type == EventSessionRecover {
-		return s.handleSessionRecover(appID, userID, sessionID, req, ip, userAgent, timestamp)
-	}
+	// Localização pelo IP e anonimização (configuração do app)
+	origin := s.resolveOrigin(appID, ip)
 	
-	// Criar evento
-	event := &TelemetryEvent{
+	return &TelemetryEvent{
 		ID:         uuid.New(),
 		AppID:      appID,
 		UserID:     userID,
@@ -233,30 +326,22 @@ func (s *TelemetryService) IngestEvent(appID uuid.UUID, req *IngestEventRequest,
 		TargetType: req.TargetType,
 		Context:    contextJSON,
 		Metadata:   metadataJSON,
-		IPAddress:  ip,
+		IPAddress:  origin.IP,
+		Country:    origin.Geo.Country,
+		Region:     origin.Geo.Region,
+		City:       origin.Geo.City,
+		ASN:        origin.Geo.ASN,
+		ASOrg:      origin.Geo.ASOrg,
 		UserAgent:  userAgent,
 		Timestamp:  timestamp,
 		IngestedAt: time.Now(),
-	}
-	
-	// Salvar evento
-	if err := s.db.Create(event).Error; err != nil {
-		return err
-	}
-	
-	// Processar evento (atualizar sessão, métricas, etc)
-	go s.processEvent(event)
-	
-	// Verificar alertas
-	go s.checkAlerts(appID, event)
-	
-	log.Printf("📊 [TELEMETRY] Event ingested: app=%s type=%s user=%s", appID, req.Type, userID)
-	return nil
+	}, nil
 }
 
 // handleSessionRecover reconecta uma sessão existente sem criar nova
 func (s *TelemetryService) handleSessionRecover(appID, userID, sessionID uuid.UUID, req *IngestEventRequest, ip, userAgent string, timestamp time.Time) error {
 	var existingSession AppSession
+	origin := s.resolveOrigin(appID, ip)
 	
 	// Buscar sessão pelo ID fornecido
 	result := s.db.Where("id = ? AND app_id = ? AND user_id = ?", sessionID, appID, userID).First(&existingSession)
@@ -272,7 +357,8 @@ func (s *TelemetryService) handleSessionRecover(appID, userID, sessionID uuid.UU
 	if existingSession.EndedAt != nil {
 		// Sessão já foi encerrada - verificar se foi recente (< 5 min)
 		if time.Since(*existingSession.EndedAt) < 5*time.Minute {
-			// Reabrir sessão
+			// Reabrir sessão (o encerramento deixa de contar nos rollups)
+			s.recordSessionEnd(&existingSession, existingSession.DurationMs, -1)
 			s.db.Model(&existingSession).Updates(map[string]interface{}{
 				"ended_at":    nil,
 				"duration_ms": 0,
@@ -291,7 +377,7 @@ func (s *TelemetryService) handleSessionRecover(appID, userID, sessionID uuid.UU
 		// Sessão ainda aberta - apenas atualizar last_seen
 		s.db.Model(&existingSession).Updates(map[string]interface{}{
 			"last_seen_at": timestamp,
-			"ip_address":   ip,
+			"ip_address":   origin.IP,
 			"user_agent":   userAgent,
 			"updated_at":   time.Now(),
 		})
@@ -306,12 +392,17 @@ func (s *TelemetryService) handleSessionRecover(appID, userID, sessionID uuid.UU
 		SessionID:  sessionID,
 		Type:       EventSessionRecover,
 		Context:    `{"recovered":true}`,
-		IPAddress:  ip,
+		IPAddress:  origin.IP,
+		Country:    origin.Geo.Country,
+		Region:     origin.Geo.Region,
+		City:       origin.Geo.City,
+		ASN:        origin.Geo.ASN,
+		ASOrg:      origin.Geo.ASOrg,
 		UserAgent:  userAgent,
 		Timestamp:  timestamp,
 		IngestedAt: time.Now(),
 	}
-	s.db.Create(event)
+	s.insertEvent(event)
 	
 	// Atualizar métricas
 	go s.updateMetricsSnapshot(appID)
@@ -323,14 +414,6 @@ func (s *TelemetryService) handleSessionRecover(appID, userID, sessionID uuid.UU
 // 2. PROCESSAMENTO - Atualizar estado
 // ========================================
 
-func (s *TelemetryService) processEvent(event *TelemetryEvent) {
-	// Atualizar sessão
-	s.updateSession(event)
-	
-	// Atualizar métricas snapshot
-	s.updateMetricsSnapshot(event.AppID)
-}
-
 func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 	var session AppSession
 	
@@ -346,6 +429,11 @@ func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 			StartedAt:      event.Timestamp,
 			LastSeenAt:     event.Timestamp,
 			IPAddress:      event.IPAddress,
+			Country:        event.Country,
+			Region:         event.Region,
+			City:           event.City,
+			ASN:            event.ASN,
+			ASOrg:          event.ASOrg,
 			UserAgent:      event.UserAgent,
 			CurrentFeature: event.Feature,
 			CurrentContext: event.Context,
@@ -354,8 +442,8 @@ func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 			UpdatedAt:      time.Now(),
 		}
 		
-		// Extrair país do contexto se disponível
-		if event.Context != "" {
+		// Sem GeoIP: país enviado pelo cliente no contexto
+		if session.Country == "" && event.Context != "" {
 			var ctx map[string]interface{}
 			if json.Unmarshal([]byte(event.Context), &ctx) == nil {
 				if country, ok := ctx["country"].(string); ok {
@@ -364,7 +452,9 @@ func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 			}
 		}
 		
-		s.db.Create(&session)
+		if s.db.Create(&session).Error == nil {
+			s.recordSessionStart(&session)
+		}
 	} else if result.Error == nil {
 		// Atualizar sessão existente
 		updates := map[string]interface{}{
@@ -382,18 +472,32 @@ func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 		}
 		
 		// Se é interação, incrementar contador
+		interactive := false
 		if strings.HasPrefix(event.Type, "interaction.") {
 			updates["interaction_count"] = gorm.Expr("interaction_count + 1")
+			interactive = session.InteractionCount == 0
 		}
 		
 		// Se é fim de sessão, marcar ended_at
+		ended := false
 		if event.Type == EventSessionEnd || event.Type == EventSessionTimeout {
 			now := time.Now()
 			updates["ended_at"] = now
 			updates["duration_ms"] = now.Sub(session.StartedAt).Milliseconds()
+			ended = session.EndedAt == nil
+		}
+		
+		if s.db.Model(&session).Updates(updates).Error != nil {
+			return
 		}
 		
-		s.db.Model(&session).Updates(updates)
+		// Rollups: primeira interação e primeiro encerramento
+		if interactive {
+			s.recordSessionInteractive(&session)
+		}
+		if ended {
+			s.recordSessionEnd(&session, updates["duration_ms"].(int64), 1)
+		}
 	}
 }
 
@@ -402,15 +506,14 @@ func (s *TelemetryService) updateSession(event *TelemetryEvent) {
 // ========================================
 
 func (s *TelemetryService) updateMetricsSnapshot(appID uuid.UUID) {
+	// Totais (eventos, interações, sessões, usuários) são contadores incrementais:
+	// aqui só as janelas, lidas dos rollups, e o estado das sessões ativas
+	if err := ensureSnapshot(s.db, appID); err != nil {
+		return
+	}
 	var snapshot AppMetricsSnapshot
-	
-	// Buscar ou criar snapshot
-	result := s.db.Where("app_id = ?", appID).First(&snapshot)
-	if result.Error == gorm.ErrRecordNotFound {
-		snapshot = AppMetricsSnapshot{
-			ID:    uuid.New(),
-			AppID: appID,
-		}
+	if err := s.db.Where("app_id = ?", appID).First(&snapshot).Error; err != nil {
+		return
 	}
 	
 	// Guardar valores anteriores para detectar quedas
@@ -418,31 +521,42 @@ func (s *TelemetryService) updateMetricsSnapshot(appID uuid.UUID) {
 	
 	now := time.Now()
 	
-	// Calcular métricas de usuários (da tabela implicit_users)
-	s.db.Table("implicit_users").Where("app_id = ?", appID).Count(&snapshot.TotalUsers)
-	s.db.Table("implicit_users").Where("app_id = ? AND last_seen_at > ?", appID, now.Add(-24*time.Hour)).Count(&snapshot.ActiveUsers24h)
-	s.db.Table("implicit_users").Where("app_id = ? AND last_seen_at > ?", appID, now.Add(-1*time.Hour)).Count(&snapshot.ActiveUsers1h)
+	// Usuários ativos (rollup por hora)
+	snapshot.ActiveUsers24h = s.activeUsersSince(appID, now.Add(-24*time.Hour))
+	snapshot.ActiveUsers1h = s.activeUsersSince(appID, now.Add(-1*time.Hour))
 	
 	// Online agora (sessões com last_seen < OnlineThreshold)
 	s.db.Model(&AppSession{}).Where("app_id = ? AND ended_at IS NULL AND last_seen_at > ?", appID, now.Add(-OnlineThreshold)).Count(&snapshot.OnlineNow)
 	
-	// Sessões
-	s.db.Model(&AppSession{}).Where("app_id = ?", appID).Count(&snapshot.TotalSessions)
+	// Sessões ativas
 	s.db.Model(&AppSession{}).Where("app_id = ? AND ended_at IS NULL AND last_seen_at > ?", appID, now.Add(-ActiveSessionThreshold)).Count(&snapshot.ActiveSessions)
 	
-	// Eventos
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ?", appID).Count(&snapshot.TotalEvents)
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND timestamp > ?", appID, now.Add(-24*time.Hour)).Count(&snapshot.Events24h)
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND timestamp > ?", appID, now.Add(-1*time.Hour)).Count(&snapshot.Events1h)
+	// Eventos e interações nas janelas
+	events24h, err := s.countEvents(appID, now.Add(-24*time.Hour), now)
+	if err != nil {
+		return
+	}
+	snapshot.Events24h, snapshot.Interactions24h = 0, 0
+	for eventType, count := range events24h {
+		snapshot.Events24h += count
+		if strings.HasPrefix(eventType, "interaction.") {
+			snapshot.Interactions24h += count
+		}
+	}
+	snapshot.Events1h = 0
+	if events1h, err := s.countEvents(appID, now.Add(-1*time.Hour), now); err == nil {
+		for _, count := range events1h {
+			snapshot.Events1h += count
+		}
+	}
 	
 	// Eventos por minuto (média últimos 5 min)
-	var events5min int64
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND timestamp > ?", appID, now.Add(-5*time.Minute)).Count(&events5min)
-	snapshot.EventsPerMinute = float64(events5min) / 5.0
-	
-	// Interações
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND type LIKE 'interaction.%'", appID).Count(&snapshot.TotalInteractions)
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND type LIKE 'interaction.%' AND timestamp > ?", appID, now.Add(-24*time.Hour)).Count(&snapshot.Interactions24h)
+	var events5min struct{ Total int64 }
+	s.db.Model(&EventRollupMinute{}).
+		Select("COALESCE(SUM(events), 0) as total").
+		Where("app_id = ? AND bucket >= ?", appID, minuteBucket(now.Add(-5*time.Minute))).
+		Scan(&events5min)
+	snapshot.EventsPerMinute = float64(events5min.Total) / 5.0
 	
 	// Usuários por feature
 	type FeatureCount struct {
@@ -464,26 +578,13 @@ func (s *TelemetryService) updateMetricsSnapshot(appID uuid.UUID) {
 		snapshot.UsersByFeature = string(b)
 	}
 	
-	// Último evento
-	var lastEvent TelemetryEvent
-	if s.db.Where("app_id = ?", appID).Order("timestamp DESC").First(&lastEvent).Error == nil {
-		snapshot.LastEventAt = &lastEvent.Timestamp
-	}
-	
-	// Última sessão
-	var lastSession AppSession
-	if s.db.Where("app_id = ?", appID).Order("started_at DESC").First(&lastSession).Error == nil {
-		snapshot.LastSessionAt = &lastSession.StartedAt
-	}
-	
 	snapshot.UpdatedAt = now
 	
-	// Salvar snapshot
-	if result.Error == gorm.ErrRecordNotFound {
-		s.db.Create(&snapshot)
-	} else {
-		s.db.Save(&snapshot)
-	}
+	// Salvar só as janelas: contadores são incrementados em paralelo pela ingestão
+	s.db.Model(&snapshot).
+		Select("ActiveUsers24h", "ActiveUsers1h", "OnlineNow", "ActiveSessions", "Events24h", "Events1h",
+			"EventsPerMinute", "Interactions24h", "UsersByFeature", "UpdatedAt").
+		Updates(&snapshot)
 	
 	// Verificar alerta de queda brusca de online
 	if prevOnline > 0 && snapshot.OnlineNow == 0 {
@@ -550,30 +651,10 @@ func (s *TelemetryService) GetRecentEvents(appID uuid.UUID, limit int) ([]Teleme
 	return events, err
 }
 
-// GetEventsByType retorna contagem de eventos por tipo
+// GetEventsByType retorna contagem de eventos por tipo (rollups)
 func (s *TelemetryService) GetEventsByType(appID uuid.UUID, since time.Duration) (map[string]int64, error) {
-	type TypeCount struct {
-		Type  string
-		Count int64
-	}
-	var counts []TypeCount
-	
-	err := s.db.Model(&TelemetryEvent{}).
-		Select("type, count(*) as count").
-		Where("app_id = ? AND timestamp > ?", appID, time.Now().Add(-since)).
-		Group("type").
-		Order("count DESC").
-		Scan(&counts).Error
-	
-	if err != nil {
-		return nil, err
-	}
-	
-	result := make(map[string]int64)
-	for _, c := range counts {
-		result[c.Type] = c.Count
-	}
-	return result, nil
+	now := time.Now()
+	return s.countEvents(appID, now.Add(-since), now)
 }
 
 // ========================================
@@ -830,11 +911,15 @@ type RetentionData struct {
 	D30Count   int64   `json:"d30_count"`   // Absoluto D30
 }
 
-// GetRetention calcula retenção D1/D7/D30 para um app
-func (s *TelemetryService) GetRetention(appID uuid.UUID, days int) ([]RetentionData, error) {
+// GetRetention calcula retenção D1/D7/D30 para um app (segmentID opcional)
+func (s *TelemetryService) GetRetention(appID uuid.UUID, days int, segmentID *uuid.UUID) ([]RetentionData, error) {
 	if days <= 0 || days > 90 {
 		days = 30
 	}
+	members, err := s.segmentMembers(appID, segmentID)
+	if err != nil {
+		return nil, err
+	}
 	
 	var results []RetentionData
 	now := time.Now()
@@ -849,6 +934,7 @@ func (s *TelemetryService) GetRetention(appID uuid.UUID, days int) ([]RetentionD
 		var newUsers int64
 		s.db.Model(&AppSession{}).
 			Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, startOfDay, endOfDay).
+			Scopes(inSegment(members)).
 			Distinct("user_id").
 			Count(&newUsers)
 		
@@ -860,7 +946,8 @@ func (s *TelemetryService) GetRetention(appID uuid.UUID, days int) ([]RetentionD
 		// Subquery: IDs dos usuários novos desse dia
 		subQuery := s.db.Model(&AppSession{}).
 			Select("DISTINCT user_id").
-			Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, startOfDay, endOfDay)
+			Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, startOfDay, endOfDay).
+			Scopes(inSegment(members))
 		
 		// D1: voltaram no dia seguinte
 		d1Start := endOfDay
@@ -910,83 +997,36 @@ func (s *TelemetryService) GetRetention(appID uuid.UUID, days int) ([]RetentionD
 
 // FunnelStep representa um passo do funil
 type FunnelStep struct {
-	Step       string  `json:"step"`        // Nome do passo
-	Users      int64   `json:"users"`       // Usuários que chegaram
-	Percentage float64 `json:"percentage"`  // % em relação ao primeiro passo
-	DropOff    float64 `json:"drop_off"`    // % que abandonou nesse passo
+	Step          string        `json:"step"`                      // Nome do passo
+	EventType     string        `json:"event_type"`                // Evento que conta o passo
+	Users         int64         `json:"users"`                     // Usuários que chegaram
+	Percentage    float64       `json:"percentage"`                // % em relação ao primeiro passo
+	DropOff       float64       `json:"drop_off"`                  // % que abandonou nesse passo
+	TimeToConvert *FunnelTiming `json:"time_to_convert,omitempty"` // Desde o passo anterior
 }
 
-// GetFunnel calcula funil de conversão por feature
-func (s *TelemetryService) GetFunnel(appID uuid.UUID, since time.Duration) ([]FunnelStep, error) {
-	if since <= 0 {
-		since = 24 * time.Hour
-	}
-	
-	cutoff := time.Now().Add(-since)
-	
-	// Definir passos do funil baseado em eventos
-	steps := []struct {
-		name  string
-		event string
-	}{
-		{"Sessão Iniciada", EventSessionStart},
-		{"Entrou na Fila", "interaction.queue.joined"},
-		{"Match Criado", "interaction.match.created"},
-		{"Mensagem Enviada", "interaction.message.sent"},
-		{"Match Completo (>1min)", "interaction.match.ended"},
-	}
-	
-	var results []FunnelStep
-	var firstStepUsers int64
-	
-	for i, step := range steps {
-		var users int64
-		
-		if step.event == "interaction.match.ended" {
-			// Caso especial: match que durou mais de 1 minuto
-			s.db.Model(&TelemetryEvent{}).
-				Where("app_id = ? AND type = ? AND timestamp > ?", appID, step.event, cutoff).
-				Where("metadata LIKE '%\"duration_ms\":%' AND CAST(JSON_EXTRACT(metadata, '$.duration_ms') AS INTEGER) > 60000").
-				Distinct("user_id").
-				Count(&users)
-			
-			// Fallback se JSON_EXTRACT não funcionar (PostgreSQL)
-			if users == 0 {
-				s.db.Model(&TelemetryEvent{}).
-					Where("app_id = ? AND type = ? AND timestamp > ?", appID, step.event, cutoff).
-					Distinct("user_id").
-					Count(&users)
-			}
-		} else {
-			s.db.Model(&TelemetryEvent{}).
-				Where("app_id = ? AND type = ? AND timestamp > ?", appID, step.event, cutoff).
-				Distinct("user_id").
-				Count(&users)
+// GetFunnel calcula um funil salvo do app (funnelID nil = o primeiro criado).
+// App sem funis recebe o funil padrão de matchmaking.
+func (s *TelemetryService) GetFunnel(appID uuid.UUID, funnelID *uuid.UUID, since time.Duration) (*FunnelReport, error) {
+	var funnel FunnelDefinition
+	query := s.db.Where("app_id = ?", appID)
+	if funnelID != nil {
+		query = query.Where("id = ?", *funnelID)
+	}
+	if err := query.Order("created_at").First(&funnel).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			return nil, err
 		}
-		
-		if i == 0 {
-			firstStepUsers = users
+		if funnelID != nil {
+			return nil, ErrFunnelNotFound
 		}
-		
-		percentage := float64(0)
-		if firstStepUsers > 0 {
-			percentage = float64(users) / float64(firstStepUsers) * 100
+		seeded, err := s.seedDefaultFunnel(appID)
+		if err != nil {
+			return nil, err
 		}
-		
-		dropOff := float64(0)
-		if i > 0 && len(results) > 0 && results[i-1].Users > 0 {
-			dropOff = (1 - float64(users)/float64(results[i-1].Users)) * 100
-		}
-		
-		results = append(results, FunnelStep{
-			Step:       step.name,
-			Users:      users,
-			Percentage: percentage,
-			DropOff:    dropOff,
-		})
+		funnel = *seeded
 	}
-	
-	return results, nil
+	return s.ComputeFunnel(&funnel, since)
 }
 
 // EngagementMetrics métricas de engajamento
@@ -999,18 +1039,23 @@ type EngagementMetrics struct {
 	MatchRate            float64 `json:"match_rate"`                // % sessões que viraram match
 }
 
-// GetEngagementMetrics calcula métricas de engajamento
-func (s *TelemetryService) GetEngagementMetrics(appID uuid.UUID, since time.Duration) (*EngagementMetrics, error) {
+// GetEngagementMetrics calcula métricas de engajamento (segmentID opcional)
+func (s *TelemetryService) GetEngagementMetrics(appID uuid.UUID, since time.Duration, segmentID *uuid.UUID) (*EngagementMetrics, error) {
 	if since <= 0 {
 		since = 24 * time.Hour
 	}
+	members, err := s.segmentMembers(appID, segmentID)
+	if err != nil {
+		return nil, err
+	}
+	scope := inSegment(members)
 	
 	cutoff := time.Now().Add(-since)
 	metrics := &EngagementMetrics{}
 	
 	// Duração média de sessão (só sessões encerradas)
 	var avgDuration struct{ Avg float64 }
-	s.db.Model(&AppSession{}).
+	s.db.Model(&AppSession{}).Scopes(scope).
 		Select("AVG(duration_ms) as avg").
 		Where("app_id = ? AND ended_at IS NOT NULL AND started_at > ?", appID, cutoff).
 		Scan(&avgDuration)
@@ -1019,8 +1064,8 @@ func (s *TelemetryService) GetEngagementMetrics(appID uuid.UUID, since time.Dura
 	// Eventos por sessão
 	var totalSessions int64
 	var totalEvents int64
-	s.db.Model(&AppSession{}).Where("app_id = ? AND started_at > ?", appID, cutoff).Count(&totalSessions)
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND timestamp > ?", appID, cutoff).Count(&totalEvents)
+	s.db.Model(&AppSession{}).Scopes(scope).Where("app_id = ? AND started_at > ?", appID, cutoff).Count(&totalSessions)
+	s.db.Model(&TelemetryEvent{}).Scopes(scope).Where("app_id = ? AND timestamp > ?", appID, cutoff).Count(&totalEvents)
 	if totalSessions > 0 {
 		metrics.AvgEventsPerSession = float64(totalEvents) / float64(totalSessions)
 	}
@@ -1028,22 +1073,22 @@ func (s *TelemetryService) GetEngagementMetrics(appID uuid.UUID, since time.Dura
 	// Matches por usuário
 	var uniqueUsers int64
 	var totalMatches int64
-	s.db.Model(&AppSession{}).Where("app_id = ? AND started_at > ?", appID, cutoff).Distinct("user_id").Count(&uniqueUsers)
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND type = ? AND timestamp > ?", appID, "interaction.match.created", cutoff).Count(&totalMatches)
+	s.db.Model(&AppSession{}).Scopes(scope).Where("app_id = ? AND started_at > ?", appID, cutoff).Distinct("user_id").Count(&uniqueUsers)
+	s.db.Model(&TelemetryEvent{}).Scopes(scope).Where("app_id = ? AND type = ? AND timestamp > ?", appID, "interaction.match.created", cutoff).Count(&totalMatches)
 	if uniqueUsers > 0 {
 		metrics.AvgMatchesPerUser = float64(totalMatches) / float64(uniqueUsers)
 	}
 	
 	// Mensagens por match
 	var totalMessages int64
-	s.db.Model(&TelemetryEvent{}).Where("app_id = ? AND type = ? AND timestamp > ?", appID, "interaction.message.sent", cutoff).Count(&totalMessages)
+	s.db.Model(&TelemetryEvent{}).Scopes(scope).Where("app_id = ? AND type = ? AND timestamp > ?", appID, "interaction.message.sent", cutoff).Count(&totalMessages)
 	if totalMatches > 0 {
 		metrics.AvgMessagesPerMatch = float64(totalMessages) / float64(totalMatches)
 	}
 	
 	// Bounce rate (sessões < 30s)
 	var bounceSessions int64
-	s.db.Model(&AppSession{}).
+	s.db.Model(&AppSession{}).Scopes(scope).
 		Where("app_id = ? AND ended_at IS NOT NULL AND started_at > ? AND duration_ms < 30000", appID, cutoff).
 		Count(&bounceSessions)
 	if totalSessions > 0 {
@@ -1052,7 +1097,7 @@ func (s *TelemetryService) GetEngagementMetrics(appID uuid.UUID, since time.Dura
 	
 	// Match rate (sessões que tiveram match)
 	var sessionsWithMatch int64
-	s.db.Model(&AppSession{}).
+	s.db.Model(&AppSession{}).Scopes(scope).
 		Where("app_id = ? AND started_at > ? AND interaction_count > 0", appID, cutoff).
 		Count(&sessionsWithMatch)
 	if totalSessions > 0 {
@@ -1142,51 +1187,40 @@ func (s *TelemetryService) calculatePeriodMetrics(appID uuid.UUID, start, end ti
 		EndDate:   end.Format("2006-01-02"),
 	}
 	
-	// Sessões
-	s.db.Model(&AppSession{}).
-		Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, start, end).
-		Count(&metrics.TotalSessions)
+	// Sessões (rollup pela hora de início)
+	var sessions struct {
+		Started, Ended, DurationMsTotal, Bounces, Interactive int64
+	}
+	s.db.Model(&SessionRollupHour{}).
+		Select("COALESCE(SUM(started), 0) as started, COALESCE(SUM(ended), 0) as ended, "+
+			"COALESCE(SUM(duration_ms_total), 0) as duration_ms_total, COALESCE(SUM(bounces), 0) as bounces, "+
+			"COALESCE(SUM(interactive), 0) as interactive").
+		Where("app_id = ? AND bucket >= ? AND bucket < ?", appID, nextHourBucket(start), nextHourBucket(end)).
+		Scan(&sessions)
+	metrics.TotalSessions = sessions.Started
 	
 	// Usuários únicos
-	s.db.Model(&AppSession{}).
-		Where("app_id = ? AND started_at >= ? AND started_at < ?", appID, start, end).
+	s.db.Model(&UserRollupHour{}).
+		Where("app_id = ? AND bucket >= ? AND bucket < ?", appID, nextHourBucket(start), nextHourBucket(end)).
 		Distinct("user_id").
 		Count(&metrics.UniquUsers)
 	
-	// Eventos
-	s.db.Model(&TelemetryEvent{}).
-		Where("app_id = ? AND timestamp >= ? AND timestamp < ?", appID, start, end).
-		Count(&metrics.TotalEvents)
-	
-	// Matches
-	s.db.Model(&TelemetryEvent{}).
-		Where("app_id = ? AND type = ? AND timestamp >= ? AND timestamp < ?", appID, "interaction.match.created", start, end).
-		Count(&metrics.TotalMatches)
+	// Eventos e matches
+	counts, _ := s.countEvents(appID, start, end)
+	for _, count := range counts {
+		metrics.TotalEvents += count
+	}
+	metrics.TotalMatches = counts[EventInteractionMatchCreated]
 	
 	// Duração média
-	var avgDuration struct{ Avg float64 }
-	s.db.Model(&AppSession{}).
-		Select("AVG(duration_ms) as avg").
-		Where("app_id = ? AND ended_at IS NOT NULL AND started_at >= ? AND started_at < ?", appID, start, end).
-		Scan(&avgDuration)
-	metrics.AvgSessionDuration = avgDuration.Avg
-	
-	// Bounce rate
-	if metrics.TotalSessions > 0 {
-		var bounceSessions int64
-		s.db.Model(&AppSession{}).
-			Where("app_id = ? AND ended_at IS NOT NULL AND started_at >= ? AND started_at < ? AND duration_ms < 30000", appID, start, end).
-			Count(&bounceSessions)
-		metrics.BounceRate = float64(bounceSessions) / float64(metrics.TotalSessions) * 100
+	if sessions.Ended > 0 {
+		metrics.AvgSessionDuration = float64(sessions.DurationMsTotal) / float64(sessions.Ended)
 	}
 	
-	// Match rate
+	// Bounce rate e match rate
 	if metrics.TotalSessions > 0 {
-		var sessionsWithMatch int64
-		s.db.Model(&AppSession{}).
-			Where("app_id = ? AND started_at >= ? AND started_at < ? AND interaction_count > 0", appID, start, end).
-			Count(&sessionsWithMatch)
-		metrics.MatchRate = float64(sessionsWithMatch) / float64(metrics.TotalSessions) * 100
+		metrics.BounceRate = float64(sessions.Bounces) / float64(metrics.TotalSessions) * 100
+		metrics.MatchRate = float64(sessions.Interactive) / float64(metrics.TotalSessions) * 100
 	}
 	
 	return metrics
@@ -1226,20 +1260,24 @@ type TopUser struct {
 	LastSeen        string  `json:"last_seen"`
 }
 
-// GetTopUsers retorna usuários mais engajados
-func (s *TelemetryService) GetTopUsers(appID uuid.UUID, since time.Duration, limit int) ([]TopUser, error) {
+// GetTopUsers retorna usuários mais engajados (segmentID opcional)
+func (s *TelemetryService) GetTopUsers(appID uuid.UUID, since time.Duration, limit int, segmentID *uuid.UUID) ([]TopUser, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 20
 	}
 	if since <= 0 {
 		since = 7 * 24 * time.Hour
 	}
+	members, err := s.segmentMembers(appID, segmentID)
+	if err != nil {
+		return nil, err
+	}
 	
 	cutoff := time.Now().Add(-since)
 	
 	var results []TopUser
 	
-	err := s.db.Model(&AppSession{}).
+	err = s.db.Model(&AppSession{}).
 		Select(`
 			user_id,
 			COUNT(*) as session_count,
@@ -1249,6 +1287,7 @@ func (s *TelemetryService) GetTopUsers(appID uuid.UUID, since time.Duration, lim
 			MAX(last_seen_at) as last_seen
 		`).
 		Where("app_id = ? AND started_at > ?", appID, cutoff).
+		Scopes(inSegment(members)).
 		Group("user_id").
 		Order("session_count DESC, total_duration DESC").
 		Limit(limit).
@@ -1297,41 +1336,26 @@ func (s *TelemetryService) GetActivityHeatmap(appID uuid.UUID, days int) (*Heatm
 	
 	cutoff := time.Now().AddDate(0, 0, -days)
 	
-	// Query para agrupar por dia da semana e hora
-	type HeatmapRow struct {
-		DayOfWeek int
-		Hour      int
-		Count     int64
-	}
-	var rows []HeatmapRow
-	
-	// PostgreSQL: EXTRACT(DOW FROM timestamp), EXTRACT(HOUR FROM timestamp)
-	err := s.db.Model(&TelemetryEvent{}).
-		Select("EXTRACT(DOW FROM timestamp)::int as day_of_week, EXTRACT(HOUR FROM timestamp)::int as hour, COUNT(*) as count").
-		Where("app_id = ? AND timestamp > ?", appID, cutoff).
-		Group("day_of_week, hour").
-		Order("day_of_week, hour").
-		Scan(&rows).Error
-	
+	// Rollup por hora → dia da semana e hora (UTC)
+	hours, err := s.eventsByHour(appID, cutoff)
 	if err != nil {
 		return nil, err
 	}
 	
+	countMap := make(map[string]int64)
+	for bucket, count := range hours {
+		key := fmt.Sprintf("%d-%d", int(bucket.Weekday()), bucket.Hour())
+		countMap[key] += count
+	}
+	
 	// Encontrar máximo para normalização
 	var maxCount int64 = 1
-	for _, row := range rows {
-		if row.Count > maxCount {
-			maxCount = row.Count
+	for _, count := range countMap {
+		if count > maxCount {
+			maxCount = count
 		}
 	}
 	
-	// Criar mapa para lookup rápido
-	countMap := make(map[string]int64)
-	for _, row := range rows {
-		key := fmt.Sprintf("%d-%d", row.DayOfWeek, row.Hour)
-		countMap[key] = row.Count
-	}
-	
 	// Gerar todas as células (7 dias x 24 horas)
 	var cells []HeatmapCell
 	for day := 0; day < 7; day++ {
@@ -1475,13 +1499,29 @@ func (s *TelemetryService) GetUserJourney(appID uuid.UUID, since time.Duration)
 // GeoData dados geográficos
 type GeoData struct {
 	Country  string  `json:"country"`
+	Region   string  `json:"region,omitempty"`
+	City     string  `json:"city,omitempty"`
+	ASN      uint    `json:"asn,omitempty"`
+	ASOrg    string  `json:"as_org,omitempty"`
 	Sessions int64   `json:"sessions"`
 	Users    int64   `json:"users"`
 	Percent  float64 `json:"percent"`
 }
 
-// GetGeoDistribution retorna distribuição geográfica
-func (s *TelemetryService) GetGeoDistribution(appID uuid.UUID, since time.Duration, limit int) ([]GeoData, error) {
+// Níveis da distribuição geográfica: colunas agrupadas e coluna obrigatória
+var geoLevels = map[string]struct{ group, required string }{
+	"country": {"country", "country != ''"},
+	"region":  {"country, region", "region != ''"},
+	"city":    {"country, region, city", "city != ''"},
+	"asn":     {"asn, as_org", "asn > 0"},
+}
+
+// GetGeoDistribution retorna distribuição geográfica (level: country, region, city ou asn)
+func (s *TelemetryService) GetGeoDistribution(appID uuid.UUID, since time.Duration, limit int, level string) ([]GeoData, error) {
+	geoLevel, ok := geoLevels[level]
+	if !ok {
+		geoLevel = geoLevels["country"]
+	}
 	if since <= 0 {
 		since = 7 * 24 * time.Hour
 	}
@@ -1494,9 +1534,9 @@ func (s *TelemetryService) GetGeoDistribution(appID uuid.UUID, since time.Durati
 	var results []GeoData
 	
 	err := s.db.Model(&AppSession{}).
-		Select("country, COUNT(*) as sessions, COUNT(DISTINCT user_id) as users").
-		Where("app_id = ? AND started_at > ? AND country != ''", appID, cutoff).
-		Group("country").
+		Select(geoLevel.group+", COUNT(*) as sessions, COUNT(DISTINCT user_id) as users").
+		Where("app_id = ? AND started_at > ? AND "+geoLevel.required, appID, cutoff).
+		Group(geoLevel.group).
 		Order("sessions DESC").
 		Limit(limit).
 		Scan(&results).Error
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
@@ -141,12 +142,20 @@ func MigrateSchema(db *gorm.DB) error {
 		// ========================================
 		&policy.Policy{},
 		&policy.PolicyEvaluation{},
+		&policy.ResourcePolicyConfig{},
+		&policy.ResourcePolicyConfigVersion{},
+		&policy.PolicyVersion{},
+		&policy.PolicyDraft{},
+		&policy.PolicyTestCase{},
+		&policy.PolicyCacheState{},
+		&policy.ApprovalConsumption{},
 
 		// ========================================
 		// POLICY THRESHOLDS - Fase 17 Step 2
 		// ========================================
 		&policy.PolicyThreshold{},
 		&policy.ThresholdAdjustment{},
+		&policy.ThresholdProposal{},
 
 		// ========================================
 		// AUDIT LOG - Fase 11
@@ -238,6 +247,15 @@ func MigrateSchema(db *gorm.DB) error {
 		&telemetry.AppSession{},
 		&telemetry.TelemetryEvent{},
 		&telemetry.AppMetricsSnapshot{},
+		&telemetry.EventRollupMinute{},
+		&telemetry.EventRollupHour{},
+		&telemetry.SessionRollupHour{},
+		&telemetry.UserRollupHour{},
+		&telemetry.FunnelDefinition{},
+		&telemetry.Segment{},
+		&telemetry.SegmentMember{},
+		&telemetry.RetentionRun{},
+		&telemetry.AppPrivacySettings{},
 
 		// ========================================
 		// AGENT MEMORY - Fase 24
@@ -341,6 +359,15 @@ func MigrateSchema(db *gorm.DB) error {
 	if err != nil {
 		return fmt.Errorf("falha ao executar migrações: %w", err)
 	}
+
+	// Policy.Name deixou de ser único global: unicidade agora é por escopo (global/tenant/app)
+	if db.Migrator().HasIndex(&policy.Policy{}, "idx_policies_name") {
+		if err := db.Migrator().DropIndex(&policy.Policy{}, "idx_policies_name"); err != nil {
+			return fmt.Errorf("falha ao remover índice único de policies.name: %w", err)
+		}
+	}
+	db.Model(&policy.Policy{}).Where("scope_id IS NULL").Update("scope_id", uuid.Nil)
+
 	log.Println("Migrações do schema concluídas com sucesso.")
 	return nil
 }